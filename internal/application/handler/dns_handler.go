@@ -102,8 +102,16 @@ func (h *DNSHandler) updateRecord(ctx context.Context, change *valueobject.Chang
 		TTL:   record.TTL,
 	}
 
+	// The record to update is the one with the old value; without it, any
+	// record of the same name and type.
+	matches := func(r *contract.DNSRecord) bool {
+		return r.Name == record.Name && strings.EqualFold(r.Type, string(record.Type))
+	}
+	if old, ok := change.OldState().(*entity.DNSRecord); ok {
+		matches = func(r *contract.DNSRecord) bool { return sameRecord(r, old) }
+	}
 	for _, r := range existingRecords {
-		if r.Name == record.Name && strings.EqualFold(r.Type, string(record.Type)) {
+		if matches(&r) {
 			if err := provider.UpdateRecord(ctx, record.Domain, r.ID, dnsRecord); err != nil {
 				result.Error = fmt.Errorf("%w: update record: %w", domainerr.ErrDNSError, err)
 				return result, nil
@@ -134,7 +142,7 @@ func (h *DNSHandler) deleteRecord(ctx context.Context, change *valueobject.Chang
 	}
 
 	for _, r := range existingRecords {
-		if r.Name == record.Name && strings.EqualFold(r.Type, string(record.Type)) {
+		if sameRecord(&r, record) {
 			if err := provider.DeleteRecord(ctx, record.Domain, r.ID); err != nil {
 				result.Error = fmt.Errorf("%w: delete record: %w", domainerr.ErrDNSError, err)
 				return result, nil
@@ -149,3 +157,9 @@ func (h *DNSHandler) deleteRecord(ctx context.Context, change *valueobject.Chang
 	result.Output = fmt.Sprintf("DNS record %s.%s not found, skipping", record.Name, record.Domain)
 	return result, nil
 }
+
+// sameRecord matches a provider record by name, type and value, so that one
+// value of a name with several records is not mistaken for another.
+func sameRecord(r *contract.DNSRecord, record *entity.DNSRecord) bool {
+	return r.Name == record.Name && strings.EqualFold(r.Type, string(record.Type)) && r.Value == record.Value
+}
@@ -104,6 +104,35 @@ func TestServerHandler_Apply_Delete(t *testing.T) {
 	}
 }
 
+func TestServerHandler_Apply_DeleteNetworks(t *testing.T) {
+	h := NewServerHandler()
+	ctx := context.Background()
+	client := &mockSSHClient{runStdout: "yamlops-demo|bridge|local"}
+	deps := newMockDeps()
+	deps.servers["server1"] = &ServerInfo{Host: "1.2.3.4"}
+	deps.sshClient = client
+
+	server := &entity.Server{Name: "server1", Networks: []entity.ServerNetwork{{Name: "yamlops-demo"}}}
+	change := valueobject.NewChangeFull(valueobject.ChangeTypeDelete, "server", "server1", server, nil, nil, false)
+
+	result, err := h.Apply(ctx, change, deps)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Success || !strings.Contains(result.Output, "yamlops-demo") {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if last := client.commandsRun[len(client.commandsRun)-1]; !strings.Contains(last, "docker network rm") {
+		t.Errorf("expected the network to be removed, last command %q", last)
+	}
+
+	deps.sshClient = nil
+	result, _ = h.Apply(ctx, change, deps)
+	if !result.Success || len(result.Warnings) != 1 {
+		t.Errorf("an unreachable server should only warn, got %+v", result)
+	}
+}
+
 func TestServerHandler_Apply_Noop(t *testing.T) {
 	h := NewServerHandler()
 	ctx := context.Background()
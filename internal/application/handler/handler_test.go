@@ -351,6 +351,36 @@ func TestDNSHandler_Apply_UpdateRecord(t *testing.T) {
 	}
 }
 
+func TestDNSHandler_Apply_UpdateMultiValueRecord(t *testing.T) {
+	h := NewDNSHandler()
+	ctx := context.Background()
+
+	mockProvider := newMockDNSProvider("mock")
+	mockProvider.records = []contract.DNSRecord{
+		{ID: "rec-1", Name: "www", Type: "A", Value: "192.168.1.1", TTL: 300},
+		{ID: "rec-2", Name: "www", Type: "A", Value: "192.168.1.2", TTL: 300},
+	}
+	deps := newMockDeps()
+	deps.dnsProvider = mockProvider
+	deps.domains["example.com"] = &entity.Domain{Name: "example.com", DNSISP: "test-isp"}
+
+	old := &entity.DNSRecord{Domain: "example.com", Type: entity.DNSRecordTypeA, Name: "www", Value: "192.168.1.2", TTL: 300}
+	change := valueobject.NewChange(valueobject.ChangeTypeUpdate, "dns_record", "example.com:A:www:192.168.1.3").
+		WithOldState(old).
+		WithNewState(&entity.DNSRecord{Domain: "example.com", Type: entity.DNSRecordTypeA, Name: "www", Value: "192.168.1.3", TTL: 300})
+
+	result, err := h.Apply(ctx, change, deps)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Success {
+		t.Errorf("expected success, got error: %v", result.Error)
+	}
+	if _, ok := mockProvider.updated["rec-2"]; len(mockProvider.updated) != 1 || !ok {
+		t.Errorf("expected rec-2 updated, got %v", mockProvider.updated)
+	}
+}
+
 func TestDNSHandler_Apply_DomainNotFound(t *testing.T) {
 	h := NewDNSHandler()
 	ctx := context.Background()
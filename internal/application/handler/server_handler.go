@@ -8,6 +8,7 @@ import (
 	domainerr "github.com/lite-lake/infra-yamlops/internal/domain"
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/network"
 	"github.com/lite-lake/infra-yamlops/internal/infrastructure/registry"
 )
 
@@ -28,9 +29,7 @@ func (h *ServerHandler) Apply(ctx context.Context, change *valueobject.Change, d
 	case valueobject.ChangeTypeCreate, valueobject.ChangeTypeUpdate:
 		return h.handleCreateOrUpdate(ctx, change, deps)
 	case valueobject.ChangeTypeDelete:
-		result.Success = true
-		result.Output = "server removed"
-		return result, nil
+		return h.handleDelete(change, deps)
 	default:
 		result.Success = true
 		result.Output = "no action needed"
@@ -96,6 +95,39 @@ func (h *ServerHandler) handleCreateOrUpdate(ctx context.Context, change *valueo
 	return result, nil
 }
 
+// handleDelete removes the docker networks of the server in the change;
+// destroy adds to them the default network and the networks of its services.
+// The server itself is left running, and a network that cannot be removed,
+// because it is still in use or the server is unreachable, is only reported.
+func (h *ServerHandler) handleDelete(change *valueobject.Change, deps DepsProvider) (*Result, error) {
+	result := &Result{Change: change, Success: true, Output: "server removed"}
+
+	server := h.getServerFromChange(change)
+	if server == nil || len(server.Networks) == 0 {
+		return result, nil
+	}
+
+	client, err := deps.SSHClient(change.Name())
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("networks not removed: %v", err))
+		return result, nil
+	}
+
+	netMgr := network.NewManager(client)
+	var removed []string
+	for _, n := range server.Networks {
+		if err := netMgr.Remove(n.Name); err != nil {
+			result.Warnings = append(result.Warnings, err.Error())
+			continue
+		}
+		removed = append(removed, n.Name)
+	}
+	if len(removed) > 0 {
+		result.Output = fmt.Sprintf("server removed, networks removed: %s", strings.Join(removed, ", "))
+	}
+	return result, nil
+}
+
 func (h *ServerHandler) getServerFromChange(change *valueobject.Change) *entity.Server {
 	if change.NewState() != nil {
 		if server, ok := change.NewState().(*entity.Server); ok {
@@ -34,6 +34,10 @@ func (h *ServiceHandler) Apply(ctx context.Context, change *valueobject.Change,
 		return DeleteServiceRemote(change, deployCtx.Client, deployCtx.RemoteDir)
 	}
 
+	if err := removeAdoptedContainer(change, deployCtx.Client); err != nil {
+		return &Result{Change: change, Error: err}, nil
+	}
+
 	return ExecuteServiceDeploy(change, deployCtx, deps, DeployServiceOptions{
 		PreDeployHook:  h.createPreDeployHook(change, deployCtx, deps),
 		PostDeployHook: nil,
@@ -41,6 +45,21 @@ func (h *ServiceHandler) Apply(ctx context.Context, change *valueobject.Change,
 	})
 }
 
+// removeAdoptedContainer removes the container a service adopted by import
+// was found running in, so that it does not hold on to the ports and name of
+// the container yamlops deploys in its place.
+func removeAdoptedContainer(change *valueobject.Change, client contract.SSHClient) error {
+	old, ok := change.OldState().(*entity.BizService)
+	if !ok || old.AdoptedContainer == "" {
+		return nil
+	}
+	_, stderr, err := client.Run(fmt.Sprintf("sudo docker rm -f %s", ssh.ShellEscape(old.AdoptedContainer)))
+	if err != nil {
+		return fmt.Errorf("removing adopted container %s: %w, stderr: %s", old.AdoptedContainer, err, stderr)
+	}
+	return nil
+}
+
 func (h *ServiceHandler) createPreDeployHook(change *valueobject.Change, deployCtx *ServiceDeployContext, deps DepsProvider) func(*Result) error {
 	return func(result *Result) error {
 		if change.NewState() == nil {
@@ -51,6 +51,43 @@ func TestServiceHandler_Apply_Deploy(t *testing.T) {
 	}
 }
 
+func TestServiceHandler_Apply_AdoptedContainer(t *testing.T) {
+	h := NewServiceHandler()
+	ctx := context.Background()
+
+	mockSSH := &mockSSHClient{runStdout: "deployment successful"}
+	deps := newMockDeps()
+	deps.sshClient = mockSSH
+	deps.servers["server1"] = &ServerInfo{Host: "1.2.3.4", Port: 22, User: "root"}
+	deps.serverEntities["server1"] = &entity.Server{Name: "server1"}
+	deps.env = "test"
+	deps.workDir = t.TempDir()
+
+	change := valueobject.NewChange(valueobject.ChangeTypeUpdate, "service", "myapp").
+		WithOldState(&entity.BizService{
+			ServiceBase:      entity.ServiceBase{Server: "server1"},
+			Name:             "myapp",
+			Image:            "nginx:1.0",
+			AdoptedContainer: "legacy-app",
+		}).
+		WithNewState(&entity.BizService{
+			ServiceBase: entity.ServiceBase{Server: "server1"},
+			Name:        "myapp",
+			Image:       "nginx:latest",
+		})
+
+	result, err := h.Apply(ctx, change, deps)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result.Success {
+		t.Errorf("expected success, got error: %v", result.Error)
+	}
+	if len(mockSSH.commandsRun) == 0 || mockSSH.commandsRun[0] != "sudo docker rm -f 'legacy-app'" {
+		t.Errorf("the adopted container should be removed first, ran %v", mockSSH.commandsRun)
+	}
+}
+
 func TestServiceHandler_Apply_Delete(t *testing.T) {
 	h := NewServiceHandler()
 	ctx := context.Background()
@@ -0,0 +1,121 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lite-lake/infra-yamlops/internal/application/handler"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/journal"
+)
+
+// ApplyRecorder follows an apply change by change: it writes each start and
+// outcome to the journal and checkpoints the current state after every change
+// that succeeded, so that an interrupted apply loses nothing it already did.
+// Finish then records the apply as a single state version.
+type ApplyRecorder struct {
+	ctx       context.Context
+	w         *Workflow
+	journal   *journal.Journal
+	store     repository.VersionedStateRepository
+	state     *repository.DeploymentState
+	operation string
+	planFile  string
+	changed   bool
+	warnings  []error
+}
+
+// NewApplyRecorder starts from the recorded state of the environment.
+// planFile names the plan file being applied, if any.
+func (w *Workflow) NewApplyRecorder(ctx context.Context, cfg *entity.Config, j *journal.Journal, planFile string) (*ApplyRecorder, error) {
+	return w.newRecorder(ctx, cfg, j, "apply", planFile)
+}
+
+// NewDestroyRecorder checkpoints the state after every delete of a destroy,
+// which is not journaled: running destroy again plans what is left in the state.
+func (w *Workflow) NewDestroyRecorder(ctx context.Context, cfg *entity.Config) (*ApplyRecorder, error) {
+	return w.newRecorder(ctx, cfg, nil, "destroy", "")
+}
+
+func (w *Workflow) newRecorder(ctx context.Context, cfg *entity.Config, j *journal.Journal, operation, planFile string) (*ApplyRecorder, error) {
+	store, err := w.StateStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	st, err := store.Load(ctx, w.env)
+	if err != nil {
+		return nil, fmt.Errorf("loading state: %w", err)
+	}
+	return &ApplyRecorder{
+		ctx:       ctx,
+		w:         w,
+		journal:   j,
+		store:     store,
+		state:     st,
+		operation: operation,
+		planFile:  planFile,
+	}, nil
+}
+
+func (r *ApplyRecorder) ChangeStarted(ch *valueobject.Change) {
+	r.record(ch, journal.StatusStarted, nil)
+}
+
+func (r *ApplyRecorder) ChangeFinished(result *handler.Result) {
+	switch {
+	case errors.Is(result.Error, domain.ErrDependencyFailed):
+		r.record(result.Change, journal.StatusSkipped, result.Error)
+	case result.Error != nil || !result.Success:
+		r.record(result.Change, journal.StatusFailed, result.Error)
+	default:
+		r.record(result.Change, journal.StatusSucceeded, nil)
+		r.saveState(result.Change)
+	}
+}
+
+func (r *ApplyRecorder) record(ch *valueobject.Change, status journal.Status, changeErr error) {
+	if r.journal == nil {
+		return
+	}
+	if err := r.journal.Record(ch, status, changeErr); err != nil {
+		r.warnings = append(r.warnings, fmt.Errorf("journal %s: %w", journal.ChangeKey(ch), err))
+	}
+}
+
+func (r *ApplyRecorder) saveState(ch *valueobject.Change) {
+	if err := service.ApplyChangeToState(r.state, ch); err != nil {
+		r.warnings = append(r.warnings, fmt.Errorf("recording %s in state: %w", journal.ChangeKey(ch), err))
+		return
+	}
+	r.changed = true
+	if err := r.store.Save(r.ctx, r.w.env, r.state); err != nil {
+		r.warnings = append(r.warnings, fmt.Errorf("saving state after %s: %w", journal.ChangeKey(ch), err))
+	}
+}
+
+// Finish records the state left by the changes that succeeded as one new
+// version, which also becomes the cached state of offline plans, and returns
+// it. It returns nil when no change succeeded or the version could not be
+// saved, which is added to the warnings.
+func (r *ApplyRecorder) Finish() *repository.StateVersion {
+	if !r.changed {
+		return nil
+	}
+	version := r.w.NewStateVersion(r.operation, r.planFile)
+	if err := r.store.SaveVersion(r.ctx, r.w.env, r.state, version); err != nil {
+		r.warnings = append(r.warnings, fmt.Errorf("saving state version: %w", err))
+		return nil
+	}
+	if err := r.w.cacheState(r.state); err != nil {
+		r.warnings = append(r.warnings, fmt.Errorf("caching state: %w", err))
+	}
+	return version
+}
+
+// Warnings lists the journal entries and state saves that failed.
+func (r *ApplyRecorder) Warnings() []error { return r.warnings }
@@ -0,0 +1,95 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/application/handler"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/journal"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/planfile"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/state"
+)
+
+func TestApplyRecorder(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &entity.Config{}
+	w := NewWorkflow("prod", dir)
+
+	api := valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "service", "api", nil,
+		&entity.BizService{Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "api:1.0"}, nil, false)
+	web := valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "service", "web", nil,
+		&entity.BizService{Name: "web", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "web:1.0"}, nil, false)
+	db := valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "service", "db", nil,
+		&entity.BizService{Name: "db", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "db:1.0"}, nil, false)
+	plan := valueobject.NewPlan()
+	plan.AddChange(api)
+	plan.AddChange(web)
+	plan.AddChange(db)
+
+	pf, err := planfile.New("prod", cfg, repository.NewDeploymentState(), plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := journal.Create(journal.Dir(dir), "prod", pf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder, err := w.NewApplyRecorder(context.Background(), cfg, j, "")
+	if err != nil {
+		t.Fatalf("NewApplyRecorder() error = %v", err)
+	}
+
+	recorder.ChangeStarted(api)
+	recorder.ChangeFinished(&handler.Result{Change: api, Success: true})
+	recorder.ChangeStarted(web)
+	recorder.ChangeFinished(&handler.Result{Change: web, Error: errors.New("pull failed")})
+	recorder.ChangeStarted(db)
+	recorder.ChangeFinished(&handler.Result{Change: db, Success: true})
+	j.Close()
+
+	store, _ := w.StateStore(cfg)
+	if versions, err := store.History(context.Background(), "prod"); err != nil || len(versions) != 0 {
+		t.Errorf("History() before Finish = %v, %v, want no version", versions, err)
+	}
+	v := recorder.Finish()
+	if warnings := recorder.Warnings(); len(warnings) != 0 {
+		t.Fatalf("Warnings() = %v", warnings)
+	}
+	if v == nil || v.Version != 1 || v.Operation != "apply" {
+		t.Errorf("Finish() = %+v", v)
+	}
+	if versions, err := store.History(context.Background(), "prod"); err != nil || len(versions) != 1 {
+		t.Errorf("History() after Finish = %v, %v, want one version", versions, err)
+	}
+
+	if cached, err := state.LoadCache(state.CacheDir(dir), "prod"); err != nil || cached == nil || cached.State.Services["db"] == nil {
+		t.Errorf("LoadCache() after Finish = %+v, %v, want the recorded state", cached, err)
+	}
+
+	st, err := store.Load(context.Background(), "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc := st.Services["api"]; svc == nil || svc.Image != "api:1.0" {
+		t.Errorf("state service api = %+v", svc)
+	}
+	if svc := st.Services["db"]; svc == nil || svc.Image != "db:1.0" {
+		t.Errorf("state service db = %+v", svc)
+	}
+	if _, ok := st.Services["web"]; ok {
+		t.Error("failed change should not be recorded in state")
+	}
+
+	_, entries, err := journal.Load(journal.Dir(dir), "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining := journal.Remaining(pf.Plan, entries)
+	if len(remaining.Changes()) != 1 || remaining.Changes()[0].Name() != "web" {
+		t.Errorf("remaining changes = %v", remaining.Changes())
+	}
+}
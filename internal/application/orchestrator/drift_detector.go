@@ -0,0 +1,400 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lite-lake/infra-yamlops/internal/constants"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/contract"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
+	infradns "github.com/lite-lake/infra-yamlops/internal/infrastructure/dns"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/ssh"
+)
+
+// Attributes reported in a DriftItem.
+const (
+	DriftContainer = "container"
+	DriftStatus    = "status"
+	DriftImage     = "image"
+	DriftDigest    = "digest"
+	DriftEnvFile   = "env_file"
+	DriftNetworks  = "networks"
+	DriftRestart   = "restart_policy"
+	DriftRecord    = "record"
+	DriftTTL       = "ttl"
+)
+
+// DriftItem is one attribute of a resource whose live value differs from the
+// desired config. An empty Expected or Actual means the value is absent.
+type DriftItem struct {
+	Resource  string `json:"resource"`
+	Server    string `json:"server,omitempty"`
+	Attribute string `json:"attribute"`
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual"`
+}
+
+// DriftError records a resource that could not be checked.
+type DriftError struct {
+	Resource string `json:"resource"`
+	Error    string `json:"error"`
+}
+
+type DriftReport struct {
+	Env    string       `json:"env"`
+	Drifts []DriftItem  `json:"drifts"`
+	Errors []DriftError `json:"errors,omitempty"`
+}
+
+func (r *DriftReport) HasDrift() bool { return len(r.Drifts) > 0 }
+
+func (r *DriftReport) addError(resource string, err error) {
+	r.Errors = append(r.Errors, DriftError{Resource: resource, Error: err.Error()})
+}
+
+// DriftFilter limits detection to one server and/or one domain. Servers are
+// skipped when only a domain is given and vice versa.
+type DriftFilter struct {
+	Server string
+	Domain string
+}
+
+func (f DriftFilter) checkServers() bool { return f.Domain == "" || f.Server != "" }
+func (f DriftFilter) checkDNS() bool     { return f.Server == "" || f.Domain != "" }
+
+// DriftDetector compares what is running on servers and DNS providers with
+// the desired config. Unlike StateFetcher, which only decides whether a
+// compose project needs redeploying, it inspects the containers themselves.
+type DriftDetector struct {
+	env       string
+	configDir string
+}
+
+func NewDriftDetector(env, configDir string) *DriftDetector {
+	return &DriftDetector{env: env, configDir: configDir}
+}
+
+// Detect expects the deployment files to have been generated for cfg.
+func (d *DriftDetector) Detect(ctx context.Context, cfg *entity.Config, filter DriftFilter) *DriftReport {
+	report := &DriftReport{Env: d.env, Drifts: []DriftItem{}}
+	secrets := cfg.GetSecretsMap()
+
+	if filter.checkServers() {
+		for i := range cfg.Servers {
+			srv := &cfg.Servers[i]
+			if filter.Server != "" && srv.Name != filter.Server {
+				continue
+			}
+			d.detectServerWithSSH(srv, cfg, secrets, report)
+		}
+	}
+
+	if filter.checkDNS() {
+		providers := make(map[string]contract.DNSProvider)
+		for i := range cfg.Domains {
+			dom := &cfg.Domains[i]
+			if dom.DNSISP == "" || (filter.Domain != "" && dom.Name != filter.Domain) {
+				continue
+			}
+			provider, ok := providers[dom.DNSISP]
+			if !ok {
+				var err error
+				provider, err = newDNSProvider(cfg, dom.DNSISP, secrets)
+				if err != nil {
+					report.addError(entityRef("domain", dom.Name), err)
+					continue
+				}
+				providers[dom.DNSISP] = provider
+			}
+			d.DetectDNS(ctx, provider, dom, report)
+		}
+	}
+
+	return report
+}
+
+func (d *DriftDetector) detectServerWithSSH(srv *entity.Server, cfg *entity.Config, secrets map[string]string, report *DriftReport) {
+	client, err := dialServer(srv, secrets)
+	if err != nil {
+		report.addError(entityRef("server", srv.Name), err)
+		return
+	}
+	defer client.Close()
+	d.DetectServer(client, srv.Name, cfg, report)
+}
+
+// DetectServer checks the biz and infra services placed on serverName.
+// Every configured service is checked, so one that was never deployed is
+// reported as a missing container.
+func (d *DriftDetector) DetectServer(client contract.SSHRunner, serverName string, cfg *entity.Config, report *DriftReport) {
+	for i := range cfg.Services {
+		svc := &cfg.Services[i]
+		if svc.Server != serverName {
+			continue
+		}
+		resource := entityRef("service", svc.Name)
+		d.detectContainer(client, serverName, resource, svc.Name, svc.Image, svc.Networks, report)
+		d.detectEnvFile(client, serverName, resource, svc.Name, report)
+	}
+	for i := range cfg.InfraServices {
+		infra := &cfg.InfraServices[i]
+		if infra.Server != serverName {
+			continue
+		}
+		resource := entityRef("infra_service", infra.Name)
+		d.detectContainer(client, serverName, resource, infra.Name, infra.Image, infra.Networks, report)
+	}
+}
+
+// containerInspect holds the parts of docker inspect output yamlops reads.
+type containerInspect struct {
+	Image  string `json:"Image"`
+	Config struct {
+		Image string   `json:"Image"`
+		Env   []string `json:"Env"`
+	} `json:"Config"`
+	RestartCount int `json:"RestartCount"`
+	State        struct {
+		Status string `json:"Status"`
+		Health *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+	HostConfig struct {
+		RestartPolicy struct {
+			Name string `json:"Name"`
+		} `json:"RestartPolicy"`
+		PortBindings map[string][]struct {
+			HostPort string `json:"HostPort"`
+		} `json:"PortBindings"`
+	} `json:"HostConfig"`
+	Mounts []struct {
+		Type        string `json:"Type"`
+		Name        string `json:"Name"`
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+	} `json:"Mounts"`
+	NetworkSettings struct {
+		Networks map[string]json.RawMessage `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+func (d *DriftDetector) detectContainer(client contract.SSHRunner, serverName, resource, name, image string, networks []string, report *DriftReport) {
+	containerName := fmt.Sprintf(constants.ServicePrefixFormat, d.env, name)
+	add := func(attr, expected, actual string) {
+		report.Drifts = append(report.Drifts, DriftItem{Resource: resource, Server: serverName, Attribute: attr, Expected: expected, Actual: actual})
+	}
+
+	live, err := inspectContainer(client, containerName)
+	if err != nil {
+		report.addError(resource, err)
+		return
+	}
+	if live == nil {
+		add(DriftContainer, containerName, "")
+		return
+	}
+
+	if live.State.Status != "running" {
+		add(DriftStatus, "running", live.State.Status)
+	}
+	if live.Config.Image != image {
+		add(DriftImage, image, live.Config.Image)
+	} else if expected, actual, ok := imageDigest(client, image, live.Image); !ok {
+		add(DriftDigest, expected, actual)
+	}
+	if policy := live.HostConfig.RestartPolicy.Name; policy != constants.DefaultRestartPolicy {
+		add(DriftRestart, constants.DefaultRestartPolicy, policy)
+	}
+
+	if len(networks) == 0 {
+		networks = []string{fmt.Sprintf("yamlops-%s", d.env)}
+	}
+	liveNetworks := make([]string, 0, len(live.NetworkSettings.Networks))
+	for net := range live.NetworkSettings.Networks {
+		liveNetworks = append(liveNetworks, net)
+	}
+	if expected, actual := joinSorted(networks), joinSorted(liveNetworks); expected != actual {
+		add(DriftNetworks, expected, actual)
+	}
+}
+
+// inspectContainer returns nil without an error when the container does not
+// exist.
+func inspectContainer(client contract.SSHRunner, name string) (*containerInspect, error) {
+	stdout, stderr, err := client.Run(fmt.Sprintf("sudo docker inspect --type container %s", ssh.ShellEscape(name)))
+	var inspected []containerInspect
+	if jsonErr := json.Unmarshal([]byte(stdout), &inspected); jsonErr != nil {
+		if strings.Contains(stderr, "No such") {
+			return nil, nil
+		}
+		if err == nil {
+			err = jsonErr
+		}
+		return nil, fmt.Errorf("inspect container %s: %w", name, err)
+	}
+	if len(inspected) == 0 {
+		return nil, nil
+	}
+	return &inspected[0], nil
+}
+
+// imageDigest checks that the container runs the image the reference
+// resolves to. A reference pinned with @sha256 must be among the repo
+// digests of the running image; a tag must point at the running image ID on
+// the host, otherwise the tag was pulled again without recreating the
+// container.
+func imageDigest(client contract.SSHRunner, image, runningID string) (expected, actual string, ok bool) {
+	if _, digest, pinned := strings.Cut(image, "@"); pinned {
+		stdout, _, err := client.Run(fmt.Sprintf("sudo docker image inspect --format '{{join .RepoDigests \"\\n\"}}' %s", ssh.ShellEscape(runningID)))
+		if err != nil {
+			return "", "", true
+		}
+		var repoDigests []string
+		for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+			if _, repoDigest, ok := strings.Cut(line, "@"); ok {
+				if repoDigest == digest {
+					return "", "", true
+				}
+				repoDigests = append(repoDigests, repoDigest)
+			}
+		}
+		return digest, strings.Join(repoDigests, ","), false
+	}
+
+	stdout, _, err := client.Run(fmt.Sprintf("sudo docker image inspect --format '{{.Id}}' %s", ssh.ShellEscape(image)))
+	if err != nil {
+		return "", "", true
+	}
+	tagID := strings.TrimSpace(stdout)
+	if tagID == "" || tagID == runningID {
+		return "", "", true
+	}
+	return tagID, runningID, false
+}
+
+// detectEnvFile compares the env file on the server with the generated one.
+// Only hashes are reported since the file holds secrets.
+func (d *DriftDetector) detectEnvFile(client contract.SSHRunner, serverName, resource, name string, report *DriftReport) {
+	expected, actual, err := envFileHashes(client, d.env, d.configDir, serverName, name)
+	if err != nil {
+		report.addError(resource, err)
+		return
+	}
+	if expected != actual {
+		report.Drifts = append(report.Drifts, DriftItem{Resource: resource, Server: serverName, Attribute: DriftEnvFile, Expected: expected, Actual: actual})
+	}
+}
+
+// envFileHashes returns the hashes of the generated env file of a service
+// and of the one on the server; both are empty when none was generated.
+// Lines are sorted before hashing because the generator writes them in map
+// order.
+func envFileHashes(client contract.SSHRunner, env, configDir, serverName, name string) (expected, actual string, err error) {
+	localContent, err := readFileContent(filepath.Join(configDir, "deployments", serverName, name+".env"))
+	if err != nil {
+		return "", "", nil
+	}
+	remotePath := fmt.Sprintf("%s/%s/%s.env", constants.RemoteBaseDir, fmt.Sprintf(constants.ServiceDirPattern, env, name), name)
+	remoteContent, _, err := client.Run(fmt.Sprintf("sudo cat %s 2>/dev/null || true", ssh.ShellEscape(remotePath)))
+	if err != nil {
+		return "", "", fmt.Errorf("read remote env file %s: %w", remotePath, err)
+	}
+	return hashString(normalizeEnvFile(localContent)), hashString(normalizeEnvFile(remoteContent)), nil
+}
+
+// DetectDNS compares the records of dom with those at its DNS provider.
+// Remote records of types yamlops does not manage are ignored.
+func (d *DriftDetector) DetectDNS(ctx context.Context, provider contract.DNSProvider, dom *entity.Domain, report *DriftReport) {
+	remoteRecords, err := provider.ListRecords(ctx, dom.Name)
+	if err != nil {
+		report.addError(entityRef("domain", dom.Name), fmt.Errorf("list records from %s: %w", dom.DNSISP, err))
+		return
+	}
+
+	remote := make(map[string]contract.DNSRecord)
+	for _, r := range remoteRecords {
+		record := entity.DNSRecord{Type: entity.DNSRecordType(r.Type), Name: relativeRecordName(r.Name, dom.Name), Value: r.Value}
+		if record.Validate() != nil {
+			continue
+		}
+		remote[recordValueKey(&record)] = r
+	}
+
+	for _, record := range dom.FlattenRecords() {
+		resource := entityRef("dns_record", fmt.Sprintf("%s:%s:%s", dom.Name, record.Type, record.Name))
+		key := recordValueKey(&record)
+		live, ok := remote[key]
+		if !ok {
+			report.Drifts = append(report.Drifts, DriftItem{Resource: resource, Attribute: DriftRecord, Expected: record.Value})
+			continue
+		}
+		delete(remote, key)
+		if record.TTL > 0 && live.TTL != record.TTL {
+			report.Drifts = append(report.Drifts, DriftItem{Resource: resource, Attribute: DriftTTL, Expected: fmt.Sprint(record.TTL), Actual: fmt.Sprint(live.TTL)})
+		}
+	}
+
+	extras := make([]string, 0, len(remote))
+	for key := range remote {
+		extras = append(extras, key)
+	}
+	sort.Strings(extras)
+	for _, key := range extras {
+		r := remote[key]
+		name := relativeRecordName(r.Name, dom.Name)
+		report.Drifts = append(report.Drifts, DriftItem{
+			Resource:  entityRef("dns_record", fmt.Sprintf("%s:%s:%s", dom.Name, r.Type, name)),
+			Attribute: DriftRecord,
+			Actual:    r.Value,
+		})
+	}
+}
+
+func newDNSProvider(cfg *entity.Config, ispName string, secrets map[string]string) (contract.DNSProvider, error) {
+	isp := cfg.GetISPMap()[ispName]
+	if isp == nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrISPNotFound, ispName)
+	}
+	return infradns.NewFactory().Create(isp, secrets)
+}
+
+// relativeRecordName maps a provider record name to the form used in
+// config, where the apex is "@".
+func relativeRecordName(name, domainName string) string {
+	if name == "" {
+		return "@"
+	}
+	return infradns.GetSubDomain(name, domainName)
+}
+
+func recordValueKey(r *entity.DNSRecord) string {
+	return fmt.Sprintf("%s:%s:%s", r.Type, r.Name, r.Value)
+}
+
+func normalizeEnvFile(content string) string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func joinSorted(values []string) string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+func entityRef(kind, name string) string {
+	return service.EntityRef{Kind: kind, Name: name}.String()
+}
@@ -0,0 +1,148 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/contract"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+)
+
+type fakeRunner struct {
+	outputs map[string]string
+}
+
+func (r *fakeRunner) Run(cmd string) (string, string, error) {
+	for fragment, out := range r.outputs {
+		if strings.Contains(cmd, fragment) {
+			return out, "", nil
+		}
+	}
+	return "", "Error: No such object", fmt.Errorf("exit status 1")
+}
+
+func (r *fakeRunner) RunWithStdin(stdin string, cmd string) (string, string, error) {
+	return r.Run(cmd)
+}
+
+type fakeDNSProvider struct {
+	contract.DNSProvider
+	records []contract.DNSRecord
+	err     error
+}
+
+func (p *fakeDNSProvider) ListRecords(ctx context.Context, domain string) ([]contract.DNSRecord, error) {
+	return p.records, p.err
+}
+
+func writeDeployment(t *testing.T, dir, server, name string, files map[string]string) {
+	t.Helper()
+	serverDir := filepath.Join(dir, "deployments", server)
+	if err := os.MkdirAll(serverDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for ext, content := range files {
+		if err := os.WriteFile(filepath.Join(serverDir, name+ext), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func driftsByAttribute(report *DriftReport, resource string) map[string]DriftItem {
+	items := make(map[string]DriftItem)
+	for _, item := range report.Drifts {
+		if item.Resource == resource {
+			items[item.Attribute] = item
+		}
+	}
+	return items
+}
+
+func TestDriftDetector_DetectServer(t *testing.T) {
+	dir := t.TempDir()
+	writeDeployment(t, dir, "srv1", "api", map[string]string{".compose.yaml": "services: {}", ".env": "A=1\nB=2\n"})
+	writeDeployment(t, dir, "srv1", "web", map[string]string{".compose.yaml": "services: {}", ".env": "PORT=80\n"})
+	writeDeployment(t, dir, "srv1", "worker", map[string]string{".compose.yaml": "services: {}"})
+
+	cfg := &entity.Config{Services: []entity.BizService{
+		{Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "api:1.0"},
+		{Name: "web", ServiceBase: entity.ServiceBase{Server: "srv1", Networks: []string{"front"}}, Image: "web:2.0"},
+		{Name: "worker", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "worker:1.0"},
+		{Name: "undeployed", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "x:1"},
+	}}
+
+	runner := &fakeRunner{outputs: map[string]string{
+		"inspect --type container 'yo-prod-api'": `[{"Image":"sha256:aaa","Config":{"Image":"api:1.0"},"State":{"Status":"running"},
+			"HostConfig":{"RestartPolicy":{"Name":"unless-stopped"}},"NetworkSettings":{"Networks":{"yamlops-prod":{}}}}]`,
+		"image inspect --format '{{.Id}}' 'api:1.0'": "sha256:aaa\n",
+		"yo-prod-api/api.env":                        "B=2\nA=1\n",
+		"inspect --type container 'yo-prod-web'": `[{"Image":"sha256:old","Config":{"Image":"web:2.0"},"State":{"Status":"exited"},
+			"HostConfig":{"RestartPolicy":{"Name":"no"}},"NetworkSettings":{"Networks":{"bridge":{}}}}]`,
+		"image inspect --format '{{.Id}}' 'web:2.0'": "sha256:new\n",
+		"yo-prod-web/web.env":                        "PORT=8080\n",
+	}}
+
+	report := &DriftReport{}
+	NewDriftDetector("prod", dir).DetectServer(runner, "srv1", cfg, report)
+
+	if items := driftsByAttribute(report, "service:api"); len(items) != 0 {
+		t.Errorf("api should not drift (env lines in another order), got %+v", items)
+	}
+
+	web := driftsByAttribute(report, "service:web")
+	for attr, want := range map[string][2]string{
+		DriftStatus:   {"running", "exited"},
+		DriftDigest:   {"sha256:new", "sha256:old"},
+		DriftRestart:  {"unless-stopped", "no"},
+		DriftNetworks: {"front", "bridge"},
+	} {
+		if got := web[attr]; got.Expected != want[0] || got.Actual != want[1] {
+			t.Errorf("web %s drift = %+v, want %v", attr, got, want)
+		}
+	}
+	if env := web[DriftEnvFile]; env.Expected == "" || env.Expected == env.Actual {
+		t.Errorf("web env_file drift = %+v", env)
+	}
+
+	if got := driftsByAttribute(report, "service:worker")[DriftContainer]; got.Expected != "yo-prod-worker" || got.Actual != "" {
+		t.Errorf("worker container drift = %+v", got)
+	}
+	if got := driftsByAttribute(report, "service:undeployed")[DriftContainer]; got.Expected != "yo-prod-undeployed" || got.Actual != "" {
+		t.Errorf("undeployed container drift = %+v", got)
+	}
+}
+
+func TestDriftDetector_DetectDNS(t *testing.T) {
+	dom := &entity.Domain{Name: "example.com", DNSISP: "cf", Records: []entity.DNSRecord{
+		{Type: entity.DNSRecordTypeA, Name: "@", Value: "1.2.3.4", TTL: 600},
+		{Type: entity.DNSRecordTypeA, Name: "www", Value: "1.2.3.4", TTL: 600},
+		{Type: entity.DNSRecordTypeCNAME, Name: "api", Value: "www.example.com"},
+	}}
+	provider := &fakeDNSProvider{records: []contract.DNSRecord{
+		{Type: "A", Name: "example.com", Value: "1.2.3.4", TTL: 600},
+		{Type: "A", Name: "www.example.com", Value: "1.2.3.4", TTL: 300},
+		{Type: "TXT", Name: "old", Value: "v=spf1"},
+		{Type: "SOA", Name: "example.com", Value: "ns1"},
+	}}
+
+	report := &DriftReport{}
+	NewDriftDetector("prod", t.TempDir()).DetectDNS(context.Background(), provider, dom, report)
+
+	want := []DriftItem{
+		{Resource: "dns_record:example.com:A:www", Attribute: DriftTTL, Expected: "600", Actual: "300"},
+		{Resource: "dns_record:example.com:CNAME:api", Attribute: DriftRecord, Expected: "www.example.com"},
+		{Resource: "dns_record:example.com:TXT:old", Attribute: DriftRecord, Actual: "v=spf1"},
+	}
+	if len(report.Drifts) != len(want) {
+		t.Fatalf("DetectDNS() drifts = %+v, want %+v", report.Drifts, want)
+	}
+	for i := range want {
+		if report.Drifts[i] != want[i] {
+			t.Errorf("drift[%d] = %+v, want %+v", i, report.Drifts[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/contract"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/ssh"
+)
+
+// defaultDockerNetworks are joined by containers that name no network.
+var defaultDockerNetworks = map[string]bool{"bridge": true, "host": true, "none": true}
+
+// RedactedEnvValue stands in for the value of an imported environment
+// variable that the config does not set to the same value.
+const RedactedEnvValue = "(redacted)"
+
+// ImportService describes the container running on serverName as the
+// service name, so that an existing deployment can be adopted into state.
+// Environment variables are compared with the configured service, if any:
+// those it injects from secrets are left out, those it sets to the same
+// value keep its reference and the others are redacted.
+func (w *Workflow) ImportService(cfg *entity.Config, name, serverName, containerName string) (*entity.BizService, error) {
+	srv, ok := cfg.GetServerMap()[serverName]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", domain.ErrServerNotRegistered, serverName)
+	}
+	client, err := dialServer(srv, cfg.GetSecretsMap())
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	return inspectService(client, name, serverName, containerName, cfg.GetServiceMap()[name], cfg.GetSecretsMap())
+}
+
+// ImportRecords reads the records of dom with the given type and name,
+// relative to the domain as in config, from the domain's DNS provider.
+func (w *Workflow) ImportRecords(ctx context.Context, cfg *entity.Config, dom *entity.Domain, recordType entity.DNSRecordType, name string) ([]entity.DNSRecord, error) {
+	if dom.DNSISP == "" {
+		return nil, fmt.Errorf("%w: dns_isp of domain %s", domain.ErrRequired, dom.Name)
+	}
+	provider, err := newDNSProvider(cfg, dom.DNSISP, cfg.GetSecretsMap())
+	if err != nil {
+		return nil, err
+	}
+	return fetchRecords(ctx, provider, dom.Name, recordType, name)
+}
+
+// inspectService leaves out environment variables that come from the image
+// rather than from the container.
+func inspectService(client contract.SSHRunner, name, serverName, containerName string, configured *entity.BizService, secrets map[string]string) (*entity.BizService, error) {
+	live, err := inspectContainer(client, containerName)
+	if err != nil {
+		return nil, err
+	}
+	if live == nil {
+		return nil, fmt.Errorf("%w: %s on server %s", domain.ErrContainerNotFound, containerName, serverName)
+	}
+
+	var imageEnv []string
+	stdout, _, err := client.Run(fmt.Sprintf("sudo docker image inspect --format '{{json .Config.Env}}' %s", ssh.ShellEscape(live.Image)))
+	if err == nil {
+		json.Unmarshal([]byte(stdout), &imageEnv)
+	}
+	svc := serviceFromContainer(name, serverName, live, imageEnv, configured, secrets)
+	svc.AdoptedContainer = containerName
+	return svc, nil
+}
+
+func serviceFromContainer(name, serverName string, live *containerInspect, imageEnv []string, configured *entity.BizService, secrets map[string]string) *entity.BizService {
+	svc := &entity.BizService{
+		ServiceBase: entity.ServiceBase{Server: serverName},
+		Name:        name,
+		Image:       live.Config.Image,
+	}
+
+	inherited := make(map[string]bool, len(imageEnv))
+	for _, kv := range imageEnv {
+		inherited[kv] = true
+	}
+	fromSecrets := make(map[string]bool)
+	if configured != nil {
+		for _, secretName := range configured.Secrets {
+			fromSecrets[strings.ToUpper(secretName)] = true
+		}
+	}
+	for _, kv := range live.Config.Env {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || inherited[kv] || fromSecrets[key] {
+			continue
+		}
+		if svc.Env == nil {
+			svc.Env = make(map[string]valueobject.SecretRef)
+		}
+		svc.Env[key] = importedEnv(configured, secrets, key, value)
+	}
+
+	for containerPort, bindings := range live.HostConfig.PortBindings {
+		port, proto, _ := strings.Cut(containerPort, "/")
+		cp, err := strconv.Atoi(port)
+		if err != nil {
+			continue
+		}
+		for _, b := range bindings {
+			hp, err := strconv.Atoi(b.HostPort)
+			if err != nil {
+				continue
+			}
+			p := entity.ServicePort{Container: cp, Host: hp}
+			if proto == "udp" {
+				p.Protocol = proto
+			}
+			svc.Ports = append(svc.Ports, p)
+		}
+	}
+	sort.Slice(svc.Ports, func(i, j int) bool { return svc.Ports[i].Host < svc.Ports[j].Host })
+
+	for _, m := range live.Mounts {
+		switch m.Type {
+		case "bind":
+			svc.Volumes = append(svc.Volumes, entity.ServiceVolume{Source: m.Source, Target: m.Destination})
+		case "volume":
+			svc.Volumes = append(svc.Volumes, entity.ServiceVolume{Source: m.Name, Target: m.Destination})
+		}
+	}
+
+	for net := range live.NetworkSettings.Networks {
+		if !defaultDockerNetworks[net] {
+			svc.Networks = append(svc.Networks, net)
+		}
+	}
+	sort.Strings(svc.Networks)
+
+	return svc
+}
+
+// importedEnv keeps the configured reference of key when it resolves to the
+// value found in the container, so that the value is never written out.
+func importedEnv(configured *entity.BizService, secrets map[string]string, key, value string) valueobject.SecretRef {
+	if configured != nil {
+		if ref, ok := configured.Env[key]; ok {
+			if resolved, err := ref.Resolve(secrets); err == nil && resolved == value {
+				return ref
+			}
+		}
+	}
+	return *valueobject.NewSecretRefPlain(RedactedEnvValue)
+}
+
+func fetchRecords(ctx context.Context, provider contract.DNSProvider, domainName string, recordType entity.DNSRecordType, name string) ([]entity.DNSRecord, error) {
+	remoteRecords, err := provider.ListRecords(ctx, domainName)
+	if err != nil {
+		return nil, fmt.Errorf("list records of %s: %w", domainName, err)
+	}
+
+	var records []entity.DNSRecord
+	for _, r := range remoteRecords {
+		if entity.DNSRecordType(r.Type) != recordType || relativeRecordName(r.Name, domainName) != name {
+			continue
+		}
+		records = append(records, entity.DNSRecord{
+			Domain: domainName,
+			Type:   recordType,
+			Name:   name,
+			Value:  r.Value,
+			TTL:    r.TTL,
+		})
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: %s %s in %s", domain.ErrDNSRecordNotFound, recordType, name, domainName)
+	}
+	return records, nil
+}
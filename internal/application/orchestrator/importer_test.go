@@ -0,0 +1,89 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/contract"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+func TestInspectService(t *testing.T) {
+	runner := &fakeRunner{outputs: map[string]string{
+		"inspect --type container 'legacy-api'": `[{"Image":"sha256:aaa","Config":{"Image":"api:1.0","Env":["PATH=/usr/bin","DB_HOST=db","MODE=prod","API_TOKEN=s3cret","DB_PASSWORD=hunter2"]},
+			"HostConfig":{"PortBindings":{"8080/tcp":[{"HostPort":"18080"}],"53/udp":[{"HostPort":"53"}]}},
+			"Mounts":[{"Type":"bind","Source":"/srv/api/data","Destination":"/data"},{"Type":"volume","Name":"api-cache","Destination":"/cache"}],
+			"NetworkSettings":{"Networks":{"bridge":{},"backend":{}}}}]`,
+		"image inspect --format '{{json .Config.Env}}'": `["PATH=/usr/bin"]`,
+	}}
+
+	configured := &entity.BizService{
+		Name:    "api",
+		Secrets: []string{"api_token"},
+		Env: map[string]valueobject.SecretRef{
+			"DB_HOST":     *valueobject.NewSecretRefPlain("db"),
+			"DB_PASSWORD": *valueobject.NewSecretRefSecret("db_password"),
+		},
+	}
+	secrets := map[string]string{"api_token": "s3cret", "db_password": "hunter2"}
+
+	svc, err := inspectService(runner, "api", "srv1", "legacy-api", configured, secrets)
+	if err != nil {
+		t.Fatalf("inspectService() error = %v", err)
+	}
+	if svc.Name != "api" || svc.Server != "srv1" || svc.Image != "api:1.0" || svc.AdoptedContainer != "legacy-api" {
+		t.Errorf("service = %+v", svc)
+	}
+	if _, ok := svc.Env["PATH"]; ok {
+		t.Errorf("env should only hold container variables, got %v", svc.Env)
+	}
+	if _, ok := svc.Env["API_TOKEN"]; ok {
+		t.Errorf("env injected from secrets should be left out, got %v", svc.Env)
+	}
+	if v := svc.Env["DB_HOST"]; v.Plain() != "db" {
+		t.Errorf("env DB_HOST = %q", v.Plain())
+	}
+	if v := svc.Env["DB_PASSWORD"]; v.Secret() != "db_password" {
+		t.Errorf("env DB_PASSWORD should keep the configured secret, got %+v", v)
+	}
+	if v := svc.Env["MODE"]; v.Plain() != RedactedEnvValue {
+		t.Errorf("env MODE = %q, want it redacted", v.Plain())
+	}
+	wantPorts := []entity.ServicePort{{Container: 53, Host: 53, Protocol: "udp"}, {Container: 8080, Host: 18080}}
+	if fmt.Sprint(svc.Ports) != fmt.Sprint(wantPorts) {
+		t.Errorf("ports = %+v, want %+v", svc.Ports, wantPorts)
+	}
+	if len(svc.Volumes) != 2 || svc.Volumes[0].Source != "/srv/api/data" || svc.Volumes[1].Source != "api-cache" {
+		t.Errorf("volumes = %+v", svc.Volumes)
+	}
+	if fmt.Sprint(svc.Networks) != "[backend]" {
+		t.Errorf("networks = %v, want [backend]", svc.Networks)
+	}
+
+	if _, err := inspectService(runner, "web", "srv1", "missing", nil, nil); !errors.Is(err, domain.ErrContainerNotFound) {
+		t.Errorf("inspectService(missing) error = %v, want ErrContainerNotFound", err)
+	}
+}
+
+func TestFetchRecords(t *testing.T) {
+	provider := &fakeDNSProvider{records: []contract.DNSRecord{
+		{Type: "A", Name: "www.example.com", Value: "1.2.3.4", TTL: 600},
+		{Type: "A", Name: "www.example.com", Value: "1.2.3.5", TTL: 600},
+		{Type: "A", Name: "api.example.com", Value: "1.2.3.6", TTL: 600},
+	}}
+
+	records, err := fetchRecords(context.Background(), provider, "example.com", entity.DNSRecordTypeA, "www")
+	if err != nil {
+		t.Fatalf("fetchRecords() error = %v", err)
+	}
+	if len(records) != 2 || records[0].Domain != "example.com" || records[1].Value != "1.2.3.5" {
+		t.Errorf("fetchRecords() = %+v", records)
+	}
+	if _, err := fetchRecords(context.Background(), provider, "example.com", entity.DNSRecordTypeCNAME, "www"); !errors.Is(err, domain.ErrDNSRecordNotFound) {
+		t.Errorf("fetchRecords(missing) error = %v, want ErrDNSRecordNotFound", err)
+	}
+}
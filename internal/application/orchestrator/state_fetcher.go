@@ -4,24 +4,45 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/lite-lake/infra-yamlops/internal/application/handler"
+	"github.com/lite-lake/infra-yamlops/internal/application/usecase"
 	"github.com/lite-lake/infra-yamlops/internal/constants"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/contract"
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
 	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/retry"
+	infradns "github.com/lite-lake/infra-yamlops/internal/infrastructure/dns"
 	"github.com/lite-lake/infra-yamlops/internal/infrastructure/logger"
-	"github.com/lite-lake/infra-yamlops/internal/infrastructure/ssh"
 )
 
 type StateFetcher struct {
-	env       string
-	configDir string
+	env            string
+	configDir      string
+	serverTimeout  time.Duration
+	sshPool        usecase.SSHPoolInterface
+	newDNSProvider func(cfg *entity.Config, ispName string, secrets map[string]string) (contract.DNSProvider, error)
 }
 
 func NewStateFetcher(env, configDir string) *StateFetcher {
 	return &StateFetcher{
-		env:       env,
-		configDir: configDir,
+		env:            env,
+		configDir:      configDir,
+		serverTimeout:  constants.DefaultStateFetchTimeout,
+		newDNSProvider: newDNSProvider,
+	}
+}
+
+// SetServerTimeout bounds how long the state of one server may take to
+// fetch, connecting included. A non-positive timeout keeps the default.
+func (f *StateFetcher) SetServerTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		f.serverTimeout = timeout
 	}
 }
 
@@ -32,32 +53,202 @@ func (f *StateFetcher) Fetch(ctx context.Context, cfg *entity.Config) *repositor
 		state.Zones[zone.Name] = &zone
 	}
 
+	f.fetchServers(ctx, cfg, state)
+	f.FetchDNS(ctx, cfg, state)
+	return state
+}
+
+// fetchServers fetches the services of every server concurrently. A server
+// that cannot be reached or does not answer within the server timeout is
+// recorded in state.Unreachable and contributes no services, so that they
+// are planned as unknown instead of as not deployed.
+func (f *StateFetcher) fetchServers(ctx context.Context, cfg *entity.Config, state *repository.DeploymentState) {
+	var fetches sync.WaitGroup
+	pool := f.sshPool
+	if pool == nil {
+		pool = usecase.NewSSHPool()
+		// Fetches that timed out may still be dialing or running their last
+		// command: the pool is closed once they are done, without holding up
+		// the caller.
+		defer func() {
+			go func() {
+				fetches.Wait()
+				pool.CloseAll()
+			}()
+		}()
+	}
 	secrets := cfg.GetSecretsMap()
-	for _, srv := range cfg.Servers {
+
+	type serverResult struct {
+		name  string
+		state *repository.DeploymentState
+		err   error
+	}
+	results := make(chan serverResult, len(cfg.Servers))
+	for i := range cfg.Servers {
+		srv := cfg.Servers[i]
 		state.Servers[srv.Name] = &srv
+		go func() {
+			srvState, err := f.fetchServer(ctx, pool, &fetches, &srv, cfg, secrets)
+			results <- serverResult{name: srv.Name, state: srvState, err: err}
+		}()
+	}
 
-		password, err := srv.SSH.Password.Resolve(secrets)
-		if err != nil {
-			logger.Warn("failed to resolve SSH password", "server", srv.Name, "error", err)
+	for range cfg.Servers {
+		r := <-results
+		if r.err != nil {
+			logger.Warn("server state unknown", "server", r.name, "error", r.err)
+			state.Unreachable[r.name] = r.err.Error()
 			continue
 		}
+		maps.Copy(state.Services, r.state.Services)
+		maps.Copy(state.InfraServices, r.state.InfraServices)
+	}
+}
+
+// fetchServer returns the services deployed on srv. Dialing and a running
+// SSH command cannot be interrupted, so on timeout the fetch is left to
+// finish in the background, tracked by fetches: it runs no further command
+// once ctx is done and its result is discarded.
+func (f *StateFetcher) fetchServer(ctx context.Context, pool usecase.SSHPoolInterface, fetches *sync.WaitGroup, srv *entity.Server, cfg *entity.Config, secrets map[string]string) (*repository.DeploymentState, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.serverTimeout)
+	defer cancel()
 
-		client, err := ssh.NewClient(srv.SSH.Host, srv.SSH.Port, srv.SSH.User, password)
+	type fetchResult struct {
+		state *repository.DeploymentState
+		err   error
+	}
+	done := make(chan fetchResult, 1)
+	fetches.Add(1)
+	go func() {
+		defer fetches.Done()
+		password, err := srv.SSH.Password.Resolve(secrets)
 		if err != nil {
-			logger.Warn("failed to create SSH client", "server", srv.Name, "error", err)
+			done <- fetchResult{err: fmt.Errorf("resolve SSH password: %w", err)}
+			return
+		}
+		client, err := pool.Get(&handler.ServerInfo{Host: srv.SSH.Host, Port: srv.SSH.Port, User: srv.SSH.User, Password: password})
+		if err != nil {
+			done <- fetchResult{err: fmt.Errorf("%w: %w", domain.ErrServerUnreachable, err)}
+			return
+		}
+		if err := ctx.Err(); err != nil {
+			done <- fetchResult{err: err}
+			return
+		}
+		srvState := repository.NewDeploymentState()
+		f.fetchServerServicesState(contextRunner{ctx: ctx, runner: client}, srv.Name, cfg, srvState)
+		done <- fetchResult{state: srvState}
+	}()
+
+	select {
+	case r := <-done:
+		return r.state, r.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: no answer within %s", domain.ErrServerUnreachable, f.serverTimeout)
+	}
+}
+
+// contextRunner refuses to run commands once ctx is done, so that a fetch
+// that timed out stops using its SSH client after the command in flight.
+type contextRunner struct {
+	ctx    context.Context
+	runner contract.SSHRunner
+}
+
+func (r contextRunner) Run(cmd string) (string, string, error) {
+	if err := r.ctx.Err(); err != nil {
+		return "", "", err
+	}
+	return r.runner.Run(cmd)
+}
+
+func (r contextRunner) RunWithStdin(stdin string, cmd string) (string, string, error) {
+	if err := r.ctx.Err(); err != nil {
+		return "", "", err
+	}
+	return r.runner.RunWithStdin(stdin, cmd)
+}
+
+// FetchDNS lists the records of every domain at its DNS provider, one domain
+// per goroutine. A domain is added to state only when its records could be
+// listed, so that OverlayState falls back to the recorded records of the
+// domains that could not. Records of types yamlops does not manage are
+// ignored.
+func (f *StateFetcher) FetchDNS(ctx context.Context, cfg *entity.Config, state *repository.DeploymentState) {
+	secrets := cfg.GetSecretsMap()
+	providers := make(map[string]contract.DNSProvider)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := range cfg.Domains {
+		dom := cfg.Domains[i]
+		if dom.DNSISP == "" {
+			continue
+		}
+		provider, ok := providers[dom.DNSISP]
+		if !ok {
+			var err error
+			provider, err = f.newDNSProvider(cfg, dom.DNSISP, secrets)
+			if err != nil {
+				logger.Warn("failed to create DNS provider", "isp", dom.DNSISP, "error", err)
+			}
+			providers[dom.DNSISP] = provider
+		}
+		if provider == nil {
 			continue
 		}
 
-		func() {
-			defer client.Close()
-			f.fetchServerServicesState(client, srv.Name, cfg, state)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			records, err := listLiveRecords(ctx, provider, dom.Name)
+			if err != nil {
+				logger.Warn("failed to list DNS records, using the recorded ones", "domain", dom.Name, "error", err)
+				return
+			}
+			dom.Records = records
+			mu.Lock()
+			defer mu.Unlock()
+			state.Domains[dom.Name] = &dom
+			for _, r := range dom.FlattenRecords() {
+				record := r
+				state.Records[record.Key()] = &record
+			}
 		}()
 	}
+	wg.Wait()
+}
 
-	return state
+func listLiveRecords(ctx context.Context, provider contract.DNSProvider, domainName string) ([]entity.DNSRecord, error) {
+	remote, err := retry.DoWithResult(ctx, func() ([]contract.DNSRecord, error) {
+		return provider.ListRecords(ctx, domainName)
+	},
+		retry.WithMaxAttempts(constants.DefaultDNSRetryAttempts),
+		retry.WithInitialDelay(constants.DefaultDNSRetryInitialDelay),
+		retry.WithMaxDelay(constants.DefaultDNSRetryMaxDelay),
+		retry.WithIsRetryable(infradns.IsRetryableDNSError))
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]entity.DNSRecord, 0, len(remote))
+	for _, r := range remote {
+		record := entity.DNSRecord{
+			Type:  entity.DNSRecordType(r.Type),
+			Name:  relativeRecordName(r.Name, domainName),
+			Value: r.Value,
+			TTL:   r.TTL,
+		}
+		if record.Validate() != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
 }
 
-func (f *StateFetcher) fetchServerServicesState(client *ssh.Client, serverName string, cfg *entity.Config, state *repository.DeploymentState) {
+func (f *StateFetcher) fetchServerServicesState(client contract.SSHRunner, serverName string, cfg *entity.Config, state *repository.DeploymentState) {
 	stdout, _, err := client.Run("sudo docker compose ls -a --format json 2>/dev/null || sudo docker compose ls -a --format json")
 	if err != nil {
 		logger.Warn("failed to list docker compose projects", "server", serverName, "error", err)
@@ -144,6 +335,7 @@ func (f *StateFetcher) fetchServerServicesState(client *ssh.Client, serverName s
 					Name: svc.Name,
 				}
 			}
+			state.Services[svc.Name].Runtime = f.fetchRuntime(client, serverName, svc.Name, svc.Image, true)
 		}
 	}
 
@@ -201,6 +393,45 @@ func (f *StateFetcher) fetchServerServicesState(client *ssh.Client, serverName s
 					Name: infra.Name,
 				}
 			}
+			state.InfraServices[infra.Name].Runtime = f.fetchRuntime(client, serverName, infra.Name, infra.Image, false)
+		}
+	}
+}
+
+// fetchRuntime inspects the container of a deployed service. A missing
+// container is reported with the status "missing". It returns nil when the
+// container cannot be inspected, leaving the service to be planned from its
+// compose file alone.
+func (f *StateFetcher) fetchRuntime(client contract.SSHRunner, serverName, name, image string, withEnvFile bool) *entity.ServiceRuntime {
+	containerName := fmt.Sprintf(constants.ServicePrefixFormat, f.env, name)
+	live, err := inspectContainer(client, containerName)
+	if err != nil {
+		logger.Warn("failed to inspect container", "server", serverName, "container", containerName, "error", err)
+		return nil
+	}
+	if live == nil {
+		return &entity.ServiceRuntime{Status: "missing"}
+	}
+
+	rt := &entity.ServiceRuntime{
+		Status:       live.State.Status,
+		RestartCount: live.RestartCount,
+	}
+	if live.State.Health != nil {
+		rt.Health = live.State.Health.Status
+	}
+	if live.Config.Image == image {
+		if expected, actual, ok := imageDigest(client, image, live.Image); !ok {
+			rt.ImageDigest, rt.WantImageDigest = actual, expected
+		}
+	}
+	if withEnvFile {
+		expected, actual, err := envFileHashes(client, f.env, f.configDir, serverName, name)
+		if err != nil {
+			logger.Warn("failed to read env file", "server", serverName, "service", name, "error", err)
+		} else if expected != "" {
+			rt.EnvFileHash, rt.WantEnvFileHash = actual, expected
 		}
 	}
+	return rt
 }
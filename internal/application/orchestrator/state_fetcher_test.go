@@ -0,0 +1,211 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lite-lake/infra-yamlops/internal/application/handler"
+	"github.com/lite-lake/infra-yamlops/internal/application/usecase"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/contract"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+)
+
+func TestStateFetcher_FetchDNS(t *testing.T) {
+	cfg := &entity.Config{Domains: []entity.Domain{
+		{Name: "example.com", DNSISP: "cf"},
+		{Name: "example.org", DNSISP: "broken"},
+		{Name: "example.net"},
+	}}
+	providers := map[string]contract.DNSProvider{
+		"cf": &fakeDNSProvider{records: []contract.DNSRecord{
+			{Type: "A", Name: "example.com", Value: "1.2.3.4", TTL: 600},
+			{Type: "CNAME", Name: "www.example.com", Value: "example.com"},
+			{Type: "SOA", Name: "example.com", Value: "ns1"},
+		}},
+		"broken": &fakeDNSProvider{err: fmt.Errorf("invalid credentials")},
+	}
+	created := 0
+	f := NewStateFetcher("prod", t.TempDir())
+	f.newDNSProvider = func(cfg *entity.Config, ispName string, secrets map[string]string) (contract.DNSProvider, error) {
+		created++
+		return providers[ispName], nil
+	}
+
+	state := repository.NewDeploymentState()
+	f.FetchDNS(context.Background(), cfg, state)
+
+	if created != 2 {
+		t.Errorf("created %d providers, want 2", created)
+	}
+	if _, ok := state.Domains["example.com"]; !ok {
+		t.Error("example.com was listed and should be in the state")
+	}
+	for _, name := range []string{"example.org", "example.net"} {
+		if _, ok := state.Domains[name]; ok {
+			t.Errorf("%s could not be listed and should be left to the recorded state", name)
+		}
+	}
+	if len(state.Records) != 2 {
+		t.Fatalf("records = %v, want the A and CNAME records only", state.Records)
+	}
+	if r := state.Records["example.com:A:@:1.2.3.4"]; r == nil || r.TTL != 600 {
+		t.Errorf("Records[example.com:A:@:1.2.3.4] = %+v", r)
+	}
+	if r := state.Records["example.com:CNAME:www:example.com"]; r == nil || r.Domain != "example.com" {
+		t.Errorf("Records[example.com:CNAME:www:example.com] = %+v", r)
+	}
+}
+
+func TestStateFetcher_FetchServerServicesState(t *testing.T) {
+	dir := t.TempDir()
+	writeDeployment(t, dir, "srv1", "api", map[string]string{".compose.yaml": "services: {}", ".env": "A=1\n"})
+	writeDeployment(t, dir, "srv1", "gw", map[string]string{".compose.yaml": "services: {}"})
+
+	cfg := &entity.Config{
+		Services: []entity.BizService{
+			{Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "api:1.0"},
+		},
+		InfraServices: []entity.InfraService{
+			{Name: "gw", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "gw:1.0"},
+		},
+	}
+	runner := &fakeRunner{outputs: map[string]string{
+		"compose ls":         `[{"Name":"yo-prod-api"},{"Name":"yo-prod-gw"}]`,
+		"docker-compose.yml": "services: {}",
+		"inspect --type container 'yo-prod-api'": `[{"Image":"sha256:old","RestartCount":2,"Config":{"Image":"api:1.0"},
+			"State":{"Status":"running","Health":{"Status":"unhealthy"}}}]`,
+		"image inspect --format '{{.Id}}' 'api:1.0'": "sha256:new\n",
+		"yo-prod-api/api.env":                        "A=2\n",
+	}}
+
+	state := repository.NewDeploymentState()
+	NewStateFetcher("prod", dir).fetchServerServicesState(runner, "srv1", cfg, state)
+
+	api := state.Services["api"]
+	if api == nil || api.Image != "api:1.0" {
+		t.Fatalf("api = %+v, want the configured service since the compose files match", api)
+	}
+	rt := api.Runtime
+	if rt == nil {
+		t.Fatal("api runtime was not fetched")
+	}
+	if rt.Status != "running" || rt.RestartCount != 2 || rt.Health != "unhealthy" {
+		t.Errorf("api runtime = %+v", rt)
+	}
+	if rt.ImageDigest != "sha256:old" || rt.WantImageDigest != "sha256:new" {
+		t.Errorf("api image digests = %q, %q", rt.ImageDigest, rt.WantImageDigest)
+	}
+	if rt.WantEnvFileHash == "" || rt.EnvFileHash == rt.WantEnvFileHash {
+		t.Errorf("api env file hashes = %q, %q", rt.EnvFileHash, rt.WantEnvFileHash)
+	}
+
+	if gw := state.InfraServices["gw"]; gw == nil || gw.Runtime == nil || gw.Runtime.Status != "missing" {
+		t.Errorf("gw = %+v, want a missing container", gw)
+	}
+}
+
+type fakeSSHClient struct {
+	contract.SSHClient
+	runner *fakeRunner
+	runs   atomic.Int32
+}
+
+func (c *fakeSSHClient) Run(cmd string) (string, string, error) {
+	c.runs.Add(1)
+	return c.runner.Run(cmd)
+}
+
+func (c *fakeSSHClient) Close() error { return nil }
+
+func TestStateFetcher_FetchServer_TimedOutRunsNothing(t *testing.T) {
+	cfg := &entity.Config{
+		Services: []entity.BizService{
+			{Name: "web", ServiceBase: entity.ServiceBase{Server: "slow"}, Image: "web:1.0"},
+		},
+	}
+	srv := &entity.Server{Name: "slow", SSH: entity.ServerSSH{Host: "10.0.0.2"}}
+	client := &fakeSSHClient{runner: &fakeRunner{outputs: map[string]string{
+		"compose ls": `[{"Name":"yo-prod-web"}]`,
+	}}}
+	release := make(chan struct{})
+	f := NewStateFetcher("prod", t.TempDir())
+	f.SetServerTimeout(20 * time.Millisecond)
+	pool := usecase.NewSSHPoolWithFactory(func(*handler.ServerInfo) (contract.SSHClient, error) {
+		<-release
+		return client, nil
+	})
+
+	var fetches sync.WaitGroup
+	_, err := f.fetchServer(context.Background(), pool, &fetches, srv, cfg, nil)
+	if !errors.Is(err, domain.ErrServerUnreachable) {
+		t.Fatalf("err = %v, want ErrServerUnreachable", err)
+	}
+	close(release)
+	fetches.Wait()
+
+	if n := client.runs.Load(); n != 0 {
+		t.Errorf("timed-out fetch ran %d commands, want none", n)
+	}
+}
+
+func TestStateFetcher_FetchServers(t *testing.T) {
+	dir := t.TempDir()
+	writeDeployment(t, dir, "srv1", "api", map[string]string{".compose.yaml": "services: {}"})
+
+	cfg := &entity.Config{
+		Servers: []entity.Server{
+			{Name: "srv1", SSH: entity.ServerSSH{Host: "10.0.0.1"}},
+			{Name: "slow", SSH: entity.ServerSSH{Host: "10.0.0.2"}},
+			{Name: "down", SSH: entity.ServerSSH{Host: "10.0.0.3"}},
+		},
+		Services: []entity.BizService{
+			{Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "api:1.0"},
+			{Name: "web", ServiceBase: entity.ServiceBase{Server: "slow"}, Image: "web:1.0"},
+		},
+	}
+	release := make(chan struct{})
+	defer close(release)
+	f := NewStateFetcher("prod", dir)
+	f.SetServerTimeout(50 * time.Millisecond)
+	f.sshPool = usecase.NewSSHPoolWithFactory(func(info *handler.ServerInfo) (contract.SSHClient, error) {
+		switch info.Host {
+		case "10.0.0.2":
+			<-release
+		case "10.0.0.3":
+			return nil, fmt.Errorf("connection refused")
+		}
+		return &fakeSSHClient{runner: &fakeRunner{outputs: map[string]string{
+			"compose ls":         `[{"Name":"yo-prod-api"}]`,
+			"docker-compose.yml": "services: {}",
+		}}}, nil
+	})
+
+	state := repository.NewDeploymentState()
+	start := time.Now()
+	f.fetchServers(context.Background(), cfg, state)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("fetchServers took %s, want it bounded by the server timeout", elapsed)
+	}
+	if _, ok := state.Services["api"]; !ok {
+		t.Error("api on the reachable server should be fetched")
+	}
+	for _, name := range []string{"slow", "down"} {
+		if reason := state.Unreachable[name]; reason == "" {
+			t.Errorf("%s should be recorded as unreachable, got %v", name, state.Unreachable)
+		}
+	}
+	if _, ok := state.Unreachable["srv1"]; ok {
+		t.Error("srv1 answered and should not be unreachable")
+	}
+	if len(state.Servers) != 3 {
+		t.Errorf("servers = %v, want all configured servers", state.Servers)
+	}
+}
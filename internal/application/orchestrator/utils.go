@@ -1,8 +1,16 @@
 package orchestrator
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"os/user"
+	"time"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/ssh"
 )
 
 func hashString(s string) string {
@@ -17,6 +25,14 @@ func hashString(s string) string {
 	return fmt.Sprintf("%08x", h)
 }
 
+func dialServer(srv *entity.Server, secrets map[string]string) (*ssh.Client, error) {
+	password, err := srv.SSH.Password.Resolve(secrets)
+	if err != nil {
+		return nil, fmt.Errorf("resolve SSH password of %s: %w", srv.Name, err)
+	}
+	return ssh.NewClient(srv.SSH.Host, srv.SSH.Port, srv.SSH.User, password)
+}
+
 func readFileContent(path string) (string, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -24,3 +40,28 @@ func readFileContent(path string) (string, error) {
 	}
 	return string(data), nil
 }
+
+func newLockInfo(env, operation string) *repository.LockInfo {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return &repository.LockInfo{
+		ID:        hex.EncodeToString(id),
+		Env:       env,
+		Operation: operation,
+		Who:       currentUser(),
+		Created:   time.Now().UTC(),
+	}
+}
+
+// currentUser identifies the person running yamlops as user@host.
+func currentUser() string {
+	who := "unknown"
+	if u, err := user.Current(); err == nil {
+		who = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		who += "@" + host
+	}
+	return who
+}
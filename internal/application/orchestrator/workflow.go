@@ -3,15 +3,14 @@ package orchestrator
 import (
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
+	"time"
 
 	"github.com/lite-lake/infra-yamlops/internal/application/plan"
-	"github.com/lite-lake/infra-yamlops/internal/constants"
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
 	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
 	"github.com/lite-lake/infra-yamlops/internal/domain/service"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/logger"
 	"github.com/lite-lake/infra-yamlops/internal/infrastructure/persistence"
 	"github.com/lite-lake/infra-yamlops/internal/infrastructure/secrets"
 	"github.com/lite-lake/infra-yamlops/internal/infrastructure/state"
@@ -23,6 +22,7 @@ type Workflow struct {
 	loader       repository.ConfigLoader
 	differ       *service.DifferService
 	stateFetcher *StateFetcher
+	stateStore   repository.VersionedStateRepository
 }
 
 func NewWorkflow(env, configDir string) *Workflow {
@@ -36,6 +36,12 @@ func NewWorkflow(env, configDir string) *Workflow {
 
 func (w *Workflow) Env() string { return w.env }
 
+// SetFetchTimeout bounds how long fetching the live state of one server may
+// take; servers that exceed it are planned as unknown.
+func (w *Workflow) SetFetchTimeout(timeout time.Duration) {
+	w.stateFetcher.SetServerTimeout(timeout)
+}
+
 func (w *Workflow) LoadConfig(ctx context.Context) (*entity.Config, error) {
 	cfg, err := w.loader.Load(ctx, w.env)
 	if err != nil {
@@ -76,19 +82,45 @@ func (w *Workflow) CreatePlanner(cfg *entity.Config, outputDir string) *plan.Pla
 }
 
 func (w *Workflow) Plan(ctx context.Context, outputDir string, scope *valueobject.Scope) (*valueobject.Plan, *entity.Config, error) {
-	cfg, err := w.LoadAndValidate(ctx)
+	cfg, remoteState, err := w.Prepare(ctx, outputDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := w.PlanFromState(cfg, remoteState, outputDir, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, cfg, nil
+}
+
+func (w *Workflow) Prepare(ctx context.Context, outputDir string) (*entity.Config, *repository.DeploymentState, error) {
+	cfg, err := w.PrepareConfig(ctx, outputDir)
 	if err != nil {
 		return nil, nil, err
 	}
+	remoteState := w.FetchRemoteState(ctx, cfg)
+	return cfg, remoteState, nil
+}
+
+// PrepareConfig loads and validates the config, resolves its secrets and
+// generates the deployment files, everything Prepare does short of
+// contacting servers.
+func (w *Workflow) PrepareConfig(ctx context.Context, outputDir string) (*entity.Config, error) {
+	cfg, err := w.LoadAndValidate(ctx)
+	if err != nil {
+		return nil, err
+	}
 	if err := w.ResolveSecrets(cfg); err != nil {
-		return nil, nil, fmt.Errorf("resolve secrets: %w", err)
+		return nil, fmt.Errorf("resolve secrets: %w", err)
 	}
 
 	if err := w.GenerateDeployments(cfg, outputDir); err != nil {
-		return nil, nil, fmt.Errorf("generate deployments: %w", err)
+		return nil, fmt.Errorf("generate deployments: %w", err)
 	}
+	return cfg, nil
+}
 
-	remoteState := w.stateFetcher.Fetch(ctx, cfg)
+func (w *Workflow) PlanFromState(cfg *entity.Config, remoteState *repository.DeploymentState, outputDir string, scope *valueobject.Scope) (*valueobject.Plan, error) {
 	opts := []plan.PlannerOption{
 		plan.WithConfig(cfg),
 		plan.WithEnv(w.env),
@@ -100,9 +132,9 @@ func (w *Workflow) Plan(ctx context.Context, outputDir string, scope *valueobjec
 	planner := plan.NewPlanner(opts...)
 	p, err := planner.Plan(scope)
 	if err != nil {
-		return nil, nil, fmt.Errorf("plan: %w", err)
+		return nil, fmt.Errorf("plan: %w", err)
 	}
-	return p, cfg, nil
+	return p, nil
 }
 
 func (w *Workflow) GenerateDeployments(cfg *entity.Config, outputDir string) error {
@@ -110,48 +142,195 @@ func (w *Workflow) GenerateDeployments(cfg *entity.Config, outputDir string) err
 	return planner.GenerateDeployments()
 }
 
+// FetchRemoteState fetches the live state and fills in what cannot be
+// observed live, such as DNS records and imported services, from the
+// recorded state. DNS records under names that are neither configured nor
+// recorded are left out, so that they are not planned for deletion. The
+// result is cached for offline plans. Every command planning against the
+// live state goes through here; the TUI and drift fetch on their own and
+// leave the cache alone.
 func (w *Workflow) FetchRemoteState(ctx context.Context, cfg *entity.Config) *repository.DeploymentState {
-	return w.stateFetcher.Fetch(ctx, cfg)
+	live := w.stateFetcher.Fetch(ctx, cfg)
+	stored := w.loadRecordedState(ctx, cfg)
+	if stored != nil {
+		service.OverlayState(live, stored)
+	}
+	service.KeepManagedRecords(live, cfg.GetAllDNSRecords(), stored)
+	if err := w.cacheState(live); err != nil {
+		logger.Warn("failed to cache remote state", "error", err)
+	}
+	return live
 }
 
-func (w *Workflow) SaveState(ctx context.Context, cfg *entity.Config) error {
-	stateDir := filepath.Join(w.configDir, constants.StateDir)
-	if err := os.MkdirAll(stateDir, constants.DirPermissionOwner); err != nil {
-		return fmt.Errorf("creating state directory %s: %w", stateDir, err)
-	}
+// cacheState replaces the state offline plans are made against with st,
+// either just fetched or just recorded by an apply or destroy.
+func (w *Workflow) cacheState(st *repository.DeploymentState) error {
+	return state.SaveCache(state.CacheDir(w.configDir), w.env, st, time.Now())
+}
 
-	statePath := filepath.Join(stateDir, fmt.Sprintf(constants.StateFileFormat, w.env))
-	store := state.NewFileStore(statePath)
+// loadRecordedState returns the recorded state, or nil when it cannot be
+// read, in which case planning goes by the live state alone.
+func (w *Workflow) loadRecordedState(ctx context.Context, cfg *entity.Config) *repository.DeploymentState {
+	store, err := w.StateStore(cfg)
+	if err != nil {
+		logger.Warn("failed to open state backend, planning against live state only", "error", err)
+		return nil
+	}
+	stored, err := store.Load(ctx, w.env)
+	if err != nil {
+		logger.Warn("failed to load recorded state, planning against live state only", "error", err)
+		return nil
+	}
+	return stored
+}
 
-	state := repository.NewDeploymentState()
+// OfflineSource tells which state an offline plan was made against.
+type OfflineSource struct {
+	// Cached is set when the plan used the cache of the last remote fetch
+	// rather than the recorded state.
+	Cached bool
+	// Time is when the state was fetched or recorded; zero when unknown.
+	Time time.Time
+	// Version is the recorded state version, zero for the cache.
+	Version int
+}
 
-	for i := range cfg.Services {
-		state.Services[cfg.Services[i].Name] = &cfg.Services[i]
-	}
-	for i := range cfg.InfraServices {
-		state.InfraServices[cfg.InfraServices[i].Name] = &cfg.InfraServices[i]
+// PlanOffline plans cfg without contacting servers or DNS providers. It
+// diffs against the cached state, which every remote fetch, apply and
+// destroy refreshes, and reads the recorded state from the backend only when
+// nothing was cached, so that it works with the backend unreachable too. It
+// returns that state with its source.
+func (w *Workflow) PlanOffline(ctx context.Context, cfg *entity.Config, outputDir string, scope *valueobject.Scope) (*valueobject.Plan, *repository.DeploymentState, *OfflineSource, error) {
+	opts := []plan.PlannerOption{
+		plan.WithConfig(cfg),
+		plan.WithEnv(w.env),
 	}
-	for i := range cfg.Servers {
-		state.Servers[cfg.Servers[i].Name] = &cfg.Servers[i]
+	if outputDir != "" {
+		opts = append(opts, plan.WithOutputDir(outputDir))
 	}
-	for i := range cfg.Zones {
-		state.Zones[cfg.Zones[i].Name] = &cfg.Zones[i]
+
+	source := &OfflineSource{}
+	cached, err := state.LoadCache(state.CacheDir(w.configDir), w.env)
+	if err != nil {
+		return nil, nil, nil, err
 	}
-	for i := range cfg.Domains {
-		state.Domains[cfg.Domains[i].Name] = &cfg.Domains[i]
-		for _, r := range cfg.Domains[i].FlattenRecords() {
-			record := r
-			key := fmt.Sprintf("%s:%s:%s", record.Domain, record.Type, record.Name)
-			state.Records[key] = &record
+	var planner *plan.Planner
+	if cached != nil {
+		planner = plan.NewPlanner(opts...)
+		planner.SetState(cached.State)
+		source = &OfflineSource{Cached: true, Time: cached.FetchedAt}
+	} else {
+		store, err := w.StateStore(cfg)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		versions, err := store.History(ctx, w.env)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("read state history: %w", err)
+		}
+		if len(versions) > 0 {
+			latest := versions[len(versions)-1]
+			source.Version, source.Time = latest.Version, latest.Created
+		}
+		planner = plan.NewPlanner(append(opts, plan.WithStateRepo(store))...)
+		if err := planner.LoadState(ctx); err != nil {
+			return nil, nil, nil, fmt.Errorf("load recorded state: %w", err)
 		}
 	}
-	for i := range cfg.ISPs {
-		state.ISPs[cfg.ISPs[i].Name] = &cfg.ISPs[i]
+
+	p, err := planner.Plan(scope)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("plan: %w", err)
 	}
+	return p, planner.GetState(), source, nil
+}
 
-	if err := store.Save(ctx, w.env, state); err != nil {
-		return fmt.Errorf("saving state: %w", err)
+// PlanDestroy plans the deletion of everything deployed for the environment,
+// as observed live and recorded in the state. It fails with
+// ErrPreventDestroy when a protected resource would be deleted.
+func (w *Workflow) PlanDestroy(ctx context.Context, cfg *entity.Config) (*valueobject.Plan, error) {
+	p := service.DestroyPlan(w.FetchRemoteState(ctx, cfg), cfg, w.env)
+	if err := service.CheckPreventDestroy(p); err != nil {
+		return nil, err
 	}
+	return p, nil
+}
 
+// ClearState saves an empty state as a new version, so that the destroyed
+// environment can still be inspected and rolled back through the history.
+func (w *Workflow) ClearState(ctx context.Context, cfg *entity.Config, meta *repository.StateVersion) error {
+	store, err := w.StateStore(cfg)
+	if err != nil {
+		return err
+	}
+	cleared := repository.NewDeploymentState()
+	if err := store.SaveVersion(ctx, w.env, cleared, meta); err != nil {
+		return err
+	}
+	if err := w.cacheState(cleared); err != nil {
+		logger.Warn("failed to cache cleared state", "error", err)
+	}
 	return nil
 }
+
+// DetectDrift compares the live servers and DNS providers with the desired
+// config of the environment.
+func (w *Workflow) DetectDrift(ctx context.Context, filter DriftFilter) (*DriftReport, error) {
+	cfg, err := w.LoadAndValidate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.ResolveSecrets(cfg); err != nil {
+		return nil, fmt.Errorf("resolve secrets: %w", err)
+	}
+	if err := w.GenerateDeployments(cfg, ""); err != nil {
+		return nil, fmt.Errorf("generate deployments: %w", err)
+	}
+	return NewDriftDetector(w.env, w.configDir).Detect(ctx, cfg, filter), nil
+}
+
+// StateStore returns the store configured by the backend of cfg. The store is
+// created once so that a lock taken through it also covers later saves.
+func (w *Workflow) StateStore(cfg *entity.Config) (repository.VersionedStateRepository, error) {
+	if w.stateStore != nil {
+		return w.stateStore, nil
+	}
+	store, err := state.NewStore(cfg.Backend, w.configDir, w.env, cfg.GetSecretsMap())
+	if err != nil {
+		return nil, fmt.Errorf("open state backend: %w", err)
+	}
+	w.stateStore = store
+	return store, nil
+}
+
+// UseStateStore makes the workflow keep state in store rather than in the
+// backend configured by the config.
+func (w *Workflow) UseStateStore(store repository.VersionedStateRepository) {
+	w.stateStore = store
+}
+
+// LockState locks the state for operation and returns the function releasing
+// the lock. It fails with ErrStateLocked when someone else holds the lock.
+func (w *Workflow) LockState(ctx context.Context, cfg *entity.Config, operation string) (func() error, error) {
+	store, err := w.StateStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	info := newLockInfo(w.env, operation)
+	if err := store.Lock(ctx, w.env, info); err != nil {
+		return nil, err
+	}
+	return func() error {
+		return store.Unlock(context.WithoutCancel(ctx), w.env, info)
+	}, nil
+}
+
+// NewStateVersion describes a state saved by the current user for operation.
+// plan names the plan file the operation applied, if any.
+func (w *Workflow) NewStateVersion(operation, plan string) *repository.StateVersion {
+	return &repository.StateVersion{
+		Who:       currentUser(),
+		Operation: operation,
+		Plan:      plan,
+	}
+}
@@ -0,0 +1,63 @@
+package orchestrator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/state"
+)
+
+func TestWorkflow_PlanOffline(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := &entity.Config{Services: []entity.BizService{
+		{Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "api:2.0"},
+	}}
+	stateWith := func(image string) *repository.DeploymentState {
+		st := repository.NewDeploymentState()
+		st.Services["api"] = &entity.BizService{Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: image}
+		return st
+	}
+
+	w := NewWorkflow("prod", dir)
+	p, _, src, err := w.PlanOffline(ctx, cfg, "", nil)
+	if err != nil {
+		t.Fatalf("PlanOffline() without state error = %v", err)
+	}
+	if src.Cached || src.Version != 0 || len(p.Changes()) != 1 {
+		t.Errorf("without state: source = %+v, changes = %d", src, len(p.Changes()))
+	}
+
+	store, _ := w.StateStore(cfg)
+	if err := store.SaveVersion(ctx, "prod", stateWith("api:1.0"), &repository.StateVersion{Operation: "apply"}); err != nil {
+		t.Fatal(err)
+	}
+	p, _, src, err = w.PlanOffline(ctx, cfg, "", nil)
+	if err != nil {
+		t.Fatalf("PlanOffline() error = %v", err)
+	}
+	if src.Cached || src.Version != 1 {
+		t.Errorf("without cache: source = %+v, want recorded version 1", src)
+	}
+	if !p.HasChanges() {
+		t.Error("without cache: plan against recorded api:1.0 should update api")
+	}
+
+	if err := state.SaveCache(state.CacheDir(dir), "prod", stateWith("api:2.0"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Backend = &entity.StateBackend{Type: entity.StateBackendHTTP, Address: "http://127.0.0.1:1"}
+	p, _, src, err = NewWorkflow("prod", dir).PlanOffline(ctx, cfg, "", nil)
+	if err != nil {
+		t.Fatalf("PlanOffline() with the backend unreachable error = %v", err)
+	}
+	if !src.Cached || src.Version != 0 {
+		t.Errorf("with cache: source = %+v, want cache", src)
+	}
+	if p.HasChanges() {
+		t.Errorf("with cache: plan against cached api:2.0 has changes %v", p.Changes())
+	}
+}
@@ -2,6 +2,7 @@ package plan
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/lite-lake/infra-yamlops/internal/application/deployment"
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
@@ -99,9 +100,44 @@ func (p *Planner) Plan(scope *valueobject.Scope) (*valueobject.Plan, error) {
 		p.differService.PlanInfraServices(plan, p.config.GetInfraServiceMap(), p.config.GetServerMap(), scope)
 	}
 
+	if len(scope.Targets()) > 0 {
+		var err error
+		if plan, err = p.selectTargets(plan, scope); err != nil {
+			return nil, err
+		}
+	}
+	if err := service.CheckPreventDestroy(plan); err != nil {
+		return nil, err
+	}
 	return plan, nil
 }
 
+// selectTargets keeps the changes addressed by the scope's targets.
+func (p *Planner) selectTargets(plan *valueobject.Plan, scope *valueobject.Scope) (*valueobject.Plan, error) {
+	refs := make([]service.EntityRef, 0, len(scope.Targets()))
+	for _, t := range scope.Targets() {
+		ref, err := service.ParseEntityRef(t)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", t, err)
+		}
+		refs = append(refs, ref)
+	}
+	if err := service.CheckTargets(refs, service.TargetRefs(p.config, p.differService.GetState())); err != nil {
+		return nil, err
+	}
+	selected := service.SelectTargets(plan.Changes(), service.NewDependencyIndex(p.config), refs,
+		scope.TargetDependencies(), scope.TargetDependents())
+
+	targeted := valueobject.NewPlanWithScope(scope)
+	for _, ch := range selected {
+		targeted.AddChange(ch)
+	}
+	for _, u := range plan.Unknown() {
+		targeted.AddUnknown(u)
+	}
+	return targeted, nil
+}
+
 func (p *Planner) GenerateDeployments() error {
 	return p.deployGen.Generate(p.config)
 }
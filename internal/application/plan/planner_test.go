@@ -1,8 +1,11 @@
 package plan
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
+	"github.com/lite-lake/infra-yamlops/internal/domain"
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
 )
@@ -93,6 +96,67 @@ func TestPlanner_Plan_WithScope(t *testing.T) {
 	}
 }
 
+func TestPlanner_Plan_WithTargets(t *testing.T) {
+	cfg := &entity.Config{
+		ISPs: []entity.ISP{
+			{Name: "isp1", Type: "cloudflare", Services: []entity.ISPService{"server"}},
+		},
+		Zones: []entity.Zone{
+			{Name: "zone1", ISP: "isp1"},
+			{Name: "zone2", ISP: "isp1"},
+		},
+	}
+	planner := NewPlanner(WithConfig(cfg), WithEnv("dev"))
+
+	plan, err := planner.Plan(valueobject.NewScope().WithTargets([]string{"zone:zone2"}, false, false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Changes()) != 1 || plan.Changes()[0].Name() != "zone2" {
+		t.Errorf("expected only zone2, got %d changes", len(plan.Changes()))
+	}
+
+	plan, err = planner.Plan(valueobject.NewScope().WithTargets([]string{"zone:zone2"}, true, false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Changes()) != 2 || plan.Changes()[0].Entity() != "isp" {
+		t.Errorf("expected isp1 and zone2, got %d changes", len(plan.Changes()))
+	}
+
+	if _, err := planner.Plan(valueobject.NewScope().WithTargets([]string{"zone2"}, false, false)); err == nil {
+		t.Error("expected an error for a target without entity")
+	}
+
+	_, err = planner.Plan(valueobject.NewScope().WithTargets([]string{"zone:nope"}, false, false))
+	if !errors.Is(err, domain.ErrUnknownTarget) || !strings.Contains(err.Error(), "zone:zone1, zone:zone2") {
+		t.Errorf("expected ErrUnknownTarget listing the zones, got %v", err)
+	}
+}
+
+func TestPlanner_Plan_PreventDestroy(t *testing.T) {
+	protected := entity.ServiceBase{Server: "srv1", Lifecycle: entity.Lifecycle{PreventDestroy: true}}
+	st := &DeploymentState{
+		Services: map[string]*entity.BizService{"db": {Name: "db", ServiceBase: protected, Image: "postgres:16"}},
+	}
+	planner := NewPlanner(WithConfig(&entity.Config{}), WithEnv("prod"), WithState(st))
+
+	_, err := planner.Plan(nil)
+	if !errors.Is(err, domain.ErrPreventDestroy) || !strings.Contains(err.Error(), "service:db") {
+		t.Fatalf("expected ErrPreventDestroy naming service:db, got %v", err)
+	}
+
+	cfg := &entity.Config{Services: []entity.BizService{{Name: "db", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "postgres:16"}}}
+	planner = NewPlanner(WithConfig(cfg), WithEnv("prod"), WithState(st))
+	plan, err := planner.Plan(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Changes()) != 1 || plan.Changes()[0].Actions()[0] != "record lifecycle of service db" {
+		t.Errorf("expected a lifecycle-only change, got %+v", plan.Changes())
+	}
+}
+
 func TestPlanner_SetOutputDir(t *testing.T) {
 	cfg := &entity.Config{}
 	planner := NewPlanner(WithConfig(cfg), WithEnv("dev"))
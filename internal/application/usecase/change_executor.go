@@ -5,7 +5,9 @@ import (
 	"fmt"
 
 	"github.com/lite-lake/infra-yamlops/internal/application/handler"
+	domainerr "github.com/lite-lake/infra-yamlops/internal/domain"
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
 	infra "github.com/lite-lake/infra-yamlops/internal/infrastructure/dns"
 	"github.com/lite-lake/infra-yamlops/internal/infrastructure/logger"
@@ -18,6 +20,14 @@ type ChangeExecutorConfig struct {
 	Env        string
 }
 
+// ChangeObserver is told when a change starts and when its result is known,
+// including changes skipped because a prerequisite failed. Calls are made
+// one at a time from the scheduler, never concurrently.
+type ChangeObserver interface {
+	ChangeStarted(ch *valueobject.Change)
+	ChangeFinished(result *handler.Result)
+}
+
 type ChangeExecutor struct {
 	plan           *valueobject.Plan
 	sshPool        SSHPoolInterface
@@ -29,6 +39,9 @@ type ChangeExecutor struct {
 	isps           map[string]*entity.ISP
 	workDir        string
 	dnsFactory     DNSFactoryInterface
+	depIndex       *service.DependencyIndex
+	parallelism    int
+	observer       ChangeObserver
 }
 
 func NewChangeExecutor(cfg *ChangeExecutorConfig) *ChangeExecutor {
@@ -56,6 +69,8 @@ func NewChangeExecutor(cfg *ChangeExecutorConfig) *ChangeExecutor {
 		env:            cfg.Env,
 		workDir:        ".",
 		dnsFactory:     cfg.DNSFactory,
+		depIndex:       service.NewDependencyIndex(nil),
+		parallelism:    1,
 	}
 }
 
@@ -64,6 +79,16 @@ func (e *ChangeExecutor) SetDomains(d map[string]*entity.Domain)        { e.doma
 func (e *ChangeExecutor) SetISPs(i map[string]*entity.ISP)              { e.isps = i }
 func (e *ChangeExecutor) SetWorkDir(w string)                           { e.workDir = w }
 func (e *ChangeExecutor) SetServerEntities(s map[string]*entity.Server) { e.serverEntities = s }
+func (e *ChangeExecutor) SetConfig(cfg *entity.Config)                  { e.depIndex = service.NewDependencyIndex(cfg) }
+
+func (e *ChangeExecutor) SetObserver(o ChangeObserver) { e.observer = o }
+
+func (e *ChangeExecutor) SetParallelism(n int) {
+	if n < 1 {
+		n = 1
+	}
+	e.parallelism = n
+}
 
 func (e *ChangeExecutor) RegisterServer(name, host string, port int, user, password string) {
 	e.servers[name] = &handler.ServerInfo{Host: host, Port: port, User: user, Password: password}
@@ -75,16 +100,8 @@ func (e *ChangeExecutor) Apply(registry handlerRegistry) []*handler.Result {
 
 	log.Info("starting apply", "changes", len(e.plan.Changes()))
 
-	results := make([]*handler.Result, 0, len(e.plan.Changes()))
-	for i, ch := range e.plan.Changes() {
-		log.Debug("applying change",
-			"index", i+1,
-			"type", ch.Type(),
-			"entity", ch.Entity(),
-			"name", ch.Name(),
-		)
-		results = append(results, e.applyChange(ctx, ch, registry))
-	}
+	graph := service.NewChangeGraph(e.plan.Changes(), e.depIndex)
+	results := e.schedule(ctx, graph, registry)
 
 	successCount := 0
 	failedCount := 0
@@ -106,9 +123,151 @@ func (e *ChangeExecutor) Apply(registry handlerRegistry) []*handler.Result {
 	return results
 }
 
+type changeDone struct {
+	index  int
+	result *handler.Result
+}
+
+// schedule runs the graph with up to e.parallelism changes in flight. Changes
+// on the same server (and all changes not bound to a server) keep their graph
+// order; results are returned in that order regardless of completion order.
+func (e *ChangeExecutor) schedule(ctx context.Context, graph *service.ChangeGraph, registry handlerRegistry) []*handler.Result {
+	log := logger.FromContext(ctx)
+	order := graph.Ordered()
+
+	index := make(map[*valueobject.Change]int, len(order))
+	prevInLane := make([]int, len(order))
+	lastInLane := make(map[string]int)
+	for i, ch := range order {
+		index[ch] = i
+		lane := handler.ExtractServerFromChange(ch)
+		if prev, ok := lastInLane[lane]; ok {
+			prevInLane[i] = prev
+		} else {
+			prevInLane[i] = -1
+		}
+		lastInLane[lane] = i
+	}
+
+	results := make([]*handler.Result, len(order))
+	started := make([]bool, len(order))
+	finished := make([]bool, len(order))
+	failed := make(map[*valueobject.Change]bool)
+	doneCh := make(chan changeDone)
+	running, completed := 0, 0
+
+	ready := func(i int) bool {
+		if p := prevInLane[i]; p >= 0 && !finished[p] {
+			return false
+		}
+		for _, prereq := range graph.Prerequisites(order[i]) {
+			if !finished[index[prereq]] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for completed < len(order) {
+		for i, ch := range order {
+			if running >= e.parallelism {
+				break
+			}
+			if started[i] || !ready(i) {
+				continue
+			}
+			started[i] = true
+			if prereq := failedPrerequisite(graph, ch, failed); prereq != nil {
+				log.Warn("skipping change, prerequisite failed",
+					"entity", ch.Entity(),
+					"name", ch.Name(),
+					"prerequisite", prereq.Entity()+":"+prereq.Name(),
+				)
+				failed[ch] = true
+				results[i] = &handler.Result{
+					Change: ch,
+					Error:  fmt.Errorf("%w: %s %s", domainerr.ErrDependencyFailed, prereq.Entity(), prereq.Name()),
+				}
+				e.notifyFinished(results[i])
+				finished[i] = true
+				completed++
+				continue
+			}
+			log.Debug("applying change",
+				"index", i+1,
+				"type", ch.Type(),
+				"entity", ch.Entity(),
+				"name", ch.Name(),
+			)
+			running++
+			e.notifyStarted(ch)
+			go func(i int, ch *valueobject.Change) {
+				doneCh <- changeDone{index: i, result: e.applyChange(ctx, ch, registry)}
+			}(i, ch)
+		}
+
+		if running == 0 {
+			if completed < len(order) {
+				// Only reachable if the graph fell back on a cycle; run the next
+				// change in order rather than stall.
+				for i := range order {
+					if !started[i] {
+						started[i] = true
+						running++
+						e.notifyStarted(order[i])
+						go func(i int, ch *valueobject.Change) {
+							doneCh <- changeDone{index: i, result: e.applyChange(ctx, ch, registry)}
+						}(i, order[i])
+						break
+					}
+				}
+			}
+			if running == 0 {
+				break
+			}
+		}
+
+		d := <-doneCh
+		running--
+		completed++
+		finished[d.index] = true
+		results[d.index] = d.result
+		e.notifyFinished(d.result)
+		if d.result.Error != nil || !d.result.Success {
+			failed[order[d.index]] = true
+		}
+	}
+	return results
+}
+
+func (e *ChangeExecutor) notifyStarted(ch *valueobject.Change) {
+	if e.observer != nil {
+		e.observer.ChangeStarted(ch)
+	}
+}
+
+func (e *ChangeExecutor) notifyFinished(result *handler.Result) {
+	if e.observer != nil {
+		e.observer.ChangeFinished(result)
+	}
+}
+
+func failedPrerequisite(graph *service.ChangeGraph, ch *valueobject.Change, failed map[*valueobject.Change]bool) *valueobject.Change {
+	for _, prereq := range graph.Prerequisites(ch) {
+		if failed[prereq] {
+			return prereq
+		}
+	}
+	return nil
+}
+
 func (e *ChangeExecutor) applyChange(ctx context.Context, ch *valueobject.Change, registry handlerRegistry) *handler.Result {
 	log := logger.FromContext(ctx)
 
+	if service.LifecycleOnly(ch) {
+		return &handler.Result{Change: ch, Success: true, Output: "lifecycle recorded in state"}
+	}
+
 	h, ok := registry.Get(ch.Entity())
 	if !ok {
 		log.Error("no handler found", "entity", ch.Entity())
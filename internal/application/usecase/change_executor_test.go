@@ -0,0 +1,200 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lite-lake/infra-yamlops/internal/application/handler"
+	domainerr "github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+type recordingHandler struct {
+	entityType string
+	fail       map[string]bool
+	delay      time.Duration
+
+	mu        sync.Mutex
+	running   int
+	maxActive int
+	applied   []string
+}
+
+func (h *recordingHandler) EntityType() string { return h.entityType }
+
+func (h *recordingHandler) Apply(ctx context.Context, ch *valueobject.Change, deps handler.DepsProvider) (*handler.Result, error) {
+	h.mu.Lock()
+	h.running++
+	if h.running > h.maxActive {
+		h.maxActive = h.running
+	}
+	h.mu.Unlock()
+
+	time.Sleep(h.delay)
+
+	h.mu.Lock()
+	h.running--
+	h.applied = append(h.applied, ch.Name())
+	h.mu.Unlock()
+
+	if h.fail[ch.Name()] {
+		return nil, errors.New("boom")
+	}
+	return &handler.Result{Change: ch, Success: true}, nil
+}
+
+func newServiceChange(name, server string) *valueobject.Change {
+	return valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "service", name, nil,
+		&entity.BizService{Name: name, ServiceBase: entity.ServiceBase{Server: server}}, nil, false)
+}
+
+func TestChangeExecutor_ParallelAcrossServers(t *testing.T) {
+	plan := valueobject.NewPlan()
+	for _, c := range []struct{ name, server string }{
+		{"a1", "srv-a"}, {"a2", "srv-a"},
+		{"b1", "srv-b"}, {"b2", "srv-b"},
+		{"c1", "srv-c"}, {"c2", "srv-c"},
+	} {
+		plan.AddChange(newServiceChange(c.name, c.server))
+	}
+
+	h := &recordingHandler{entityType: "service", delay: 20 * time.Millisecond}
+	registry := handler.NewRegistry()
+	registry.Register(h)
+
+	executor := NewChangeExecutor(&ChangeExecutorConfig{Plan: plan})
+	executor.SetParallelism(3)
+	results := executor.Apply(registry)
+
+	expected := []string{"a1", "a2", "b1", "b2", "c1", "c2"}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(results))
+	}
+	for i, r := range results {
+		if r.Change.Name() != expected[i] {
+			t.Errorf("result %d = %s, expected %s", i, r.Change.Name(), expected[i])
+		}
+		if !r.Success {
+			t.Errorf("expected %s to succeed, got %v", r.Change.Name(), r.Error)
+		}
+	}
+
+	if h.maxActive < 2 || h.maxActive > 3 {
+		t.Errorf("expected between 2 and 3 concurrent changes, got %d", h.maxActive)
+	}
+
+	pos := make(map[string]int)
+	for i, name := range h.applied {
+		pos[name] = i
+	}
+	for _, pair := range [][2]string{{"a1", "a2"}, {"b1", "b2"}, {"c1", "c2"}} {
+		if pos[pair[0]] > pos[pair[1]] {
+			t.Errorf("expected %s to be applied before %s, got %v", pair[0], pair[1], h.applied)
+		}
+	}
+}
+
+func TestChangeExecutor_Sequential(t *testing.T) {
+	plan := valueobject.NewPlan()
+	plan.AddChange(newServiceChange("a1", "srv-a"))
+	plan.AddChange(newServiceChange("b1", "srv-b"))
+
+	h := &recordingHandler{entityType: "service", delay: 5 * time.Millisecond}
+	registry := handler.NewRegistry()
+	registry.Register(h)
+
+	executor := NewChangeExecutor(&ChangeExecutorConfig{Plan: plan})
+	executor.Apply(registry)
+
+	if h.maxActive != 1 {
+		t.Errorf("expected sequential apply by default, got %d concurrent", h.maxActive)
+	}
+}
+
+func TestChangeExecutor_SkipsDependents(t *testing.T) {
+	plan := valueobject.NewPlan()
+	plan.AddChange(newServiceChange("api", "srv-a"))
+	plan.AddChange(newServiceChange("web", "srv-b"))
+	plan.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "server", "srv-a", nil,
+		&entity.Server{Name: "srv-a"}, nil, false))
+
+	services := &recordingHandler{entityType: "service"}
+	servers := &recordingHandler{entityType: "server", fail: map[string]bool{"srv-a": true}}
+	registry := handler.NewRegistry()
+	registry.Register(services)
+	registry.Register(servers)
+
+	executor := NewChangeExecutor(&ChangeExecutorConfig{Plan: plan})
+	executor.SetParallelism(4)
+	results := executor.Apply(registry)
+
+	byName := make(map[string]*handler.Result)
+	for _, r := range results {
+		byName[r.Change.Name()] = r
+	}
+	if byName["srv-a"].Error == nil {
+		t.Error("expected server change to fail")
+	}
+	if !errors.Is(byName["api"].Error, domainerr.ErrDependencyFailed) {
+		t.Errorf("expected api to be skipped, got %v", byName["api"].Error)
+	}
+	if !byName["web"].Success {
+		t.Errorf("expected unrelated service to succeed, got %v", byName["web"].Error)
+	}
+	for _, name := range services.applied {
+		if name == "api" {
+			t.Error("expected skipped change not to reach its handler")
+		}
+	}
+}
+
+type recordingObserver struct {
+	events []string
+}
+
+func (o *recordingObserver) ChangeStarted(ch *valueobject.Change) {
+	o.events = append(o.events, "start "+ch.Name())
+}
+
+func (o *recordingObserver) ChangeFinished(result *handler.Result) {
+	outcome := "ok"
+	switch {
+	case errors.Is(result.Error, domainerr.ErrDependencyFailed):
+		outcome = "skipped"
+	case result.Error != nil:
+		outcome = "failed"
+	}
+	o.events = append(o.events, outcome+" "+result.Change.Name())
+}
+
+func TestChangeExecutor_Observer(t *testing.T) {
+	plan := valueobject.NewPlan()
+	plan.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "server", "srv-a", nil,
+		&entity.Server{Name: "srv-a"}, nil, false))
+	plan.AddChange(newServiceChange("api", "srv-a"))
+	plan.AddChange(newServiceChange("web", "srv-b"))
+
+	registry := handler.NewRegistry()
+	registry.Register(&recordingHandler{entityType: "service"})
+	registry.Register(&recordingHandler{entityType: "server", fail: map[string]bool{"srv-a": true}})
+
+	observer := &recordingObserver{}
+	executor := NewChangeExecutor(&ChangeExecutorConfig{Plan: plan})
+	executor.SetObserver(observer)
+	executor.Apply(registry)
+
+	want := []string{"start srv-a", "failed srv-a", "skipped api", "start web", "ok web"}
+	if len(observer.events) != len(want) {
+		t.Fatalf("events = %v, want %v", observer.events, want)
+	}
+	for i := range want {
+		if observer.events[i] != want[i] {
+			t.Errorf("events = %v, want %v", observer.events, want)
+			break
+		}
+	}
+}
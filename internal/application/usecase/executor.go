@@ -97,6 +97,18 @@ func (e *Executor) SetServerEntities(s map[string]*entity.Server) {
 	e.changeExecutor.SetServerEntities(s)
 }
 
+func (e *Executor) SetConfig(cfg *entity.Config) {
+	e.changeExecutor.SetConfig(cfg)
+}
+
+func (e *Executor) SetParallelism(n int) {
+	e.changeExecutor.SetParallelism(n)
+}
+
+func (e *Executor) SetObserver(o ChangeObserver) {
+	e.changeExecutor.SetObserver(o)
+}
+
 func (e *Executor) RegisterServer(name, host string, port int, user, password string) {
 	e.changeExecutor.RegisterServer(name, host, port, user, password)
 }
@@ -43,17 +43,19 @@ func (p *SSHPool) Get(info *handler.ServerInfo) (contract.SSHClient, error) {
 	}
 	p.mu.RUnlock()
 
-	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	if client, ok := p.clients[key]; ok {
-		return client, nil
-	}
-
+	// Dial without holding the lock so that a slow server does not hold up
+	// connections to the others.
 	client, err := p.factory(info)
 	if err != nil {
 		return nil, err
 	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if existing, ok := p.clients[key]; ok {
+		client.Close()
+		return existing, nil
+	}
 	p.clients[key] = client
 	return client, nil
 }
@@ -10,6 +10,7 @@ const (
 	ServicePrefixFormat = "yo-%s-%s"
 	StateDir            = ".state"
 	StateFileFormat     = "%s.yaml"
+	PlanFileVersion     = 1
 )
 
 const (
@@ -24,6 +25,9 @@ const (
 	ComposeVersion       = "3.8"
 	DefaultRestartPolicy = "unless-stopped"
 	DefaultHealthRetries = 3
+	// CrashLoopRestarts is the restart count from which a running container
+	// is considered crash-looping and gets recreated.
+	CrashLoopRestarts = 5
 )
 
 const (
@@ -44,6 +48,8 @@ const (
 	DefaultSSHRetryAttempts        = 3
 	DefaultSSHRetryInitialDelaySec = 1
 	DefaultSSHRetryMaxDelaySec     = 30
+	DefaultStateFetchTimeoutSec    = 60
+	DefaultStateHistoryKeep        = 100
 
 	DefaultRetryMaxAttempts    = 3
 	DefaultRetryInitialDelayMs = 100
@@ -71,6 +77,7 @@ var (
 	DefaultSSHTimeout           = DefaultSSHTimeoutSec * time.Second
 	DefaultSSHRetryInitialDelay = DefaultSSHRetryInitialDelaySec * time.Second
 	DefaultSSHRetryMaxDelay     = DefaultSSHRetryMaxDelaySec * time.Second
+	DefaultStateFetchTimeout    = DefaultStateFetchTimeoutSec * time.Second
 	DefaultRetryInitialDelay    = DefaultRetryInitialDelayMs * time.Millisecond
 	DefaultRetryMaxDelay        = DefaultRetryMaxDelaySec * time.Second
 	DefaultDNSRetryInitialDelay = DefaultDNSRetryInitialDelayMs * time.Millisecond
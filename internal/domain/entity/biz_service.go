@@ -11,8 +11,11 @@ import (
 )
 
 type ServiceBase struct {
-	Server   string   `yaml:"server"`
-	Networks []string `yaml:"networks,omitempty"`
+	Server    string    `yaml:"server"`
+	Networks  []string  `yaml:"networks,omitempty"`
+	Lifecycle Lifecycle `yaml:"lifecycle,omitempty"`
+	// Runtime is only set on services fetched from a server.
+	Runtime *ServiceRuntime `yaml:"-" json:"-"`
 }
 
 func (s *ServiceBase) GetServer() string {
@@ -137,6 +140,10 @@ type BizService struct {
 	Volumes     []ServiceVolume                  `yaml:"volumes,omitempty"`
 	Gateways    []ServiceGatewayRoute            `yaml:"gateways,omitempty"`
 	Internal    bool                             `yaml:"internal,omitempty"`
+	// AdoptedContainer is only set in state, on a service adopted by import
+	// that yamlops has not deployed yet: the container it was found running
+	// in, which its first deploy removes.
+	AdoptedContainer string `yaml:"-"`
 }
 
 type bizServiceAlias BizService
@@ -156,6 +163,9 @@ func (s *BizService) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		Volumes     []ServiceVolume                  `yaml:"volumes,omitempty"`
 		Gateways    []ServiceGatewayRoute            `yaml:"gateways,omitempty"`
 		Internal    bool                             `yaml:"internal,omitempty"`
+		Lifecycle   Lifecycle                        `yaml:"lifecycle,omitempty"`
+
+		AdoptedContainer string `yaml:"adopted_container,omitempty"`
 	}
 	if err := unmarshal(&raw); err != nil {
 		return err
@@ -174,11 +184,13 @@ func (s *BizService) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	s.Volumes = raw.Volumes
 	s.Gateways = raw.Gateways
 	s.Internal = raw.Internal
+	s.ServiceBase.Lifecycle = raw.Lifecycle
+	s.AdoptedContainer = raw.AdoptedContainer
 
 	return nil
 }
 
-func (s *BizService) MarshalYAML() (interface{}, error) {
+func (s BizService) MarshalYAML() (interface{}, error) {
 	return struct {
 		Name        string                           `yaml:"name"`
 		Server      string                           `yaml:"server"`
@@ -193,6 +205,9 @@ func (s *BizService) MarshalYAML() (interface{}, error) {
 		Volumes     []ServiceVolume                  `yaml:"volumes,omitempty"`
 		Gateways    []ServiceGatewayRoute            `yaml:"gateways,omitempty"`
 		Internal    bool                             `yaml:"internal,omitempty"`
+		Lifecycle   Lifecycle                        `yaml:"lifecycle,omitempty"`
+
+		AdoptedContainer string `yaml:"adopted_container,omitempty"`
 	}{
 		Name:        s.Name,
 		Server:      s.ServiceBase.Server,
@@ -207,6 +222,9 @@ func (s *BizService) MarshalYAML() (interface{}, error) {
 		Volumes:     s.Volumes,
 		Gateways:    s.Gateways,
 		Internal:    s.Internal,
+		Lifecycle:   s.ServiceBase.Lifecycle,
+
+		AdoptedContainer: s.AdoptedContainer,
 	}, nil
 }
 
@@ -220,6 +238,9 @@ func (s *BizService) Validate() error {
 	if s.Image == "" {
 		return domain.RequiredField("image")
 	}
+	if s.AdoptedContainer != "" {
+		return fmt.Errorf("%w: adopted_container is recorded in state by import and cannot be configured", domain.ErrInvalidFormat)
+	}
 	for i, port := range s.Ports {
 		if err := port.Validate(); err != nil {
 			return fmt.Errorf("port %d: %w", i, err)
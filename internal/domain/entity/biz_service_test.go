@@ -2,8 +2,11 @@ package entity
 
 import (
 	"errors"
+	"strings"
 	"testing"
 
+	"gopkg.in/yaml.v3"
+
 	"github.com/lite-lake/infra-yamlops/internal/domain"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
 )
@@ -359,3 +362,48 @@ func TestBizService_GetServer(t *testing.T) {
 		t.Errorf("GetServer() = %v, want my-server", got)
 	}
 }
+
+func TestServiceCodecs_Lifecycle(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		service   interface{}
+		lifecycle func(interface{}) Lifecycle
+	}{
+		{
+			name:      "biz service",
+			input:     "name: api\nserver: srv1\nlifecycle: {prevent_destroy: true}\n",
+			service:   &BizService{},
+			lifecycle: func(s interface{}) Lifecycle { return s.(*BizService).Lifecycle },
+		},
+		{
+			name:      "gateway infra service",
+			input:     "name: gw\ntype: gateway\nserver: srv1\nlifecycle: {prevent_destroy: true}\n",
+			service:   &InfraService{},
+			lifecycle: func(s interface{}) Lifecycle { return s.(*InfraService).Lifecycle },
+		},
+		{
+			name:      "ssl infra service",
+			input:     "name: ssl\ntype: ssl\nserver: srv1\nlifecycle: {prevent_destroy: true}\n",
+			service:   &InfraService{},
+			lifecycle: func(s interface{}) Lifecycle { return s.(*InfraService).Lifecycle },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := yaml.Unmarshal([]byte(tt.input), tt.service); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !tt.lifecycle(tt.service).PreventDestroy {
+				t.Error("Unmarshal() dropped lifecycle")
+			}
+			data, err := yaml.Marshal(tt.service)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if !strings.Contains(string(data), "prevent_destroy: true") {
+				t.Errorf("Marshal() dropped lifecycle:\n%s", data)
+			}
+		})
+	}
+}
@@ -17,51 +17,77 @@ type Config struct {
 	InfraServices []InfraService `yaml:"infra_services,omitempty"`
 	Services      []BizService   `yaml:"services,omitempty"`
 	Domains       []Domain       `yaml:"domains,omitempty"`
+	Backend       *StateBackend  `yaml:"backend,omitempty"`
+	Policies      []Policy       `yaml:"policies,omitempty"`
+	// Sources locates the entities in the config files, see SourceKey. It
+	// is set by the config loader.
+	Sources map[string]Source `yaml:"-" json:"-"`
 }
 
 func (c *Config) Validate() error {
+	var errs domain.ValidationErrors
 	for i, s := range c.Secrets {
 		if err := s.Validate(); err != nil {
-			return fmt.Errorf("secrets[%d]: %w", i, err)
+			errs = append(errs, c.ValidationError("secrets", nameOr(s.Name, i), "", fmt.Errorf("secrets[%d]: %w", i, err)))
 		}
 	}
 	for i, isp := range c.ISPs {
 		if err := isp.Validate(); err != nil {
-			return fmt.Errorf("isps[%d]: %w", i, err)
+			errs = append(errs, c.ValidationError("isps", nameOr(isp.Name, i), "", fmt.Errorf("isps[%d]: %w", i, err)))
 		}
 	}
 	for i, r := range c.Registries {
 		if err := r.Validate(); err != nil {
-			return fmt.Errorf("registries[%d]: %w", i, err)
+			errs = append(errs, c.ValidationError("registries", nameOr(r.Name, i), "", fmt.Errorf("registries[%d]: %w", i, err)))
 		}
 	}
 	for i, z := range c.Zones {
 		if err := z.Validate(); err != nil {
-			return fmt.Errorf("zones[%d]: %w", i, err)
+			errs = append(errs, c.ValidationError("zones", nameOr(z.Name, i), "", fmt.Errorf("zones[%d]: %w", i, err)))
 		}
 	}
 	for i, s := range c.Servers {
 		if err := s.Validate(); err != nil {
-			return fmt.Errorf("servers[%d]: %w", i, err)
+			errs = append(errs, c.ValidationError("servers", nameOr(s.Name, i), "", fmt.Errorf("servers[%d]: %w", i, err)))
 		}
 	}
 	for i, infra := range c.InfraServices {
 		if err := infra.Validate(); err != nil {
-			return fmt.Errorf("infra_services[%d]: %w", i, err)
+			errs = append(errs, c.ValidationError("infra_services", nameOr(infra.Name, i), "", fmt.Errorf("infra_services[%d]: %w", i, err)))
 		}
 	}
 
 	for i, s := range c.Services {
 		if err := s.Validate(); err != nil {
-			return fmt.Errorf("services[%d]: %w", i, err)
+			errs = append(errs, c.ValidationError("services", nameOr(s.Name, i), "", fmt.Errorf("services[%d]: %w", i, err)))
 		}
 	}
 	for i, d := range c.Domains {
 		if err := d.Validate(); err != nil {
-			return fmt.Errorf("domains[%d]: %w", i, err)
+			errs = append(errs, c.ValidationError("domains", nameOr(d.Name, i), "", fmt.Errorf("domains[%d]: %w", i, err)))
 		}
 	}
-	return nil
+	if c.Backend != nil {
+		if err := c.Backend.Validate(); err != nil {
+			errs = append(errs, c.ValidationError("backend", "", "", fmt.Errorf("backend: %w", err)))
+		}
+	}
+	for i, p := range c.Policies {
+		if err := p.Validate(); err != nil {
+			errs = append(errs, c.ValidationError("policies", nameOr(p.Name, i), "", fmt.Errorf("policies[%d]: %w", i, err)))
+		}
+	}
+	return errs.Err()
+}
+
+// ValidationError positions err, found validating field of the named entity
+// of section, at its source when known.
+func (c *Config) ValidationError(section, name, field string, err error) *domain.ValidationError {
+	verr := &domain.ValidationError{Err: err}
+	if src, ok := c.SourceOf(section, name, field); ok {
+		verr.File, verr.Line, verr.Column = src.File, src.Line, src.Column
+	}
+	return verr
 }
 
 func toMapPtr[T any](items []T, getName func(T) string) map[string]*T {
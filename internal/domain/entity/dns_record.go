@@ -19,11 +19,23 @@ const (
 )
 
 type DNSRecord struct {
-	Domain string        `yaml:"-"`
-	Type   DNSRecordType `yaml:"type"`
-	Name   string        `yaml:"name"`
-	Value  string        `yaml:"value"`
-	TTL    int           `yaml:"ttl"`
+	Domain    string        `yaml:"-"`
+	Type      DNSRecordType `yaml:"type"`
+	Name      string        `yaml:"name"`
+	Value     string        `yaml:"value"`
+	TTL       int           `yaml:"ttl"`
+	Lifecycle Lifecycle     `yaml:"lifecycle,omitempty"`
+}
+
+// Key identifies the record in state and plans. It includes the value, so
+// that the values of a name with several records of one type are kept apart.
+func (r *DNSRecord) Key() string {
+	return fmt.Sprintf("%s:%s:%s:%s", r.Domain, r.Type, r.Name, r.Value)
+}
+
+// Address names the records of one type under one name, as domain:TYPE:name.
+func (r *DNSRecord) Address() string {
+	return fmt.Sprintf("%s:%s:%s", r.Domain, r.Type, r.Name)
 }
 
 func (r *DNSRecord) Validate() error {
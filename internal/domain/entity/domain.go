@@ -9,11 +9,12 @@ import (
 )
 
 type Domain struct {
-	Name    string      `yaml:"name"`
-	ISP     string      `yaml:"isp,omitempty"`
-	DNSISP  string      `yaml:"dns_isp"`
-	Parent  string      `yaml:"parent,omitempty"`
-	Records []DNSRecord `yaml:"records,omitempty"`
+	Name      string      `yaml:"name"`
+	ISP       string      `yaml:"isp,omitempty"`
+	DNSISP    string      `yaml:"dns_isp"`
+	Parent    string      `yaml:"parent,omitempty"`
+	Records   []DNSRecord `yaml:"records,omitempty"`
+	Lifecycle Lifecycle   `yaml:"lifecycle,omitempty"`
 }
 
 var domainRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
@@ -84,11 +84,12 @@ type infraServiceAlias InfraService
 
 func (s *InfraService) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	var raw struct {
-		Name     string           `yaml:"name"`
-		Type     InfraServiceType `yaml:"type"`
-		Server   string           `yaml:"server"`
-		Image    string           `yaml:"image"`
-		Networks []string         `yaml:"networks"`
+		Name      string           `yaml:"name"`
+		Type      InfraServiceType `yaml:"type"`
+		Server    string           `yaml:"server"`
+		Image     string           `yaml:"image"`
+		Networks  []string         `yaml:"networks"`
+		Lifecycle Lifecycle        `yaml:"lifecycle"`
 	}
 	if err := unmarshal(&raw); err != nil {
 		return err
@@ -98,6 +99,7 @@ func (s *InfraService) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	s.Type = raw.Type
 	s.ServiceBase.Server = raw.Server
 	s.ServiceBase.Networks = raw.Networks
+	s.ServiceBase.Lifecycle = raw.Lifecycle
 	s.Image = raw.Image
 
 	switch s.Type {
@@ -136,52 +138,76 @@ func (s *InfraService) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
-func (s *InfraService) MarshalYAML() (interface{}, error) {
+func (s InfraService) MarshalYAML() (interface{}, error) {
 	switch s.Type {
 	case InfraServiceTypeGateway:
 		return struct {
-			Name     string            `yaml:"name"`
-			Type     InfraServiceType  `yaml:"type"`
-			Server   string            `yaml:"server"`
-			Image    string            `yaml:"image"`
-			Ports    *GatewayPorts     `yaml:"ports,omitempty"`
-			Config   *GatewayConfig    `yaml:"config,omitempty"`
-			SSL      *GatewaySSLConfig `yaml:"ssl,omitempty"`
-			WAF      *GatewayWAFConfig `yaml:"waf,omitempty"`
-			LogLevel int               `yaml:"log_level,omitempty"`
-			Networks []string          `yaml:"networks,omitempty"`
+			Name      string            `yaml:"name"`
+			Type      InfraServiceType  `yaml:"type"`
+			Server    string            `yaml:"server"`
+			Image     string            `yaml:"image"`
+			Ports     *GatewayPorts     `yaml:"ports,omitempty"`
+			Config    *GatewayConfig    `yaml:"config,omitempty"`
+			SSL       *GatewaySSLConfig `yaml:"ssl,omitempty"`
+			WAF       *GatewayWAFConfig `yaml:"waf,omitempty"`
+			LogLevel  int               `yaml:"log_level,omitempty"`
+			Networks  []string          `yaml:"networks,omitempty"`
+			Lifecycle Lifecycle         `yaml:"lifecycle,omitempty"`
 		}{
-			Name:     s.Name,
-			Type:     s.Type,
-			Server:   s.ServiceBase.Server,
-			Image:    s.Image,
-			Ports:    s.GatewayPorts,
-			Config:   s.GatewayConfig,
-			SSL:      s.GatewaySSL,
-			WAF:      s.GatewayWAF,
-			LogLevel: s.GatewayLogLevel,
-			Networks: s.ServiceBase.Networks,
+			Name:      s.Name,
+			Type:      s.Type,
+			Server:    s.ServiceBase.Server,
+			Image:     s.Image,
+			Ports:     s.GatewayPorts,
+			Config:    s.GatewayConfig,
+			SSL:       s.GatewaySSL,
+			WAF:       s.GatewayWAF,
+			LogLevel:  s.GatewayLogLevel,
+			Networks:  s.ServiceBase.Networks,
+			Lifecycle: s.ServiceBase.Lifecycle,
 		}, nil
 	case InfraServiceTypeSSL:
+		var ports *SSLPorts
+		var config *SSLVolumeConfig
+		if s.SSLConfig != nil {
+			ports = &s.SSLConfig.Ports
+			config = s.SSLConfig.Config
+		}
 		return struct {
-			Name     string           `yaml:"name"`
-			Type     InfraServiceType `yaml:"type"`
-			Server   string           `yaml:"server"`
-			Image    string           `yaml:"image"`
-			Ports    *SSLPorts        `yaml:"ports,omitempty"`
-			Config   *SSLVolumeConfig `yaml:"config,omitempty"`
-			Networks []string         `yaml:"networks,omitempty"`
+			Name      string           `yaml:"name"`
+			Type      InfraServiceType `yaml:"type"`
+			Server    string           `yaml:"server"`
+			Image     string           `yaml:"image"`
+			Ports     *SSLPorts        `yaml:"ports,omitempty"`
+			Config    *SSLVolumeConfig `yaml:"config,omitempty"`
+			Networks  []string         `yaml:"networks,omitempty"`
+			Lifecycle Lifecycle        `yaml:"lifecycle,omitempty"`
 		}{
-			Name:     s.Name,
-			Type:     s.Type,
-			Server:   s.ServiceBase.Server,
-			Image:    s.Image,
-			Ports:    &s.SSLConfig.Ports,
-			Config:   s.SSLConfig.Config,
-			Networks: s.ServiceBase.Networks,
+			Name:      s.Name,
+			Type:      s.Type,
+			Server:    s.ServiceBase.Server,
+			Image:     s.Image,
+			Ports:     ports,
+			Config:    config,
+			Networks:  s.ServiceBase.Networks,
+			Lifecycle: s.ServiceBase.Lifecycle,
 		}, nil
 	}
-	return (*infraServiceAlias)(s), nil
+	return struct {
+		Name      string           `yaml:"name"`
+		Type      InfraServiceType `yaml:"type,omitempty"`
+		Server    string           `yaml:"server"`
+		Image     string           `yaml:"image,omitempty"`
+		Networks  []string         `yaml:"networks,omitempty"`
+		Lifecycle Lifecycle        `yaml:"lifecycle,omitempty"`
+	}{
+		Name:      s.Name,
+		Type:      s.Type,
+		Server:    s.ServiceBase.Server,
+		Image:     s.Image,
+		Networks:  s.ServiceBase.Networks,
+		Lifecycle: s.ServiceBase.Lifecycle,
+	}, nil
 }
 
 func (s *InfraService) Validate() error {
@@ -0,0 +1,9 @@
+package entity
+
+// Lifecycle controls what yamlops may do to a deployed entity. It is recorded
+// in the state with the entity, so the protection still holds after the
+// entity is removed from the config.
+type Lifecycle struct {
+	// PreventDestroy fails every plan that deletes or recreates the entity.
+	PreventDestroy bool `yaml:"prevent_destroy,omitempty"`
+}
@@ -0,0 +1,71 @@
+package entity
+
+import (
+	"fmt"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+)
+
+const (
+	// PolicyRuleNoDelete forbids deleting entities of the listed kinds.
+	PolicyRuleNoDelete = "no_delete"
+	// PolicyRuleNoLatestTag forbids images tagged latest or not tagged at all.
+	PolicyRuleNoLatestTag = "no_latest_tag"
+	// PolicyRuleHTTPSRoutes requires every gateway route to serve HTTPS.
+	PolicyRuleHTTPSRoutes = "https_routes"
+)
+
+const (
+	PolicySeverityDeny = "deny"
+	PolicySeverityWarn = "warn"
+)
+
+var policyEntityKinds = map[string]bool{
+	"isp": true, "zone": true, "domain": true, "server": true,
+	"infra_service": true, "service": true, "dns_record": true,
+}
+
+// Policy is a guardrail checked against every plan of the environment. A
+// violated deny policy blocks apply; a warn policy is only reported.
+type Policy struct {
+	Name     string   `yaml:"name"`
+	Rule     string   `yaml:"rule"`
+	Severity string   `yaml:"severity"`
+	Entities []string `yaml:"entities,omitempty"`
+	Message  string   `yaml:"message,omitempty"`
+}
+
+// DeleteKinds returns the entity kinds a no_delete policy protects; services
+// and infra services unless the policy lists its own.
+func (p *Policy) DeleteKinds() []string {
+	if len(p.Entities) > 0 {
+		return p.Entities
+	}
+	return []string{"service", "infra_service"}
+}
+
+func (p *Policy) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("%w: policy name is required", domain.ErrInvalidName)
+	}
+	switch p.Rule {
+	case PolicyRuleNoDelete, PolicyRuleNoLatestTag, PolicyRuleHTTPSRoutes:
+	case "":
+		return domain.RequiredField("rule")
+	default:
+		return fmt.Errorf("%w: policy rule %s", domain.ErrInvalidType, p.Rule)
+	}
+	switch p.Severity {
+	case PolicySeverityDeny, PolicySeverityWarn:
+	case "":
+		return domain.RequiredField("severity")
+	default:
+		return fmt.Errorf("%w: policy severity %s (expected deny or warn)", domain.ErrInvalidType, p.Severity)
+	}
+	for _, kind := range p.Entities {
+		if !policyEntityKinds[kind] {
+			return fmt.Errorf("%w: entity %s", domain.ErrInvalidType, kind)
+		}
+	}
+	return nil
+}
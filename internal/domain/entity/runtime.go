@@ -0,0 +1,22 @@
+package entity
+
+// ServiceRuntime is what docker inspect reports about the container of a
+// deployed service, next to the values the config expects. It is filled in by
+// the state fetcher only and never written to config, state or plan files.
+type ServiceRuntime struct {
+	// Status is the container state, such as running, exited or restarting.
+	Status       string
+	RestartCount int
+	// Health is healthy, unhealthy or starting, or empty without a
+	// healthcheck.
+	Health string
+	// ImageDigest identifies the image the container runs; WantImageDigest
+	// the image the configured reference resolves to on the server. Both are
+	// empty when the image could not be resolved.
+	ImageDigest     string
+	WantImageDigest string
+	// EnvFileHash is the hash of the env file on the server;
+	// WantEnvFileHash that of the generated one, empty without an env file.
+	EnvFileHash     string
+	WantEnvFileHash string
+}
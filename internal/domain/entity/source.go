@@ -0,0 +1,47 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Source is where an entity, or one of its fields, is defined in the
+// config files.
+type Source struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// SourceKey names an entity of a config section, such as services, or one
+// of its fields in Config.Sources. Sections holding a single value, such as
+// backend, use an empty name.
+func SourceKey(section, name string, field ...string) string {
+	return strings.Join(append([]string{section, name}, field...), "/")
+}
+
+// ItemName stands for the i-th entity of a section in SourceKey, so that
+// entities without a name can be located too.
+func ItemName(i int) string {
+	return fmt.Sprintf("[%d]", i)
+}
+
+// nameOr returns name, or ItemName(i) when the i-th entity has no name.
+func nameOr(name string, i int) string {
+	if name == "" {
+		return ItemName(i)
+	}
+	return name
+}
+
+// SourceOf returns where field of the named entity is defined, falling
+// back to the entity itself when field is empty or not found.
+func (c *Config) SourceOf(section, name, field string) (Source, bool) {
+	if field != "" {
+		if src, ok := c.Sources[SourceKey(section, name, field)]; ok {
+			return src, true
+		}
+	}
+	src, ok := c.Sources[SourceKey(section, name)]
+	return src, ok
+}
@@ -0,0 +1,47 @@
+package entity
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+const (
+	StateBackendFile = "file"
+	StateBackendHTTP = "http"
+)
+
+// StateBackend selects where the deployment state of an environment is
+// stored. Without one, state is kept in .state/<env>.yaml next to the config.
+type StateBackend struct {
+	Type     string                `yaml:"type"`
+	Address  string                `yaml:"address,omitempty"`
+	Username string                `yaml:"username,omitempty"`
+	Password valueobject.SecretRef `yaml:"password,omitempty"`
+	// Keep is how many state versions the file backend keeps in its history,
+	// zero for the default. The http backend prunes on the server.
+	Keep int `yaml:"keep,omitempty"`
+}
+
+func (b *StateBackend) Validate() error {
+	if b.Keep < 0 {
+		return fmt.Errorf("%w: keep must not be negative", domain.ErrInvalidFormat)
+	}
+	switch b.Type {
+	case "", StateBackendFile:
+		return nil
+	case StateBackendHTTP:
+		if b.Address == "" {
+			return domain.RequiredField("address")
+		}
+		u, err := url.Parse(b.Address)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: %s", domain.ErrInvalidURL, b.Address)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: state backend %s", domain.ErrInvalidType, b.Type)
+	}
+}
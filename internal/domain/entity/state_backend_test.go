@@ -0,0 +1,60 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+)
+
+func TestStateBackend_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend StateBackend
+		wantErr error
+	}{
+		{
+			name:    "default file backend",
+			backend: StateBackend{},
+			wantErr: nil,
+		},
+		{
+			name:    "explicit file backend",
+			backend: StateBackend{Type: StateBackendFile},
+			wantErr: nil,
+		},
+		{
+			name:    "http without address",
+			backend: StateBackend{Type: StateBackendHTTP},
+			wantErr: domain.ErrRequired,
+		},
+		{
+			name:    "http with invalid address",
+			backend: StateBackend{Type: StateBackendHTTP, Address: "state.example.com"},
+			wantErr: domain.ErrInvalidURL,
+		},
+		{
+			name:    "valid http backend",
+			backend: StateBackend{Type: StateBackendHTTP, Address: "https://state.example.com/yamlops", Username: "ops"},
+			wantErr: nil,
+		},
+		{
+			name:    "unknown type",
+			backend: StateBackend{Type: "s3"},
+			wantErr: domain.ErrInvalidType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.backend.Validate()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("Validate() unexpected error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package entity
+
+import (
+	"reflect"
+	"strings"
+)
+
+// YAMLName returns the key of field in YAML, empty for an untagged field,
+// and whether the field is not serialized at all.
+func YAMLName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("yaml")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, false
+}
+
+// ConfigSection returns the field of Config stored under key in the config
+// files, such as services.
+func ConfigSection(key string) (reflect.StructField, bool) {
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, _ := YAMLName(t.Field(i)); name == key {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
@@ -3,6 +3,7 @@ package domain
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var (
@@ -41,16 +42,31 @@ var (
 	ErrSSHHostKeyMismatch    = errors.New("SSH host key mismatch")
 	ErrSSHFileTransfer       = errors.New("SSH file transfer failed")
 	ErrSSHClientNotAvailable = errors.New("SSH client not available")
-
-	ErrConfigReadFailed   = errors.New("config read failed")
-	ErrConfigParseFailed  = errors.New("config parse failed")
-	ErrConfigValidateFail = errors.New("config validation failed")
-	ErrConfigNotFound     = errors.New("config not found")
-
-	ErrStateReadFailed    = errors.New("state read failed")
-	ErrStateWriteFailed   = errors.New("state write failed")
-	ErrStateSerializeFail = errors.New("state serialization failed")
-	ErrStateNotFound      = errors.New("state not found")
+	ErrServerUnreachable     = errors.New("server unreachable")
+
+	ErrConfigReadFailed    = errors.New("config read failed")
+	ErrConfigParseFailed   = errors.New("config parse failed")
+	ErrConfigValidateFail  = errors.New("config validation failed")
+	ErrConfigNotFound      = errors.New("config not found")
+	ErrUnresolvedReference = errors.New("unresolved reference")
+	ErrDuplicateName       = errors.New("duplicate name")
+
+	ErrStateReadFailed      = errors.New("state read failed")
+	ErrStateWriteFailed     = errors.New("state write failed")
+	ErrStateSerializeFail   = errors.New("state serialization failed")
+	ErrStateNotFound        = errors.New("state not found")
+	ErrStateLocked          = errors.New("state locked")
+	ErrStateEntryNotFound   = errors.New("state entry not found")
+	ErrStateEntryExists     = errors.New("state entry already exists")
+	ErrStateVersionNotFound = errors.New("state version not found")
+
+	ErrPlanFileInvalid  = errors.New("plan file invalid")
+	ErrPlanStale        = errors.New("plan is stale")
+	ErrDependencyFailed = errors.New("dependency failed")
+	ErrJournalNotFound  = errors.New("apply journal not found")
+	ErrPolicyDenied     = errors.New("denied by policy")
+	ErrPreventDestroy   = errors.New("destroy prevented by lifecycle.prevent_destroy")
+	ErrUnknownTarget    = errors.New("unknown target")
 
 	ErrDNSError          = errors.New("DNS operation failed")
 	ErrDNSRecordExists   = errors.New("DNS record already exists")
@@ -76,11 +92,13 @@ var (
 	ErrNetworkInspectFailed = errors.New("network inspection failed")
 	ErrNetworkListFailed    = errors.New("network list failed")
 	ErrNetworkCheckFailed   = errors.New("network check failed")
+	ErrNetworkRemoveFailed  = errors.New("network removal failed")
 
 	ErrComposeGenerateFailed = errors.New("compose generation failed")
 	ErrComposeSyncFailed     = errors.New("compose sync failed")
 	ErrDockerComposeFailed   = errors.New("docker compose failed")
 	ErrServiceInvalid        = errors.New("service invalid")
+	ErrContainerNotFound     = errors.New("container not found")
 )
 
 func RequiredField(field string) error {
@@ -117,3 +135,53 @@ func (e *OpError) Unwrap() error {
 func NewOpError(op string, cause error) error {
 	return &OpError{Op: op, Cause: cause}
 }
+
+// ValidationError is a config validation failure, with the position of the
+// offending entity or field in the config files when it is known.
+type ValidationError struct {
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	if e.File == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s:%d:%d: %v", e.File, e.Line, e.Column, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors holds every failure found validating a config.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = "  " + err.Error()
+	}
+	return fmt.Sprintf("%d validation errors:\n%s", len(e), strings.Join(lines, "\n"))
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Err returns e, or nil when there are no failures.
+func (e ValidationErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
 )
@@ -11,6 +13,50 @@ type StateRepository interface {
 	Save(ctx context.Context, env string, state *DeploymentState) error
 }
 
+// StateLocker guards a state against concurrent writers for the length of an
+// operation such as apply.
+type StateLocker interface {
+	Lock(ctx context.Context, env string, info *LockInfo) error
+	Unlock(ctx context.Context, env string, info *LockInfo) error
+}
+
+type LockableStateRepository interface {
+	StateRepository
+	StateLocker
+}
+
+// StateHistory keeps a numbered snapshot of every saved state.
+type StateHistory interface {
+	SaveVersion(ctx context.Context, env string, state *DeploymentState, meta *StateVersion) error
+	History(ctx context.Context, env string) ([]*StateVersion, error)
+	LoadVersion(ctx context.Context, env string, version int) (*DeploymentState, error)
+}
+
+type VersionedStateRepository interface {
+	LockableStateRepository
+	StateHistory
+}
+
+type StateVersion struct {
+	Version   int       `json:"version"`
+	Created   time.Time `json:"created"`
+	Who       string    `json:"who,omitempty"`
+	Operation string    `json:"operation,omitempty"`
+	Plan      string    `json:"plan,omitempty"`
+}
+
+type LockInfo struct {
+	ID        string    `json:"id"`
+	Env       string    `json:"env"`
+	Operation string    `json:"operation"`
+	Who       string    `json:"who"`
+	Created   time.Time `json:"created"`
+}
+
+func (l *LockInfo) String() string {
+	return fmt.Sprintf("id=%s operation=%s who=%s created=%s", l.ID, l.Operation, l.Who, l.Created.Format(time.RFC3339))
+}
+
 type DeploymentState struct {
 	Services      map[string]*entity.BizService
 	InfraServices map[string]*entity.InfraService
@@ -19,6 +65,9 @@ type DeploymentState struct {
 	Domains       map[string]*entity.Domain
 	Records       map[string]*entity.DNSRecord
 	ISPs          map[string]*entity.ISP
+	// Unreachable maps the servers whose live state could not be fetched to
+	// the reason. Their services are unknown rather than not deployed.
+	Unreachable map[string]string `yaml:",omitempty"`
 }
 
 func NewDeploymentState() *DeploymentState {
@@ -30,5 +79,6 @@ func NewDeploymentState() *DeploymentState {
 		Domains:       make(map[string]*entity.Domain),
 		Records:       make(map[string]*entity.DNSRecord),
 		ISPs:          make(map[string]*entity.ISP),
+		Unreachable:   make(map[string]string),
 	}
 }
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+var entityApplyRank = map[string]int{
+	"isp":           0,
+	"zone":          1,
+	"domain":        2,
+	"server":        3,
+	"infra_service": 4,
+	"service":       5,
+	"dns_record":    6,
+}
+
+// ChangeGraph orders plan changes so prerequisites run first. Deletions are
+// ordered in reverse: a service is removed before the server it runs on.
+type ChangeGraph struct {
+	order         []*valueobject.Change
+	prerequisites map[*valueobject.Change][]*valueobject.Change
+}
+
+func NewChangeGraph(changes []*valueobject.Change, idx *DependencyIndex) *ChangeGraph {
+	if idx == nil {
+		idx = NewDependencyIndex(nil)
+	}
+	idx = idx.withChanges(changes)
+
+	g := &ChangeGraph{prerequisites: make(map[*valueobject.Change][]*valueobject.Change)}
+
+	applyNodes := make(map[EntityRef]*valueobject.Change)
+	deleteNodes := make(map[EntityRef]*valueobject.Change)
+	for _, ch := range changes {
+		ref := EntityRef{Kind: ch.Entity(), Name: ch.Name()}
+		if ch.Type() == valueobject.ChangeTypeDelete {
+			deleteNodes[ref] = ch
+		} else {
+			applyNodes[ref] = ch
+		}
+	}
+
+	for _, ch := range changes {
+		if ch.Type() == valueobject.ChangeTypeDelete {
+			for _, dep := range idx.Dependencies(ch.OldState()) {
+				if d, ok := deleteNodes[dep]; ok && d != ch {
+					g.addPrerequisite(d, ch)
+				}
+			}
+			continue
+		}
+		for _, dep := range idx.Dependencies(ch.NewState()) {
+			if d, ok := applyNodes[dep]; ok && d != ch {
+				g.addPrerequisite(ch, d)
+			}
+		}
+	}
+
+	g.order = g.sort(changes)
+	return g
+}
+
+func (g *ChangeGraph) addPrerequisite(ch, prereq *valueobject.Change) {
+	for _, existing := range g.prerequisites[ch] {
+		if existing == prereq {
+			return
+		}
+	}
+	g.prerequisites[ch] = append(g.prerequisites[ch], prereq)
+}
+
+func (g *ChangeGraph) Ordered() []*valueobject.Change {
+	return g.order
+}
+
+func (g *ChangeGraph) Prerequisites(ch *valueobject.Change) []*valueobject.Change {
+	return g.prerequisites[ch]
+}
+
+// sort is a Kahn topological sort that always picks the lowest ranked ready
+// change, keeping the order stable regardless of map iteration in the differ.
+func (g *ChangeGraph) sort(changes []*valueobject.Change) []*valueobject.Change {
+	remaining := make([]*valueobject.Change, len(changes))
+	copy(remaining, changes)
+	done := make(map[*valueobject.Change]bool, len(changes))
+	order := make([]*valueobject.Change, 0, len(changes))
+
+	for len(remaining) > 0 {
+		best := -1
+		for i, ch := range remaining {
+			if !g.ready(ch, done) {
+				continue
+			}
+			if best < 0 || changeLess(ch, remaining[best]) {
+				best = i
+			}
+		}
+		if best < 0 {
+			// A cycle cannot come from the rank rules, but never drop changes.
+			for i, ch := range remaining {
+				if best < 0 || changeLess(ch, remaining[best]) {
+					best = i
+				}
+			}
+		}
+		ch := remaining[best]
+		order = append(order, ch)
+		done[ch] = true
+		remaining = append(remaining[:best], remaining[best+1:]...)
+	}
+	return order
+}
+
+func (g *ChangeGraph) ready(ch *valueobject.Change, done map[*valueobject.Change]bool) bool {
+	for _, prereq := range g.prerequisites[ch] {
+		if !done[prereq] {
+			return false
+		}
+	}
+	return true
+}
+
+func changeLess(a, b *valueobject.Change) bool {
+	aDelete := a.Type() == valueobject.ChangeTypeDelete
+	bDelete := b.Type() == valueobject.ChangeTypeDelete
+	if aDelete != bDelete {
+		return aDelete
+	}
+	ra, rb := entityRank(a.Entity()), entityRank(b.Entity())
+	if ra != rb {
+		if aDelete {
+			return ra > rb
+		}
+		return ra < rb
+	}
+	return a.Name() < b.Name()
+}
+
+func entityRank(kind string) int {
+	if r, ok := entityApplyRank[kind]; ok {
+		return r
+	}
+	return len(entityApplyRank)
+}
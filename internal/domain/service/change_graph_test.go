@@ -0,0 +1,104 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+func changeNames(changes []*valueobject.Change) []string {
+	names := make([]string, len(changes))
+	for i, ch := range changes {
+		names[i] = ch.Entity() + ":" + ch.Name()
+	}
+	return names
+}
+
+func TestChangeGraph_ApplyOrder(t *testing.T) {
+	cfg := &entity.Config{
+		Servers: []entity.Server{{Name: "srv1", Zone: "z1", IP: entity.ServerIP{Public: "1.2.3.4"}}},
+		InfraServices: []entity.InfraService{
+			{Name: "gw", Type: entity.InfraServiceTypeGateway, ServiceBase: entity.ServiceBase{Server: "srv1"}},
+			{Name: "ssl", Type: entity.InfraServiceTypeSSL, ServiceBase: entity.ServiceBase{Server: "srv1"}},
+		},
+		Services: []entity.BizService{
+			{Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"},
+				Gateways: []entity.ServiceGatewayRoute{{Hostname: "api.example.com"}}},
+		},
+	}
+
+	// Deliberately scrambled, as map iteration in the differ would produce.
+	changes := []*valueobject.Change{
+		valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "dns_record", "example.com:CNAME:api", nil,
+			&entity.DNSRecord{Domain: "example.com", Type: entity.DNSRecordTypeCNAME, Name: "api", Value: "lb.example.com"}, nil, false),
+		valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "service", "api", nil, &cfg.Services[0], nil, false),
+		valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "infra_service", "gw", nil, &cfg.InfraServices[0], nil, false),
+		valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "infra_service", "ssl", nil, &cfg.InfraServices[1], nil, false),
+		valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "server", "srv1", nil, &cfg.Servers[0], nil, false),
+		valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "zone", "z1", nil, &entity.Zone{Name: "z1"}, nil, false),
+	}
+
+	g := NewChangeGraph(changes, NewDependencyIndex(cfg))
+	got := changeNames(g.Ordered())
+	expected := []string{"zone:z1", "server:srv1", "infra_service:ssl", "infra_service:gw", "service:api", "dns_record:example.com:CNAME:api"}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("order = %v, expected %v", got, expected)
+		}
+	}
+
+	record := g.Ordered()[5]
+	prereqs := changeNames(g.Prerequisites(record))
+	found := false
+	for _, p := range prereqs {
+		if p == "infra_service:gw" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected dns record to depend on the gateway, got %v", prereqs)
+	}
+}
+
+func TestChangeGraph_DeletesInReverse(t *testing.T) {
+	changes := []*valueobject.Change{
+		valueobject.NewChangeFull(valueobject.ChangeTypeDelete, "server", "srv1", &entity.Server{Name: "srv1"}, nil, nil, false),
+		valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "service", "new", nil,
+			&entity.BizService{Name: "new", ServiceBase: entity.ServiceBase{Server: "srv2"}}, nil, false),
+		valueobject.NewChangeFull(valueobject.ChangeTypeDelete, "service", "old", &entity.BizService{Name: "old", ServiceBase: entity.ServiceBase{Server: "srv1"}}, nil, nil, true),
+	}
+
+	g := NewChangeGraph(changes, nil)
+	got := changeNames(g.Ordered())
+	expected := []string{"service:old", "server:srv1", "service:new"}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("order = %v, expected %v", got, expected)
+		}
+	}
+
+	serverDelete := g.Ordered()[1]
+	if prereqs := changeNames(g.Prerequisites(serverDelete)); len(prereqs) != 1 || prereqs[0] != "service:old" {
+		t.Errorf("expected server deletion to wait for service deletion, got %v", prereqs)
+	}
+}
+
+func TestChangeGraph_Deterministic(t *testing.T) {
+	build := func(names ...string) []string {
+		var changes []*valueobject.Change
+		for _, n := range names {
+			changes = append(changes, valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "service", n, nil,
+				&entity.BizService{Name: n, ServiceBase: entity.ServiceBase{Server: "srv1"}}, nil, false))
+		}
+		return changeNames(NewChangeGraph(changes, nil).Ordered())
+	}
+
+	a := build("c", "a", "b")
+	b := build("b", "c", "a")
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("orders differ: %v vs %v", a, b)
+		}
+	}
+}
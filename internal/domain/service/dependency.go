@@ -0,0 +1,196 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+type EntityRef struct {
+	Kind string
+	Name string
+}
+
+func (r EntityRef) String() string {
+	return r.Kind + ":" + r.Name
+}
+
+// DependencyIndex knows which servers host which infra services and which
+// hostnames are routed through them, so DNS records can be ordered after the
+// gateway that serves them.
+type DependencyIndex struct {
+	serversByIP    map[string][]string
+	serversByHost  map[string][]string
+	servicesByHost map[string][]string
+	infraByServer  map[string][]*entity.InfraService
+}
+
+func NewDependencyIndex(cfg *entity.Config) *DependencyIndex {
+	idx := &DependencyIndex{
+		serversByIP:    make(map[string][]string),
+		serversByHost:  make(map[string][]string),
+		servicesByHost: make(map[string][]string),
+		infraByServer:  make(map[string][]*entity.InfraService),
+	}
+	if cfg == nil {
+		return idx
+	}
+	for i := range cfg.Servers {
+		idx.addServer(&cfg.Servers[i])
+	}
+	for i := range cfg.InfraServices {
+		idx.addInfraService(&cfg.InfraServices[i])
+	}
+	for i := range cfg.Services {
+		idx.addService(&cfg.Services[i])
+	}
+	return idx
+}
+
+func (x *DependencyIndex) withChanges(changes []*valueobject.Change) *DependencyIndex {
+	idx := &DependencyIndex{
+		serversByIP:    copyIndex(x.serversByIP),
+		serversByHost:  copyIndex(x.serversByHost),
+		servicesByHost: copyIndex(x.servicesByHost),
+		infraByServer:  make(map[string][]*entity.InfraService, len(x.infraByServer)),
+	}
+	for k, v := range x.infraByServer {
+		idx.infraByServer[k] = append([]*entity.InfraService(nil), v...)
+	}
+	for _, ch := range changes {
+		for _, state := range []interface{}{ch.OldState(), ch.NewState()} {
+			switch v := state.(type) {
+			case *entity.Server:
+				idx.addServer(v)
+			case *entity.InfraService:
+				idx.addInfraService(v)
+			case *entity.BizService:
+				idx.addService(v)
+			}
+		}
+	}
+	return idx
+}
+
+func (x *DependencyIndex) addServer(srv *entity.Server) {
+	for _, ip := range []string{srv.IP.Public, srv.IP.Private} {
+		if ip != "" {
+			x.serversByIP[ip] = appendUnique(x.serversByIP[ip], srv.Name)
+		}
+	}
+}
+
+func (x *DependencyIndex) addInfraService(infra *entity.InfraService) {
+	for _, existing := range x.infraByServer[infra.Server] {
+		if existing.Name == infra.Name {
+			return
+		}
+	}
+	x.infraByServer[infra.Server] = append(x.infraByServer[infra.Server], infra)
+}
+
+func (x *DependencyIndex) addService(svc *entity.BizService) {
+	for _, gw := range svc.Gateways {
+		host := strings.ToLower(gw.Hostname)
+		x.serversByHost[host] = appendUnique(x.serversByHost[host], svc.Server)
+		x.servicesByHost[host] = appendUnique(x.servicesByHost[host], svc.Name)
+	}
+}
+
+// Dependencies returns the entities that must exist before the given state
+// can be applied.
+func (x *DependencyIndex) Dependencies(state interface{}) []EntityRef {
+	var deps []EntityRef
+	switch v := state.(type) {
+	case *entity.Zone:
+		deps = appendRef(deps, "isp", v.ISP)
+	case *entity.Domain:
+		deps = appendRef(deps, "isp", v.ISP)
+		deps = appendRef(deps, "domain", v.Parent)
+	case *entity.Server:
+		deps = appendRef(deps, "zone", v.Zone)
+	case *entity.InfraService:
+		deps = appendRef(deps, "server", v.Server)
+		if v.Type == entity.InfraServiceTypeGateway {
+			for _, infra := range x.infraByServer[v.Server] {
+				if infra.Type == entity.InfraServiceTypeSSL {
+					deps = appendRef(deps, "infra_service", infra.Name)
+				}
+			}
+		}
+	case *entity.BizService:
+		deps = appendRef(deps, "server", v.Server)
+		for _, infra := range x.infraByServer[v.Server] {
+			deps = appendRef(deps, "infra_service", infra.Name)
+		}
+	case *entity.DNSRecord:
+		deps = appendRef(deps, "domain", v.Domain)
+		for _, server := range x.recordServers(v) {
+			deps = appendRef(deps, "server", server)
+			for _, infra := range x.infraByServer[server] {
+				if infra.Type == entity.InfraServiceTypeGateway {
+					deps = appendRef(deps, "infra_service", infra.Name)
+				}
+			}
+		}
+	}
+	return deps
+}
+
+// routedServices returns the services whose gateway routes serve the
+// hostname of r. They are not prerequisites of r, since the record only needs
+// the gateway, but a record belongs to them when selecting targets.
+func (x *DependencyIndex) routedServices(r *entity.DNSRecord) []string {
+	return x.servicesByHost[strings.ToLower(recordFQDN(r))]
+}
+
+func recordFQDN(r *entity.DNSRecord) string {
+	if r.Name != "" && r.Name != "@" {
+		return r.Name + "." + r.Domain
+	}
+	return r.Domain
+}
+
+func (x *DependencyIndex) recordServers(r *entity.DNSRecord) []string {
+	var servers []string
+	for _, s := range x.serversByHost[strings.ToLower(recordFQDN(r))] {
+		servers = appendUnique(servers, s)
+	}
+	if r.Type == entity.DNSRecordTypeA || r.Type == entity.DNSRecordTypeAAAA {
+		for _, s := range x.serversByIP[r.Value] {
+			servers = appendUnique(servers, s)
+		}
+	}
+	return servers
+}
+
+func appendRef(refs []EntityRef, kind, name string) []EntityRef {
+	if name == "" {
+		return refs
+	}
+	ref := EntityRef{Kind: kind, Name: name}
+	for _, r := range refs {
+		if r == ref {
+			return refs
+		}
+	}
+	return append(refs, ref)
+}
+
+func appendUnique(values []string, v string) []string {
+	for _, existing := range values {
+		if existing == v {
+			return values
+		}
+	}
+	return append(values, v)
+}
+
+func copyIndex(m map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(m))
+	for k, v := range m {
+		out[k] = append([]string(nil), v...)
+	}
+	return out
+}
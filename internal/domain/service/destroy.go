@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+// DestroyPlan deletes everything st holds on servers and DNS providers: the
+// services, infra services and DNS records, and through the server deletes
+// the networks created for them. ISPs, zones and domains only exist in the
+// state and are dropped with it. The change graph orders the deletes
+// services first.
+func DestroyPlan(st *repository.DeploymentState, cfg *entity.Config, env string) *valueobject.Plan {
+	p := valueobject.NewPlan()
+	for _, name := range sortedNames(st.Services) {
+		p.AddChange(destroyChange("service", name, st.Services[name], true))
+	}
+	for _, name := range sortedNames(st.InfraServices) {
+		p.AddChange(destroyChange("infra_service", name, st.InfraServices[name], true))
+	}
+	for _, name := range sortedNames(st.Records) {
+		p.AddChange(destroyChange("dns_record", name, st.Records[name], false))
+	}
+	for _, name := range sortedNames(st.Servers) {
+		server := serverWithNetworks(st.Servers[name], destroyNetworks(st, cfg, name, env))
+		actions := []string{fmt.Sprintf("delete server %s", name)}
+		for _, n := range server.Networks {
+			actions = append(actions, fmt.Sprintf("remove network %s", n.Name))
+		}
+		p.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeDelete, "server", name, server, nil, actions, false))
+	}
+	return p
+}
+
+// destroyNetworks returns the docker networks yamlops may have created on
+// server: the default yamlops-<env> network and the networks the services
+// of the server declare, in the state or in cfg.
+func destroyNetworks(st *repository.DeploymentState, cfg *entity.Config, server, env string) []string {
+	names := []string{fmt.Sprintf("yamlops-%s", env)}
+	for _, name := range sortedNames(st.Services) {
+		if svc := st.Services[name]; svc.Server == server {
+			names = append(names, svc.Networks...)
+		}
+	}
+	for _, name := range sortedNames(st.InfraServices) {
+		if infra := st.InfraServices[name]; infra.Server == server {
+			names = append(names, infra.Networks...)
+		}
+	}
+	if cfg != nil {
+		for _, svc := range cfg.Services {
+			if svc.Server == server {
+				names = append(names, svc.Networks...)
+			}
+		}
+		for _, infra := range cfg.InfraServices {
+			if infra.Server == server {
+				names = append(names, infra.Networks...)
+			}
+		}
+	}
+	return names
+}
+
+// serverWithNetworks returns a copy of server whose networks also include
+// names, each network listed once.
+func serverWithNetworks(server *entity.Server, names []string) *entity.Server {
+	copied := *server
+	copied.Networks = append([]entity.ServerNetwork(nil), server.Networks...)
+	seen := make(map[string]bool, len(copied.Networks))
+	for _, n := range copied.Networks {
+		seen[n.Name] = true
+	}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		copied.Networks = append(copied.Networks, entity.ServerNetwork{Name: name, Type: entity.NetworkTypeBridge})
+	}
+	return &copied
+}
+
+func destroyChange(kind, name string, state interface{}, remoteExists bool) *valueobject.Change {
+	return valueobject.NewChangeFull(valueobject.ChangeTypeDelete, kind, name, state, nil,
+		[]string{fmt.Sprintf("delete %s %s", kind, name)}, remoteExists)
+}
+
+func sortedNames[T any](m map[string]*T) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
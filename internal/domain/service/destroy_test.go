@@ -0,0 +1,48 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+func TestDestroyPlan(t *testing.T) {
+	st := stateOpsFixture()
+	st.Servers["srv1"].Networks = []entity.ServerNetwork{{Name: "backend", Type: entity.NetworkTypeBridge}}
+	st.Services["api"].Networks = []string{"backend"}
+	cfg := &entity.Config{Services: []entity.BizService{
+		{Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1", Networks: []string{"frontend"}}},
+		{Name: "other", ServiceBase: entity.ServiceBase{Server: "srv2", Networks: []string{"elsewhere"}}},
+	}}
+	p := DestroyPlan(st, cfg, "prod")
+
+	var got []string
+	for _, ch := range p.Changes() {
+		if ch.Type() != valueobject.ChangeTypeDelete {
+			t.Errorf("%s:%s is not a delete", ch.Entity(), ch.Name())
+		}
+		got = append(got, EntityRef{Kind: ch.Entity(), Name: ch.Name()}.String())
+	}
+	want := []string{"service:api", "dns_record:example.com:A:api:1.2.3.4", "dns_record:example.com:A:www:1.2.3.4", "server:srv1"}
+	if len(got) != len(want) {
+		t.Fatalf("DestroyPlan() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("DestroyPlan()[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	server := p.Changes()[len(p.Changes())-1].OldState().(*entity.Server)
+	if got, want := server.GetNetworkNames(), []string{"backend", "yamlops-prod", "frontend"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("networks removed with srv1 = %v, want %v", got, want)
+	}
+
+	graph := NewChangeGraph(p.Changes(), NewDependencyIndex(nil))
+	order := graph.Ordered()
+	if order[len(order)-1].Entity() != "server" {
+		t.Errorf("the server should be deleted after its services, got order %v", order)
+	}
+}
@@ -34,39 +34,60 @@ func (s *DifferService) SetState(state *repository.DeploymentState) {
 }
 
 func (s *DifferService) PlanISPs(plan *valueobject.Plan, cfgMap map[string]*entity.ISP, scope *valueobject.Scope) {
-	planSimpleEntity(plan, cfgMap, s.state.ISPs, ISPEquals, "isp",
+	planSimpleEntity(plan, cfgMap, s.state.ISPs, ISPDiff, "isp",
 		func(_ string) bool { return scope.Matches("", "", "", "") })
 }
 
 func ISPEquals(a, b *entity.ISP) bool {
-	if a.Name != b.Name {
-		return false
-	}
-	if len(a.Services) != len(b.Services) {
-		return false
-	}
-	for i, s := range a.Services {
-		if i >= len(b.Services) || s != b.Services[i] {
-			return false
-		}
+	return len(ISPDiff(a, b)) == 0
+}
+
+func ISPDiff(a, b *entity.ISP) []valueobject.FieldDiff {
+	var d fieldDiffs
+	d.value("name", a.Name, b.Name)
+	d.list("services", ispServiceStrings(a.Services), ispServiceStrings(b.Services))
+	return d
+}
+
+func ispServiceStrings(services []entity.ISPService) []string {
+	out := make([]string, len(services))
+	for i, svc := range services {
+		out[i] = string(svc)
 	}
-	return true
+	return out
 }
 
 func (s *DifferService) PlanZones(plan *valueobject.Plan, cfgMap map[string]*entity.Zone, scope *valueobject.Scope) {
-	planSimpleEntity(plan, cfgMap, s.state.Zones, ZoneEquals, "zone",
+	planSimpleEntity(plan, cfgMap, s.state.Zones, ZoneDiff, "zone",
 		func(name string) bool { return scope.Matches(name, "", "", "") })
 }
 
 func ZoneEquals(a, b *entity.Zone) bool {
-	return a.Name == b.Name && a.ISP == b.ISP && a.Region == b.Region
+	return len(ZoneDiff(a, b)) == 0
+}
+
+func ZoneDiff(a, b *entity.Zone) []valueobject.FieldDiff {
+	var d fieldDiffs
+	d.value("name", a.Name, b.Name)
+	d.value("isp", a.ISP, b.ISP)
+	d.value("region", a.Region, b.Region)
+	return d
 }
 
 func (s *DifferService) PlanDomains(plan *valueobject.Plan, cfgMap map[string]*entity.Domain, scope *valueobject.Scope) {
-	planSimpleEntity(plan, cfgMap, s.state.Domains, DomainEquals, "domain",
+	planSimpleEntity(plan, cfgMap, s.state.Domains, DomainDiff, "domain",
 		func(_ string) bool { return scope.Matches("", "", "", "") })
 }
 
 func DomainEquals(a, b *entity.Domain) bool {
-	return a.Name == b.Name && a.ISP == b.ISP && a.Parent == b.Parent
+	return len(DomainDiff(a, b)) == 0
+}
+
+func DomainDiff(a, b *entity.Domain) []valueobject.FieldDiff {
+	var d fieldDiffs
+	d.value("name", a.Name, b.Name)
+	d.value("isp", a.ISP, b.ISP)
+	d.value("parent", a.Parent, b.Parent)
+	d.bool("lifecycle.prevent_destroy", a.Lifecycle.PreventDestroy, b.Lifecycle.PreventDestroy)
+	return d
 }
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+const sensitiveValue = "(sensitive)"
+
+type fieldDiffs []valueobject.FieldDiff
+
+func (d *fieldDiffs) value(field, oldValue, newValue string) {
+	if oldValue != newValue {
+		*d = append(*d, valueobject.NewFieldDiff(field, oldValue, newValue))
+	}
+}
+
+func (d *fieldDiffs) int(field string, oldValue, newValue int) {
+	d.value(field, strconv.Itoa(oldValue), strconv.Itoa(newValue))
+}
+
+func (d *fieldDiffs) bool(field string, oldValue, newValue bool) {
+	d.value(field, strconv.FormatBool(oldValue), strconv.FormatBool(newValue))
+}
+
+func (d *fieldDiffs) list(field string, oldValues, newValues []string) {
+	n := len(oldValues)
+	if len(newValues) > n {
+		n = len(newValues)
+	}
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("%s[%d]", field, i)
+		switch {
+		case i >= len(oldValues):
+			*d = append(*d, valueobject.NewFieldAdded(name, newValues[i]))
+		case i >= len(newValues):
+			*d = append(*d, valueobject.NewFieldRemoved(name, oldValues[i]))
+		default:
+			d.value(name, oldValues[i], newValues[i])
+		}
+	}
+}
+
+// set compares order-insensitively, reporting only added and removed members.
+func (d *fieldDiffs) set(field string, oldValues, newValues []string) {
+	before := len(*d)
+	oldSet := make(map[string]bool, len(oldValues))
+	for _, v := range oldValues {
+		oldSet[v] = true
+	}
+	newSet := make(map[string]bool, len(newValues))
+	for _, v := range newValues {
+		newSet[v] = true
+	}
+	for _, v := range oldValues {
+		if !newSet[v] {
+			*d = append(*d, valueobject.NewFieldRemoved(field, v))
+		}
+	}
+	for _, v := range newValues {
+		if !oldSet[v] {
+			*d = append(*d, valueobject.NewFieldAdded(field, v))
+		}
+	}
+	if len(oldValues) != len(newValues) && len(*d) == before {
+		d.int(field+".count", len(oldValues), len(newValues))
+	}
+}
+
+func (d *fieldDiffs) keyed(field string, oldValues, newValues map[string]string) {
+	for _, k := range sortedKeys(oldValues) {
+		name := field + "." + k
+		if nv, ok := newValues[k]; ok {
+			d.value(name, oldValues[k], nv)
+		} else {
+			*d = append(*d, valueobject.NewFieldRemoved(name, oldValues[k]))
+		}
+	}
+	for _, k := range sortedKeys(newValues) {
+		if _, ok := oldValues[k]; !ok {
+			*d = append(*d, valueobject.NewFieldAdded(field+"."+k, newValues[k]))
+		}
+	}
+}
+
+// nested handles optional sub-structs: a nil on one side is reported as the
+// whole block being added or removed, otherwise fields are compared one by one.
+func nested[T any](d *fieldDiffs, field string, a, b *T, summary func(*T) string, fields func(d *fieldDiffs, prefix string, a, b *T)) {
+	switch {
+	case a == nil && b == nil:
+	case a == nil:
+		*d = append(*d, valueobject.NewFieldAdded(field, summary(b)))
+	case b == nil:
+		*d = append(*d, valueobject.NewFieldRemoved(field, summary(a)))
+	default:
+		fields(d, field+".", a, b)
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func secretRefString(ref *valueobject.SecretRef) string {
+	if ref.Secret() != "" {
+		return "secret:" + ref.Secret()
+	}
+	if ref.Plain() == "" {
+		return ""
+	}
+	return sensitiveValue
+}
+
+func joinFields(parts ...string) string {
+	var nonEmpty []string
+	for _, p := range parts {
+		if p != "" {
+			nonEmpty = append(nonEmpty, p)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
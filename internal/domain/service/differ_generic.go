@@ -10,7 +10,7 @@ func planSimpleEntity[T any](
 	plan *valueobject.Plan,
 	cfgMap map[string]*T,
 	stateMap map[string]*T,
-	equals func(a, b *T) bool,
+	diff func(a, b *T) []valueobject.FieldDiff,
 	entityName string,
 	scopeMatcher func(name string) bool,
 ) {
@@ -32,7 +32,7 @@ func planSimpleEntity[T any](
 
 	for name, cfg := range cfgMap {
 		if state, exists := stateMap[name]; exists {
-			if !equals(state, cfg) {
+			if diffs := diff(state, cfg); len(diffs) > 0 {
 				if scopeMatcher(name) {
 					plan.AddChange(valueobject.NewChangeFull(
 						valueobject.ChangeTypeUpdate,
@@ -42,7 +42,7 @@ func planSimpleEntity[T any](
 						cfg,
 						[]string{fmt.Sprintf("update %s %s", entityName, name)},
 						false,
-					))
+					).WithDiffs(diffs...))
 				}
 			}
 		} else {
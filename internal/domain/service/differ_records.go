@@ -2,74 +2,115 @@ package service
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
 )
 
+// PlanRecords diffs the configured DNS records with the records in state
+// name by name, as sets: the records of one domain, type and name are paired
+// by value first, and a single remaining record on each side is an update of
+// its value. Every other remaining record is created or deleted.
 func (s *DifferService) PlanRecords(plan *valueobject.Plan, cfgRecords []entity.DNSRecord, scope *valueobject.Scope) {
-	recordKey := func(r *entity.DNSRecord) string {
-		return fmt.Sprintf("%s:%s:%s", r.Domain, r.Type, r.Name)
+	stateSets := make(map[string][]*entity.DNSRecord)
+	for _, r := range s.state.Records {
+		stateSets[r.Address()] = append(stateSets[r.Address()], r)
 	}
-
-	stateMap := make(map[string]*entity.DNSRecord)
-	for key, r := range s.state.Records {
-		stateMap[key] = r
-	}
-
-	cfgMap := make(map[string]*entity.DNSRecord)
+	cfgSets := make(map[string][]*entity.DNSRecord)
 	for i := range cfgRecords {
-		key := recordKey(&cfgRecords[i])
-		cfgMap[key] = &cfgRecords[i]
+		r := &cfgRecords[i]
+		cfgSets[r.Address()] = append(cfgSets[r.Address()], r)
 	}
 
-	for key, state := range stateMap {
-		if _, exists := cfgMap[key]; !exists {
-			if scope.Matches("", "", "", state.Domain) {
-				plan.AddChange(valueobject.NewChangeFull(
-					valueobject.ChangeTypeDelete,
-					"dns_record",
-					key,
-					state,
-					nil,
-					[]string{fmt.Sprintf("delete dns record %s", key)},
-					false,
-				))
-			}
+	addresses := make(map[string]string, len(stateSets)+len(cfgSets))
+	for address, set := range stateSets {
+		addresses[address] = set[0].Domain
+	}
+	for address, set := range cfgSets {
+		addresses[address] = set[0].Domain
+	}
+	for _, address := range sortedKeys(addresses) {
+		if scope.Matches("", "", "", addresses[address]) {
+			planRecordSet(plan, stateSets[address], cfgSets[address])
 		}
 	}
+}
 
-	for key, cfg := range cfgMap {
-		if state, exists := stateMap[key]; exists {
-			if !RecordEquals(state, cfg) {
-				if scope.Matches("", "", "", cfg.Domain) {
-					plan.AddChange(valueobject.NewChangeFull(
-						valueobject.ChangeTypeUpdate,
-						"dns_record",
-						key,
-						state,
-						cfg,
-						[]string{fmt.Sprintf("update dns record %s", key)},
-						false,
-					))
-				}
-			}
-		} else {
-			if scope.Matches("", "", "", cfg.Domain) {
-				plan.AddChange(valueobject.NewChangeFull(
-					valueobject.ChangeTypeCreate,
-					"dns_record",
-					key,
-					nil,
-					cfg,
-					[]string{fmt.Sprintf("create dns record %s", key)},
-					false,
-				))
-			}
+func planRecordSet(plan *valueobject.Plan, state, cfg []*entity.DNSRecord) {
+	sortRecords(state)
+	sortRecords(cfg)
+
+	var oldRest, newRest []*entity.DNSRecord
+	byValue := make(map[string]*entity.DNSRecord, len(state))
+	for _, r := range state {
+		byValue[r.Value] = r
+	}
+	for _, r := range cfg {
+		old, ok := byValue[r.Value]
+		if !ok {
+			newRest = append(newRest, r)
+			continue
+		}
+		delete(byValue, r.Value)
+		if diffs := RecordDiff(old, r); len(diffs) > 0 {
+			plan.AddChange(recordChange(valueobject.ChangeTypeUpdate, old, r).WithDiffs(diffs...))
 		}
 	}
+	for _, r := range state {
+		if _, ok := byValue[r.Value]; ok {
+			oldRest = append(oldRest, r)
+		}
+	}
+
+	if len(oldRest) == 1 && len(newRest) == 1 {
+		plan.AddChange(recordChange(valueobject.ChangeTypeUpdate, oldRest[0], newRest[0]).WithDiffs(RecordDiff(oldRest[0], newRest[0])...))
+		return
+	}
+	for _, r := range oldRest {
+		plan.AddChange(recordChange(valueobject.ChangeTypeDelete, r, nil))
+	}
+	for _, r := range newRest {
+		plan.AddChange(recordChange(valueobject.ChangeTypeCreate, nil, r))
+	}
+}
+
+// recordChange names the change after the record it leaves in place, or
+// after the deleted record.
+func recordChange(changeType valueobject.ChangeType, from, to *entity.DNSRecord) *valueobject.Change {
+	var oldState, newState interface{}
+	key := ""
+	if from != nil {
+		oldState, key = from, from.Key()
+	}
+	if to != nil {
+		newState, key = to, to.Key()
+	}
+	return valueobject.NewChangeFull(changeType, "dns_record", key, oldState, newState,
+		[]string{fmt.Sprintf("%s dns record %s", strings.ToLower(changeType.String()), key)}, false)
+}
+
+func sortRecords(records []*entity.DNSRecord) {
+	sort.Slice(records, func(i, j int) bool { return records[i].Value < records[j].Value })
 }
 
 func RecordEquals(a, b *entity.DNSRecord) bool {
-	return a.Domain == b.Domain && a.Type == b.Type && a.Name == b.Name && a.Value == b.Value && a.TTL == b.TTL
+	return len(RecordDiff(a, b)) == 0
+}
+
+// RecordDiff compares the current record a with the desired record b. The
+// TTL is only compared when b sets one, since a record without one gets the
+// default TTL of its provider.
+func RecordDiff(a, b *entity.DNSRecord) []valueobject.FieldDiff {
+	var d fieldDiffs
+	d.value("domain", a.Domain, b.Domain)
+	d.value("type", string(a.Type), string(b.Type))
+	d.value("name", a.Name, b.Name)
+	d.value("value", a.Value, b.Value)
+	if b.TTL > 0 {
+		d.int("ttl", a.TTL, b.TTL)
+	}
+	d.bool("lifecycle.prevent_destroy", a.Lifecycle.PreventDestroy, b.Lifecycle.PreventDestroy)
+	return d
 }
@@ -2,6 +2,7 @@ package service
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
@@ -41,8 +42,11 @@ func (s *DifferService) PlanServers(plan *valueobject.Plan, cfgMap map[string]*e
 				zoneName = z.Name
 			}
 		}
+		if reason, ok := s.state.Unreachable[name]; ok && scope.Matches(zoneName, name, "", "") {
+			plan.AddUnknown(valueobject.Unknown{Entity: "server", Name: name, Reason: reason})
+		}
 		if state, exists := s.state.Servers[name]; exists {
-			if !ServerEquals(state, cfg) {
+			if diffs := ServerDiff(state, cfg); len(diffs) > 0 {
 				if scope.Matches(zoneName, name, "", "") {
 					plan.AddChange(valueobject.NewChangeFull(
 						valueobject.ChangeTypeUpdate,
@@ -52,7 +56,7 @@ func (s *DifferService) PlanServers(plan *valueobject.Plan, cfgMap map[string]*e
 						cfg,
 						[]string{fmt.Sprintf("update server %s", name)},
 						false,
-					))
+					).WithDiffs(diffs...))
 				}
 			}
 		} else {
@@ -72,47 +76,36 @@ func (s *DifferService) PlanServers(plan *valueobject.Plan, cfgMap map[string]*e
 }
 
 func ServerEquals(a, b *entity.Server) bool {
-	if a.Name != b.Name || a.Zone != b.Zone || a.ISP != b.ISP || a.OS != b.OS {
-		return false
-	}
-	if a.IP.Public != b.IP.Public || a.IP.Private != b.IP.Private {
-		return false
-	}
-	if a.SSH.Host != b.SSH.Host || a.SSH.Port != b.SSH.Port || a.SSH.User != b.SSH.User {
-		return false
-	}
+	return len(ServerDiff(a, b)) == 0
+}
+
+func ServerDiff(a, b *entity.Server) []valueobject.FieldDiff {
+	var d fieldDiffs
+	d.value("name", a.Name, b.Name)
+	d.value("zone", a.Zone, b.Zone)
+	d.value("isp", a.ISP, b.ISP)
+	d.value("os", a.OS, b.OS)
+	d.value("ip.public", a.IP.Public, b.IP.Public)
+	d.value("ip.private", a.IP.Private, b.IP.Private)
+	d.value("ssh.host", a.SSH.Host, b.SSH.Host)
+	d.int("ssh.port", a.SSH.Port, b.SSH.Port)
+	d.value("ssh.user", a.SSH.User, b.SSH.User)
 	if !a.SSH.Password.Equals(&b.SSH.Password) {
-		return false
-	}
-	if a.Environment.APTSource != b.Environment.APTSource {
-		return false
-	}
-	if len(a.Environment.Registries) != len(b.Environment.Registries) {
-		return false
-	}
-	for i, reg := range a.Environment.Registries {
-		if i >= len(b.Environment.Registries) || reg != b.Environment.Registries[i] {
-			return false
-		}
+		d = append(d, valueobject.NewFieldDiff("ssh.password", secretRefString(&a.SSH.Password), secretRefString(&b.SSH.Password)))
 	}
-	if len(a.Networks) != len(b.Networks) {
-		return false
-	}
-	// 使用 map 进行顺序不敏感比较，比较所有字段
-	netMapA := make(map[string]entity.ServerNetwork)
-	for _, n := range a.Networks {
-		netMapA[n.Name] = n
-	}
-	for _, n := range b.Networks {
-		netA, ok := netMapA[n.Name]
-		if !ok {
-			return false
-		}
-		if netA.Type != n.Type || netA.Driver != n.Driver {
-			return false
-		}
+	d.value("environment.apt_source", a.Environment.APTSource, b.Environment.APTSource)
+	d.list("environment.registries", a.Environment.Registries, b.Environment.Registries)
+	// 网络按名称比较，与顺序无关
+	d.keyed("networks", serverNetworkMap(a.Networks), serverNetworkMap(b.Networks))
+	return d
+}
+
+func serverNetworkMap(networks []entity.ServerNetwork) map[string]string {
+	m := make(map[string]string, len(networks))
+	for _, n := range networks {
+		m[n.Name] = joinFields(string(n.Type), n.Driver)
 	}
-	return true
+	return m
 }
 
 func planServiceDeletions[T serviceEntity](
@@ -153,8 +146,9 @@ func planServiceUpdatesAndCreates[T serviceEntity](
 	serverMap map[string]*entity.Server,
 	scope *valueobject.Scope,
 	matchScope matchScopeFunc,
+	unreachable map[string]string,
 	entityType string,
-	equals func(a, b T) bool,
+	diff func(a, b T) []valueobject.FieldDiff,
 ) {
 	for name, cfg := range cfgMap {
 		serverName := cfg.GetServer()
@@ -165,12 +159,27 @@ func planServiceUpdatesAndCreates[T serviceEntity](
 		if !matchScope(zoneName, serverName, name) {
 			continue
 		}
+		// What runs on an unreachable server is unknown; creating or
+		// redeploying the service there would only be a guess.
+		if _, ok := unreachable[serverName]; ok {
+			plan.AddUnknown(valueobject.Unknown{Entity: entityType, Name: name,
+				Reason: fmt.Sprintf("server %s unreachable", serverName)})
+			continue
+		}
 
 		if state, exists := stateMap[name]; exists {
-			if scope.ForceDeploy() || !equals(state, cfg) {
+			diffs := diff(state, cfg)
+			if scope.ForceDeploy() || len(diffs) > 0 {
 				changeType := valueobject.ChangeTypeUpdate
-				if scope.ForceDeploy() && equals(state, cfg) {
+				action := fmt.Sprintf("deploy %s %s", entityType, name)
+				switch {
+				case len(diffs) > 0 && runtimeOnly(diffs):
+					action = fmt.Sprintf("restart %s %s", entityType, name)
+				case !lifecycleOnly(diffs):
+				case scope.ForceDeploy():
 					changeType = valueobject.ChangeTypeCreate
+				default:
+					action = fmt.Sprintf("record lifecycle of %s %s", entityType, name)
 				}
 				plan.AddChange(valueobject.NewChangeFull(
 					changeType,
@@ -178,9 +187,9 @@ func planServiceUpdatesAndCreates[T serviceEntity](
 					name,
 					state,
 					cfg,
-					[]string{fmt.Sprintf("deploy %s %s", entityType, name)},
+					[]string{action},
 					true,
-				))
+				).WithDiffs(diffs...))
 			}
 		} else {
 			plan.AddChange(valueobject.NewChangeFull(
@@ -217,79 +226,109 @@ func (s *DifferService) PlanServices(plan *valueobject.Plan, cfgMap map[string]*
 		func(zoneName, serverName, serviceName string) bool {
 			return scope.Matches(zoneName, serverName, serviceName, "")
 		},
+		s.state.Unreachable,
 		"service",
-		ServiceEquals,
+		ServiceDiff,
 	)
 }
 
 func ServiceEquals(a, b *entity.BizService) bool {
-	if a.Name != b.Name || a.Server != b.Server || a.Image != b.Image {
-		return false
-	}
-	if len(a.Ports) != len(b.Ports) {
-		return false
-	}
-	for i, port := range a.Ports {
-		if i >= len(b.Ports) || port != b.Ports[i] {
-			return false
-		}
-	}
-	if len(a.Env) != len(b.Env) {
-		return false
-	}
-	for k, v := range a.Env {
-		if bv, ok := b.Env[k]; !ok || !v.Equals(&bv) {
-			return false
+	return len(ServiceDiff(a, b)) == 0
+}
+
+func ServiceDiff(a, b *entity.BizService) []valueobject.FieldDiff {
+	var d fieldDiffs
+	d.value("name", a.Name, b.Name)
+	d.value("server", a.Server, b.Server)
+	d.value("image", a.Image, b.Image)
+	d.list("ports", mapSlice(a.Ports, formatPort), mapSlice(b.Ports, formatPort))
+	envDiff(&d, a.Env, b.Env)
+	d.list("secrets", a.Secrets, b.Secrets)
+	nested(&d, "healthcheck", a.Healthcheck, b.Healthcheck, formatHealthcheck,
+		func(d *fieldDiffs, prefix string, x, y *entity.ServiceHealthcheck) {
+			d.value(prefix+"path", x.Path, y.Path)
+			d.value(prefix+"interval", x.Interval, y.Interval)
+			d.value(prefix+"timeout", x.Timeout, y.Timeout)
+		})
+	d.value("resources.cpu", a.Resources.CPU, b.Resources.CPU)
+	d.value("resources.memory", a.Resources.Memory, b.Resources.Memory)
+	d.list("volumes", mapSlice(a.Volumes, formatVolume), mapSlice(b.Volumes, formatVolume))
+	d.list("gateways", mapSlice(a.Gateways, formatGatewayRoute), mapSlice(b.Gateways, formatGatewayRoute))
+	d.bool("internal", a.Internal, b.Internal)
+	d.list("networks", a.Networks, b.Networks)
+	d.bool("lifecycle.prevent_destroy", a.Lifecycle.PreventDestroy, b.Lifecycle.PreventDestroy)
+	runtimeDiff(&d, a.Runtime)
+	return d
+}
+
+func envDiff(d *fieldDiffs, a, b map[string]valueobject.SecretRef) {
+	for _, k := range sortedRefKeys(a) {
+		av := a[k]
+		bv, ok := b[k]
+		switch {
+		case !ok:
+			*d = append(*d, valueobject.NewFieldRemoved("env."+k, secretRefString(&av)))
+		case !av.Equals(&bv):
+			*d = append(*d, valueobject.NewFieldDiff("env."+k, secretRefString(&av), secretRefString(&bv)))
 		}
 	}
-	if len(a.Secrets) != len(b.Secrets) {
-		return false
-	}
-	for i, sec := range a.Secrets {
-		if i >= len(b.Secrets) || sec != b.Secrets[i] {
-			return false
+	for _, k := range sortedRefKeys(b) {
+		if _, ok := a[k]; !ok {
+			bv := b[k]
+			*d = append(*d, valueobject.NewFieldAdded("env."+k, secretRefString(&bv)))
 		}
 	}
-	if !healthcheckEqual(a.Healthcheck, b.Healthcheck) {
-		return false
-	}
-	if a.Resources != b.Resources {
-		return false
-	}
-	if len(a.Volumes) != len(b.Volumes) {
-		return false
+}
+
+func sortedRefKeys(m map[string]valueobject.SecretRef) []string {
+	keys := make(map[string]string, len(m))
+	for k := range m {
+		keys[k] = ""
 	}
-	for i, vol := range a.Volumes {
-		if i >= len(b.Volumes) || vol != b.Volumes[i] {
-			return false
-		}
+	return sortedKeys(keys)
+}
+
+func mapSlice[T any](items []T, format func(T) string) []string {
+	out := make([]string, len(items))
+	for i, item := range items {
+		out[i] = format(item)
 	}
-	if len(a.Gateways) != len(b.Gateways) {
-		return false
+	return out
+}
+
+func formatPort(p entity.ServicePort) string {
+	s := fmt.Sprintf("%d:%d", p.Host, p.Container)
+	if p.Protocol != "" {
+		s += "/" + p.Protocol
 	}
-	for i, gw := range a.Gateways {
-		if i >= len(b.Gateways) || gw != b.Gateways[i] {
-			return false
-		}
+	return s
+}
+
+func formatVolume(v entity.ServiceVolume) string {
+	s := v.Source + ":" + v.Target
+	if v.Sync {
+		s += " (sync)"
 	}
-	if a.Internal != b.Internal {
-		return false
+	return s
+}
+
+func formatGatewayRoute(r entity.ServiceGatewayRoute) string {
+	s := fmt.Sprintf("%s%s -> :%d", r.Hostname, r.Path, r.ContainerPort)
+	var proto []string
+	if r.HTTP {
+		proto = append(proto, "http")
 	}
-	if len(a.Networks) != len(b.Networks) {
-		return false
+	if r.HTTPS {
+		proto = append(proto, "https")
 	}
-	for i, net := range a.Networks {
-		if i >= len(b.Networks) || net != b.Networks[i] {
-			return false
-		}
+	if len(proto) > 0 {
+		s += " (" + strings.Join(proto, ",") + ")"
 	}
-	return true
+	return s
 }
 
-func healthcheckEqual(a, b *entity.ServiceHealthcheck) bool {
-	return ptrEqual(a, b, func(x, y *entity.ServiceHealthcheck) bool {
-		return x.Path == y.Path && x.Interval == y.Interval && x.Timeout == y.Timeout
-	})
+func formatHealthcheck(h *entity.ServiceHealthcheck) string {
+	return joinFields("path="+h.Path, "interval="+h.Interval, "timeout="+h.Timeout)
 }
 
 func (s *DifferService) PlanInfraServices(plan *valueobject.Plan, cfgMap map[string]*entity.InfraService, serverMap map[string]*entity.Server, scope *valueobject.Scope) {
@@ -313,105 +352,70 @@ func (s *DifferService) PlanInfraServices(plan *valueobject.Plan, cfgMap map[str
 		func(zoneName, serverName, serviceName string) bool {
 			return scope.MatchesInfra(zoneName, serverName, serviceName)
 		},
+		s.state.Unreachable,
 		"infra_service",
-		InfraServiceEquals,
+		InfraServiceDiff,
 	)
 }
 
 func InfraServiceEquals(a, b *entity.InfraService) bool {
-	if a.Name != b.Name || a.Server != b.Server || a.Image != b.Image || a.Type != b.Type {
-		return false
-	}
-	if a.GatewayLogLevel != b.GatewayLogLevel {
-		return false
-	}
-	if !gatewayPortsEqual(a.GatewayPorts, b.GatewayPorts) {
-		return false
-	}
-	if !gatewayConfigEqual(a.GatewayConfig, b.GatewayConfig) {
-		return false
-	}
-	if !gatewaySSLConfigEqual(a.GatewaySSL, b.GatewaySSL) {
-		return false
-	}
-	if !gatewayWAFConfigEqual(a.GatewayWAF, b.GatewayWAF) {
-		return false
-	}
-	if !sslConfigEqual(a.SSLConfig, b.SSLConfig) {
-		return false
-	}
-	// Networks: order-insensitive comparison
-	if len(a.Networks) != len(b.Networks) {
-		return false
-	}
-	netMap := make(map[string]struct{})
-	for _, net := range a.Networks {
-		netMap[net] = struct{}{}
-	}
-	for _, net := range b.Networks {
-		if _, ok := netMap[net]; !ok {
-			return false
-		}
-	}
-	return true
+	return len(InfraServiceDiff(a, b)) == 0
 }
 
-func gatewayPortsEqual(a, b *entity.GatewayPorts) bool {
-	return ptrEqual(a, b, func(x, y *entity.GatewayPorts) bool {
-		return x.HTTP == y.HTTP && x.HTTPS == y.HTTPS
-	})
-}
-
-func gatewayConfigEqual(a, b *entity.GatewayConfig) bool {
-	return ptrEqual(a, b, func(x, y *entity.GatewayConfig) bool {
-		return x.Source == y.Source && x.Sync == y.Sync
-	})
-}
-
-func gatewaySSLConfigEqual(a, b *entity.GatewaySSLConfig) bool {
-	return ptrEqual(a, b, func(x, y *entity.GatewaySSLConfig) bool {
-		return x.Mode == y.Mode && x.Endpoint == y.Endpoint
-	})
-}
-
-func gatewayWAFConfigEqual(a, b *entity.GatewayWAFConfig) bool {
-	return ptrEqual(a, b, func(x, y *entity.GatewayWAFConfig) bool {
-		if x.Enabled != y.Enabled {
-			return false
-		}
-		if len(x.Whitelist) != len(y.Whitelist) {
-			return false
-		}
-		for i, w := range x.Whitelist {
-			if i >= len(y.Whitelist) || w != y.Whitelist[i] {
-				return false
-			}
-		}
-		return true
-	})
-}
-
-func sslConfigEqual(a, b *entity.SSLConfig) bool {
-	return ptrEqual(a, b, func(x, y *entity.SSLConfig) bool {
-		if x.Ports.API != y.Ports.API {
-			return false
-		}
-		if x.Config == nil && y.Config == nil {
-			return true
-		}
-		if x.Config == nil || y.Config == nil {
-			return false
-		}
-		return x.Config.Source == y.Config.Source && x.Config.Sync == y.Config.Sync
-	})
+func InfraServiceDiff(a, b *entity.InfraService) []valueobject.FieldDiff {
+	var d fieldDiffs
+	d.value("name", a.Name, b.Name)
+	d.value("server", a.Server, b.Server)
+	d.value("image", a.Image, b.Image)
+	d.value("type", string(a.Type), string(b.Type))
+	d.int("log_level", a.GatewayLogLevel, b.GatewayLogLevel)
+	nested(&d, "ports", a.GatewayPorts, b.GatewayPorts,
+		func(p *entity.GatewayPorts) string { return fmt.Sprintf("http=%d https=%d", p.HTTP, p.HTTPS) },
+		func(d *fieldDiffs, prefix string, x, y *entity.GatewayPorts) {
+			d.int(prefix+"http", x.HTTP, y.HTTP)
+			d.int(prefix+"https", x.HTTPS, y.HTTPS)
+		})
+	nested(&d, "config", a.GatewayConfig, b.GatewayConfig,
+		func(c *entity.GatewayConfig) string { return fmt.Sprintf("source=%s sync=%t", c.Source, c.Sync) },
+		func(d *fieldDiffs, prefix string, x, y *entity.GatewayConfig) {
+			d.value(prefix+"source", x.Source, y.Source)
+			d.bool(prefix+"sync", x.Sync, y.Sync)
+		})
+	nested(&d, "ssl", a.GatewaySSL, b.GatewaySSL,
+		func(c *entity.GatewaySSLConfig) string { return joinFields("mode="+c.Mode, "endpoint="+c.Endpoint) },
+		func(d *fieldDiffs, prefix string, x, y *entity.GatewaySSLConfig) {
+			d.value(prefix+"mode", x.Mode, y.Mode)
+			d.value(prefix+"endpoint", x.Endpoint, y.Endpoint)
+		})
+	nested(&d, "waf", a.GatewayWAF, b.GatewayWAF,
+		func(w *entity.GatewayWAFConfig) string {
+			return fmt.Sprintf("enabled=%t whitelist=[%s]", w.Enabled, strings.Join(w.Whitelist, ", "))
+		},
+		func(d *fieldDiffs, prefix string, x, y *entity.GatewayWAFConfig) {
+			d.bool(prefix+"enabled", x.Enabled, y.Enabled)
+			d.list(prefix+"whitelist", x.Whitelist, y.Whitelist)
+		})
+	nested(&d, "ssl_config", a.SSLConfig, b.SSLConfig, formatSSLConfig,
+		func(d *fieldDiffs, prefix string, x, y *entity.SSLConfig) {
+			d.int(prefix+"ports.api", x.Ports.API, y.Ports.API)
+			nested(d, prefix+"config", x.Config, y.Config,
+				func(c *entity.SSLVolumeConfig) string { return fmt.Sprintf("source=%s sync=%t", c.Source, c.Sync) },
+				func(d *fieldDiffs, prefix string, x, y *entity.SSLVolumeConfig) {
+					d.value(prefix+"source", x.Source, y.Source)
+					d.bool(prefix+"sync", x.Sync, y.Sync)
+				})
+		})
+	// Networks: order-insensitive comparison
+	d.set("networks", a.Networks, b.Networks)
+	d.bool("lifecycle.prevent_destroy", a.Lifecycle.PreventDestroy, b.Lifecycle.PreventDestroy)
+	runtimeDiff(&d, a.Runtime)
+	return d
 }
 
-func ptrEqual[T any](a, b *T, eq func(a, b *T) bool) bool {
-	if a == nil && b == nil {
-		return true
-	}
-	if a == nil || b == nil {
-		return false
+func formatSSLConfig(c *entity.SSLConfig) string {
+	s := fmt.Sprintf("api=%d", c.Ports.API)
+	if c.Config != nil {
+		s += fmt.Sprintf(" source=%s sync=%t", c.Config.Source, c.Config.Sync)
 	}
-	return eq(a, b)
+	return s
 }
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
@@ -351,6 +352,12 @@ func TestRecordEquals(t *testing.T) {
 			b:        &entity.DNSRecord{Domain: "example.com", Type: "A", Name: "www", Value: "1.2.3.4", TTL: 600},
 			expected: false,
 		},
+		{
+			name:     "provider default TTL against no configured TTL",
+			a:        &entity.DNSRecord{Domain: "example.com", Type: "A", Name: "www", Value: "1.2.3.4", TTL: 600},
+			b:        &entity.DNSRecord{Domain: "example.com", Type: "A", Name: "www", Value: "1.2.3.4"},
+			expected: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -407,6 +414,86 @@ func TestServiceEquals(t *testing.T) {
 	}
 }
 
+func TestServiceDiff(t *testing.T) {
+	a := &entity.BizService{Name: "svc1", Image: "app:v1",
+		Ports: []entity.ServicePort{{Host: 8080, Container: 80}},
+		Env: map[string]valueobject.SecretRef{
+			"KEEP": *valueobject.NewSecretRefPlain("same"),
+			"PASS": *valueobject.NewSecretRefPlain("old-secret"),
+			"OLD":  *valueobject.NewSecretRefSecret("old_ref"),
+		}}
+	b := &entity.BizService{Name: "svc1", Image: "app:v2",
+		Ports: []entity.ServicePort{{Host: 8080, Container: 80}, {Host: 9090, Container: 90}},
+		Env: map[string]valueobject.SecretRef{
+			"KEEP": *valueobject.NewSecretRefPlain("same"),
+			"PASS": *valueobject.NewSecretRefPlain("new-secret"),
+			"NEW":  *valueobject.NewSecretRefSecret("new_ref"),
+		}}
+
+	got := make(map[string]string)
+	for _, d := range ServiceDiff(a, b) {
+		got[d.Field()] = d.String()
+	}
+
+	expected := map[string]string{
+		"image":    `~ image = "app:v1" -> "app:v2"`,
+		"ports[1]": `+ ports[1] = "9090:90"`,
+		"env.PASS": `~ env.PASS = "(sensitive)" -> "(sensitive)"`,
+		"env.OLD":  `- env.OLD = "secret:old_ref" -> null`,
+		"env.NEW":  `+ env.NEW = "secret:new_ref"`,
+	}
+	if len(got) != len(expected) {
+		t.Errorf("expected %d diffs, got %v", len(expected), got)
+	}
+	for field, want := range expected {
+		if got[field] != want {
+			t.Errorf("diff %s = %q, expected %q", field, got[field], want)
+		}
+	}
+}
+
+func TestInfraServiceDiff(t *testing.T) {
+	a := &entity.InfraService{Name: "gw", ServiceBase: entity.ServiceBase{Networks: []string{"a", "b"}},
+		GatewayPorts: &entity.GatewayPorts{HTTP: 80, HTTPS: 443}}
+	b := &entity.InfraService{Name: "gw", ServiceBase: entity.ServiceBase{Networks: []string{"b", "a"}},
+		GatewayPorts: &entity.GatewayPorts{HTTP: 8080, HTTPS: 443},
+		GatewayWAF:   &entity.GatewayWAFConfig{Enabled: true}}
+
+	diffs := InfraServiceDiff(a, b)
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 diffs, got %v", diffs)
+	}
+	if diffs[0].Field() != "ports.http" || diffs[0].OldValue() != "80" || diffs[0].NewValue() != "8080" {
+		t.Errorf("unexpected ports diff: %s", diffs[0])
+	}
+	if diffs[1].Field() != "waf" || diffs[1].Type() != valueobject.ChangeTypeCreate {
+		t.Errorf("unexpected waf diff: %s", diffs[1])
+	}
+}
+
+func TestDifferService_PlanServices_Diffs(t *testing.T) {
+	state := &repository.DeploymentState{
+		Services: map[string]*entity.BizService{
+			"api": {Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "api:1.0"},
+		},
+	}
+	svc := NewDifferService(state)
+	plan := valueobject.NewPlan()
+
+	cfgMap := map[string]*entity.BizService{
+		"api": {Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "api:1.1"},
+	}
+	svc.PlanServices(plan, cfgMap, map[string]*entity.Server{}, valueobject.NewScope())
+
+	if len(plan.Changes()) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(plan.Changes()))
+	}
+	diffs := plan.Changes()[0].Diffs()
+	if len(diffs) != 1 || diffs[0].Field() != "image" {
+		t.Errorf("expected only the image to differ, got %v", diffs)
+	}
+}
+
 func TestDifferService_PlanZones(t *testing.T) {
 	svc := NewDifferService(nil)
 	plan := valueobject.NewPlan()
@@ -458,6 +545,58 @@ func TestDifferService_PlanRecords(t *testing.T) {
 	}
 }
 
+func TestDifferService_PlanRecords_DefaultTTL(t *testing.T) {
+	st := repository.NewDeploymentState()
+	for _, r := range []entity.DNSRecord{
+		{Domain: "example.com", Type: "A", Name: "www", Value: "1.2.3.4", TTL: 600},
+		{Domain: "example.com", Type: "A", Name: "api", Value: "1.2.3.4", TTL: 1},
+	} {
+		record := r
+		st.Records[record.Key()] = &record
+	}
+	svc := NewDifferService(st)
+	plan := valueobject.NewPlan()
+
+	svc.PlanRecords(plan, []entity.DNSRecord{
+		{Domain: "example.com", Type: "A", Name: "www", Value: "1.2.3.4"},
+		{Domain: "example.com", Type: "A", Name: "api", Value: "1.2.3.4"},
+	}, valueobject.NewScope())
+
+	if len(plan.Changes()) != 0 {
+		t.Errorf("records without a configured TTL should not be updated, got %+v", plan.Changes())
+	}
+}
+
+func TestDifferService_PlanRecords_MultiValue(t *testing.T) {
+	st := repository.NewDeploymentState()
+	for _, r := range []entity.DNSRecord{
+		{Domain: "example.com", Type: "A", Name: "www", Value: "1.1.1.1", TTL: 300},
+		{Domain: "example.com", Type: "A", Name: "www", Value: "3.3.3.3", TTL: 300},
+		{Domain: "example.com", Type: "MX", Name: "@", Value: "10 mx1.example.com", TTL: 300},
+	} {
+		record := r
+		st.Records[record.Key()] = &record
+	}
+	svc := NewDifferService(st)
+	plan := valueobject.NewPlan()
+
+	svc.PlanRecords(plan, []entity.DNSRecord{
+		{Domain: "example.com", Type: "A", Name: "www", Value: "1.1.1.1", TTL: 300},
+		{Domain: "example.com", Type: "A", Name: "www", Value: "2.2.2.2", TTL: 300},
+		{Domain: "example.com", Type: "MX", Name: "@", Value: "10 mx1.example.com", TTL: 300},
+		{Domain: "example.com", Type: "MX", Name: "@", Value: "20 mx2.example.com", TTL: 300},
+	}, valueobject.NewScope())
+
+	var got []string
+	for _, ch := range plan.Changes() {
+		got = append(got, ch.Type().String()+" "+ch.Name())
+	}
+	want := []string{"UPDATE example.com:A:www:2.2.2.2", "CREATE example.com:MX:@:20 mx2.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+}
+
 func TestDifferService_PlanServers(t *testing.T) {
 	svc := NewDifferService(nil)
 	plan := valueobject.NewPlan()
@@ -509,3 +648,24 @@ func TestDifferService_GetSetState(t *testing.T) {
 		t.Error("expected state to be set and retrieved")
 	}
 }
+
+func TestDifferService_PlanServices_UnreachableServer(t *testing.T) {
+	state := repository.NewDeploymentState()
+	state.Unreachable["srv2"] = "server unreachable: no answer within 1m0s"
+	svc := NewDifferService(state)
+	plan := valueobject.NewPlan()
+
+	cfgMap := map[string]*entity.BizService{
+		"api": {Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "api:1.0"},
+		"web": {Name: "web", ServiceBase: entity.ServiceBase{Server: "srv2"}, Image: "web:1.0"},
+	}
+	svc.PlanServices(plan, cfgMap, map[string]*entity.Server{}, valueobject.NewScope())
+
+	if len(plan.Changes()) != 1 || plan.Changes()[0].Name() != "api" {
+		t.Errorf("changes = %v, want only api to be created", plan.Changes())
+	}
+	unknown := plan.Unknown()
+	if len(unknown) != 1 || unknown[0].Entity != "service" || unknown[0].Name != "web" {
+		t.Errorf("unknown = %+v, want service web", unknown)
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+const lifecyclePrefix = "lifecycle."
+
+// LifecycleOnly reports whether ch is an update that changes nothing but the
+// lifecycle of its entity. Lifecycle settings only live in the state, so
+// such a change is recorded without touching servers or DNS providers.
+func LifecycleOnly(ch *valueobject.Change) bool {
+	return ch.Type() == valueobject.ChangeTypeUpdate && len(ch.Diffs()) > 0 && lifecycleOnly(ch.Diffs())
+}
+
+func lifecycleOnly(diffs []valueobject.FieldDiff) bool {
+	for _, d := range diffs {
+		if !strings.HasPrefix(d.Field(), lifecyclePrefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckPreventDestroy fails with ErrPreventDestroy, naming every protected
+// resource, when p deletes or recreates an entity whose recorded or desired
+// lifecycle sets prevent_destroy. Moving a service to another server
+// recreates it: its containers and volumes are not carried over.
+func CheckPreventDestroy(p *valueobject.Plan) error {
+	var blocked []string
+	for _, ch := range p.Changes() {
+		ref := EntityRef{Kind: ch.Entity(), Name: ch.Name()}.String()
+		switch {
+		case ch.Type() == valueobject.ChangeTypeDelete && preventsDestroy(ch.OldState()):
+			blocked = append(blocked, "deletes "+ref)
+		case ch.Type() == valueobject.ChangeTypeUpdate && (preventsDestroy(ch.OldState()) || preventsDestroy(ch.NewState())):
+			for _, d := range ch.Diffs() {
+				if d.Field() == "server" {
+					blocked = append(blocked, fmt.Sprintf("recreates %s (server %s -> %s)", ref, d.OldValue(), d.NewValue()))
+				}
+			}
+		}
+	}
+	if len(blocked) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: plan %s; set prevent_destroy to false and apply first to allow it",
+		domain.ErrPreventDestroy, strings.Join(blocked, ", "))
+}
+
+func preventsDestroy(state interface{}) bool {
+	switch v := state.(type) {
+	case *entity.BizService:
+		return v.Lifecycle.PreventDestroy
+	case *entity.InfraService:
+		return v.Lifecycle.PreventDestroy
+	case *entity.Domain:
+		return v.Lifecycle.PreventDestroy
+	case *entity.DNSRecord:
+		return v.Lifecycle.PreventDestroy
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+func TestCheckPreventDestroy(t *testing.T) {
+	protected := entity.Lifecycle{PreventDestroy: true}
+	oldDB := &entity.BizService{Name: "db", ServiceBase: entity.ServiceBase{Server: "srv1", Lifecycle: protected}}
+	newDB := &entity.BizService{Name: "db", ServiceBase: entity.ServiceBase{Server: "srv2", Lifecycle: protected}}
+
+	p := valueobject.NewPlan()
+	p.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeDelete, "service", "old", &entity.BizService{Name: "old"}, nil, nil, true))
+	p.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeUpdate, "service", "web", nil,
+		&entity.BizService{Name: "web", ServiceBase: entity.ServiceBase{Lifecycle: protected}, Image: "web:2"}, nil, true).
+		WithDiffs(valueobject.NewFieldDiff("image", "web:1", "web:2")))
+	if err := CheckPreventDestroy(p); err != nil {
+		t.Fatalf("CheckPreventDestroy() = %v, want nil for unprotected deletes and in-place updates", err)
+	}
+
+	p.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeDelete, "dns_record", "example.com:A:www",
+		&entity.DNSRecord{Domain: "example.com", Type: entity.DNSRecordTypeA, Name: "www", Lifecycle: protected}, nil, nil, false))
+	p.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeUpdate, "service", "db", oldDB, newDB, nil, true).
+		WithDiffs(ServiceDiff(oldDB, newDB)...))
+
+	err := CheckPreventDestroy(p)
+	if !errors.Is(err, domain.ErrPreventDestroy) {
+		t.Fatalf("CheckPreventDestroy() = %v, want ErrPreventDestroy", err)
+	}
+	for _, want := range []string{"deletes dns_record:example.com:A:www", "recreates service:db (server srv1 -> srv2)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "service:old") {
+		t.Errorf("error %q names an unprotected resource", err)
+	}
+}
+
+func TestLifecycleOnly(t *testing.T) {
+	a := &entity.BizService{Name: "api", Image: "api:1"}
+	b := &entity.BizService{Name: "api", Image: "api:1", ServiceBase: entity.ServiceBase{Lifecycle: entity.Lifecycle{PreventDestroy: true}}}
+	ch := valueobject.NewChangeFull(valueobject.ChangeTypeUpdate, "service", "api", a, b, nil, true).WithDiffs(ServiceDiff(a, b)...)
+	if !LifecycleOnly(ch) {
+		t.Errorf("LifecycleOnly() = false for diffs %v", ch.Diffs())
+	}
+
+	b.Image = "api:2"
+	ch = ch.WithDiffs(ServiceDiff(a, b)...)
+	if LifecycleOnly(ch) {
+		t.Errorf("LifecycleOnly() = true for diffs %v", ch.Diffs())
+	}
+	if LifecycleOnly(valueobject.NewChange(valueobject.ChangeTypeUpdate, "service", "api")) {
+		t.Error("LifecycleOnly() = true for an update without diffs")
+	}
+}
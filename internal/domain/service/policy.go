@@ -0,0 +1,113 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+// PolicyViolation is a change of a plan that breaks a policy.
+type PolicyViolation struct {
+	Policy   string `json:"policy"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Resource string `json:"resource"`
+	Message  string `json:"message"`
+}
+
+// PolicyOptions are the overrides given on the command line.
+type PolicyOptions struct {
+	// AllowDestroy turns no_delete denials into warnings.
+	AllowDestroy bool
+}
+
+// EvaluatePolicies checks every change of p against the policies of cfg.
+// Only what the plan changes is checked, so existing resources that break a
+// newly added policy do not block unrelated applies.
+func EvaluatePolicies(cfg *entity.Config, p *valueobject.Plan, opts PolicyOptions) []PolicyViolation {
+	var violations []PolicyViolation
+	for i := range cfg.Policies {
+		policy := &cfg.Policies[i]
+		for _, ch := range p.Changes() {
+			for _, msg := range checkPolicy(policy, ch) {
+				v := PolicyViolation{
+					Policy:   policy.Name,
+					Rule:     policy.Rule,
+					Severity: policy.Severity,
+					Resource: EntityRef{Kind: ch.Entity(), Name: ch.Name()}.String(),
+					Message:  msg,
+				}
+				if policy.Message != "" {
+					v.Message = policy.Message + " (" + msg + ")"
+				}
+				if policy.Rule == entity.PolicyRuleNoDelete && opts.AllowDestroy && v.Severity == entity.PolicySeverityDeny {
+					v.Severity = entity.PolicySeverityWarn
+					v.Message += ", allowed by --allow-destroy"
+				}
+				violations = append(violations, v)
+			}
+		}
+	}
+	return violations
+}
+
+// HasDenials reports whether any violation blocks apply.
+func HasDenials(violations []PolicyViolation) bool {
+	for _, v := range violations {
+		if v.Severity == entity.PolicySeverityDeny {
+			return true
+		}
+	}
+	return false
+}
+
+func checkPolicy(policy *entity.Policy, ch *valueobject.Change) []string {
+	switch policy.Rule {
+	case entity.PolicyRuleNoDelete:
+		if ch.Type() != valueobject.ChangeTypeDelete {
+			return nil
+		}
+		for _, kind := range policy.DeleteKinds() {
+			if kind == ch.Entity() {
+				return []string{fmt.Sprintf("deletes %s %s", ch.Entity(), ch.Name())}
+			}
+		}
+	case entity.PolicyRuleNoLatestTag:
+		var image string
+		switch v := ch.NewState().(type) {
+		case *entity.BizService:
+			image = v.Image
+		case *entity.InfraService:
+			image = v.Image
+		}
+		if ch.Type() != valueobject.ChangeTypeDelete && image != "" && !pinnedImage(image) {
+			return []string{fmt.Sprintf("image %s is not pinned to a tag other than latest", image)}
+		}
+	case entity.PolicyRuleHTTPSRoutes:
+		svc, ok := ch.NewState().(*entity.BizService)
+		if !ok || ch.Type() == valueobject.ChangeTypeDelete {
+			return nil
+		}
+		var msgs []string
+		for _, gw := range svc.Gateways {
+			if !gw.HTTPS {
+				msgs = append(msgs, fmt.Sprintf("gateway route %s%s does not serve HTTPS", gw.Hostname, gw.Path))
+			}
+		}
+		return msgs
+	}
+	return nil
+}
+
+// pinnedImage reports whether image names a digest or a tag other than
+// latest. A colon before the last slash belongs to a registry port.
+func pinnedImage(image string) bool {
+	if strings.Contains(image, "@") {
+		return true
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	_, tag, ok := strings.Cut(name, ":")
+	return ok && tag != "" && tag != "latest"
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+func TestEvaluatePolicies(t *testing.T) {
+	cfg := &entity.Config{Policies: []entity.Policy{
+		{Name: "keep-services", Rule: entity.PolicyRuleNoDelete, Severity: entity.PolicySeverityDeny},
+		{Name: "pinned-images", Rule: entity.PolicyRuleNoLatestTag, Severity: entity.PolicySeverityWarn},
+		{Name: "https-only", Rule: entity.PolicyRuleHTTPSRoutes, Severity: entity.PolicySeverityDeny},
+	}}
+	p := valueobject.NewPlan()
+	p.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeDelete, "service", "old",
+		&entity.BizService{Name: "old", Image: "old:latest"}, nil, nil, true))
+	p.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "service", "api", nil,
+		&entity.BizService{Name: "api", Image: "registry:5000/api", Gateways: []entity.ServiceGatewayRoute{
+			{Hostname: "api.example.com", HTTP: true},
+			{Hostname: "secure.example.com", HTTPS: true},
+		}}, nil, false))
+	p.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeUpdate, "service", "web", nil,
+		&entity.BizService{Name: "web", Image: "web@sha256:abc"}, nil, true))
+	p.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeDelete, "dns_record", "example.com:A:www",
+		&entity.DNSRecord{Domain: "example.com", Type: entity.DNSRecordTypeA, Name: "www"}, nil, nil, true))
+
+	violations := EvaluatePolicies(cfg, p, PolicyOptions{})
+	want := []struct{ policy, severity, resource string }{
+		{"keep-services", entity.PolicySeverityDeny, "service:old"},
+		{"pinned-images", entity.PolicySeverityWarn, "service:api"},
+		{"https-only", entity.PolicySeverityDeny, "service:api"},
+	}
+	if len(violations) != len(want) {
+		t.Fatalf("EvaluatePolicies() = %+v, want %d violations", violations, len(want))
+	}
+	for i, w := range want {
+		v := violations[i]
+		if v.Policy != w.policy || v.Severity != w.severity || v.Resource != w.resource {
+			t.Errorf("violation[%d] = %+v, want %+v", i, v, w)
+		}
+	}
+	if !HasDenials(violations) {
+		t.Error("HasDenials() = false, want true")
+	}
+
+	violations = EvaluatePolicies(cfg, p, PolicyOptions{AllowDestroy: true})
+	if violations[0].Severity != entity.PolicySeverityWarn {
+		t.Errorf("--allow-destroy should downgrade deletes to warnings, got %+v", violations[0])
+	}
+}
+
+func TestPinnedImage(t *testing.T) {
+	for image, want := range map[string]bool{
+		"nginx":                     false,
+		"nginx:latest":              false,
+		"nginx:1.25":                true,
+		"registry:5000/team/app":    false,
+		"registry:5000/team/app:v2": true,
+		"app@sha256:0123":           true,
+	} {
+		if got := pinnedImage(image); got != want {
+			t.Errorf("pinnedImage(%q) = %v, want %v", image, got, want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lite-lake/infra-yamlops/internal/constants"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+const runtimePrefix = "runtime."
+
+// runtimeDiff adds how the container of a fetched service differs from a
+// healthy deployment of its config: not running, crash-looping, unhealthy,
+// running another image than its reference resolves to, or started with an
+// outdated env file. Deploying the service recreates the container, which
+// fixes each of them.
+func runtimeDiff(d *fieldDiffs, rt *entity.ServiceRuntime) {
+	if rt == nil {
+		return
+	}
+	switch {
+	case rt.Status != "" && rt.Status != "running":
+		status := rt.Status
+		if rt.RestartCount > 0 {
+			status = fmt.Sprintf("%s (%d restarts)", rt.Status, rt.RestartCount)
+		}
+		d.value(runtimePrefix+"status", status, "running")
+	case rt.RestartCount >= constants.CrashLoopRestarts:
+		d.int(runtimePrefix+"restart_count", rt.RestartCount, 0)
+	}
+	if rt.Health == "unhealthy" {
+		d.value(runtimePrefix+"health", rt.Health, "healthy")
+	}
+	if rt.WantImageDigest != "" {
+		d.value(runtimePrefix+"image_digest", rt.ImageDigest, rt.WantImageDigest)
+	}
+	if rt.WantEnvFileHash != "" {
+		d.value(runtimePrefix+"env_file", rt.EnvFileHash, rt.WantEnvFileHash)
+	}
+}
+
+// runtimeOnly reports whether diffs only concern the container of a service
+// that is otherwise deployed as configured, so that deploying it amounts to
+// a restart.
+func runtimeOnly(diffs []valueobject.FieldDiff) bool {
+	for _, d := range diffs {
+		if !strings.HasPrefix(d.Field(), runtimePrefix) {
+			return false
+		}
+	}
+	return true
+}
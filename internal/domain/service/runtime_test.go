@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+func TestRuntimeDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		rt   *entity.ServiceRuntime
+		want map[string][2]string
+	}{
+		{"not fetched", nil, map[string][2]string{}},
+		{"healthy", &entity.ServiceRuntime{Status: "running", RestartCount: 1, Health: "healthy"}, map[string][2]string{}},
+		{"stopped", &entity.ServiceRuntime{Status: "exited"}, map[string][2]string{
+			"runtime.status": {"exited", "running"},
+		}},
+		{"crash loop", &entity.ServiceRuntime{Status: "restarting", RestartCount: 12}, map[string][2]string{
+			"runtime.status": {"restarting (12 restarts)", "running"},
+		}},
+		{"restarted often", &entity.ServiceRuntime{Status: "running", RestartCount: 5, Health: "unhealthy"}, map[string][2]string{
+			"runtime.restart_count": {"5", "0"},
+			"runtime.health":        {"unhealthy", "healthy"},
+		}},
+		{"outdated", &entity.ServiceRuntime{Status: "running",
+			ImageDigest: "sha256:old", WantImageDigest: "sha256:new",
+			EnvFileHash: "aaaa", WantEnvFileHash: "bbbb"}, map[string][2]string{
+			"runtime.image_digest": {"sha256:old", "sha256:new"},
+			"runtime.env_file":     {"aaaa", "bbbb"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d fieldDiffs
+			runtimeDiff(&d, tt.rt)
+			got := make(map[string][2]string)
+			for _, fd := range d {
+				got[fd.Field()] = [2]string{fd.OldValue(), fd.NewValue()}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("runtimeDiff() = %v, want %v", got, tt.want)
+			}
+			for field, want := range tt.want {
+				if got[field] != want {
+					t.Errorf("%s = %v, want %v", field, got[field], want)
+				}
+			}
+		})
+	}
+}
+
+func TestDifferService_PlanServices_Runtime(t *testing.T) {
+	state := &repository.DeploymentState{
+		Services: map[string]*entity.BizService{
+			"api": {Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1",
+				Runtime: &entity.ServiceRuntime{Status: "exited"}}, Image: "api:1.0"},
+		},
+	}
+	plan := valueobject.NewPlan()
+	cfgMap := map[string]*entity.BizService{
+		"api": {Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "api:1.0"},
+	}
+	NewDifferService(state).PlanServices(plan, cfgMap, map[string]*entity.Server{}, valueobject.NewScope())
+
+	if len(plan.Changes()) != 1 {
+		t.Fatalf("expected 1 change, got %d", len(plan.Changes()))
+	}
+	ch := plan.Changes()[0]
+	if ch.Type() != valueobject.ChangeTypeUpdate || len(ch.Actions()) != 1 || ch.Actions()[0] != "restart service api" {
+		t.Errorf("change = %s %v, want an update restarting api", ch.Type(), ch.Actions())
+	}
+}
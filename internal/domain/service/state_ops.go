@@ -0,0 +1,346 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lite-lake/infra-yamlops/internal/constants"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+// ParseEntityRef parses an address of the form kind:name, e.g. service:api or
+// dns_record:example.com:A:www:1.2.3.4.
+func ParseEntityRef(s string) (EntityRef, error) {
+	kind, name, ok := strings.Cut(s, ":")
+	if !ok || name == "" {
+		return EntityRef{}, fmt.Errorf("%w: address %q must be <entity>:<name>", domain.ErrInvalidFormat, s)
+	}
+	if _, known := entityApplyRank[kind]; !known {
+		return EntityRef{}, fmt.Errorf("%w: entity %s", domain.ErrInvalidType, kind)
+	}
+	return EntityRef{Kind: kind, Name: name}, nil
+}
+
+// StateRefs lists every entity recorded in st, ordered by entity kind in
+// apply order and then by name.
+func StateRefs(st *repository.DeploymentState) []EntityRef {
+	var refs []EntityRef
+	refs = appendKeys(refs, "isp", st.ISPs)
+	refs = appendKeys(refs, "zone", st.Zones)
+	refs = appendKeys(refs, "domain", st.Domains)
+	refs = appendKeys(refs, "server", st.Servers)
+	refs = appendKeys(refs, "infra_service", st.InfraServices)
+	refs = appendKeys(refs, "service", st.Services)
+	refs = appendKeys(refs, "dns_record", st.Records)
+	sortRefs(refs)
+	return refs
+}
+
+// sortRefs orders refs by entity kind in apply order and then by name.
+func sortRefs(refs []EntityRef) {
+	sort.SliceStable(refs, func(i, j int) bool {
+		if refs[i].Kind != refs[j].Kind {
+			return entityApplyRank[refs[i].Kind] < entityApplyRank[refs[j].Kind]
+		}
+		return refs[i].Name < refs[j].Name
+	})
+}
+
+func appendKeys[T any](refs []EntityRef, kind string, m map[string]*T) []EntityRef {
+	for name := range m {
+		refs = append(refs, EntityRef{Kind: kind, Name: name})
+	}
+	return refs
+}
+
+// StateEntity returns the entity recorded in st under ref.
+func StateEntity(st *repository.DeploymentState, ref EntityRef) (interface{}, bool) {
+	switch ref.Kind {
+	case "isp":
+		return lookup(st.ISPs, ref.Name)
+	case "zone":
+		return lookup(st.Zones, ref.Name)
+	case "domain":
+		return lookup(st.Domains, ref.Name)
+	case "server":
+		return lookup(st.Servers, ref.Name)
+	case "infra_service":
+		return lookup(st.InfraServices, ref.Name)
+	case "service":
+		return lookup(st.Services, ref.Name)
+	case "dns_record":
+		return lookup(st.Records, ref.Name)
+	}
+	return nil, false
+}
+
+func lookup[T any](m map[string]*T, name string) (interface{}, bool) {
+	v, ok := m[name]
+	if !ok {
+		return nil, false
+	}
+	return v, true
+}
+
+// RemoveFromState forgets ref without touching any server or provider.
+// Removing a domain also forgets its records.
+func RemoveFromState(st *repository.DeploymentState, ref EntityRef) error {
+	if _, ok := StateEntity(st, ref); !ok {
+		return fmt.Errorf("%w: %s", domain.ErrStateEntryNotFound, ref)
+	}
+	switch ref.Kind {
+	case "isp":
+		delete(st.ISPs, ref.Name)
+	case "zone":
+		delete(st.Zones, ref.Name)
+	case "domain":
+		delete(st.Domains, ref.Name)
+		for key, r := range st.Records {
+			if r.Domain == ref.Name {
+				delete(st.Records, key)
+			}
+		}
+	case "server":
+		delete(st.Servers, ref.Name)
+	case "infra_service":
+		delete(st.InfraServices, ref.Name)
+	case "service":
+		delete(st.Services, ref.Name)
+	case "dns_record":
+		r := st.Records[ref.Name]
+		delete(st.Records, ref.Name)
+		if d, ok := st.Domains[r.Domain]; ok {
+			updated := *d
+			updated.Records = nil
+			for _, existing := range d.Records {
+				if existing.Type != r.Type || existing.Name != r.Name || existing.Value != r.Value {
+					updated.Records = append(updated.Records, existing)
+				}
+			}
+			st.Domains[r.Domain] = &updated
+		}
+	}
+	return nil
+}
+
+// MoveInState renames the service at from, deployed in env, to the name of
+// to without redeploying it. Its container keeps the old name, so the moved
+// service is recorded as adopting that container until its first deploy
+// under the new name replaces it. Other entities cannot be moved.
+func MoveInState(st *repository.DeploymentState, env string, from, to EntityRef) error {
+	if from.Kind != "service" || to.Kind != "service" {
+		return fmt.Errorf("%w: cannot move %s to %s, only services can be moved", domain.ErrInvalidType, from, to)
+	}
+	svc, ok := st.Services[from.Name]
+	if !ok {
+		return fmt.Errorf("%w: %s", domain.ErrStateEntryNotFound, from)
+	}
+	if _, ok := st.Services[to.Name]; ok {
+		return fmt.Errorf("%w: %s", domain.ErrStateEntryExists, to)
+	}
+
+	moved := *svc
+	moved.Name = to.Name
+	if moved.AdoptedContainer == "" {
+		moved.AdoptedContainer = fmt.Sprintf(constants.ServicePrefixFormat, env, from.Name)
+	}
+	delete(st.Services, from.Name)
+	st.Services[to.Name] = &moved
+	return nil
+}
+
+// ImportService records svc, which describes a running container, in st.
+// svc names that container in AdoptedContainer until yamlops deploys it.
+func ImportService(st *repository.DeploymentState, svc *entity.BizService) error {
+	if _, ok := st.Services[svc.Name]; ok {
+		return fmt.Errorf("%w: service:%s", domain.ErrStateEntryExists, svc.Name)
+	}
+	st.Services[svc.Name] = svc
+	return nil
+}
+
+// ImportRecords records the given records of dom in st, adding dom itself
+// when st does not know it yet. Records already in state are rejected.
+func ImportRecords(st *repository.DeploymentState, dom *entity.Domain, records []entity.DNSRecord) error {
+	for i := range records {
+		records[i].Domain = dom.Name
+		if _, ok := st.Records[records[i].Key()]; ok {
+			return fmt.Errorf("%w: dns_record:%s", domain.ErrStateEntryExists, records[i].Key())
+		}
+	}
+
+	updated := entity.Domain{Name: dom.Name, ISP: dom.ISP, DNSISP: dom.DNSISP, Parent: dom.Parent}
+	if existing, ok := st.Domains[dom.Name]; ok {
+		updated = *existing
+	}
+	updated.Records = append(append([]entity.DNSRecord(nil), updated.Records...), records...)
+	st.Domains[dom.Name] = &updated
+
+	for i := range records {
+		record := records[i]
+		if _, ok := st.Records[record.Key()]; !ok {
+			st.Records[record.Key()] = &record
+		}
+	}
+	return nil
+}
+
+// OverlayState adds to live what is recorded in stored but cannot be
+// observed live: services adopted by import that still run in their old
+// container, and the domains and DNS records whose provider was not read.
+// The records of a domain that was observed live are taken as they are, and
+// recorded entities that are simply gone are left out so that they are
+// planned again. The lifecycle of an entity cannot be observed and is always
+// taken from stored.
+func OverlayState(live, stored *repository.DeploymentState) {
+	for name, svc := range live.Services {
+		if recorded, ok := stored.Services[name]; ok {
+			svc.Lifecycle = recorded.Lifecycle
+		}
+	}
+	for name, infra := range live.InfraServices {
+		if recorded, ok := stored.InfraServices[name]; ok {
+			infra.Lifecycle = recorded.Lifecycle
+		}
+	}
+	for name, d := range live.Domains {
+		if recorded, ok := stored.Domains[name]; ok {
+			d.Lifecycle = recorded.Lifecycle
+		}
+	}
+	for key, r := range live.Records {
+		if recorded, ok := stored.Records[key]; ok {
+			r.Lifecycle = recorded.Lifecycle
+		}
+	}
+	for key, r := range stored.Records {
+		if _, observed := live.Domains[r.Domain]; !observed {
+			if _, ok := live.Records[key]; !ok {
+				live.Records[key] = r
+			}
+		}
+	}
+	for name, d := range stored.Domains {
+		if _, observed := live.Domains[name]; !observed {
+			live.Domains[name] = d
+		}
+	}
+	for name, svc := range stored.Services {
+		if _, ok := live.Services[name]; !ok && svc.AdoptedContainer != "" {
+			live.Services[name] = svc
+		}
+	}
+}
+
+// KeepManagedRecords drops from live the DNS records under names that are
+// neither configured nor recorded in stored, which may be nil, so that
+// records created at the provider by other means are left alone. Records are
+// matched by domain, type and name: a configured name is reconciled as a
+// whole, including values that were added to it at the provider.
+func KeepManagedRecords(live *repository.DeploymentState, configured []entity.DNSRecord, stored *repository.DeploymentState) {
+	managed := make(map[string]bool, len(configured))
+	for i := range configured {
+		managed[configured[i].Address()] = true
+	}
+	if stored != nil {
+		for _, r := range stored.Records {
+			managed[r.Address()] = true
+		}
+	}
+
+	for key, r := range live.Records {
+		if !managed[r.Address()] {
+			delete(live.Records, key)
+		}
+	}
+	for name, d := range live.Domains {
+		kept := make([]entity.DNSRecord, 0, len(d.Records))
+		for _, r := range d.Records {
+			r.Domain = d.Name
+			if managed[r.Address()] {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) != len(d.Records) {
+			updated := *d
+			updated.Records = kept
+			live.Domains[name] = &updated
+		}
+	}
+}
+
+// ApplyChangeToState records in st the outcome of the successfully applied
+// change ch, so that state can be saved after every change of an apply.
+// DNS records are kept both in Records and in the records of their domain.
+func ApplyChangeToState(st *repository.DeploymentState, ch *valueobject.Change) error {
+	if ch.Type() == valueobject.ChangeTypeDelete {
+		ref := EntityRef{Kind: ch.Entity(), Name: ch.Name()}
+		if _, ok := StateEntity(st, ref); !ok {
+			return nil
+		}
+		return RemoveFromState(st, ref)
+	}
+	if ch.NewState() == nil {
+		return nil
+	}
+
+	switch v := ch.NewState().(type) {
+	case *entity.ISP:
+		st.ISPs[ch.Name()] = v
+	case *entity.Zone:
+		st.Zones[ch.Name()] = v
+	case *entity.Domain:
+		updated := *v
+		updated.Records = nil
+		if existing, ok := st.Domains[ch.Name()]; ok {
+			updated.Records = existing.Records
+		}
+		st.Domains[ch.Name()] = &updated
+	case *entity.Server:
+		st.Servers[ch.Name()] = v
+	case *entity.InfraService:
+		st.InfraServices[ch.Name()] = v
+	case *entity.BizService:
+		st.Services[ch.Name()] = v
+	case *entity.DNSRecord:
+		if old, ok := ch.OldState().(*entity.DNSRecord); ok && old.Key() != v.Key() {
+			if _, recorded := st.Records[old.Key()]; recorded {
+				if err := RemoveFromState(st, EntityRef{Kind: "dns_record", Name: old.Key()}); err != nil {
+					return err
+				}
+			}
+		}
+		applyRecordToState(st, v)
+	default:
+		return fmt.Errorf("%w: state of %s is %T", domain.ErrInvalidType, EntityRef{Kind: ch.Entity(), Name: ch.Name()}, v)
+	}
+	return nil
+}
+
+func applyRecordToState(st *repository.DeploymentState, r *entity.DNSRecord) {
+	record := *r
+	st.Records[record.Key()] = &record
+
+	updated := entity.Domain{Name: record.Domain}
+	if existing, ok := st.Domains[record.Domain]; ok {
+		updated = *existing
+	}
+	replaced := false
+	records := make([]entity.DNSRecord, 0, len(updated.Records)+1)
+	for _, existing := range updated.Records {
+		if existing.Type == record.Type && existing.Name == record.Name && existing.Value == record.Value {
+			existing = record
+			replaced = true
+		}
+		records = append(records, existing)
+	}
+	if !replaced {
+		records = append(records, record)
+	}
+	updated.Records = records
+	st.Domains[record.Domain] = &updated
+}
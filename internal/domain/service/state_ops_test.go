@@ -0,0 +1,312 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+func stateOpsFixture() *repository.DeploymentState {
+	st := repository.NewDeploymentState()
+	st.Servers["srv1"] = &entity.Server{Name: "srv1", Zone: "z1"}
+	st.Services["api"] = &entity.BizService{Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "api:1.0"}
+	st.Domains["example.com"] = &entity.Domain{Name: "example.com", DNSISP: "cf", Records: []entity.DNSRecord{
+		{Type: entity.DNSRecordTypeA, Name: "www", Value: "1.2.3.4"},
+		{Type: entity.DNSRecordTypeA, Name: "api", Value: "1.2.3.4"},
+	}}
+	for _, r := range st.Domains["example.com"].FlattenRecords() {
+		record := r
+		st.Records[record.Key()] = &record
+	}
+	return st
+}
+
+func TestParseEntityRef(t *testing.T) {
+	ref, err := ParseEntityRef("dns_record:example.com:A:www")
+	if err != nil {
+		t.Fatalf("ParseEntityRef() error = %v", err)
+	}
+	if ref.Kind != "dns_record" || ref.Name != "example.com:A:www" {
+		t.Errorf("ParseEntityRef() = %+v", ref)
+	}
+
+	if _, err := ParseEntityRef("api"); !errors.Is(err, domain.ErrInvalidFormat) {
+		t.Errorf("ParseEntityRef(api) error = %v, want ErrInvalidFormat", err)
+	}
+	if _, err := ParseEntityRef("volume:data"); !errors.Is(err, domain.ErrInvalidType) {
+		t.Errorf("ParseEntityRef(volume:data) error = %v, want ErrInvalidType", err)
+	}
+}
+
+func TestStateRefs_Ordered(t *testing.T) {
+	got := make([]string, 0)
+	for _, ref := range StateRefs(stateOpsFixture()) {
+		got = append(got, ref.String())
+	}
+	want := []string{
+		"domain:example.com",
+		"server:srv1",
+		"service:api",
+		"dns_record:example.com:A:api:1.2.3.4",
+		"dns_record:example.com:A:www:1.2.3.4",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StateRefs() = %v, want %v", got, want)
+	}
+}
+
+func TestRemoveFromState(t *testing.T) {
+	st := stateOpsFixture()
+
+	if err := RemoveFromState(st, EntityRef{Kind: "dns_record", Name: "example.com:A:www:1.2.3.4"}); err != nil {
+		t.Fatalf("RemoveFromState(record) error = %v", err)
+	}
+	if _, ok := st.Records["example.com:A:www:1.2.3.4"]; ok {
+		t.Error("record still in state")
+	}
+	if recs := st.Domains["example.com"].Records; len(recs) != 1 || recs[0].Name != "api" {
+		t.Errorf("domain records = %+v, want only api", recs)
+	}
+
+	if err := RemoveFromState(st, EntityRef{Kind: "domain", Name: "example.com"}); err != nil {
+		t.Fatalf("RemoveFromState(domain) error = %v", err)
+	}
+	if len(st.Records) != 0 {
+		t.Errorf("removing a domain should drop its records, got %v", st.Records)
+	}
+
+	err := RemoveFromState(st, EntityRef{Kind: "service", Name: "missing"})
+	if !errors.Is(err, domain.ErrStateEntryNotFound) {
+		t.Errorf("RemoveFromState(missing) error = %v, want ErrStateEntryNotFound", err)
+	}
+}
+
+func TestMoveInState(t *testing.T) {
+	st := stateOpsFixture()
+
+	if err := MoveInState(st, "prod", EntityRef{Kind: "service", Name: "api"}, EntityRef{Kind: "service", Name: "api-v2"}); err != nil {
+		t.Fatalf("MoveInState() error = %v", err)
+	}
+	if _, ok := st.Services["api"]; ok {
+		t.Error("old name still in state")
+	}
+	svc := st.Services["api-v2"]
+	if svc == nil || svc.Name != "api-v2" || svc.Image != "api:1.0" || svc.Server != "srv1" || svc.AdoptedContainer != "yo-prod-api" {
+		t.Errorf("moved service = %+v", svc)
+	}
+
+	if err := MoveInState(st, "prod", EntityRef{Kind: "service", Name: "api-v2"}, EntityRef{Kind: "service", Name: "api-v3"}); err != nil {
+		t.Fatalf("MoveInState() again error = %v", err)
+	}
+	if svc := st.Services["api-v3"]; svc == nil || svc.AdoptedContainer != "yo-prod-api" {
+		t.Errorf("a second move should keep the adopted container, got %+v", svc)
+	}
+	live := repository.NewDeploymentState()
+	OverlayState(live, st)
+	configured := &entity.BizService{Name: "api-v3", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "api:1.0"}
+	if svc := live.Services["api-v3"]; svc == nil || !ServiceEquals(svc, configured) {
+		t.Errorf("the moved service should be planned as deployed and unchanged, got %+v", svc)
+	}
+
+	st.Services["web"] = &entity.BizService{Name: "web"}
+	err := MoveInState(st, "prod", EntityRef{Kind: "service", Name: "web"}, EntityRef{Kind: "service", Name: "api-v3"})
+	if !errors.Is(err, domain.ErrStateEntryExists) {
+		t.Errorf("MoveInState() onto existing error = %v, want ErrStateEntryExists", err)
+	}
+	err = MoveInState(st, "prod", EntityRef{Kind: "server", Name: "srv1"}, EntityRef{Kind: "server", Name: "srv2"})
+	if !errors.Is(err, domain.ErrInvalidType) {
+		t.Errorf("MoveInState(server) error = %v, want ErrInvalidType", err)
+	}
+}
+
+func TestImportService(t *testing.T) {
+	st := stateOpsFixture()
+
+	if err := ImportService(st, &entity.BizService{Name: "web", Image: "nginx:1.25"}); err != nil {
+		t.Fatalf("ImportService() error = %v", err)
+	}
+	if svc := st.Services["web"]; svc == nil || svc.Image != "nginx:1.25" {
+		t.Errorf("imported service = %+v", svc)
+	}
+	if err := ImportService(st, &entity.BizService{Name: "api"}); !errors.Is(err, domain.ErrStateEntryExists) {
+		t.Errorf("ImportService(api) error = %v, want ErrStateEntryExists", err)
+	}
+}
+
+func TestImportRecords(t *testing.T) {
+	st := stateOpsFixture()
+
+	mx := []entity.DNSRecord{
+		{Type: entity.DNSRecordTypeMX, Name: "@", Value: "10 mx1.example.com"},
+		{Type: entity.DNSRecordTypeMX, Name: "@", Value: "20 mx2.example.com"},
+	}
+	if err := ImportRecords(st, &entity.Domain{Name: "example.com", DNSISP: "other"}, mx); err != nil {
+		t.Fatalf("ImportRecords() error = %v", err)
+	}
+	for _, key := range []string{"example.com:MX:@:10 mx1.example.com", "example.com:MX:@:20 mx2.example.com"} {
+		if r := st.Records[key]; r == nil {
+			t.Errorf("Records[%s] missing, every value of a name should be kept", key)
+		}
+	}
+	dom := st.Domains["example.com"]
+	if len(dom.Records) != 4 || dom.DNSISP != "cf" {
+		t.Errorf("existing domain should keep its settings and gain the records, got %+v", dom)
+	}
+
+	txt := []entity.DNSRecord{{Type: entity.DNSRecordTypeTXT, Name: "@", Value: "v=spf1"}}
+	if err := ImportRecords(st, &entity.Domain{Name: "example.org", DNSISP: "cf"}, txt); err != nil {
+		t.Fatalf("ImportRecords(new domain) error = %v", err)
+	}
+	if d := st.Domains["example.org"]; d == nil || d.DNSISP != "cf" || len(d.Records) != 1 {
+		t.Errorf("new domain = %+v", d)
+	}
+
+	err := ImportRecords(st, &entity.Domain{Name: "example.com"}, []entity.DNSRecord{{Type: entity.DNSRecordTypeA, Name: "www", Value: "1.2.3.4"}})
+	if !errors.Is(err, domain.ErrStateEntryExists) {
+		t.Errorf("ImportRecords(existing) error = %v, want ErrStateEntryExists", err)
+	}
+}
+
+func TestOverlayState(t *testing.T) {
+	live := repository.NewDeploymentState()
+	live.Services["api"] = &entity.BizService{Name: "api"}
+	stored := stateOpsFixture()
+	stored.Services["api"].Lifecycle.PreventDestroy = true
+	stored.Services["worker"] = &entity.BizService{Name: "worker", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "worker:1.0"}
+	stored.Services["legacy"] = &entity.BizService{Name: "legacy", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "legacy:1.0", AdoptedContainer: "legacy"}
+	stored.InfraServices["gw"] = &entity.InfraService{Name: "gw"}
+
+	OverlayState(live, stored)
+
+	if svc := live.Services["api"]; svc.Image != "" {
+		t.Errorf("live entries should win over recorded ones, got %+v", svc)
+	}
+	if !live.Services["api"].Lifecycle.PreventDestroy {
+		t.Error("the recorded lifecycle should be kept on live services")
+	}
+	if _, ok := live.Domains["example.com"]; !ok {
+		t.Error("recorded domain missing from overlay")
+	}
+	if len(live.Records) != 2 {
+		t.Errorf("overlay records = %v, want 2", live.Records)
+	}
+	if len(live.Servers) != 0 {
+		t.Errorf("servers are observed live and should not be overlaid, got %v", live.Servers)
+	}
+	if _, ok := live.Services["worker"]; ok {
+		t.Error("a recorded service missing live should be planned again, not overlaid")
+	}
+	if _, ok := live.InfraServices["gw"]; ok {
+		t.Error("a recorded infra service missing live should be planned again, not overlaid")
+	}
+	if svc := live.Services["legacy"]; svc == nil || svc.AdoptedContainer != "legacy" {
+		t.Errorf("an imported service still in its old container should be overlaid, got %+v", svc)
+	}
+}
+
+func TestOverlayState_ObservedDomain(t *testing.T) {
+	live := repository.NewDeploymentState()
+	live.Domains["example.com"] = &entity.Domain{Name: "example.com", DNSISP: "cf"}
+	www := &entity.DNSRecord{Domain: "example.com", Type: entity.DNSRecordTypeA, Name: "www", Value: "5.6.7.8"}
+	live.Records[www.Key()] = www
+	stored := stateOpsFixture()
+	stored.Records["example.com:A:www:1.2.3.4"].Lifecycle.PreventDestroy = true
+	recorded := *www
+	recorded.Lifecycle.PreventDestroy = true
+	stored.Records[www.Key()] = &recorded
+
+	OverlayState(live, stored)
+
+	if len(live.Records) != 1 || live.Records[www.Key()] != www {
+		t.Errorf("records of an observed domain should be taken as they are, got %v", live.Records)
+	}
+	if !www.Lifecycle.PreventDestroy {
+		t.Error("the recorded lifecycle should be kept on live records")
+	}
+}
+
+func TestKeepManagedRecords_UnmanagedSurvivesPlan(t *testing.T) {
+	live := repository.NewDeploymentState()
+	liveRecords := []entity.DNSRecord{
+		{Type: entity.DNSRecordTypeA, Name: "www", Value: "1.2.3.4"},
+		{Type: entity.DNSRecordTypeA, Name: "www", Value: "9.9.9.9"},
+		{Type: entity.DNSRecordTypeA, Name: "api", Value: "1.2.3.4"},
+		{Type: entity.DNSRecordTypeTXT, Name: "@", Value: "google-site-verification=abc"},
+	}
+	live.Domains["example.com"] = &entity.Domain{Name: "example.com", Records: liveRecords}
+	for _, r := range live.Domains["example.com"].FlattenRecords() {
+		record := r
+		live.Records[record.Key()] = &record
+	}
+	configured := []entity.DNSRecord{{Domain: "example.com", Type: entity.DNSRecordTypeA, Name: "www", Value: "1.2.3.4"}}
+	stored := repository.NewDeploymentState()
+	api := entity.DNSRecord{Domain: "example.com", Type: entity.DNSRecordTypeA, Name: "api", Value: "1.2.3.4"}
+	stored.Records[api.Key()] = &api
+
+	KeepManagedRecords(live, configured, stored)
+	plan := valueobject.NewPlan()
+	NewDifferService(live).PlanRecords(plan, configured, valueobject.NewScope())
+
+	var got []string
+	for _, ch := range plan.Changes() {
+		got = append(got, ch.Type().String()+" "+ch.Name())
+	}
+	want := []string{"DELETE example.com:A:api:1.2.3.4", "DELETE example.com:A:www:9.9.9.9"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+	if len(live.Domains["example.com"].Records) != 3 {
+		t.Errorf("domain records = %+v, want the unmanaged TXT record left out", live.Domains["example.com"].Records)
+	}
+}
+
+func TestApplyChangeToState(t *testing.T) {
+	st := stateOpsFixture()
+
+	changes := []*valueobject.Change{
+		valueobject.NewChangeFull(valueobject.ChangeTypeUpdate, "service", "api", st.Services["api"],
+			&entity.BizService{Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "api:2.0"}, nil, true),
+		valueobject.NewChangeFull(valueobject.ChangeTypeUpdate, "domain", "example.com", st.Domains["example.com"],
+			&entity.Domain{Name: "example.com", DNSISP: "aliyun"}, nil, true),
+		valueobject.NewChangeFull(valueobject.ChangeTypeUpdate, "dns_record", "example.com:A:www:5.6.7.8", st.Records["example.com:A:www:1.2.3.4"],
+			&entity.DNSRecord{Domain: "example.com", Type: entity.DNSRecordTypeA, Name: "www", Value: "5.6.7.8"}, nil, true),
+		valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "dns_record", "example.org:A:@:5.6.7.8", nil,
+			&entity.DNSRecord{Domain: "example.org", Type: entity.DNSRecordTypeA, Name: "@", Value: "5.6.7.8"}, nil, false),
+		valueobject.NewChangeFull(valueobject.ChangeTypeDelete, "dns_record", "example.com:A:api:1.2.3.4", st.Records["example.com:A:api:1.2.3.4"], nil, nil, true),
+		valueobject.NewChangeFull(valueobject.ChangeTypeDelete, "service", "gone", nil, nil, nil, false),
+	}
+	for _, ch := range changes {
+		if err := ApplyChangeToState(st, ch); err != nil {
+			t.Fatalf("ApplyChangeToState(%s %s) error = %v", ch.Entity(), ch.Name(), err)
+		}
+	}
+
+	if svc := st.Services["api"]; svc.Image != "api:2.0" {
+		t.Errorf("service api = %+v", svc)
+	}
+	dom := st.Domains["example.com"]
+	if dom.DNSISP != "aliyun" {
+		t.Errorf("domain update not recorded: %+v", dom)
+	}
+	want := []entity.DNSRecord{{Domain: "example.com", Type: entity.DNSRecordTypeA, Name: "www", Value: "5.6.7.8"}}
+	if !reflect.DeepEqual(dom.Records, want) {
+		t.Errorf("domain records = %+v, want %+v", dom.Records, want)
+	}
+	if r := st.Records["example.com:A:www:5.6.7.8"]; r == nil {
+		t.Errorf("updated record missing, got %v", st.Records)
+	}
+	if _, ok := st.Records["example.com:A:www:1.2.3.4"]; ok {
+		t.Error("the old value of an updated record is still in state")
+	}
+	if _, ok := st.Records["example.com:A:api:1.2.3.4"]; ok {
+		t.Error("deleted record still in state")
+	}
+	if d := st.Domains["example.org"]; d == nil || len(d.Records) != 1 || st.Records["example.org:A:@:5.6.7.8"] == nil {
+		t.Errorf("record of unknown domain not recorded: %+v", d)
+	}
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+// TargetRefs lists the addresses a target may name: every entity configured
+// in cfg or recorded in st, with DNS records also addressed as
+// domain:TYPE:name. st may be nil.
+func TargetRefs(cfg *entity.Config, st *repository.DeploymentState) []EntityRef {
+	var refs []EntityRef
+	if st != nil {
+		refs = StateRefs(st)
+		for _, r := range st.Records {
+			refs = append(refs, EntityRef{Kind: "dns_record", Name: r.Address()})
+		}
+	}
+	if cfg != nil {
+		refs = appendKeys(refs, "isp", cfg.GetISPMap())
+		refs = appendKeys(refs, "zone", cfg.GetZoneMap())
+		refs = appendKeys(refs, "domain", cfg.GetDomainMap())
+		refs = appendKeys(refs, "server", cfg.GetServerMap())
+		refs = appendKeys(refs, "infra_service", cfg.GetInfraServiceMap())
+		refs = appendKeys(refs, "service", cfg.GetServiceMap())
+		for _, r := range cfg.GetAllDNSRecords() {
+			refs = append(refs, EntityRef{Kind: "dns_record", Name: r.Key()}, EntityRef{Kind: "dns_record", Name: r.Address()})
+		}
+	}
+
+	seen := make(map[EntityRef]bool, len(refs))
+	unique := refs[:0]
+	for _, ref := range refs {
+		if !seen[ref] {
+			seen[ref] = true
+			unique = append(unique, ref)
+		}
+	}
+	sortRefs(unique)
+	return unique
+}
+
+// CheckTargets fails with ErrUnknownTarget, listing the valid addresses,
+// when a target is not one of valid.
+func CheckTargets(targets, valid []EntityRef) error {
+	known := make(map[EntityRef]bool, len(valid))
+	for _, ref := range valid {
+		known[ref] = true
+	}
+	for _, t := range targets {
+		if known[t] {
+			continue
+		}
+		names := make([]string, len(valid))
+		for i, ref := range valid {
+			names[i] = ref.String()
+		}
+		return fmt.Errorf("%w: %s; valid targets are: %s", domain.ErrUnknownTarget, t, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// SelectTargets returns the changes addressed by targets, in their order in
+// changes. withDependencies adds, transitively, the changes that have to run
+// before them; withDependents adds the changes that have to run after them,
+// including the DNS records of hostnames routed to a targeted service.
+func SelectTargets(changes []*valueobject.Change, idx *DependencyIndex, targets []EntityRef, withDependencies, withDependents bool) []*valueobject.Change {
+	if idx == nil {
+		idx = NewDependencyIndex(nil)
+	}
+	graph := NewChangeGraph(changes, idx)
+	idx = idx.withChanges(changes)
+
+	byRef := make(map[EntityRef][]*valueobject.Change)
+	for _, ch := range changes {
+		ref := EntityRef{Kind: ch.Entity(), Name: ch.Name()}
+		byRef[ref] = append(byRef[ref], ch)
+		// A DNS record is also addressed by domain:TYPE:name, which
+		// targets all of its values.
+		if r := changeRecord(ch); r != nil && r.Address() != ch.Name() {
+			address := EntityRef{Kind: ch.Entity(), Name: r.Address()}
+			byRef[address] = append(byRef[address], ch)
+		}
+	}
+
+	needs := make(map[*valueobject.Change][]*valueobject.Change, len(changes))
+	neededBy := make(map[*valueobject.Change][]*valueobject.Change, len(changes))
+	link := func(ch, prereq *valueobject.Change) {
+		needs[ch] = append(needs[ch], prereq)
+		neededBy[prereq] = append(neededBy[prereq], ch)
+	}
+	for _, ch := range changes {
+		for _, prereq := range graph.Prerequisites(ch) {
+			link(ch, prereq)
+		}
+		if r, ok := ch.NewState().(*entity.DNSRecord); ok && ch.Type() != valueobject.ChangeTypeDelete {
+			for _, name := range idx.routedServices(r) {
+				for _, svc := range byRef[EntityRef{Kind: "service", Name: name}] {
+					link(ch, svc)
+				}
+			}
+		}
+	}
+
+	var roots []*valueobject.Change
+	for _, t := range targets {
+		roots = append(roots, byRef[t]...)
+	}
+
+	selected := make(map[*valueobject.Change]bool)
+	for _, ch := range roots {
+		selected[ch] = true
+	}
+	if withDependencies {
+		walk(roots, needs, selected)
+	}
+	if withDependents {
+		walk(roots, neededBy, selected)
+	}
+
+	var out []*valueobject.Change
+	for _, ch := range changes {
+		if selected[ch] {
+			out = append(out, ch)
+		}
+	}
+	return out
+}
+
+func changeRecord(ch *valueobject.Change) *entity.DNSRecord {
+	if r, ok := ch.NewState().(*entity.DNSRecord); ok {
+		return r
+	}
+	r, _ := ch.OldState().(*entity.DNSRecord)
+	return r
+}
+
+// walk follows edges from roots only, so that dependencies of dependents
+// (every other service on a shared server, say) are not pulled in.
+func walk(roots []*valueobject.Change, edges map[*valueobject.Change][]*valueobject.Change, selected map[*valueobject.Change]bool) {
+	seen := make(map[*valueobject.Change]bool, len(roots))
+	queue := append([]*valueobject.Change(nil), roots...)
+	for len(queue) > 0 {
+		ch := queue[0]
+		queue = queue[1:]
+		if seen[ch] {
+			continue
+		}
+		seen[ch] = true
+		selected[ch] = true
+		queue = append(queue, edges[ch]...)
+	}
+}
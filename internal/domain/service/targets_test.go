@@ -0,0 +1,64 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+func TestSelectTargets(t *testing.T) {
+	cfg := &entity.Config{
+		Servers: []entity.Server{{Name: "srv1", Zone: "z1", IP: entity.ServerIP{Public: "1.2.3.4"}}},
+		InfraServices: []entity.InfraService{
+			{Name: "gw", Type: entity.InfraServiceTypeGateway, ServiceBase: entity.ServiceBase{Server: "srv1"}},
+		},
+		Services: []entity.BizService{
+			{Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"},
+				Gateways: []entity.ServiceGatewayRoute{{Hostname: "api.example.com"}}},
+			{Name: "web", ServiceBase: entity.ServiceBase{Server: "srv1"},
+				Gateways: []entity.ServiceGatewayRoute{{Hostname: "www.example.com"}}},
+		},
+	}
+	changes := []*valueobject.Change{
+		valueobject.NewChangeFull(valueobject.ChangeTypeUpdate, "server", "srv1", nil, &cfg.Servers[0], nil, true),
+		valueobject.NewChangeFull(valueobject.ChangeTypeUpdate, "infra_service", "gw", nil, &cfg.InfraServices[0], nil, true),
+		valueobject.NewChangeFull(valueobject.ChangeTypeUpdate, "service", "api", nil, &cfg.Services[0], nil, true),
+		valueobject.NewChangeFull(valueobject.ChangeTypeUpdate, "service", "web", nil, &cfg.Services[1], nil, true),
+		valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "dns_record", "example.com:CNAME:api:lb.example.com", nil,
+			&entity.DNSRecord{Domain: "example.com", Type: entity.DNSRecordTypeCNAME, Name: "api", Value: "lb.example.com"}, nil, false),
+		valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "dns_record", "example.com:CNAME:www:lb.example.com", nil,
+			&entity.DNSRecord{Domain: "example.com", Type: entity.DNSRecordTypeCNAME, Name: "www", Value: "lb.example.com"}, nil, false),
+	}
+	idx := NewDependencyIndex(cfg)
+	api := []EntityRef{{Kind: "service", Name: "api"}}
+
+	tests := []struct {
+		name         string
+		targets      []EntityRef
+		deps, depnts bool
+		want         []string
+	}{
+		{"exact", api, false, false, []string{"service:api"}},
+		{"dependencies", api, true, false, []string{"server:srv1", "infra_service:gw", "service:api"}},
+		{"dependents", api, false, true, []string{"service:api", "dns_record:example.com:CNAME:api:lb.example.com"}},
+		{"gateway dependents", []EntityRef{{Kind: "infra_service", Name: "gw"}}, false, true,
+			[]string{"infra_service:gw", "service:api", "service:web", "dns_record:example.com:CNAME:api:lb.example.com", "dns_record:example.com:CNAME:www:lb.example.com"}},
+		{"record address", []EntityRef{{Kind: "dns_record", Name: "example.com:CNAME:www"}}, false, false,
+			[]string{"dns_record:example.com:CNAME:www:lb.example.com"}},
+		{"unknown", []EntityRef{{Kind: "service", Name: "missing"}}, true, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SelectTargets(changes, idx, tt.targets, tt.deps, tt.depnts)
+			var names []string
+			for _, ch := range got {
+				names = append(names, ch.Entity()+":"+ch.Name())
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("SelectTargets() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/lite-lake/infra-yamlops/internal/domain"
@@ -15,6 +16,8 @@ type Validator struct {
 	zones     map[string]*entity.Zone
 	servers   map[string]*entity.Server
 	domainMap map[string]*entity.Domain
+
+	errs domain.ValidationErrors
 }
 
 func NewValidator(cfg *entity.Config) *Validator {
@@ -31,155 +34,131 @@ func NewValidator(cfg *entity.Config) *Validator {
 	}
 }
 
+// Validate checks the config and its references, and returns every failure
+// found as domain.ValidationErrors.
 func (v *Validator) Validate() error {
 	if v.cfg == nil {
 		return domain.ErrConfigNotLoaded
 	}
 
+	v.errs = nil
 	if err := v.cfg.Validate(); err != nil {
-		return err
-	}
-
-	if err := v.validateISPReferences(); err != nil {
-		return err
-	}
-
-	if err := v.validateZoneReferences(); err != nil {
-		return err
-	}
-
-	if err := v.validateInfraServiceReferences(); err != nil {
-		return err
-	}
-
-	if err := v.validateServerReferences(); err != nil {
-		return err
-	}
-
-	if err := v.validateServiceReferences(); err != nil {
-		return err
-	}
-
-	if err := v.validateDomainReferences(); err != nil {
-		return err
-	}
-
-	if err := v.validateDNSReferences(); err != nil {
-		return err
+		var verrs domain.ValidationErrors
+		if !errors.As(err, &verrs) {
+			return err
+		}
+		v.errs = append(v.errs, verrs...)
 	}
 
-	if err := v.validatePortConflicts(); err != nil {
-		return err
-	}
+	v.validateISPReferences()
+	v.validateZoneReferences()
+	v.validateInfraServiceReferences()
+	v.validateServerReferences()
+	v.validateServiceReferences()
+	v.validateDomainReferences()
+	v.validateDNSReferences()
+	v.validatePortConflicts()
+	v.validateDomainConflicts()
+	v.validateHostnameConflicts()
 
-	if err := v.validateDomainConflicts(); err != nil {
-		return err
-	}
-
-	if err := v.validateHostnameConflicts(); err != nil {
-		return err
-	}
+	return v.errs.Err()
+}
 
-	return nil
+// report records err, found checking field of the named entity of section.
+func (v *Validator) report(section, name, field string, err error) {
+	v.errs = append(v.errs, v.cfg.ValidationError(section, name, field, err))
 }
 
-func (v *Validator) validateISPReferences() error {
+func (v *Validator) validateISPReferences() {
 	for _, isp := range v.cfg.ISPs {
 		for _, ref := range isp.Credentials {
 			if ref.Secret() != "" {
 				if _, ok := v.secrets[ref.Secret()]; !ok {
-					return fmt.Errorf("%w: secret '%s' referenced by isp '%s' does not exist", domain.ErrMissingReference, ref.Secret(), isp.Name)
+					v.report("isps", isp.Name, "credentials", fmt.Errorf("%w: secret '%s' referenced by isp '%s' does not exist", domain.ErrMissingReference, ref.Secret(), isp.Name))
 				}
 			}
 		}
 	}
-	return nil
 }
 
-func (v *Validator) validateZoneReferences() error {
+func (v *Validator) validateZoneReferences() {
 	for _, zone := range v.cfg.Zones {
 		if zone.ISP != "" {
 			if _, ok := v.isps[zone.ISP]; !ok {
-				return fmt.Errorf("%w: isp '%s' referenced by zone '%s' does not exist", domain.ErrMissingReference, zone.ISP, zone.Name)
+				v.report("zones", zone.Name, "isp", fmt.Errorf("%w: isp '%s' referenced by zone '%s' does not exist", domain.ErrMissingReference, zone.ISP, zone.Name))
 			}
 		}
 	}
-	return nil
 }
 
-func (v *Validator) validateInfraServiceReferences() error {
+func (v *Validator) validateInfraServiceReferences() {
 	for _, infra := range v.cfg.InfraServices {
 		if _, ok := v.servers[infra.Server]; !ok {
-			return fmt.Errorf("%w: server '%s' referenced by infra_service '%s' does not exist", domain.ErrMissingReference, infra.Server, infra.Name)
+			v.report("infra_services", infra.Name, "server", fmt.Errorf("%w: server '%s' referenced by infra_service '%s' does not exist", domain.ErrMissingReference, infra.Server, infra.Name))
 		}
 	}
-	return nil
 }
 
-func (v *Validator) validateServerReferences() error {
+func (v *Validator) validateServerReferences() {
 	for _, server := range v.cfg.Servers {
 		if _, ok := v.zones[server.Zone]; !ok {
-			return fmt.Errorf("%w: zone '%s' referenced by server '%s' does not exist", domain.ErrMissingReference, server.Zone, server.Name)
+			v.report("servers", server.Name, "zone", fmt.Errorf("%w: zone '%s' referenced by server '%s' does not exist", domain.ErrMissingReference, server.Zone, server.Name))
 		}
 		if server.ISP != "" {
 			if _, ok := v.isps[server.ISP]; !ok {
-				return fmt.Errorf("%w: isp '%s' referenced by server '%s' does not exist", domain.ErrMissingReference, server.ISP, server.Name)
+				v.report("servers", server.Name, "isp", fmt.Errorf("%w: isp '%s' referenced by server '%s' does not exist", domain.ErrMissingReference, server.ISP, server.Name))
 			}
 		}
 		if server.SSH.Password.Secret() != "" {
 			if _, ok := v.secrets[server.SSH.Password.Secret()]; !ok {
-				return fmt.Errorf("%w: secret '%s' referenced by server '%s' ssh password does not exist", domain.ErrMissingReference, server.SSH.Password.Secret(), server.Name)
+				v.report("servers", server.Name, "ssh", fmt.Errorf("%w: secret '%s' referenced by server '%s' ssh password does not exist", domain.ErrMissingReference, server.SSH.Password.Secret(), server.Name))
 			}
 		}
 	}
-	return nil
 }
 
-func (v *Validator) validateServiceReferences() error {
+func (v *Validator) validateServiceReferences() {
 	for _, service := range v.cfg.Services {
 		if _, ok := v.servers[service.Server]; !ok {
-			return fmt.Errorf("%w: server '%s' referenced by service '%s' does not exist", domain.ErrMissingReference, service.Server, service.Name)
+			v.report("services", service.Name, "server", fmt.Errorf("%w: server '%s' referenced by service '%s' does not exist", domain.ErrMissingReference, service.Server, service.Name))
 		}
 		for _, secretName := range service.Secrets {
 			if _, ok := v.secrets[secretName]; !ok {
-				return fmt.Errorf("%w: secret '%s' referenced by service '%s' does not exist", domain.ErrMissingReference, secretName, service.Name)
+				v.report("services", service.Name, "secrets", fmt.Errorf("%w: secret '%s' referenced by service '%s' does not exist", domain.ErrMissingReference, secretName, service.Name))
 			}
 		}
 	}
-	return nil
 }
 
-func (v *Validator) validateDomainReferences() error {
+func (v *Validator) validateDomainReferences() {
 	for _, d := range v.cfg.Domains {
 		if d.ISP != "" {
 			if _, ok := v.isps[d.ISP]; !ok {
-				return fmt.Errorf("%w: isp '%s' referenced by domain '%s' does not exist", domain.ErrMissingReference, d.ISP, d.Name)
+				v.report("domains", d.Name, "isp", fmt.Errorf("%w: isp '%s' referenced by domain '%s' does not exist", domain.ErrMissingReference, d.ISP, d.Name))
 			}
 		}
 		if d.DNSISP != "" {
 			if _, ok := v.isps[d.DNSISP]; !ok {
-				return fmt.Errorf("%w: dns_isp '%s' referenced by domain '%s' does not exist", domain.ErrMissingReference, d.DNSISP, d.Name)
+				v.report("domains", d.Name, "dns_isp", fmt.Errorf("%w: dns_isp '%s' referenced by domain '%s' does not exist", domain.ErrMissingReference, d.DNSISP, d.Name))
 			}
 		}
 		if d.Parent != "" {
 			if _, ok := v.domainMap[d.Parent]; !ok {
-				return fmt.Errorf("%w: parent domain '%s' referenced by domain '%s' does not exist", domain.ErrMissingReference, d.Parent, d.Name)
+				v.report("domains", d.Name, "parent", fmt.Errorf("%w: parent domain '%s' referenced by domain '%s' does not exist", domain.ErrMissingReference, d.Parent, d.Name))
 			}
 		}
 	}
-	return nil
 }
 
-func (v *Validator) validateDNSReferences() error {
+func (v *Validator) validateDNSReferences() {
 	for _, record := range v.cfg.GetAllDNSRecords() {
 		if _, ok := v.domainMap[record.Domain]; !ok {
-			return fmt.Errorf("%w: domain '%s' referenced by dns record does not exist", domain.ErrMissingReference, record.Domain)
+			v.report("domains", record.Domain, "records", fmt.Errorf("%w: domain '%s' referenced by dns record does not exist", domain.ErrMissingReference, record.Domain))
 		}
 	}
-	return nil
 }
 
-func (v *Validator) validatePortConflicts() error {
+func (v *Validator) validatePortConflicts() {
 	serverPorts := make(map[string]map[int]string)
 
 	for _, infra := range v.cfg.InfraServices {
@@ -189,22 +168,25 @@ func (v *Validator) validatePortConflicts() error {
 		}
 		if infra.SSLConfig != nil && infra.SSLConfig.Ports.API > 0 {
 			if existing, ok := serverPorts[key][infra.SSLConfig.Ports.API]; ok {
-				return fmt.Errorf("%w: api port %d on server '%s' is used by both '%s' and '%s'", domain.ErrPortConflict, infra.SSLConfig.Ports.API, infra.Server, existing, infra.Name)
+				v.report("infra_services", infra.Name, "ports", fmt.Errorf("%w: api port %d on server '%s' is used by both '%s' and '%s'", domain.ErrPortConflict, infra.SSLConfig.Ports.API, infra.Server, existing, infra.Name))
+			} else {
+				serverPorts[key][infra.SSLConfig.Ports.API] = infra.Name
 			}
-			serverPorts[key][infra.SSLConfig.Ports.API] = infra.Name
 		}
 		if infra.GatewayPorts != nil {
 			if infra.GatewayPorts.HTTP > 0 {
 				if existing, ok := serverPorts[key][infra.GatewayPorts.HTTP]; ok {
-					return fmt.Errorf("%w: gateway http port %d on server '%s' is used by both '%s' and '%s'", domain.ErrPortConflict, infra.GatewayPorts.HTTP, infra.Server, existing, infra.Name)
+					v.report("infra_services", infra.Name, "ports", fmt.Errorf("%w: gateway http port %d on server '%s' is used by both '%s' and '%s'", domain.ErrPortConflict, infra.GatewayPorts.HTTP, infra.Server, existing, infra.Name))
+				} else {
+					serverPorts[key][infra.GatewayPorts.HTTP] = infra.Name
 				}
-				serverPorts[key][infra.GatewayPorts.HTTP] = infra.Name
 			}
 			if infra.GatewayPorts.HTTPS > 0 {
 				if existing, ok := serverPorts[key][infra.GatewayPorts.HTTPS]; ok {
-					return fmt.Errorf("%w: gateway https port %d on server '%s' is used by both '%s' and '%s'", domain.ErrPortConflict, infra.GatewayPorts.HTTPS, infra.Server, existing, infra.Name)
+					v.report("infra_services", infra.Name, "ports", fmt.Errorf("%w: gateway https port %d on server '%s' is used by both '%s' and '%s'", domain.ErrPortConflict, infra.GatewayPorts.HTTPS, infra.Server, existing, infra.Name))
+				} else {
+					serverPorts[key][infra.GatewayPorts.HTTPS] = infra.Name
 				}
-				serverPorts[key][infra.GatewayPorts.HTTPS] = infra.Name
 			}
 		}
 	}
@@ -216,20 +198,20 @@ func (v *Validator) validatePortConflicts() error {
 		}
 		for _, port := range service.Ports {
 			if existing, ok := serverPorts[key][port.Host]; ok {
-				return fmt.Errorf("%w: host port %d on server '%s' is used by both '%s' and '%s'", domain.ErrPortConflict, port.Host, service.Server, existing, service.Name)
+				v.report("services", service.Name, "ports", fmt.Errorf("%w: host port %d on server '%s' is used by both '%s' and '%s'", domain.ErrPortConflict, port.Host, service.Server, existing, service.Name))
+			} else {
+				serverPorts[key][port.Host] = service.Name
 			}
-			serverPorts[key][port.Host] = service.Name
 		}
 	}
-
-	return nil
 }
 
-func (v *Validator) validateDomainConflicts() error {
+func (v *Validator) validateDomainConflicts() {
 	domainNames := make(map[string]string)
 	for _, d := range v.cfg.Domains {
 		if existing, ok := domainNames[d.Name]; ok {
-			return fmt.Errorf("%w: domain '%s' is defined multiple times (first: '%s')", domain.ErrDomainConflict, d.Name, existing)
+			v.report("domains", d.Name, "", fmt.Errorf("%w: domain '%s' is defined multiple times (first: '%s')", domain.ErrDomainConflict, d.Name, existing))
+			continue
 		}
 		domainNames[d.Name] = d.Name
 	}
@@ -238,26 +220,25 @@ func (v *Validator) validateDomainConflicts() error {
 	for _, record := range v.cfg.GetAllDNSRecords() {
 		key := fmt.Sprintf("%s:%s:%s:%s", record.Domain, record.Type, record.Name, record.Value)
 		if dnsKeys[key] {
-			return fmt.Errorf("%w: dns record '%s' is defined multiple times (type: %s, name: %s, value: %s)", domain.ErrDNSSubdomainConflict, record.Domain, record.Type, record.Name, record.Value)
+			v.report("domains", record.Domain, "records", fmt.Errorf("%w: dns record '%s' is defined multiple times (type: %s, name: %s, value: %s)", domain.ErrDNSSubdomainConflict, record.Domain, record.Type, record.Name, record.Value))
+			continue
 		}
 		dnsKeys[key] = true
 	}
-
-	return nil
 }
 
-func (v *Validator) validateHostnameConflicts() error {
+func (v *Validator) validateHostnameConflicts() {
 	hostnames := make(map[string]string)
 	for _, service := range v.cfg.Services {
 		for _, route := range service.Gateways {
 			if route.HasGateway() && route.Hostname != "" {
 				hostname := route.Hostname
 				if existing, ok := hostnames[hostname]; ok {
-					return fmt.Errorf("%w: hostname '%s' is used by both services '%s' and '%s'", domain.ErrHostnameConflict, hostname, existing, service.Name)
+					v.report("services", service.Name, "gateways", fmt.Errorf("%w: hostname '%s' is used by both services '%s' and '%s'", domain.ErrHostnameConflict, hostname, existing, service.Name))
+					continue
 				}
 				hostnames[hostname] = service.Name
 			}
 		}
 	}
-	return nil
 }
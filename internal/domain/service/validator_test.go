@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -431,3 +432,42 @@ func TestValidator_DomainConflicts(t *testing.T) {
 		}
 	})
 }
+
+func TestValidator_CollectsAllErrors(t *testing.T) {
+	cfg := &entity.Config{
+		Zones: []entity.Zone{{Name: "zone1", Region: "us-east-1", ISP: "missing-isp"}},
+		Services: []entity.BizService{
+			{Name: "api", ServiceBase: entity.ServiceBase{Server: "missing-server"}, Image: "nginx"},
+			{Name: "web", ServiceBase: entity.ServiceBase{Server: "missing-server"}, Image: "nginx", Secrets: []string{"missing-secret"}},
+		},
+		Sources: map[string]entity.Source{
+			entity.SourceKey("services", "web"):           {File: "services_biz.yaml", Line: 5, Column: 5},
+			entity.SourceKey("services", "web", "server"): {File: "services_biz.yaml", Line: 7, Column: 5},
+		},
+	}
+	err := NewValidator(cfg).Validate()
+
+	var verrs domain.ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	if len(verrs) != 4 {
+		t.Fatalf("expected 4 errors, got %d: %v", len(verrs), err)
+	}
+	if !errors.Is(err, domain.ErrMissingReference) {
+		t.Errorf("expected errors to wrap ErrMissingReference")
+	}
+	var positioned []string
+	for _, verr := range verrs {
+		if verr.File != "" {
+			positioned = append(positioned, verr.Error())
+		}
+	}
+	want := []string{
+		"services_biz.yaml:7:5: missing reference: server 'missing-server' referenced by service 'web' does not exist",
+		"services_biz.yaml:5:5: missing reference: secret 'missing-secret' referenced by service 'web' does not exist",
+	}
+	if strings.Join(positioned, "\n") != strings.Join(want, "\n") {
+		t.Errorf("positioned errors = %q, want %q", positioned, want)
+	}
+}
@@ -32,6 +32,7 @@ type Change struct {
 	newState     interface{}
 	actions      []string
 	remoteExists bool
+	diffs        []FieldDiff
 }
 
 func NewChange(changeType ChangeType, entity, name string) *Change {
@@ -63,6 +64,7 @@ func (c *Change) OldState() interface{} { return c.oldState }
 func (c *Change) NewState() interface{} { return c.newState }
 func (c *Change) Actions() []string     { return c.actions }
 func (c *Change) RemoteExists() bool    { return c.remoteExists }
+func (c *Change) Diffs() []FieldDiff    { return c.diffs }
 
 func (c *Change) WithOldState(state interface{}) *Change {
 	return &Change{
@@ -73,6 +75,7 @@ func (c *Change) WithOldState(state interface{}) *Change {
 		newState:     c.newState,
 		actions:      c.actions,
 		remoteExists: c.remoteExists,
+		diffs:        c.diffs,
 	}
 }
 
@@ -85,6 +88,7 @@ func (c *Change) WithNewState(state interface{}) *Change {
 		newState:     state,
 		actions:      c.actions,
 		remoteExists: c.remoteExists,
+		diffs:        c.diffs,
 	}
 }
 
@@ -99,6 +103,7 @@ func (c *Change) WithActions(actions ...string) *Change {
 		newState:     c.newState,
 		actions:      newActions,
 		remoteExists: c.remoteExists,
+		diffs:        c.diffs,
 	}
 }
 
@@ -111,6 +116,22 @@ func (c *Change) WithRemoteExists(exists bool) *Change {
 		newState:     c.newState,
 		actions:      c.actions,
 		remoteExists: exists,
+		diffs:        c.diffs,
+	}
+}
+
+func (c *Change) WithDiffs(diffs ...FieldDiff) *Change {
+	newDiffs := make([]FieldDiff, len(diffs))
+	copy(newDiffs, diffs)
+	return &Change{
+		changeType:   c.changeType,
+		entity:       c.entity,
+		name:         c.name,
+		oldState:     c.oldState,
+		newState:     c.newState,
+		actions:      c.actions,
+		remoteExists: c.remoteExists,
+		diffs:        newDiffs,
 	}
 }
 
@@ -138,6 +159,11 @@ func (c *Change) Equals(other *Change) bool {
 func (c *Change) Clone() *Change {
 	newActions := make([]string, len(c.actions))
 	copy(newActions, c.actions)
+	var newDiffs []FieldDiff
+	if c.diffs != nil {
+		newDiffs = make([]FieldDiff, len(c.diffs))
+		copy(newDiffs, c.diffs)
+	}
 	return &Change{
 		changeType:   c.changeType,
 		entity:       c.entity,
@@ -146,5 +172,6 @@ func (c *Change) Clone() *Change {
 		newState:     c.newState,
 		actions:      newActions,
 		remoteExists: c.remoteExists,
+		diffs:        newDiffs,
 	}
 }
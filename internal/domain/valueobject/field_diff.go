@@ -0,0 +1,39 @@
+package valueobject
+
+import "fmt"
+
+type FieldDiff struct {
+	changeType ChangeType
+	field      string
+	oldValue   string
+	newValue   string
+}
+
+func NewFieldDiff(field, oldValue, newValue string) FieldDiff {
+	return FieldDiff{changeType: ChangeTypeUpdate, field: field, oldValue: oldValue, newValue: newValue}
+}
+
+func NewFieldAdded(field, newValue string) FieldDiff {
+	return FieldDiff{changeType: ChangeTypeCreate, field: field, newValue: newValue}
+}
+
+func NewFieldRemoved(field, oldValue string) FieldDiff {
+	return FieldDiff{changeType: ChangeTypeDelete, field: field, oldValue: oldValue}
+}
+
+func (d FieldDiff) Type() ChangeType { return d.changeType }
+func (d FieldDiff) Field() string    { return d.field }
+func (d FieldDiff) OldValue() string { return d.oldValue }
+func (d FieldDiff) NewValue() string { return d.newValue }
+
+// String renders the diff the way Terraform does: `~ image = "a" -> "b"`.
+func (d FieldDiff) String() string {
+	switch d.changeType {
+	case ChangeTypeCreate:
+		return fmt.Sprintf("+ %s = %q", d.field, d.newValue)
+	case ChangeTypeDelete:
+		return fmt.Sprintf("- %s = %q -> null", d.field, d.oldValue)
+	default:
+		return fmt.Sprintf("~ %s = %q -> %q", d.field, d.oldValue, d.newValue)
+	}
+}
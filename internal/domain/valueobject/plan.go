@@ -3,6 +3,15 @@ package valueobject
 type Plan struct {
 	changes []*Change
 	scope   *Scope
+	unknown []Unknown
+}
+
+// Unknown is an entity whose live state could not be observed, so the plan
+// neither creates nor updates it.
+type Unknown struct {
+	Entity string
+	Name   string
+	Reason string
 }
 
 func NewPlan() *Plan {
@@ -24,11 +33,16 @@ func NewPlanWithScope(scope *Scope) *Plan {
 
 func (p *Plan) Changes() []*Change { return p.changes }
 func (p *Plan) Scope() *Scope      { return p.scope }
+func (p *Plan) Unknown() []Unknown { return p.unknown }
 
 func (p *Plan) AddChange(ch *Change) {
 	p.changes = append(p.changes, ch)
 }
 
+func (p *Plan) AddUnknown(u Unknown) {
+	p.unknown = append(p.unknown, u)
+}
+
 func (p *Plan) WithChange(ch *Change) *Plan {
 	newChanges := make([]*Change, len(p.changes)+1)
 	copy(newChanges, p.changes)
@@ -36,6 +50,7 @@ func (p *Plan) WithChange(ch *Change) *Plan {
 	return &Plan{
 		changes: newChanges,
 		scope:   p.scope,
+		unknown: p.unknown,
 	}
 }
 
@@ -94,5 +109,6 @@ func (p *Plan) Clone() *Plan {
 	return &Plan{
 		changes: changes,
 		scope:   p.scope.Clone(),
+		unknown: append([]Unknown(nil), p.unknown...),
 	}
 }
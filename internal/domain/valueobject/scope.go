@@ -9,6 +9,16 @@ type Scope struct {
 	infraServices []string
 	forceDeploy   bool
 	dnsOnly       bool
+	target        *targetSelection
+}
+
+// targetSelection addresses single changes as entity:name; the closure flags
+// pull in what the targeted changes need or what needs them. It is never
+// modified, so scopes derived from one another share it.
+type targetSelection struct {
+	targets      []string
+	dependencies bool
+	dependents   bool
 }
 
 func NewScope() *Scope {
@@ -50,6 +60,16 @@ func (s *Scope) InfraServices() []string { return s.infraServices }
 func (s *Scope) ForceDeploy() bool       { return s.forceDeploy }
 func (s *Scope) DNSOnly() bool           { return s.dnsOnly }
 
+func (s *Scope) Targets() []string {
+	if s.target == nil {
+		return nil
+	}
+	return s.target.targets
+}
+
+func (s *Scope) TargetDependencies() bool { return s.target != nil && s.target.dependencies }
+func (s *Scope) TargetDependents() bool   { return s.target != nil && s.target.dependents }
+
 func (s *Scope) WithDomain(domain string) *Scope {
 	return &Scope{
 		domain:        domain,
@@ -60,6 +80,7 @@ func (s *Scope) WithDomain(domain string) *Scope {
 		infraServices: s.copyInfraServices(),
 		forceDeploy:   s.forceDeploy,
 		dnsOnly:       s.dnsOnly,
+		target:        s.target,
 	}
 }
 
@@ -73,6 +94,7 @@ func (s *Scope) WithZone(zone string) *Scope {
 		infraServices: s.copyInfraServices(),
 		forceDeploy:   s.forceDeploy,
 		dnsOnly:       s.dnsOnly,
+		target:        s.target,
 	}
 }
 
@@ -86,6 +108,7 @@ func (s *Scope) WithServer(server string) *Scope {
 		infraServices: s.copyInfraServices(),
 		forceDeploy:   s.forceDeploy,
 		dnsOnly:       s.dnsOnly,
+		target:        s.target,
 	}
 }
 
@@ -99,6 +122,7 @@ func (s *Scope) WithService(service string) *Scope {
 		infraServices: s.copyInfraServices(),
 		forceDeploy:   s.forceDeploy,
 		dnsOnly:       s.dnsOnly,
+		target:        s.target,
 	}
 }
 
@@ -114,6 +138,7 @@ func (s *Scope) WithServices(services []string) *Scope {
 		infraServices: s.copyInfraServices(),
 		forceDeploy:   s.forceDeploy,
 		dnsOnly:       s.dnsOnly,
+		target:        s.target,
 	}
 }
 
@@ -129,6 +154,7 @@ func (s *Scope) WithInfraServices(infraServices []string) *Scope {
 		infraServices: newInfraServices,
 		forceDeploy:   s.forceDeploy,
 		dnsOnly:       s.dnsOnly,
+		target:        s.target,
 	}
 }
 
@@ -142,6 +168,7 @@ func (s *Scope) WithForceDeploy(forceDeploy bool) *Scope {
 		infraServices: s.copyInfraServices(),
 		forceDeploy:   forceDeploy,
 		dnsOnly:       s.dnsOnly,
+		target:        s.target,
 	}
 }
 
@@ -155,9 +182,20 @@ func (s *Scope) WithDNSOnly(dnsOnly bool) *Scope {
 		infraServices: s.copyInfraServices(),
 		forceDeploy:   s.forceDeploy,
 		dnsOnly:       dnsOnly,
+		target:        s.target,
 	}
 }
 
+// WithTargets limits the plan to the changes addressed by targets, given as
+// entity:name, plus their dependencies and dependents when asked for.
+func (s *Scope) WithTargets(targets []string, dependencies, dependents bool) *Scope {
+	newTargets := make([]string, len(targets))
+	copy(newTargets, targets)
+	c := s.Clone()
+	c.target = &targetSelection{targets: newTargets, dependencies: dependencies, dependents: dependents}
+	return c
+}
+
 func (s *Scope) copyServices() []string {
 	if s.services == nil {
 		return nil
@@ -186,6 +224,17 @@ func (s *Scope) Equals(other *Scope) bool {
 	if s.forceDeploy != other.forceDeploy || s.dnsOnly != other.dnsOnly {
 		return false
 	}
+	if s.TargetDependencies() != other.TargetDependencies() || s.TargetDependents() != other.TargetDependents() {
+		return false
+	}
+	if len(s.Targets()) != len(other.Targets()) {
+		return false
+	}
+	for i, target := range s.Targets() {
+		if target != other.Targets()[i] {
+			return false
+		}
+	}
 	if len(s.services) != len(other.services) || len(s.infraServices) != len(other.infraServices) {
 		return false
 	}
@@ -212,6 +261,7 @@ func (s *Scope) Clone() *Scope {
 		infraServices: s.copyInfraServices(),
 		forceDeploy:   s.forceDeploy,
 		dnsOnly:       s.dnsOnly,
+		target:        s.target,
 	}
 }
 
@@ -266,7 +316,7 @@ func (s *Scope) MatchesInfra(zone, server, infraService string) bool {
 }
 
 func (s *Scope) IsEmpty() bool {
-	return s.zone == "" && s.server == "" && s.service == "" && s.domain == "" && len(s.services) == 0 && len(s.infraServices) == 0
+	return s.zone == "" && s.server == "" && s.service == "" && s.domain == "" && len(s.services) == 0 && len(s.infraServices) == 0 && len(s.Targets()) == 0
 }
 
 func (s *Scope) HasServicesOnly() bool {
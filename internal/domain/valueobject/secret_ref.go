@@ -53,7 +53,7 @@ func (s *SecretRef) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
-func (s *SecretRef) MarshalYAML() (interface{}, error) {
+func (s SecretRef) MarshalYAML() (interface{}, error) {
 	if s.secret != "" {
 		return map[string]string{"secret": s.secret}, nil
 	}
@@ -0,0 +1,408 @@
+// Package formatter rewrites the userdata config files in a canonical form.
+// It works on the parsed yaml.Node tree rather than on decoded entities, so
+// that comments, quoting and ${...} references survive.
+package formatter
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+var (
+	secretRefType    = reflect.TypeOf(valueobject.SecretRef{})
+	volumeType       = reflect.TypeOf(entity.ServiceVolume{})
+	infraServiceType = reflect.TypeOf(entity.InfraService{})
+)
+
+// Format returns src, the content of a config file, in canonical form:
+//
+//   - entities are sorted by name, DNS records by name and type;
+//   - fields are in the order the entity codecs write them, unknown keys
+//     last;
+//   - short source:target volumes are expanded to source and target;
+//   - secret refs are a plain string or a block mapping with only secret;
+//   - numbers such as TTLs and ports are unquoted and written in decimal;
+//   - mappings and lists use block style, indented by two spaces, and the
+//     entities of a file are separated by a blank line.
+//
+// Comments are kept with the node they belong to. Keys that are not entity
+// sections, such as vars, only have their layout normalized.
+func Format(src []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, fmt.Errorf("parsing YAML: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return src, nil
+	}
+	formatDocument(&doc)
+	return encode(&doc)
+}
+
+// Marshal encodes data under key as a config file in canonical form. The
+// comments of previous, the file's current content, are carried over to the
+// keys and entities that are still there. previous may be nil.
+func Marshal(key string, data interface{}, previous []byte) ([]byte, error) {
+	var root yaml.Node
+	if err := root.Encode(map[string]interface{}{key: data}); err != nil {
+		return nil, fmt.Errorf("encoding %s: %w", key, err)
+	}
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&root}}
+
+	var old yaml.Node
+	if len(previous) > 0 && yaml.Unmarshal(previous, &old) == nil {
+		copyComments(doc, &old)
+	}
+	formatDocument(doc)
+	return encode(doc)
+}
+
+func formatDocument(doc *yaml.Node) {
+	blockStyle(doc)
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if f, ok := entity.ConfigSection(root.Content[i].Value); ok {
+			formatValue(root.Content[i+1], f.Type)
+		}
+	}
+}
+
+func formatValue(node *yaml.Node, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case secretRefType:
+		formatSecretRef(node)
+		return
+	case volumeType:
+		expandVolume(node)
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		switch t.Kind() {
+		case reflect.Struct:
+			formatStruct(node, shape(t, node))
+		case reflect.Map:
+			for i := 1; i < len(node.Content); i += 2 {
+				formatValue(node.Content[i], t.Elem())
+			}
+		}
+	case yaml.SequenceNode:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, item := range node.Content {
+				formatValue(item, t.Elem())
+			}
+			sortByName(node)
+		}
+	case yaml.ScalarNode:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			normalizeInt(node)
+		}
+	}
+}
+
+// shape returns the struct whose fields describe t in YAML. For entities
+// with their own codec, that is the struct their MarshalYAML returns, which
+// for an infra service depends on its type.
+func shape(t reflect.Type, node *yaml.Node) reflect.Type {
+	v := reflect.New(t).Elem()
+	if t == infraServiceType {
+		v.Set(reflect.ValueOf(entity.InfraService{Type: entity.InfraServiceType(mappingValue(node, "type"))}))
+	}
+	if m, ok := v.Interface().(yaml.Marshaler); ok {
+		if out, err := m.MarshalYAML(); err == nil && out != nil && reflect.TypeOf(out).Kind() == reflect.Struct {
+			return reflect.TypeOf(out)
+		}
+	}
+	return t
+}
+
+type field struct {
+	key string
+	typ reflect.Type
+}
+
+// fields lists the YAML keys of struct t in order, inlining embedded
+// structs where they appear.
+func fields(t reflect.Type) []field {
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, skip := entity.YAMLName(f)
+		if skip {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			out = append(out, fields(embedded)...)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		out = append(out, field{key: name, typ: f.Type})
+	}
+	return out
+}
+
+// formatStruct orders the keys of node as the fields of t and formats
+// their values. Keys t does not know keep their order after the others.
+func formatStruct(node *yaml.Node, t reflect.Type) {
+	index := make(map[string]int)
+	types := make(map[string]reflect.Type)
+	for i, f := range fields(t) {
+		index[f.key] = i
+		types[f.key] = f.typ
+	}
+
+	pairs := make([][2]*yaml.Node, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+	}
+	position := func(key string) int {
+		if i, ok := index[key]; ok {
+			return i
+		}
+		return len(index)
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return position(pairs[i][0].Value) < position(pairs[j][0].Value)
+	})
+
+	node.Content = node.Content[:0]
+	for _, p := range pairs {
+		if typ, ok := types[p[0].Value]; ok {
+			formatValue(p[1], typ)
+		}
+		node.Content = append(node.Content, p[0], p[1])
+	}
+}
+
+// sortByName sorts a list of named entities by name, and by type among
+// those of the same name such as DNS records. Lists with an item lacking a
+// name are left as they are.
+func sortByName(node *yaml.Node) {
+	for _, item := range node.Content {
+		if mappingValue(item, "name") == "" {
+			return
+		}
+	}
+	sort.SliceStable(node.Content, func(i, j int) bool {
+		a, b := node.Content[i], node.Content[j]
+		if na, nb := mappingValue(a, "name"), mappingValue(b, "name"); na != nb {
+			return na < nb
+		}
+		return mappingValue(a, "type") < mappingValue(b, "type")
+	})
+}
+
+// formatSecretRef writes a secret ref as its plain value, or as a mapping
+// holding only secret.
+func formatSecretRef(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	var plain, secret []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		switch node.Content[i].Value {
+		case "plain":
+			plain = node.Content[i : i+2]
+		case "secret":
+			secret = node.Content[i : i+2]
+		}
+	}
+	switch {
+	case secret != nil && secret[1].Value != "":
+		node.Content = []*yaml.Node{secret[0], secret[1]}
+	case plain != nil:
+		value := plain[1]
+		node.Kind, node.Tag, node.Style, node.Value = value.Kind, value.Tag, value.Style, value.Value
+		node.Content = nil
+		node.LineComment = joinComments(node.LineComment, value.LineComment)
+	}
+}
+
+// expandVolume turns the short form source:target of a volume into a
+// mapping.
+func expandVolume(node *yaml.Node) {
+	if node.Kind != yaml.ScalarNode {
+		return
+	}
+	source, target, ok := strings.Cut(node.Value, ":")
+	if !ok {
+		return
+	}
+	node.Kind, node.Tag, node.Style, node.Value = yaml.MappingNode, "!!map", 0, ""
+	node.Content = []*yaml.Node{
+		scalar("source"), scalar(source),
+		scalar("target"), scalar(target),
+	}
+}
+
+// normalizeInt writes a number as a plain decimal integer, whether it is
+// quoted, such as ttl: "600", or in another notation YAML reads as an
+// integer, such as 0x258. A quoted number is read as decimal. References
+// and other strings are left alone.
+func normalizeInt(node *yaml.Node) {
+	var n int64
+	switch node.ShortTag() {
+	case "!!str":
+		v, err := strconv.ParseInt(node.Value, 10, 64)
+		if err != nil {
+			return
+		}
+		n = v
+	case "!!int":
+		if err := node.Decode(&n); err != nil {
+			return
+		}
+	default:
+		return
+	}
+	node.Tag, node.Style, node.Value = "!!int", 0, strconv.FormatInt(n, 10)
+}
+
+// blockStyle switches every mapping and list under node to block style.
+func blockStyle(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode || node.Kind == yaml.SequenceNode {
+		node.Style &^= yaml.FlowStyle
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// copyComments copies the comments of src onto the matching nodes of dst
+// that have none: mapping values are matched by key and list items by
+// name and type.
+func copyComments(dst, src *yaml.Node) {
+	if dst.Kind != src.Kind {
+		return
+	}
+	if dst.HeadComment == "" {
+		dst.HeadComment = src.HeadComment
+	}
+	if dst.LineComment == "" {
+		dst.LineComment = src.LineComment
+	}
+	if dst.FootComment == "" {
+		dst.FootComment = src.FootComment
+	}
+
+	switch dst.Kind {
+	case yaml.DocumentNode:
+		if len(dst.Content) > 0 && len(src.Content) > 0 {
+			copyComments(dst.Content[0], src.Content[0])
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(dst.Content); i += 2 {
+			for j := 0; j+1 < len(src.Content); j += 2 {
+				if dst.Content[i].Value == src.Content[j].Value {
+					copyComments(dst.Content[i], src.Content[j])
+					copyComments(dst.Content[i+1], src.Content[j+1])
+					break
+				}
+			}
+		}
+	case yaml.SequenceNode:
+		for _, item := range dst.Content {
+			name := mappingValue(item, "name")
+			if name == "" {
+				continue
+			}
+			for _, old := range src.Content {
+				if mappingValue(old, "name") == name && mappingValue(old, "type") == mappingValue(item, "type") {
+					copyComments(item, old)
+					break
+				}
+			}
+		}
+	}
+}
+
+// encode writes doc with two-space indentation and a blank line between
+// the entities of each top-level list.
+func encode(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("encoding YAML: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encoding YAML: %w", err)
+	}
+	return separateEntities(buf.Bytes()), nil
+}
+
+// separateEntities inserts a blank line before every item of a top-level
+// list but the first, above the comments leading the item.
+func separateEntities(data []byte) []byte {
+	lines := strings.SplitAfter(string(data), "\n")
+	out := make([]string, 0, len(lines))
+	first := true
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "  - "):
+			if !first {
+				i := len(out)
+				for i > 0 && strings.HasPrefix(out[i-1], "  #") {
+					i--
+				}
+				out = append(out[:i], append([]string{"\n"}, out[i:]...)...)
+			}
+			first = false
+		case line != "" && line != "\n" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "#"):
+			first = true
+		}
+		out = append(out, line)
+	}
+	return []byte(strings.Join(out, ""))
+}
+
+// mappingValue returns the scalar value of key in node, empty when node is
+// not a mapping or has no such scalar.
+func mappingValue(node *yaml.Node, key string) string {
+	if node.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key && node.Content[i+1].Kind == yaml.ScalarNode {
+			return node.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+func joinComments(a, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + " " + b
+}
@@ -0,0 +1,214 @@
+package formatter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "sorts entities and orders fields",
+			src: `services:
+  - image: web:1.0
+    name: web
+    server: srv1
+  # the API
+  - name: api # public
+    port: 80
+    server: srv1
+    image: api:1.0
+`,
+			want: `services:
+  # the API
+  - name: api # public
+    server: srv1
+    image: api:1.0
+    port: 80
+
+  - name: web
+    server: srv1
+    image: web:1.0
+`,
+		},
+		{
+			name: "orders infra services by their type",
+			src: `infra_services:
+  - ports: {api: 38567}
+    image: ssl:1.0
+    server: srv1
+    type: ssl
+    name: ssl
+`,
+			want: `infra_services:
+  - name: ssl
+    type: ssl
+    server: srv1
+    image: ssl:1.0
+    ports:
+      api: 38567
+`,
+		},
+		{
+			name: "expands volumes and normalizes secret refs",
+			src: `services:
+  - name: api
+    env:
+      A: {plain: x}
+      B: {secret: db_password}
+      C: y
+    volumes:
+      - ./data:/app/data
+`,
+			want: `services:
+  - name: api
+    env:
+      A: x
+      B:
+        secret: db_password
+      C: y
+    volumes:
+      - source: ./data
+        target: /app/data
+`,
+		},
+		{
+			name: "sorts records and unquotes ttls",
+			src: `domains:
+  - name: example.com
+    records:
+      - {type: TXT, name: www, value: v, ttl: "600"}
+      - type: A
+        name: www
+        value: 1.2.3.4
+        ttl: ${var.ttl}
+      - type: A
+        name: "@"
+        value: 1.2.3.4
+        ttl: 300
+`,
+			want: `domains:
+  - name: example.com
+    records:
+      - type: A
+        name: "@"
+        value: 1.2.3.4
+        ttl: 300
+      - type: A
+        name: www
+        value: 1.2.3.4
+        ttl: ${var.ttl}
+      - type: TXT
+        name: www
+        value: v
+        ttl: 600
+`,
+		},
+		{
+			name: "keeps other keys",
+			src: `# shared values
+vars:
+  region: {east: cn-shanghai}
+`,
+			want: `# shared values
+vars:
+  region:
+    east: cn-shanghai
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format([]byte(tt.src))
+			if err != nil {
+				t.Fatalf("Format() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Format() =\n%s\nwant\n%s", got, tt.want)
+			}
+			again, err := Format(got)
+			if err != nil || string(again) != string(got) {
+				t.Errorf("Format() is not idempotent:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestFormat_Idempotent(t *testing.T) {
+	tests := []struct {
+		ttl  string
+		want string
+	}{
+		{`600`, "ttl: 600"},
+		{`"600"`, "ttl: 600"},
+		{`'0600'`, "ttl: 600"},
+		{`+600`, "ttl: 600"},
+		{`0x258`, "ttl: 600"},
+		{`6_00`, "ttl: 600"},
+		{`0600`, "ttl: 384"},
+		{`"${var.ttl}"`, `ttl: "${var.ttl}"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ttl, func(t *testing.T) {
+			src := "domains:\n  - name: example.com\n    records:\n      - {type: A, name: www, value: 1.2.3.4, ttl: " + tt.ttl + "}\n"
+			once, err := Format([]byte(src))
+			if err != nil {
+				t.Fatalf("Format() error = %v", err)
+			}
+			if !strings.Contains(string(once), "        "+tt.want+"\n") {
+				t.Errorf("Format() =\n%s\nwant it to contain %q", once, tt.want)
+			}
+			twice, err := Format(once)
+			if err != nil {
+				t.Fatalf("Format() error = %v", err)
+			}
+			if string(twice) != string(once) {
+				t.Errorf("Format() of its own output changed it:\n%s\nthen\n%s", once, twice)
+			}
+		})
+	}
+}
+
+func TestFormat_InvalidYAML(t *testing.T) {
+	if _, err := Format([]byte("services: [")); err == nil {
+		t.Error("Format() error = nil, want a parse error")
+	}
+}
+
+func TestMarshal_KeepsComments(t *testing.T) {
+	previous := []byte(`# managed by dns pull
+domains:
+  # main site
+  - name: example.com
+    records:
+      - type: A
+        name: www # load balancer
+        value: 1.2.3.4
+        ttl: 300
+`)
+	domains := []entity.Domain{{
+		Name: "example.com",
+		Records: []entity.DNSRecord{
+			{Type: entity.DNSRecordTypeA, Name: "www", Value: "5.6.7.8", TTL: 600},
+			{Type: entity.DNSRecordTypeA, Name: "api", Value: "5.6.7.8", TTL: 600},
+		},
+	}}
+	got, err := Marshal("domains", domains, previous)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	for _, want := range []string{"# managed by dns pull\ndomains:", "  # main site\n  - name: example.com", "name: www # load balancer", "value: 5.6.7.8"} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("Marshal() =\n%s\nwant it to contain %q", got, want)
+		}
+	}
+	if strings.Index(string(got), "name: api") > strings.Index(string(got), "name: www") {
+		t.Errorf("Marshal() did not sort the records:\n%s", got)
+	}
+}
@@ -0,0 +1,209 @@
+// Package journal records the progress of an apply on disk so that an apply
+// that stopped halfway can be resumed with the same plan.
+package journal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lite-lake/infra-yamlops/internal/constants"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/planfile"
+)
+
+type Status string
+
+const (
+	StatusStarted   Status = "started"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusSkipped   Status = "skipped"
+)
+
+// Entry is one line of the journal log.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Change string    `json:"change"`
+	Type   string    `json:"type"`
+	Status Status    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Journal is the plan of an apply, stored as a plan file, together with an
+// append-only log of the start and outcome of each of its changes.
+type Journal struct {
+	planPath string
+	logPath  string
+	log      *os.File
+}
+
+// Dir is the directory holding the journals of configDir.
+func Dir(configDir string) string {
+	return filepath.Join(configDir, constants.StateDir, "journal")
+}
+
+// ChangeKey identifies ch in the journal log.
+func ChangeKey(ch *valueobject.Change) string {
+	return ch.Entity() + ":" + ch.Name()
+}
+
+func paths(dir, env string) (string, string) {
+	return filepath.Join(dir, env+".plan.yaml"), filepath.Join(dir, env+".jsonl")
+}
+
+// Exists reports whether an unfinished journal is left for env.
+func Exists(dir, env string) bool {
+	planPath, _ := paths(dir, env)
+	_, err := os.Stat(planPath)
+	return err == nil
+}
+
+// Create starts a new journal for pf, replacing any journal left for env.
+func Create(dir, env string, pf *planfile.File) (*Journal, error) {
+	planPath, logPath := paths(dir, env)
+	if err := planfile.Save(planPath, pf); err != nil {
+		return nil, err
+	}
+	log, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, constants.FilePermissionOwnerRW)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", domain.ErrFileWriteFailed, logPath, err)
+	}
+	return &Journal{planPath: planPath, logPath: logPath, log: log}, nil
+}
+
+// Load reads the journal left for env: the plan it was created for and the
+// entries logged so far.
+func Load(dir, env string) (*planfile.File, []Entry, error) {
+	planPath, logPath := paths(dir, env)
+	if _, err := os.Stat(planPath); os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("%w: env %s", domain.ErrJournalNotFound, env)
+	}
+	pf, err := planfile.Load(planPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, _, err := readEntries(logPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pf, entries, nil
+}
+
+// Open reopens the journal left for env so that new entries are appended.
+func Open(dir, env string) (*Journal, error) {
+	planPath, logPath := paths(dir, env)
+	if _, err := os.Stat(planPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: env %s", domain.ErrJournalNotFound, env)
+	}
+	_, truncated, err := readEntries(logPath)
+	if err != nil {
+		return nil, err
+	}
+	log, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, constants.FilePermissionOwnerRW)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", domain.ErrFileWriteFailed, logPath, err)
+	}
+	if truncated {
+		if _, err := log.Write([]byte("\n")); err != nil {
+			log.Close()
+			return nil, fmt.Errorf("%w: %s: %w", domain.ErrFileWriteFailed, logPath, err)
+		}
+	}
+	return &Journal{planPath: planPath, logPath: logPath, log: log}, nil
+}
+
+// readEntries also reports whether the log ends in the middle of a line, so
+// that appending starts on a fresh one.
+func readEntries(path string) ([]Entry, bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %s: %w", domain.ErrFileReadFailed, path, err)
+	}
+
+	var entries []Entry
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var e Entry
+		// A line cut short by a crash is the last one and carries nothing
+		// that resuming depends on.
+		if err := json.Unmarshal(line, &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, len(data) > 0 && data[len(data)-1] != '\n', nil
+}
+
+// Record appends an entry for ch and syncs it to disk before returning.
+func (j *Journal) Record(ch *valueobject.Change, status Status, changeErr error) error {
+	e := Entry{
+		Time:   time.Now().UTC(),
+		Change: ChangeKey(ch),
+		Type:   ch.Type().String(),
+		Status: status,
+	}
+	if changeErr != nil {
+		e.Error = changeErr.Error()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshaling journal entry: %w", err)
+	}
+	if _, err := j.log.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("%w: %s: %w", domain.ErrFileWriteFailed, j.logPath, err)
+	}
+	if err := j.log.Sync(); err != nil {
+		return fmt.Errorf("%w: %s: %w", domain.ErrFileWriteFailed, j.logPath, err)
+	}
+	return nil
+}
+
+func (j *Journal) Close() error {
+	return j.log.Close()
+}
+
+// Remove closes the journal and deletes it, once the whole plan is applied.
+func (j *Journal) Remove() error {
+	j.log.Close()
+	for _, path := range []string{j.logPath, j.planPath} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing journal %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Succeeded returns the changes whose latest entry reports success.
+func Succeeded(entries []Entry) map[string]bool {
+	last := make(map[string]Status)
+	for _, e := range entries {
+		last[e.Change] = e.Status
+	}
+	done := make(map[string]bool)
+	for change, status := range last {
+		if status == StatusSucceeded {
+			done[change] = true
+		}
+	}
+	return done
+}
+
+// Remaining returns the changes of plan that have not succeeded yet, in plan
+// order and with the plan's scope.
+func Remaining(plan *valueobject.Plan, entries []Entry) *valueobject.Plan {
+	done := Succeeded(entries)
+	remaining := valueobject.NewPlanWithScope(plan.Scope())
+	for _, ch := range plan.Changes() {
+		if !done[ChangeKey(ch)] {
+			remaining.AddChange(ch)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,119 @@
+package journal
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/planfile"
+)
+
+func testPlanFile(t *testing.T) *planfile.File {
+	t.Helper()
+	p := valueobject.NewPlanWithScope(valueobject.NewScope().WithServer("srv1"))
+	for _, name := range []string{"api", "web", "worker"} {
+		p.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "service", name, nil,
+			&entity.BizService{Name: name, ServiceBase: entity.ServiceBase{Server: "srv1"}}, nil, false))
+	}
+	pf, err := planfile.New("prod", &entity.Config{}, repository.NewDeploymentState(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pf
+}
+
+func TestJournal_Resume(t *testing.T) {
+	dir := t.TempDir()
+	pf := testPlanFile(t)
+	changes := pf.Plan.Changes()
+
+	if _, _, err := Load(dir, "prod"); !errors.Is(err, domain.ErrJournalNotFound) {
+		t.Fatalf("Load() without journal error = %v, want ErrJournalNotFound", err)
+	}
+
+	j, err := Create(dir, "prod", pf)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	j.Record(changes[0], StatusStarted, nil)
+	j.Record(changes[0], StatusSucceeded, nil)
+	j.Record(changes[1], StatusStarted, nil)
+	j.Record(changes[1], StatusFailed, errors.New("boom"))
+	j.Close()
+	if !Exists(dir, "prod") {
+		t.Fatal("Exists() = false after Create")
+	}
+
+	loaded, entries, err := Load(dir, "prod")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(entries) != 4 || entries[3].Error != "boom" || entries[3].Change != "service:web" {
+		t.Errorf("entries = %+v", entries)
+	}
+
+	remaining := Remaining(loaded.Plan, entries)
+	var names []string
+	for _, ch := range remaining.Changes() {
+		names = append(names, ch.Name())
+	}
+	if len(names) != 2 || names[0] != "web" || names[1] != "worker" {
+		t.Errorf("Remaining() = %v, want [web worker]", names)
+	}
+	if remaining.Scope().Server() != "srv1" {
+		t.Errorf("Remaining() lost the plan scope: %+v", remaining.Scope())
+	}
+
+	if j, err = Open(dir, "prod"); err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	j.Record(remaining.Changes()[0], StatusSucceeded, nil)
+	j.Close()
+	_, entries, _ = Load(dir, "prod")
+	if !Succeeded(entries)["service:web"] {
+		t.Errorf("appended entry not read back: %+v", entries)
+	}
+}
+
+func TestJournal_IgnoresTruncatedLine(t *testing.T) {
+	dir := t.TempDir()
+	pf := testPlanFile(t)
+	j, err := Create(dir, "prod", pf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Record(pf.Plan.Changes()[0], StatusSucceeded, nil)
+	j.log.WriteString(`{"time":"2024-01-01T00:00:00Z","change":"serv`)
+	j.Close()
+
+	_, entries, err := Load(dir, "prod")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("entries = %+v, want the complete line only", entries)
+	}
+
+	j, _ = Open(dir, "prod")
+	j.Record(pf.Plan.Changes()[1], StatusSucceeded, nil)
+	j.Close()
+	_, entries, _ = Load(dir, "prod")
+	if len(entries) != 2 {
+		t.Errorf("entry appended after a truncated line was lost: %+v", entries)
+	}
+
+	j, _ = Open(dir, "prod")
+	if err := j.Remove(); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if Exists(dir, "prod") {
+		t.Error("journal still exists after Remove")
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("files left after Remove: %v", files)
+	}
+}
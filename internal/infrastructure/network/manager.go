@@ -96,6 +96,21 @@ func (m *Manager) Create(spec *entity.ServerNetwork) error {
 	return nil
 }
 
+// Remove deletes the network name; a network that does not exist is not an
+// error.
+func (m *Manager) Remove(name string) error {
+	exists, err := m.Exists(name)
+	if err != nil || !exists {
+		return err
+	}
+	cmd := fmt.Sprintf("sudo docker network rm %s", ssh.ShellEscape(name))
+	_, stderr, err := m.client.Run(cmd)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w, stderr: %s", domainerr.ErrNetworkRemoveFailed, name, err, stderr)
+	}
+	return nil
+}
+
 func (m *Manager) Ensure(spec *entity.ServerNetwork) error {
 	exists, err := m.Exists(spec.Name)
 	if err != nil {
@@ -2,9 +2,12 @@ package persistence
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 
 	domainerr "github.com/lite-lake/infra-yamlops/internal/domain"
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
@@ -18,10 +21,15 @@ type ConfigLoader struct{ baseDir string }
 
 func NewConfigLoader(baseDir string) *ConfigLoader { return &ConfigLoader{baseDir: baseDir} }
 
+// Load reads the config of env. Every file of the userdata/_base layer is
+// deep-merged with the environment file of the same name, see
+// mergeDocuments, and the references in its values are then resolved
+// against vars.yaml and servers.yaml, see interpolator.
 func (l *ConfigLoader) Load(ctx context.Context, env string) (*entity.Config, error) {
 	log := logger.FromContext(ctx)
 
 	configDir := filepath.Join(l.baseDir, "userdata", env)
+	baseDir := filepath.Join(l.baseDir, "userdata", BaseEnv)
 	log.Debug("loading config", "env", env, "dir", configDir)
 
 	if _, err := os.Stat(configDir); os.IsNotExist(err) {
@@ -29,10 +37,10 @@ func (l *ConfigLoader) Load(ctx context.Context, env string) (*entity.Config, er
 		return nil, fmt.Errorf("%w: %s", domainerr.ErrConfigNotFound, configDir)
 	}
 
-	cfg := &entity.Config{}
+	cfg := &entity.Config{Sources: make(map[string]entity.Source)}
 	loaders := []struct {
 		filename string
-		loader   func(string, *entity.Config) error
+		loader   func(*decoder, *yaml.Node, *entity.Config)
 	}{
 		{"secrets.yaml", loadSecrets},
 		{"isps.yaml", loadISPs},
@@ -42,123 +50,283 @@ func (l *ConfigLoader) Load(ctx context.Context, env string) (*entity.Config, er
 		{"services_biz.yaml", loadServices},
 		{"registries.yaml", loadRegistries},
 		{"dns.yaml", loadDomains},
+		{"backend.yaml", loadBackend},
+		{"policies.yaml", loadPolicies},
 	}
 
+	filenames := []string{varsFile}
 	for _, f := range loaders {
-		filePath := filepath.Join(configDir, f.filename)
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			log.Debug("config file skipped", "file", f.filename, "reason", "not found")
+		filenames = append(filenames, f.filename)
+	}
+	files := nodeFiles{}
+	docs := make(map[string]*yaml.Node, len(filenames))
+	for _, filename := range filenames {
+		doc, err := readLayeredDocument(baseDir, configDir, filename, files)
+		if err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			log.Debug("config file skipped", "file", filename, "reason", "not found")
 			continue
 		}
-		log.Debug("loading config file", "file", f.filename)
-		if err := f.loader(filePath, cfg); err != nil {
-			log.Error("failed to load config file", "file", f.filename, "error", err)
-			return nil, fmt.Errorf("%w: %s: %w", domainerr.ErrConfigReadFailed, f.filename, err)
+		docs[filename] = doc
+	}
+
+	if err := interpolateDocuments(env, filenames, docs); err != nil {
+		log.Error("failed to resolve config references", "error", err)
+		return nil, err
+	}
+
+	d := &decoder{files: files}
+	for _, f := range loaders {
+		doc, ok := docs[f.filename]
+		if !ok {
+			continue
 		}
+		log.Debug("loading config file", "file", f.filename)
+		recordSources(doc, files, cfg.Sources)
+		f.loader(d, doc, cfg)
+	}
+	if err := d.errs.Err(); err != nil {
+		log.Error("failed to load config", "error", err)
+		return nil, fmt.Errorf("%w: %w", domainerr.ErrConfigReadFailed, err)
 	}
 
 	log.Info("config loaded", "env", env)
 	return cfg, nil
 }
 
+// varsFile holds the variables of an environment under its vars key. It
+// only feeds interpolation and is not part of entity.Config.
+const varsFile = "vars.yaml"
+
+// readLayeredDocument reads filename, with its fragments, from the base
+// layer and from the environment and merges the two. It returns nil when
+// neither exists.
+func readLayeredDocument(baseDir, configDir, filename string, files nodeFiles) (*yaml.Node, error) {
+	base, err := readLayer(baseDir, filename, files)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := readLayer(configDir, filename, files)
+	if err != nil {
+		return nil, err
+	}
+	if base == nil && doc == nil {
+		return nil, nil
+	}
+	return mergeDocuments(base, doc, files), nil
+}
+
+// interpolateDocuments resolves the references of all documents in place.
+// vars.yaml may only use ${env}, and servers.yaml is resolved before the
+// others so that they can refer to its values.
+func interpolateDocuments(env string, filenames []string, docs map[string]*yaml.Node) error {
+	in := newInterpolator(env, nil)
+	if err := in.interpolateDocument(docs[varsFile]); err != nil {
+		return fmt.Errorf("%s: %w", varsFile, err)
+	}
+	if vars := docs[varsFile]; vars != nil {
+		var raw map[string]interface{}
+		if err := vars.Decode(&raw); err != nil {
+			return fmt.Errorf("%s: %w", varsFile, err)
+		}
+		in.vars, _ = raw["vars"].(map[string]interface{})
+	}
+
+	const serversFile = "servers.yaml"
+	if err := in.interpolateDocument(docs[serversFile]); err != nil {
+		return fmt.Errorf("%s: %w", serversFile, err)
+	}
+	if err := in.setServers(docs[serversFile]); err != nil {
+		return fmt.Errorf("%s: %w", serversFile, err)
+	}
+
+	for _, filename := range filenames {
+		doc, ok := docs[filename]
+		if !ok || filename == varsFile || filename == serversFile {
+			continue
+		}
+		if err := in.interpolateDocument(doc); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	return nil
+}
+
 func (l *ConfigLoader) Validate(cfg *entity.Config) error {
 	return service.NewValidator(cfg).Validate()
 }
 
-func loadEntity[T any](filePath, yamlKey string) ([]T, error) {
+// readOptionalDocument parses a config file into its top-level mapping
+// node, returning nil when it does not exist. An empty file is an empty
+// document. Its nodes are recorded in files.
+func readOptionalDocument(filePath string, files nodeFiles) (*yaml.Node, error) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
 		return nil, fmt.Errorf("reading config file %s: %w", filePath, err)
 	}
-	var raw map[string]interface{}
-	if err := yaml.Unmarshal(data, &raw); err != nil {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
 		return nil, fmt.Errorf("parsing YAML in %s: %w", filePath, err)
 	}
-	itemsRaw, ok := raw[yamlKey]
-	if !ok {
-		return nil, nil
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1, Column: 1}
+	if len(node.Content) > 0 && node.Content[0].ShortTag() != "!!null" {
+		root = node.Content[0]
+		if root.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("parsing YAML in %s: line %d: the document is not a mapping", filePath, root.Line)
+		}
 	}
-	itemsData, err := yaml.Marshal(itemsRaw)
+	files.add(root, filePath)
+	return root, nil
+}
+
+func loadEntity[T any](filePath, yamlKey string) ([]T, error) {
+	files := nodeFiles{}
+	doc, err := readOptionalDocument(filePath, files)
 	if err != nil {
-		return nil, fmt.Errorf("marshaling %s items in %s: %w", yamlKey, filePath, err)
+		return nil, err
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("reading config file %s: %w", filePath, os.ErrNotExist)
 	}
-	var items []T
-	if err := yaml.Unmarshal(itemsData, &items); err != nil {
-		return nil, fmt.Errorf("parsing %s items in %s: %w", yamlKey, filePath, err)
+	d := &decoder{files: files}
+	items := decodeEntity[T](d, doc, yamlKey)
+	if err := d.errs.Err(); err != nil {
+		return nil, err
 	}
 	return items, nil
 }
 
-func loadSecrets(fp string, cfg *entity.Config) error {
-	items, err := loadEntity[entity.Secret](fp, "secrets")
-	if err != nil {
-		return fmt.Errorf("loading secrets from %s: %w", fp, err)
-	}
-	cfg.Secrets = items
-	return nil
+// decoder decodes the entities of config documents, collecting every
+// failure with the position of the node at fault.
+type decoder struct {
+	files nodeFiles
+	errs  domainerr.ValidationErrors
 }
 
-func loadISPs(fp string, cfg *entity.Config) error {
-	items, err := loadEntity[entity.ISP](fp, "isps")
-	if err != nil {
-		return fmt.Errorf("loading ISPs from %s: %w", fp, err)
+// typeErrorLine matches the messages of a yaml.TypeError, which locate the
+// value at fault by line.
+var typeErrorLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// decode decodes node into out and reports its failures under path. The
+// type errors of its fields are reported one by one, at the value at
+// fault.
+func (d *decoder) decode(node *yaml.Node, path string, out interface{}) bool {
+	err := node.Decode(out)
+	if err == nil {
+		return true
 	}
-	cfg.ISPs = items
-	return nil
+	var terr *yaml.TypeError
+	if !errors.As(err, &terr) {
+		d.fail(d.files.source(node, node), fmt.Errorf("%s: %w", path, err))
+		return false
+	}
+	for _, msg := range terr.Errors {
+		at := node
+		if m := typeErrorLine.FindStringSubmatch(msg); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			if found := findLine(node, line); found != nil {
+				at, msg = found, m[2]
+			}
+		}
+		d.fail(d.files.source(at, node), fmt.Errorf("%s: %s", path, msg))
+	}
+	return false
 }
 
-func loadZones(fp string, cfg *entity.Config) error {
-	items, err := loadEntity[entity.Zone](fp, "zones")
-	if err != nil {
-		return fmt.Errorf("loading zones from %s: %w", fp, err)
-	}
-	cfg.Zones = items
-	return nil
+func (d *decoder) fail(src entity.Source, err error) {
+	d.errs = append(d.errs, &domainerr.ValidationError{File: src.File, Line: src.Line, Column: src.Column, Err: err})
 }
 
-func loadInfraServices(fp string, cfg *entity.Config) error {
-	items, err := loadEntity[entity.InfraService](fp, "infra_services")
-	if err != nil {
-		return fmt.Errorf("loading infra services from %s: %w", fp, err)
+// findLine returns the first value under node that starts on line.
+func findLine(node *yaml.Node, line int) *yaml.Node {
+	if node.Line == line && node.Kind != yaml.MappingNode {
+		return node
+	}
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		if found := findLine(child, line); found != nil {
+			return found
+		}
+	}
+	if node.Line == line {
+		return node
 	}
-	cfg.InfraServices = items
 	return nil
 }
 
-func loadServers(fp string, cfg *entity.Config) error {
-	items, err := loadEntity[entity.Server](fp, "servers")
-	if err != nil {
-		return fmt.Errorf("loading servers from %s: %w", fp, err)
+// decodeEntity decodes each item of the yamlKey list of doc on its own, so
+// that every item at fault is reported.
+func decodeEntity[T any](d *decoder, doc *yaml.Node, yamlKey string) []T {
+	list := mappingValue(doc, yamlKey)
+	if list == nil || list.ShortTag() == "!!null" {
+		return nil
 	}
-	cfg.Servers = items
-	return nil
+	if list.Kind != yaml.SequenceNode {
+		d.fail(d.files.source(list, doc), fmt.Errorf("%s: must be a list", yamlKey))
+		return nil
+	}
+	items := make([]T, 0, len(list.Content))
+	for i, node := range list.Content {
+		var item T
+		if d.decode(node, fmt.Sprintf("%s[%d]", yamlKey, i), &item) {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
-func loadServices(fp string, cfg *entity.Config) error {
-	items, err := loadEntity[entity.BizService](fp, "services")
-	if err != nil {
-		return fmt.Errorf("loading services from %s: %w", fp, err)
-	}
-	cfg.Services = items
-	return nil
+func loadSecrets(d *decoder, doc *yaml.Node, cfg *entity.Config) {
+	cfg.Secrets = decodeEntity[entity.Secret](d, doc, "secrets")
 }
 
-func loadRegistries(fp string, cfg *entity.Config) error {
-	items, err := loadEntity[entity.Registry](fp, "registries")
-	if err != nil {
-		return fmt.Errorf("loading registries from %s: %w", fp, err)
-	}
-	cfg.Registries = items
-	return nil
+func loadISPs(d *decoder, doc *yaml.Node, cfg *entity.Config) {
+	cfg.ISPs = decodeEntity[entity.ISP](d, doc, "isps")
 }
 
-func loadDomains(fp string, cfg *entity.Config) error {
-	items, err := loadEntity[entity.Domain](fp, "domains")
-	if err != nil {
-		return fmt.Errorf("loading domains from %s: %w", fp, err)
+func loadZones(d *decoder, doc *yaml.Node, cfg *entity.Config) {
+	cfg.Zones = decodeEntity[entity.Zone](d, doc, "zones")
+}
+
+func loadInfraServices(d *decoder, doc *yaml.Node, cfg *entity.Config) {
+	cfg.InfraServices = decodeEntity[entity.InfraService](d, doc, "infra_services")
+}
+
+func loadServers(d *decoder, doc *yaml.Node, cfg *entity.Config) {
+	cfg.Servers = decodeEntity[entity.Server](d, doc, "servers")
+}
+
+func loadServices(d *decoder, doc *yaml.Node, cfg *entity.Config) {
+	cfg.Services = decodeEntity[entity.BizService](d, doc, "services")
+}
+
+func loadRegistries(d *decoder, doc *yaml.Node, cfg *entity.Config) {
+	cfg.Registries = decodeEntity[entity.Registry](d, doc, "registries")
+}
+
+func loadBackend(d *decoder, doc *yaml.Node, cfg *entity.Config) {
+	node := mappingValue(doc, "backend")
+	if node == nil || node.ShortTag() == "!!null" {
+		return
 	}
-	cfg.Domains = items
-	return nil
+	var backend entity.StateBackend
+	if d.decode(node, "backend", &backend) {
+		cfg.Backend = &backend
+	}
+}
+
+func loadPolicies(d *decoder, doc *yaml.Node, cfg *entity.Config) {
+	cfg.Policies = decodeEntity[entity.Policy](d, doc, "policies")
+}
+
+func loadDomains(d *decoder, doc *yaml.Node, cfg *entity.Config) {
+	cfg.Domains = decodeEntity[entity.Domain](d, doc, "domains")
 }
 
 var _ repository.ConfigLoader = (*ConfigLoader)(nil)
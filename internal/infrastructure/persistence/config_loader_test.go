@@ -2,6 +2,8 @@ package persistence
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -40,6 +42,235 @@ func TestConfigLoader_Load(t *testing.T) {
 	})
 }
 
+func TestConfigLoader_LoadOverlay(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(env, name, content string) {
+		dir := filepath.Join(tmpDir, "userdata", env)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(BaseEnv, "registries.yaml", "registries:\n  - name: hub\n    url: https://hub.example.com\n")
+	write(BaseEnv, "services_biz.yaml", `services:
+  - name: api
+    server: srv1
+    image: api:1.0
+    env:
+      LOG_LEVEL: info
+  - name: debug
+    server: srv1
+    image: debug:1.0
+`)
+	write("prod", "services_biz.yaml", `services:
+  - name: api
+    image: api:1.1
+  - name: debug
+    _delete: true
+`)
+
+	cfg, err := NewConfigLoader(tmpDir).Load(context.Background(), "prod")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Registries) != 1 || cfg.Registries[0].Name != "hub" {
+		t.Errorf("registries = %+v, want inherited hub", cfg.Registries)
+	}
+	if len(cfg.Services) != 1 {
+		t.Fatalf("services = %+v, want only api", cfg.Services)
+	}
+	api := cfg.Services[0]
+	logLevel := api.Env["LOG_LEVEL"]
+	if api.Image != "api:1.1" || api.Server != "srv1" || logLevel.Plain() != "info" {
+		t.Errorf("api = %+v, want prod image on base server and env", api)
+	}
+}
+
+func TestConfigLoader_LoadInterpolation(t *testing.T) {
+	tmpDir := t.TempDir()
+	envDir := filepath.Join(tmpDir, "userdata", "prod")
+	if err := os.MkdirAll(envDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"vars.yaml":    "vars:\n  api_tag: \"1.4\"\n  ttl: 300\n",
+		"servers.yaml": "servers:\n  - name: srv-east-01\n    zone: east\n    ip:\n      public: 203.0.113.10\n",
+		"services_biz.yaml": `services:
+  - name: api
+    server: srv-east-01
+    image: registry/api:${var.api_tag}
+    env:
+      APP_ENV: ${env}
+`,
+		"dns.yaml": `domains:
+  - name: example.com
+    dns_isp: cf
+    records:
+      - type: A
+        name: api
+        value: ${server.srv-east-01.ip.public}
+        ttl: ${var.ttl}
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(envDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loader := NewConfigLoader(tmpDir)
+	cfg, err := loader.Load(context.Background(), "prod")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	api := cfg.Services[0]
+	appEnv := api.Env["APP_ENV"]
+	if api.Image != "registry/api:1.4" || appEnv.Plain() != "prod" {
+		t.Errorf("api = %+v, want interpolated image and env", api)
+	}
+	record := cfg.Domains[0].Records[0]
+	if record.Value != "203.0.113.10" || record.TTL != 300 {
+		t.Errorf("record = %+v, want server IP and ttl 300", record)
+	}
+
+	if err := os.WriteFile(filepath.Join(envDir, "services_biz.yaml"), []byte("services:\n  - name: api\n    image: api:${var.nope}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = loader.Load(context.Background(), "prod")
+	if !errors.Is(err, domain.ErrUnresolvedReference) || !strings.Contains(err.Error(), "services_biz.yaml: services[0].image") {
+		t.Errorf("Load() error = %v, want unresolved reference in services_biz.yaml", err)
+	}
+}
+
+func TestConfigLoader_LoadFragments(t *testing.T) {
+	tmpDir := t.TempDir()
+	envDir := filepath.Join(tmpDir, "userdata", "prod")
+	if err := os.MkdirAll(filepath.Join(envDir, "services_biz.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(envDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("services_biz.yaml", "services:\n  - name: api\n    image: api:1.0\n")
+	write("services_biz.d/web.yaml", "services:\n  - name: web\n    image: web:1.0\n")
+	write("services_biz.d/workers.yaml", "services:\n  - name: worker-a\n  - name: worker-b\n")
+	write("services_biz.d/notes.txt", "services: [{name: api}]\n")
+
+	loader := NewConfigLoader(tmpDir)
+	cfg, err := loader.Load(context.Background(), "prod")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	var names []string
+	for _, s := range cfg.Services {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != "api,web,worker-a,worker-b" {
+		t.Errorf("services = %v, want api, web, worker-a, worker-b", names)
+	}
+
+	write("services_biz.d/workers.yaml", "services:\n  - name: worker-a\n  - name: api\n")
+	_, err = loader.Load(context.Background(), "prod")
+	if !errors.Is(err, domain.ErrDuplicateName) ||
+		!strings.Contains(err.Error(), "prod/services_biz.yaml and prod/services_biz.d/workers.yaml") {
+		t.Errorf("Load() error = %v, want duplicate api naming both files", err)
+	}
+}
+
+func TestConfigLoader_ValidationPositions(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, env := range []string{BaseEnv, "prod"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, "userdata", env), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(tmpDir, "userdata", name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(BaseEnv+"/zones.yaml", "zones:\n  - name: zone1\n    region: us-east-1\n    isp: base-isp\n")
+	write("prod/zones.yaml", "zones:\n  - name: zone1\n    isp: prod-isp\n")
+	write("prod/services_biz.yaml", "services:\n  - name: api\n    server: srv1\n    image: api:1.0\n")
+
+	loader := NewConfigLoader(tmpDir)
+	cfg, err := loader.Load(context.Background(), "prod")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	err = loader.Validate(cfg)
+	var verrs domain.ValidationErrors
+	if !errors.As(err, &verrs) || len(verrs) != 2 {
+		t.Fatalf("Validate() error = %v, want 2 validation errors", err)
+	}
+
+	prefix := filepath.ToSlash(filepath.Join(tmpDir, "userdata")) + "/"
+	want := []string{"prod/zones.yaml:3:5", "prod/services_biz.yaml:3:5"}
+	for i, verr := range verrs {
+		got := fmt.Sprintf("%s:%d:%d", strings.TrimPrefix(verr.File, prefix), verr.Line, verr.Column)
+		if got != want[i] {
+			t.Errorf("error %d at %s, want %s (%v)", i, got, want[i], verr)
+		}
+	}
+}
+
+func TestConfigLoader_DecodeErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	envDir := filepath.Join(tmpDir, "userdata", "prod")
+	if err := os.MkdirAll(envDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(envDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("servers.yaml", `servers:
+  - name: srv1
+    zone: zone1
+    ssh:
+      host: 10.0.0.1
+      port: twenty-two
+  - name: srv2
+    zone: zone1
+    ssh:
+      host: 10.0.0.2
+      port: [22]
+`)
+
+	loader := NewConfigLoader(tmpDir)
+	_, err := loader.Load(context.Background(), "prod")
+	var verrs domain.ValidationErrors
+	if !errors.As(err, &verrs) || len(verrs) != 2 {
+		t.Fatalf("Load() error = %v, want 2 validation errors", err)
+	}
+	file := filepath.ToSlash(filepath.Join(envDir, "servers.yaml"))
+	want := []string{file + ":6:13", file + ":11:13"}
+	for i, verr := range verrs {
+		if got := fmt.Sprintf("%s:%d:%d", verr.File, verr.Line, verr.Column); got != want[i] {
+			t.Errorf("error %d at %s, want %s (%v)", i, got, want[i], verr)
+		}
+	}
+
+	write("servers.yaml", "servers: []\n")
+	write("zones.yaml", "zones:\n  - name: zone1\n    region: r\n  - region: r\n")
+	cfg, err := loader.Load(context.Background(), "prod")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	verrs = nil
+	if err := loader.Validate(cfg); !errors.As(err, &verrs) || len(verrs) != 1 {
+		t.Fatalf("Validate() error = %v, want 1 validation error", err)
+	}
+	if got, want := fmt.Sprintf("%s:%d:%d", verrs[0].File, verrs[0].Line, verrs[0].Column), filepath.ToSlash(filepath.Join(envDir, "zones.yaml"))+":4:5"; got != want {
+		t.Errorf("unnamed zone error at %s, want %s (%v)", got, want, verrs[0])
+	}
+}
+
 func TestConfigLoader_Validate(t *testing.T) {
 	loader := NewConfigLoader(".")
 
@@ -0,0 +1,115 @@
+package persistence
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	domainerr "github.com/lite-lake/infra-yamlops/internal/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// fragmentDir is the directory whose *.yaml files extend filename, such as
+// services_biz.d for services_biz.yaml.
+func fragmentDir(dir, filename string) string {
+	return filepath.Join(dir, strings.TrimSuffix(filename, filepath.Ext(filename))+".d")
+}
+
+// readLayer reads filename and the fragments in its .d directory from one
+// layer of userdata and concatenates their lists. An entity defined in two
+// of these files is an error naming both. It returns nil when none exist.
+func readLayer(dir, filename string, files nodeFiles) (*yaml.Node, error) {
+	fragments, err := filepath.Glob(filepath.Join(fragmentDir(dir, filename), "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", domainerr.ErrConfigReadFailed, filename, err)
+	}
+	sort.Strings(fragments)
+
+	var doc *yaml.Node
+	origins := make(map[string]string)
+	for _, path := range append([]string{filepath.Join(dir, filename)}, fragments...) {
+		source := displayPath(dir, path)
+		part, err := readOptionalDocument(path, files)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", domainerr.ErrConfigReadFailed, source, err)
+		}
+		if part == nil {
+			continue
+		}
+		if doc == nil {
+			doc = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			files.inherit(doc, part)
+		}
+		if err := appendDocument(doc, part, source, origins); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// appendDocument adds the keys of part, read from source, to doc. Lists are
+// concatenated; origins maps every key and named item seen so far to the
+// file defining it.
+func appendDocument(doc, part *yaml.Node, source string, origins map[string]string) error {
+	keys := make([]int, 0, len(part.Content)/2)
+	for i := 0; i+1 < len(part.Content); i += 2 {
+		keys = append(keys, i)
+	}
+	sort.SliceStable(keys, func(a, b int) bool {
+		return part.Content[keys[a]].Value < part.Content[keys[b]].Value
+	})
+
+	for _, i := range keys {
+		key, value := part.Content[i].Value, part.Content[i+1]
+		if value.ShortTag() == "!!null" {
+			continue
+		}
+		isList := value.Kind == yaml.SequenceNode
+		j := mappingIndex(doc, key)
+		var existing *yaml.Node
+		if j >= 0 {
+			existing = doc.Content[j+1]
+		}
+		if existing != nil && existing.ShortTag() != "!!null" {
+			if !isList || existing.Kind != yaml.SequenceNode {
+				return fmt.Errorf("%w: %s is defined in %s and %s", domainerr.ErrDuplicateName, key, origins[key], source)
+			}
+		} else {
+			origins[key] = source
+		}
+
+		if isList {
+			for _, item := range value.Content {
+				name, ok := itemKey(key, item)
+				if !ok {
+					continue
+				}
+				id := key + "\x00" + name
+				if first, seen := origins[id]; seen && first != source {
+					return fmt.Errorf("%w: %s entry %s is defined in %s and %s", domainerr.ErrDuplicateName, key, name, first, source)
+				}
+				origins[id] = source
+			}
+		}
+		switch {
+		case j < 0:
+			doc.Content = append(doc.Content, part.Content[i], value)
+		case isList && existing.Kind == yaml.SequenceNode:
+			existing.Content = append(existing.Content, value.Content...)
+		default:
+			doc.Content[j+1] = value
+		}
+	}
+	return nil
+}
+
+// displayPath names path in errors relative to userdata, such as
+// prod/services_biz.d/api.yaml.
+func displayPath(dir, path string) string {
+	rel, err := filepath.Rel(filepath.Dir(dir), path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
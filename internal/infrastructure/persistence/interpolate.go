@@ -0,0 +1,189 @@
+package persistence
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	domainerr "github.com/lite-lake/infra-yamlops/internal/domain"
+	"gopkg.in/yaml.v3"
+)
+
+// referencePattern matches the references interpolated in config values:
+// ${env}, ${var.<path>} and ${server.<name>.<path>}. Other ${...} strings,
+// such as docker compose variables, are left alone, and $${ escapes a
+// literal ${.
+var referencePattern = regexp.MustCompile(`\$?\$\{(env|var\.[^}]+|server\.[^}]+)\}`)
+
+// interpolator resolves references against the environment name, the vars
+// of vars.yaml and the servers of servers.yaml.
+type interpolator struct {
+	env     string
+	vars    map[string]interface{}
+	servers map[string]interface{}
+}
+
+func newInterpolator(env string, vars map[string]interface{}) *interpolator {
+	return &interpolator{env: env, vars: vars}
+}
+
+// setServers makes the servers of an interpolated servers.yaml document
+// available to ${server.*} references.
+func (in *interpolator) setServers(doc *yaml.Node) error {
+	in.servers = make(map[string]interface{})
+	var raw map[string]interface{}
+	if doc != nil {
+		if err := doc.Decode(&raw); err != nil {
+			return err
+		}
+	}
+	items, _ := raw["servers"].([]interface{})
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			if name, ok := m["name"].(string); ok {
+				in.servers[name] = m
+			}
+		}
+	}
+	return nil
+}
+
+// interpolateDocument replaces, in place, the references in every string
+// of doc. A nil doc has none.
+func (in *interpolator) interpolateDocument(doc *yaml.Node) error {
+	if doc == nil {
+		return nil
+	}
+	return in.interpolate(doc, "")
+}
+
+func (in *interpolator) interpolate(node *yaml.Node, path string) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if err := in.interpolate(node.Content[i+1], joinPath(path, node.Content[i].Value)); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			if err := in.interpolate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if node.ShortTag() != "!!str" {
+			return nil
+		}
+		resolved, err := in.interpolateString(node.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return replaceScalar(node, resolved)
+	}
+	return nil
+}
+
+// replaceScalar sets the string node to value, resolved from its
+// references. A string stays a string; any other value is encoded in its
+// place, at the same position.
+func replaceScalar(node *yaml.Node, value interface{}) error {
+	if s, ok := value.(string); ok {
+		if s != node.Value {
+			node.Value = s
+			if node.Style == 0 {
+				node.Style = yaml.DoubleQuotedStyle
+			}
+		}
+		return nil
+	}
+	var replaced yaml.Node
+	if err := replaced.Encode(value); err != nil {
+		return err
+	}
+	replaced.Line, replaced.Column = node.Line, node.Column
+	*node = replaced
+	return nil
+}
+
+// interpolateString resolves the references in s. A value consisting of a
+// single reference takes the type of what it refers to, so that numbers
+// such as TTLs stay numbers.
+func (in *interpolator) interpolateString(s string) (interface{}, error) {
+	if m := referencePattern.FindStringSubmatch(s); m != nil && m[0] == s && !strings.HasPrefix(s, "$$") {
+		return in.resolve(m[1])
+	}
+
+	var firstErr error
+	out := referencePattern.ReplaceAllStringFunc(s, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+		ref := match[2 : len(match)-1]
+		value, err := in.resolve(ref)
+		if err == nil {
+			switch value.(type) {
+			case map[string]interface{}, []interface{}:
+				err = fmt.Errorf("%w: ${%s} is not a scalar and cannot be embedded in a string", domainerr.ErrUnresolvedReference, ref)
+			}
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return match
+		}
+		return fmt.Sprintf("%v", value)
+	})
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
+
+func (in *interpolator) resolve(ref string) (interface{}, error) {
+	switch {
+	case ref == "env":
+		return in.env, nil
+	case strings.HasPrefix(ref, "var."):
+		value, ok := lookupPath(in.vars, strings.Split(strings.TrimPrefix(ref, "var."), "."))
+		if !ok {
+			return nil, fmt.Errorf("%w: ${%s}: variable is not defined in vars.yaml", domainerr.ErrUnresolvedReference, ref)
+		}
+		return value, nil
+	default:
+		parts := strings.Split(strings.TrimPrefix(ref, "server."), ".")
+		if in.servers == nil {
+			return nil, fmt.Errorf("%w: ${%s}: servers cannot be referenced in servers.yaml or vars.yaml", domainerr.ErrUnresolvedReference, ref)
+		}
+		server, ok := in.servers[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w: ${%s}: server %s is not defined", domainerr.ErrUnresolvedReference, ref, parts[0])
+		}
+		value, ok := lookupPath(server, parts[1:])
+		if !ok {
+			return nil, fmt.Errorf("%w: ${%s}: server %s has no %s", domainerr.ErrUnresolvedReference, ref, parts[0], strings.Join(parts[1:], "."))
+		}
+		return value, nil
+	}
+}
+
+func lookupPath(v interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok || v == nil {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
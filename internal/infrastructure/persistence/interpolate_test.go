@@ -0,0 +1,63 @@
+package persistence
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+)
+
+func TestInterpolator(t *testing.T) {
+	in := newInterpolator("prod", docValue(t, parseDoc(t, "tag: v1.2\nttl: 600\nnested: {region: east}\nlist: [a]\n")))
+	if err := in.setServers(parseDoc(t, "servers: [{name: srv1, ip: {public: 1.2.3.4}}]\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    interface{}
+		wantErr string
+	}{
+		{name: "env", value: "api-${env}", want: "api-prod"},
+		{name: "embedded var", value: "api:${var.tag}", want: "api:v1.2"},
+		{name: "whole value keeps type", value: "${var.ttl}", want: 600},
+		{name: "nested var", value: "${var.nested.region}", want: "east"},
+		{name: "server", value: "${server.srv1.ip.public}", want: "1.2.3.4"},
+		{name: "several references", value: "${env}-${var.nested.region}", want: "prod-east"},
+		{name: "escaped", value: "$${var.tag}", want: "${var.tag}"},
+		{name: "other variables untouched", value: "${HOME}/data", want: "${HOME}/data"},
+		{name: "undefined var", value: "${var.missing}", wantErr: "variable is not defined"},
+		{name: "undefined server", value: "${server.srv9.ip.public}", wantErr: "server srv9 is not defined"},
+		{name: "missing server field", value: "${server.srv1.ip.private}", wantErr: "server srv1 has no ip.private"},
+		{name: "embedded list", value: "x-${var.list}", wantErr: "not a scalar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := in.interpolateString(tt.value)
+			if tt.wantErr != "" {
+				if !errors.Is(err, domain.ErrUnresolvedReference) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("interpolateString(%q) error = %v, want %q", tt.value, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("interpolateString(%q) error = %v", tt.value, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("interpolateString(%q) = %#v, want %#v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolator_ErrorPath(t *testing.T) {
+	in := newInterpolator("prod", nil)
+	err := in.interpolateDocument(parseDoc(t, "services: [{name: api, image: \"api:${var.tag}\"}]\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "services[0].image: ") {
+		t.Errorf("interpolateDocument() error = %v, want services[0].image prefix", err)
+	}
+}
@@ -0,0 +1,195 @@
+package persistence
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BaseEnv is the userdata directory holding the layer every environment
+// is merged onto.
+const BaseEnv = "_base"
+
+// deleteMarker set to true on a list item of an environment file removes
+// the item of the same name inherited from the base layer.
+const deleteMarker = "_delete"
+
+// mergeDocuments deep-merges the override document of an environment onto
+// the base document, both top-level mapping nodes. Maps are merged key by
+// key, lists of named items are merged item by item (DNS records by type
+// and name), and any other value in override replaces the base one. The
+// nodes built for merged maps are recorded in files under the file of the
+// override. Neither argument is modified.
+func mergeDocuments(base, override *yaml.Node, files nodeFiles) *yaml.Node {
+	if base == nil {
+		return stripDeleted(override, files)
+	}
+	if override == nil {
+		return base
+	}
+	return mergeMaps(base, override, files)
+}
+
+func mergeMaps(base, override *yaml.Node, files nodeFiles) *yaml.Node {
+	out := copyNode(override, files)
+	out.Content = make([]*yaml.Node, 0, len(base.Content)+len(override.Content))
+	index := make(map[string]int, len(base.Content)/2)
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		index[base.Content[i].Value] = len(out.Content)
+		out.Content = append(out.Content, base.Content[i], base.Content[i+1])
+	}
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+		if key.Value == deleteMarker {
+			continue
+		}
+		if j, ok := index[key.Value]; ok {
+			out.Content[j] = key
+			out.Content[j+1] = mergeValue(key.Value, out.Content[j+1], value, files)
+		} else {
+			out.Content = append(out.Content, key, stripDeleted(value, files))
+		}
+	}
+	return out
+}
+
+func mergeValue(field string, base, override *yaml.Node, files nodeFiles) *yaml.Node {
+	switch {
+	case override.Kind == yaml.MappingNode && base.Kind == yaml.MappingNode:
+		return mergeMaps(base, override, files)
+	case override.Kind == yaml.SequenceNode && base.Kind == yaml.SequenceNode:
+		if merged, ok := mergeLists(field, base, override, files); ok {
+			return merged
+		}
+	}
+	return stripDeleted(override, files)
+}
+
+// mergeLists merges two lists whose items all have a key. It reports false
+// when they do not, in which case override replaces base as a whole.
+func mergeLists(field string, base, override *yaml.Node, files nodeFiles) (*yaml.Node, bool) {
+	index := make(map[string]int, len(base.Content))
+	for i, item := range base.Content {
+		key, ok := itemKey(field, item)
+		if !ok {
+			return nil, false
+		}
+		index[key] = i
+	}
+	for _, item := range override.Content {
+		if _, ok := itemKey(field, item); !ok {
+			return nil, false
+		}
+	}
+
+	merged := make([]*yaml.Node, len(base.Content))
+	copy(merged, base.Content)
+	deleted := make(map[int]bool)
+	for _, item := range override.Content {
+		key, _ := itemKey(field, item)
+		i, exists := index[key]
+		switch {
+		case isDeleted(item):
+			if exists {
+				deleted[i] = true
+			}
+		case exists:
+			merged[i] = mergeMaps(merged[i], item, files)
+			delete(deleted, i)
+		default:
+			index[key] = len(merged)
+			merged = append(merged, stripDeleted(item, files))
+		}
+	}
+
+	out := copyNode(override, files)
+	out.Content = make([]*yaml.Node, 0, len(merged))
+	for i, item := range merged {
+		if !deleted[i] {
+			out.Content = append(out.Content, item)
+		}
+	}
+	return out, true
+}
+
+// itemKey identifies a list item across layers: by name, and for DNS
+// records by type and name since a name may carry several record types.
+func itemKey(field string, item *yaml.Node) (string, bool) {
+	name := mappingValue(item, "name")
+	if name == nil {
+		return "", false
+	}
+	if field == "records" {
+		recordType := "<nil>"
+		if t := mappingValue(item, "type"); t != nil {
+			recordType = t.Value
+		}
+		return fmt.Sprintf("%s %s", recordType, name.Value), true
+	}
+	return name.Value, true
+}
+
+func isDeleted(item *yaml.Node) bool {
+	marker := mappingValue(item, deleteMarker)
+	if marker == nil {
+		return false
+	}
+	var marked bool
+	return marker.Decode(&marked) == nil && marked
+}
+
+// stripDeleted drops delete markers, and the items they mark, from a value
+// that has nothing to be merged with.
+func stripDeleted(node *yaml.Node, files nodeFiles) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		out := copyNode(node, files)
+		out.Content = make([]*yaml.Node, 0, len(node.Content))
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value != deleteMarker {
+				out.Content = append(out.Content, node.Content[i], stripDeleted(node.Content[i+1], files))
+			}
+		}
+		return out
+	case yaml.SequenceNode:
+		out := copyNode(node, files)
+		out.Content = make([]*yaml.Node, 0, len(node.Content))
+		for _, child := range node.Content {
+			if !isDeleted(child) {
+				out.Content = append(out.Content, stripDeleted(child, files))
+			}
+		}
+		return out
+	default:
+		return node
+	}
+}
+
+// copyNode returns a shallow copy of node, defined in the same file.
+func copyNode(node *yaml.Node, files nodeFiles) *yaml.Node {
+	out := *node
+	files.inherit(&out, node)
+	return &out
+}
+
+// mappingValue returns the value of key in the mapping node m, or nil.
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if i := mappingIndex(m, key); i >= 0 {
+		return m.Content[i+1]
+	}
+	return nil
+}
+
+// mappingIndex returns the index of key in the content of the mapping node
+// m, or -1.
+func mappingIndex(m *yaml.Node, key string) int {
+	if m == nil || m.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
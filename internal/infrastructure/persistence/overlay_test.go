@@ -0,0 +1,140 @@
+package persistence
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func parseDoc(t *testing.T, s string) *yaml.Node {
+	t.Helper()
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(s), &node); err != nil {
+		t.Fatal(err)
+	}
+	if len(node.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	return node.Content[0]
+}
+
+// docValue decodes node for comparisons.
+func docValue(t *testing.T, node *yaml.Node) map[string]interface{} {
+	t.Helper()
+	value := map[string]interface{}{}
+	if err := node.Decode(&value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestMergeDocuments(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		override string
+		want     string
+	}{
+		{
+			name: "merge named items",
+			base: `services:
+  - name: api
+    image: api:1.0
+    env: {A: "1", B: "2"}
+    ports: ["80:80", "443:443"]
+  - name: web
+    image: web:1.0
+`,
+			override: `services:
+  - name: api
+    image: api:2.0
+    env: {B: "3"}
+    ports: ["8080:80"]
+  - name: worker
+    image: worker:1.0
+`,
+			want: `services:
+  - name: api
+    image: api:2.0
+    env: {A: "1", B: "3"}
+    ports: ["8080:80"]
+  - name: web
+    image: web:1.0
+  - name: worker
+    image: worker:1.0
+`,
+		},
+		{
+			name: "delete marker",
+			base: `services:
+  - name: api
+  - name: web
+`,
+			override: `services:
+  - name: web
+    _delete: true
+  - name: missing
+    _delete: true
+`,
+			want: `services:
+  - name: api
+`,
+		},
+		{
+			name: "records keyed by type and name",
+			base: `domains:
+  - name: example.com
+    dns_isp: cf
+    records:
+      - {type: A, name: www, value: 1.1.1.1}
+      - {type: AAAA, name: www, value: "::1"}
+`,
+			override: `domains:
+  - name: example.com
+    records:
+      - {type: A, name: www, value: 2.2.2.2}
+      - {type: AAAA, name: www, _delete: true}
+`,
+			want: `domains:
+  - name: example.com
+    dns_isp: cf
+    records:
+      - {type: A, name: www, value: 2.2.2.2}
+`,
+		},
+		{
+			name:     "null clears a field",
+			base:     "backend: {type: http, address: http://state}\n",
+			override: "backend: {address: null}\n",
+			want:     "backend: {type: http, address: null}\n",
+		},
+		{
+			name:     "base only",
+			base:     "isps: [{name: cf}]\n",
+			override: "",
+			want:     "isps: [{name: cf}]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var override *yaml.Node
+			if tt.override != "" {
+				override = parseDoc(t, tt.override)
+			}
+			got := docValue(t, mergeDocuments(parseDoc(t, tt.base), override, nil))
+			if want := docValue(t, parseDoc(t, tt.want)); !reflect.DeepEqual(got, want) {
+				t.Errorf("mergeDocuments() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMergeDocuments_EnvOnlyStripsMarkers(t *testing.T) {
+	got := docValue(t, mergeDocuments(nil, parseDoc(t, "services: [{name: api}, {name: web, _delete: true}]\n"), nil))
+	want := docValue(t, parseDoc(t, "services: [{name: api}]\n"))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeDocuments() = %v, want %v", got, want)
+	}
+}
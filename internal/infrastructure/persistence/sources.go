@@ -0,0 +1,84 @@
+package persistence
+
+import (
+	"path/filepath"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"gopkg.in/yaml.v3"
+)
+
+// nodeFiles maps the nodes of the parsed config files to the file defining
+// them, so that nodes moved around by merging can still be located.
+type nodeFiles map[*yaml.Node]string
+
+// add records node and everything below it as defined in file.
+func (f nodeFiles) add(node *yaml.Node, file string) {
+	if f == nil || node == nil {
+		return
+	}
+	f[node] = filepath.ToSlash(file)
+	for _, child := range node.Content {
+		f.add(child, file)
+	}
+}
+
+// inherit records node as defined where from is.
+func (f nodeFiles) inherit(node, from *yaml.Node) {
+	if f == nil {
+		return
+	}
+	if file, ok := f[from]; ok {
+		f[node] = file
+	}
+}
+
+// source returns the position of node, whose file is that of the closest
+// recorded node among node and fallback.
+func (f nodeFiles) source(node, fallback *yaml.Node) entity.Source {
+	file, ok := f[node]
+	if !ok {
+		file = f[fallback]
+	}
+	return entity.Source{File: file, Line: node.Line, Column: node.Column}
+}
+
+// recordSources records in sources where the entities of a merged config
+// document, and their fields, are defined. root is the document's
+// top-level mapping: a list under a key holds the entities of that section,
+// located by name and by index, and a mapping, such as backend, the
+// section's single value.
+func recordSources(root *yaml.Node, files nodeFiles, sources map[string]entity.Source) {
+	if sources == nil || root == nil || root.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		section, value := root.Content[i].Value, root.Content[i+1]
+		switch value.Kind {
+		case yaml.SequenceNode:
+			for j, item := range value.Content {
+				recordEntity(item, files, section, entity.ItemName(j), sources)
+				if name, ok := nodeName(item); ok {
+					recordEntity(item, files, section, name, sources)
+				}
+			}
+		case yaml.MappingNode:
+			recordEntity(value, files, section, "", sources)
+		}
+	}
+}
+
+func recordEntity(item *yaml.Node, files nodeFiles, section, name string, sources map[string]entity.Source) {
+	sources[entity.SourceKey(section, name)] = files.source(item, item)
+	for i := 0; i+1 < len(item.Content); i += 2 {
+		key := item.Content[i]
+		sources[entity.SourceKey(section, name, key.Value)] = files.source(key, item)
+	}
+}
+
+func nodeName(item *yaml.Node) (string, bool) {
+	name := mappingValue(item, "name")
+	if name == nil || name.Kind != yaml.ScalarNode {
+		return "", false
+	}
+	return name.Value, true
+}
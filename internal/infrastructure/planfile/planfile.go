@@ -0,0 +1,357 @@
+package planfile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lite-lake/infra-yamlops/internal/constants"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+	"gopkg.in/yaml.v3"
+)
+
+type File struct {
+	Version    int
+	Env        string
+	CreatedAt  time.Time
+	ConfigHash string
+	StateHash  string
+	Plan       *valueobject.Plan
+}
+
+func New(env string, cfg *entity.Config, state *repository.DeploymentState, plan *valueobject.Plan) (*File, error) {
+	configHash, err := HashConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	stateHash, err := HashState(state)
+	if err != nil {
+		return nil, err
+	}
+	return &File{
+		Version:    constants.PlanFileVersion,
+		Env:        env,
+		CreatedAt:  time.Now().UTC(),
+		ConfigHash: configHash,
+		StateHash:  stateHash,
+		Plan:       plan,
+	}, nil
+}
+
+// Verify reports ErrPlanStale when the config or the fetched remote state no
+// longer match what the plan was computed from.
+func (f *File) Verify(env string, cfg *entity.Config, state *repository.DeploymentState) error {
+	if f.Env != env {
+		return fmt.Errorf("%w: plan was created for env %s, not %s", domain.ErrPlanStale, f.Env, env)
+	}
+	configHash, err := HashConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if configHash != f.ConfigHash {
+		return fmt.Errorf("%w: configuration changed since the plan was created", domain.ErrPlanStale)
+	}
+	stateHash, err := HashState(state)
+	if err != nil {
+		return err
+	}
+	if stateHash != f.StateHash {
+		return fmt.Errorf("%w: remote state changed since the plan was created", domain.ErrPlanStale)
+	}
+	return nil
+}
+
+// VerifyConfig is Verify without the remote state check, for resuming a
+// plan whose changes have been partly applied already.
+func (f *File) VerifyConfig(env string, cfg *entity.Config) error {
+	if f.Env != env {
+		return fmt.Errorf("%w: plan was created for env %s, not %s", domain.ErrPlanStale, f.Env, env)
+	}
+	configHash, err := HashConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if configHash != f.ConfigHash {
+		return fmt.Errorf("%w: configuration changed since the plan was created", domain.ErrPlanStale)
+	}
+	return nil
+}
+
+func HashConfig(cfg *entity.Config) (string, error) {
+	return hashYAML(cfg)
+}
+
+func HashState(state *repository.DeploymentState) (string, error) {
+	return hashYAML(state)
+}
+
+func hashYAML(v interface{}) (string, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("hashing %T: %w", v, err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type fileDoc struct {
+	Version    int         `yaml:"version"`
+	Env        string      `yaml:"env"`
+	CreatedAt  time.Time   `yaml:"created_at"`
+	ConfigHash string      `yaml:"config_hash"`
+	StateHash  string      `yaml:"state_hash"`
+	Scope      scopeDoc    `yaml:"scope"`
+	Changes    []changeDoc `yaml:"changes"`
+}
+
+type scopeDoc struct {
+	Domain        string   `yaml:"domain,omitempty"`
+	Zone          string   `yaml:"zone,omitempty"`
+	Server        string   `yaml:"server,omitempty"`
+	Service       string   `yaml:"service,omitempty"`
+	Services      []string `yaml:"services,omitempty"`
+	InfraServices []string `yaml:"infra_services,omitempty"`
+	ForceDeploy   bool     `yaml:"force_deploy,omitempty"`
+	DNSOnly       bool     `yaml:"dns_only,omitempty"`
+
+	Targets            []string `yaml:"targets,omitempty"`
+	TargetDependencies bool     `yaml:"target_dependencies,omitempty"`
+	TargetDependents   bool     `yaml:"target_dependents,omitempty"`
+}
+
+type diffDoc struct {
+	Type  string `yaml:"type"`
+	Field string `yaml:"field"`
+	Old   string `yaml:"old,omitempty"`
+	New   string `yaml:"new,omitempty"`
+}
+
+type changeDoc struct {
+	Type         string    `yaml:"type"`
+	Entity       string    `yaml:"entity"`
+	Name         string    `yaml:"name"`
+	Actions      []string  `yaml:"actions,omitempty"`
+	RemoteExists bool      `yaml:"remote_exists,omitempty"`
+	Diffs        []diffDoc `yaml:"diffs,omitempty"`
+	OldState     yaml.Node `yaml:"old_state,omitempty"`
+	NewState     yaml.Node `yaml:"new_state,omitempty"`
+}
+
+func Save(path string, f *File) error {
+	doc, err := encodeFile(f)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("marshaling plan file %s: %w", path, err)
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, constants.DirPermissionOwner); err != nil {
+			return fmt.Errorf("%w: %s: %w", domain.ErrDirectoryCreateFailed, dir, err)
+		}
+	}
+	if err := os.WriteFile(path, data, constants.FilePermissionOwnerRW); err != nil {
+		return fmt.Errorf("%w: %s: %w", domain.ErrFileWriteFailed, path, err)
+	}
+	return nil
+}
+
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", domain.ErrFileReadFailed, path, err)
+	}
+	var doc fileDoc
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", domain.ErrPlanFileInvalid, path, err)
+	}
+	if doc.Version != constants.PlanFileVersion {
+		return nil, fmt.Errorf("%w: %s: unsupported version %d", domain.ErrPlanFileInvalid, path, doc.Version)
+	}
+	f, err := decodeFile(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", domain.ErrPlanFileInvalid, path, err)
+	}
+	return f, nil
+}
+
+func encodeFile(f *File) (*fileDoc, error) {
+	scope := f.Plan.Scope()
+	doc := &fileDoc{
+		Version:    f.Version,
+		Env:        f.Env,
+		CreatedAt:  f.CreatedAt,
+		ConfigHash: f.ConfigHash,
+		StateHash:  f.StateHash,
+		Scope: scopeDoc{
+			Domain:        scope.Domain(),
+			Zone:          scope.Zone(),
+			Server:        scope.Server(),
+			Service:       scope.Service(),
+			Services:      scope.Services(),
+			InfraServices: scope.InfraServices(),
+			ForceDeploy:   scope.ForceDeploy(),
+			DNSOnly:       scope.DNSOnly(),
+
+			Targets:            scope.Targets(),
+			TargetDependencies: scope.TargetDependencies(),
+			TargetDependents:   scope.TargetDependents(),
+		},
+		Changes: make([]changeDoc, 0, len(f.Plan.Changes())),
+	}
+	for _, ch := range f.Plan.Changes() {
+		cd := changeDoc{
+			Type:         ch.Type().String(),
+			Entity:       ch.Entity(),
+			Name:         ch.Name(),
+			Actions:      ch.Actions(),
+			RemoteExists: ch.RemoteExists(),
+		}
+		for _, d := range ch.Diffs() {
+			cd.Diffs = append(cd.Diffs, diffDoc{Type: d.Type().String(), Field: d.Field(), Old: d.OldValue(), New: d.NewValue()})
+		}
+		var err error
+		if cd.OldState, err = encodeState(ch.OldState()); err != nil {
+			return nil, fmt.Errorf("encoding old state of %s %s: %w", ch.Entity(), ch.Name(), err)
+		}
+		if cd.NewState, err = encodeState(ch.NewState()); err != nil {
+			return nil, fmt.Errorf("encoding new state of %s %s: %w", ch.Entity(), ch.Name(), err)
+		}
+		doc.Changes = append(doc.Changes, cd)
+	}
+	return doc, nil
+}
+
+func encodeState(state interface{}) (yaml.Node, error) {
+	var node yaml.Node
+	if state == nil {
+		return node, nil
+	}
+	err := node.Encode(state)
+	return node, err
+}
+
+func decodeFile(doc *fileDoc) (*File, error) {
+	scope := valueobject.NewScopeFull(
+		doc.Scope.Domain,
+		doc.Scope.Zone,
+		doc.Scope.Server,
+		doc.Scope.Service,
+		doc.Scope.Services,
+		doc.Scope.InfraServices,
+		doc.Scope.ForceDeploy,
+		doc.Scope.DNSOnly,
+	).WithTargets(doc.Scope.Targets, doc.Scope.TargetDependencies, doc.Scope.TargetDependents)
+	plan := valueobject.NewPlanWithScope(scope)
+	for _, cd := range doc.Changes {
+		changeType, err := parseChangeType(cd.Type)
+		if err != nil {
+			return nil, err
+		}
+		oldState, err := decodeState(cd.Entity, cd.Name, &cd.OldState)
+		if err != nil {
+			return nil, fmt.Errorf("decoding old state of %s %s: %w", cd.Entity, cd.Name, err)
+		}
+		newState, err := decodeState(cd.Entity, cd.Name, &cd.NewState)
+		if err != nil {
+			return nil, fmt.Errorf("decoding new state of %s %s: %w", cd.Entity, cd.Name, err)
+		}
+		diffs, err := decodeDiffs(cd.Diffs)
+		if err != nil {
+			return nil, err
+		}
+		plan.AddChange(valueobject.NewChangeFull(changeType, cd.Entity, cd.Name, oldState, newState, cd.Actions, cd.RemoteExists).WithDiffs(diffs...))
+	}
+	return &File{
+		Version:    doc.Version,
+		Env:        doc.Env,
+		CreatedAt:  doc.CreatedAt,
+		ConfigHash: doc.ConfigHash,
+		StateHash:  doc.StateHash,
+		Plan:       plan,
+	}, nil
+}
+
+func parseChangeType(s string) (valueobject.ChangeType, error) {
+	for _, ct := range []valueobject.ChangeType{
+		valueobject.ChangeTypeNoop,
+		valueobject.ChangeTypeCreate,
+		valueobject.ChangeTypeUpdate,
+		valueobject.ChangeTypeDelete,
+	} {
+		if ct.String() == s {
+			return ct, nil
+		}
+	}
+	return valueobject.ChangeTypeNoop, fmt.Errorf("%w: change type %s", domain.ErrInvalidType, s)
+}
+
+func decodeDiffs(docs []diffDoc) ([]valueobject.FieldDiff, error) {
+	diffs := make([]valueobject.FieldDiff, 0, len(docs))
+	for _, d := range docs {
+		changeType, err := parseChangeType(d.Type)
+		if err != nil {
+			return nil, err
+		}
+		switch changeType {
+		case valueobject.ChangeTypeCreate:
+			diffs = append(diffs, valueobject.NewFieldAdded(d.Field, d.New))
+		case valueobject.ChangeTypeDelete:
+			diffs = append(diffs, valueobject.NewFieldRemoved(d.Field, d.Old))
+		default:
+			diffs = append(diffs, valueobject.NewFieldDiff(d.Field, d.Old, d.New))
+		}
+	}
+	return diffs, nil
+}
+
+func decodeState(entityType, name string, node *yaml.Node) (interface{}, error) {
+	if node.Kind == 0 {
+		return nil, nil
+	}
+	switch entityType {
+	case "service":
+		var v entity.BizService
+		return decodeInto(node, &v)
+	case "infra_service":
+		var v entity.InfraService
+		return decodeInto(node, &v)
+	case "server":
+		var v entity.Server
+		return decodeInto(node, &v)
+	case "zone":
+		var v entity.Zone
+		return decodeInto(node, &v)
+	case "domain":
+		var v entity.Domain
+		return decodeInto(node, &v)
+	case "isp":
+		var v entity.ISP
+		return decodeInto(node, &v)
+	case "dns_record":
+		var v entity.DNSRecord
+		if _, err := decodeInto(node, &v); err != nil {
+			return nil, err
+		}
+		// The record's domain is not serialized; it leads the change name (domain:type:name).
+		v.Domain = strings.SplitN(name, ":", 2)[0]
+		return &v, nil
+	default:
+		return nil, fmt.Errorf("%w: entity %s", domain.ErrInvalidType, entityType)
+	}
+}
+
+func decodeInto[T any](node *yaml.Node, v *T) (interface{}, error) {
+	if err := node.Decode(v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
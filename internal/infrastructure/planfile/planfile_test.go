@@ -0,0 +1,164 @@
+package planfile
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+func testConfig() *entity.Config {
+	return &entity.Config{
+		Services: []entity.BizService{
+			{
+				ServiceBase: entity.ServiceBase{Server: "srv1"},
+				Name:        "api",
+				Image:       "api:1.0",
+				Env: map[string]valueobject.SecretRef{
+					"DB_PASS": *valueobject.NewSecretRefSecret("db_pass"),
+				},
+			},
+		},
+		InfraServices: []entity.InfraService{
+			{
+				ServiceBase: entity.ServiceBase{Server: "srv1"},
+				Name:        "ssl",
+				Type:        entity.InfraServiceTypeSSL,
+				Image:       "ssl:1.0",
+				SSLConfig: &entity.SSLConfig{
+					Ports:  entity.SSLPorts{API: 38567},
+					Config: &entity.SSLVolumeConfig{Source: "volumes://ssl"},
+				},
+			},
+		},
+	}
+}
+
+func testPlan(cfg *entity.Config) *valueobject.Plan {
+	scope := valueobject.NewScope().WithServer("srv1").WithServices([]string{"api"}).WithTargets([]string{"service:api"}, true, false)
+	p := valueobject.NewPlanWithScope(scope)
+	p.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "service", "api",
+		nil, &cfg.Services[0], []string{"deploy service api"}, false))
+	p.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeUpdate, "infra_service", "ssl",
+		&entity.InfraService{Name: "ssl"}, &cfg.InfraServices[0], []string{"update ssl"}, true).
+		WithDiffs(valueobject.NewFieldDiff("image", "", "ssl:1.0"), valueobject.NewFieldAdded("ssl_config", "api=38567")))
+	p.AddChange(valueobject.NewChangeFull(valueobject.ChangeTypeDelete, "dns_record", "example.com:A:www",
+		&entity.DNSRecord{Domain: "example.com", Type: entity.DNSRecordTypeA, Name: "www", Value: "1.2.3.4", TTL: 600},
+		nil, nil, true))
+	return p
+}
+
+func TestSaveLoad_RoundTrip(t *testing.T) {
+	cfg := testConfig()
+	st := repository.NewDeploymentState()
+	original := testPlan(cfg)
+
+	pf, err := New("prod", cfg, st, original)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "plan.yaml")
+	if err := Save(path, pf); err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if loaded.Env != "prod" || loaded.ConfigHash != pf.ConfigHash || loaded.StateHash != pf.StateHash {
+		t.Errorf("metadata mismatch: got %+v", loaded)
+	}
+	if !loaded.Plan.Scope().Equals(original.Scope()) {
+		t.Error("scope not preserved")
+	}
+	if len(loaded.Plan.Changes()) != len(original.Changes()) {
+		t.Fatalf("expected %d changes, got %d", len(original.Changes()), len(loaded.Plan.Changes()))
+	}
+
+	for i, ch := range loaded.Plan.Changes() {
+		want := original.Changes()[i]
+		if ch.Type() != want.Type() || ch.Entity() != want.Entity() || ch.Name() != want.Name() || ch.RemoteExists() != want.RemoteExists() {
+			t.Errorf("change %d: got %s %s %s, want %s %s %s", i, ch.Type(), ch.Entity(), ch.Name(), want.Type(), want.Entity(), want.Name())
+		}
+	}
+
+	svc, ok := loaded.Plan.Changes()[0].NewState().(*entity.BizService)
+	if !ok {
+		t.Fatalf("expected *entity.BizService, got %T", loaded.Plan.Changes()[0].NewState())
+	}
+	dbPass := svc.Env["DB_PASS"]
+	if svc.Server != "srv1" || dbPass.Secret() != "db_pass" {
+		t.Errorf("service state not preserved: %+v", svc)
+	}
+
+	infra, ok := loaded.Plan.Changes()[1].NewState().(*entity.InfraService)
+	if !ok {
+		t.Fatalf("expected *entity.InfraService, got %T", loaded.Plan.Changes()[1].NewState())
+	}
+	if infra.SSLConfig == nil || infra.SSLConfig.Ports.API != 38567 {
+		t.Errorf("ssl config not preserved: %+v", infra.SSLConfig)
+	}
+	diffs := loaded.Plan.Changes()[1].Diffs()
+	if len(diffs) != 2 || diffs[0] != original.Changes()[1].Diffs()[0] || diffs[1] != original.Changes()[1].Diffs()[1] {
+		t.Errorf("diffs not preserved: %v", diffs)
+	}
+
+	record, ok := loaded.Plan.Changes()[2].OldState().(*entity.DNSRecord)
+	if !ok {
+		t.Fatalf("expected *entity.DNSRecord, got %T", loaded.Plan.Changes()[2].OldState())
+	}
+	if record.Domain != "example.com" || record.Value != "1.2.3.4" {
+		t.Errorf("record state not preserved: %+v", record)
+	}
+	if loaded.Plan.Changes()[2].NewState() != nil {
+		t.Error("expected nil new state for delete")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	cfg := testConfig()
+	st := repository.NewDeploymentState()
+	pf, err := New("prod", cfg, st, testPlan(cfg))
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		if err := pf.Verify("prod", testConfig(), repository.NewDeploymentState()); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("config changed", func(t *testing.T) {
+		changed := testConfig()
+		changed.InfraServices[0].SSLConfig.Ports.API = 1
+		if err := pf.Verify("prod", changed, st); !errors.Is(err, domain.ErrPlanStale) {
+			t.Errorf("expected ErrPlanStale, got %v", err)
+		}
+	})
+
+	t.Run("state changed", func(t *testing.T) {
+		changed := repository.NewDeploymentState()
+		changed.Services["api"] = &entity.BizService{Name: "api"}
+		if err := pf.Verify("prod", cfg, changed); !errors.Is(err, domain.ErrPlanStale) {
+			t.Errorf("expected ErrPlanStale, got %v", err)
+		}
+	})
+
+	t.Run("env changed", func(t *testing.T) {
+		if err := pf.Verify("dev", cfg, st); !errors.Is(err, domain.ErrPlanStale) {
+			t.Errorf("expected ErrPlanStale, got %v", err)
+		}
+	})
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
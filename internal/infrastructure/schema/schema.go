@@ -0,0 +1,279 @@
+// Package schema derives JSON Schemas for the userdata config files from
+// the entity structs and their yaml tags, so that editors can complete and
+// check the files before yamlops loads them.
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+// Schema is a JSON Schema document or subschema.
+type Schema map[string]interface{}
+
+const draft = "http://json-schema.org/draft-07/schema#"
+
+// referencePattern matches a value that is a single ${...} reference, which
+// the loader resolves before decoding and which may therefore stand in for
+// numbers and booleans.
+const referencePattern = `^\$\{(env|var\..+|server\..+)\}$`
+
+// File is a userdata config file and the top-level key holding its
+// entities.
+type File struct {
+	Name string
+	Key  string
+}
+
+// Files lists the config files a schema can be generated for.
+var Files = []File{
+	{"secrets.yaml", "secrets"},
+	{"isps.yaml", "isps"},
+	{"zones.yaml", "zones"},
+	{"servers.yaml", "servers"},
+	{"services_infra.yaml", "infra_services"},
+	{"services_biz.yaml", "services"},
+	{"registries.yaml", "registries"},
+	{"dns.yaml", "domains"},
+	{"backend.yaml", "backend"},
+	{"policies.yaml", "policies"},
+}
+
+// enums lists the values of the string types with a fixed set of values.
+var enums = map[reflect.Type][]interface{}{
+	reflect.TypeOf(entity.InfraServiceType("")): {entity.InfraServiceTypeGateway, entity.InfraServiceTypeSSL},
+	reflect.TypeOf(entity.ISPType("")):          {entity.ISPTypeAliyun, entity.ISPTypeCloudflare, entity.ISPTypeTencent},
+	reflect.TypeOf(entity.ISPService("")):       {entity.ISPServiceServer, entity.ISPServiceDomain, entity.ISPServiceDNS},
+	reflect.TypeOf(entity.NetworkType("")):      {entity.NetworkTypeBridge, entity.NetworkTypeOverlay},
+	reflect.TypeOf(entity.DNSRecordType("")): {
+		entity.DNSRecordTypeA, entity.DNSRecordTypeAAAA, entity.DNSRecordTypeCNAME, entity.DNSRecordTypeMX,
+		entity.DNSRecordTypeTXT, entity.DNSRecordTypeNS, entity.DNSRecordTypeSRV,
+	},
+}
+
+// fieldEnums lists the values of plain string fields, by type and yaml key.
+var fieldEnums = map[string][]interface{}{
+	"Policy.rule":              {entity.PolicyRuleNoDelete, entity.PolicyRuleNoLatestTag, entity.PolicyRuleHTTPSRoutes},
+	"Policy.severity":          {entity.PolicySeverityDeny, entity.PolicySeverityWarn},
+	"StateBackend.type":        {entity.StateBackendFile, entity.StateBackendHTTP},
+	"ServicePort.protocol":     {"tcp", "udp"},
+	"GatewaySSLConfig.mode":    {"local", "remote"},
+	"gatewayInfraService.type": {entity.InfraServiceTypeGateway},
+	"sslInfraService.type":     {entity.InfraServiceTypeSSL},
+}
+
+// infraServiceBase, gatewayInfraService and sslInfraService mirror the two
+// shapes InfraService.UnmarshalYAML accepts, told apart by type.
+type infraServiceBase struct {
+	Name string `yaml:"name"`
+	entity.ServiceBase
+	Image string `yaml:"image"`
+}
+
+type gatewayInfraService struct {
+	infraServiceBase
+	Type     entity.InfraServiceType  `yaml:"type"`
+	Ports    *entity.GatewayPorts     `yaml:"ports,omitempty"`
+	Config   *entity.GatewayConfig    `yaml:"config,omitempty"`
+	SSL      *entity.GatewaySSLConfig `yaml:"ssl,omitempty"`
+	WAF      *entity.GatewayWAFConfig `yaml:"waf,omitempty"`
+	LogLevel int                      `yaml:"log_level,omitempty"`
+}
+
+type sslInfraService struct {
+	infraServiceBase
+	Type   entity.InfraServiceType `yaml:"type"`
+	Ports  *entity.SSLPorts        `yaml:"ports,omitempty"`
+	Config *entity.SSLVolumeConfig `yaml:"config,omitempty"`
+}
+
+// Generate returns the schema of the config file named name.
+func Generate(name string) (Schema, error) {
+	for _, f := range Files {
+		if f.Name == name {
+			return generate(f)
+		}
+	}
+	return nil, fmt.Errorf("unknown config file %s, expected one of %s", name, strings.Join(Names(), ", "))
+}
+
+func generate(f File) (Schema, error) {
+	field, ok := entity.ConfigSection(f.Key)
+	if !ok {
+		return nil, fmt.Errorf("entity.Config has no %s field", f.Key)
+	}
+	g := &generator{defs: make(map[string]Schema)}
+	root := Schema{
+		"$schema":              draft,
+		"title":                "yamlops " + f.Name,
+		"type":                 "object",
+		"properties":           Schema{f.Key: g.schemaFor(field.Type)},
+		"additionalProperties": false,
+	}
+	if len(g.defs) > 0 {
+		root["definitions"] = g.defs
+	}
+	return root, nil
+}
+
+type generator struct {
+	defs map[string]Schema
+}
+
+func (g *generator) schemaFor(t reflect.Type) Schema {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case reflect.TypeOf(valueobject.SecretRef{}):
+		return g.define("SecretRef", func() Schema {
+			return Schema{"anyOf": []interface{}{
+				Schema{"type": "string"},
+				Schema{
+					"type":                 "object",
+					"properties":           Schema{"secret": Schema{"type": "string"}, "plain": Schema{"type": "string"}},
+					"additionalProperties": false,
+				},
+			}}
+		})
+	case reflect.TypeOf(entity.ServiceVolume{}):
+		return g.define("ServiceVolume", func() Schema {
+			return Schema{"anyOf": []interface{}{
+				Schema{"type": "string", "pattern": "^[^:]+:.+$"},
+				g.structSchema(t),
+			}}
+		})
+	case reflect.TypeOf(entity.InfraService{}):
+		return g.define("InfraService", func() Schema {
+			return Schema{"oneOf": []interface{}{
+				g.schemaFor(reflect.TypeOf(gatewayInfraService{})),
+				g.schemaFor(reflect.TypeOf(sslInfraService{})),
+			}}
+		})
+	}
+	if values, ok := enums[t]; ok {
+		return Schema{"type": "string", "enum": values}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return orReference("boolean")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return orReference("integer")
+	case reflect.Float32, reflect.Float64:
+		return orReference("number")
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		return g.define(defName(t), func() Schema { return g.structSchema(t) })
+	default:
+		return Schema{}
+	}
+}
+
+// define adds the schema built by build to the definitions under name,
+// once, and returns a reference to it.
+func (g *generator) define(name string, build func() Schema) Schema {
+	ref := Schema{"$ref": "#/definitions/" + name}
+	if _, ok := g.defs[name]; ok {
+		return ref
+	}
+	g.defs[name] = nil
+	g.defs[name] = build()
+	return ref
+}
+
+// structSchema describes t as an object with one property per yaml key.
+// Embedded structs are inlined as the entity codecs do. Only name is
+// required, with type where it selects the shape or identifies a record,
+// since an environment may override a base entity with just the fields it
+// changes; named entities also accept the _delete marker.
+func (g *generator) structSchema(t reflect.Type) Schema {
+	properties := Schema{}
+	g.addFields(t, t.Name(), properties)
+	s := Schema{
+		"title":                defName(t),
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if _, ok := properties["name"]; ok {
+		properties["_delete"] = Schema{"type": "boolean", "description": "Remove the entity of this name inherited from userdata/_base"}
+		required := []string{"name"}
+		if t.Name() == "DNSRecord" || strings.HasSuffix(t.Name(), "InfraService") {
+			required = append(required, "type")
+		}
+		s["required"] = required
+	}
+	return s
+}
+
+func (g *generator) addFields(t reflect.Type, owner string, properties Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, skip := entity.YAMLName(field)
+		if skip {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			g.addFields(embedded, owner, properties)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if values, ok := fieldEnums[owner+"."+name]; ok {
+			properties[name] = Schema{"type": "string", "enum": values}
+			continue
+		}
+		properties[name] = g.schemaFor(field.Type)
+	}
+}
+
+// defNames names the definitions of the unexported mirrors of
+// InfraService; other structs are named after their type.
+var defNames = map[reflect.Type]string{
+	reflect.TypeOf(gatewayInfraService{}): "GatewayInfraService",
+	reflect.TypeOf(sslInfraService{}):     "SSLInfraService",
+}
+
+func defName(t reflect.Type) string {
+	if name, ok := defNames[t]; ok {
+		return name
+	}
+	return t.Name()
+}
+
+func orReference(typ string) Schema {
+	return Schema{"anyOf": []interface{}{
+		Schema{"type": typ},
+		Schema{"type": "string", "pattern": referencePattern},
+	}}
+}
+
+// Names returns the names of the config files in Files, sorted.
+func Names() []string {
+	names := make([]string, len(Files))
+	for i, f := range Files {
+		names[i] = f.Name
+	}
+	sort.Strings(names)
+	return names
+}
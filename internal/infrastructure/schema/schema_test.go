@@ -0,0 +1,173 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// unknownKeys walks value along s and returns the keys no schema of an
+// object declares, resolving references and taking the union of the
+// variants of anyOf and oneOf.
+func unknownKeys(t *testing.T, root, s map[string]interface{}, value interface{}, path string) []string {
+	t.Helper()
+	if ref, ok := s["$ref"].(string); ok {
+		defs := root["definitions"].(map[string]interface{})
+		return unknownKeys(t, root, defs[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{}), value, path)
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		if variants, ok := s[key].([]interface{}); ok {
+			var best []string
+			for i, v := range variants {
+				unknown := unknownKeys(t, root, v.(map[string]interface{}), value, path)
+				if i == 0 || len(unknown) < len(best) {
+					best = unknown
+				}
+			}
+			return best
+		}
+	}
+
+	var unknown []string
+	switch val := value.(type) {
+	case map[string]interface{}:
+		if s["type"] != "object" {
+			return []string{path}
+		}
+		props, _ := s["properties"].(map[string]interface{})
+		for k, child := range val {
+			if ps, ok := props[k].(map[string]interface{}); ok {
+				unknown = append(unknown, unknownKeys(t, root, ps, child, path+"."+k)...)
+			} else if extra, ok := s["additionalProperties"].(map[string]interface{}); ok {
+				unknown = append(unknown, unknownKeys(t, root, extra, child, path+"."+k)...)
+			} else {
+				unknown = append(unknown, path+"."+k)
+			}
+		}
+	case []interface{}:
+		items, _ := s["items"].(map[string]interface{})
+		for _, item := range val {
+			unknown = append(unknown, unknownKeys(t, root, items, item, path+"[]")...)
+		}
+	}
+	return unknown
+}
+
+func generic(t *testing.T, s Schema) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestGenerate(t *testing.T) {
+	samples := map[string]string{
+		"services_biz.yaml": `services:
+  - name: api
+    server: srv1
+    image: api:${var.tag}
+    ports: [{container: 80, host: 8080, protocol: tcp}]
+    env: {A: plain, B: {secret: b}}
+    volumes: ["./data:/data", {source: ./conf, target: /conf, sync: true}]
+    gateways: [{hostname: api.example.com, container_port: 80, https: true}]
+    lifecycle: {prevent_destroy: true}
+  - name: old
+    _delete: true
+`,
+		"services_infra.yaml": `infra_services:
+  - name: gw
+    type: gateway
+    server: srv1
+    image: gw:1
+    ports: {http: 80, https: 443}
+    ssl: {mode: remote, endpoint: http://ssl}
+    waf: {enabled: true}
+  - name: ssl
+    type: ssl
+    server: srv1
+    image: ssl:1
+    ports: {api: 38567}
+    config: {source: volumes://ssl, sync: true}
+`,
+		"dns.yaml": `domains:
+  - name: example.com
+    dns_isp: cf
+    records:
+      - {type: A, name: www, value: "${server.srv1.ip.public}", ttl: "${var.ttl}"}
+`,
+		"servers.yaml": `servers:
+  - name: srv1
+    zone: z
+    ip: {public: 1.2.3.4}
+    ssh: {host: 1.2.3.4, port: 22, user: root, password: {secret: pw}}
+    networks: [{name: n, type: bridge}]
+`,
+	}
+	for _, name := range Names() {
+		s, err := Generate(name)
+		if err != nil {
+			t.Fatalf("Generate(%s) error = %v", name, err)
+		}
+		root := generic(t, s)
+		sample, ok := samples[name]
+		if !ok {
+			continue
+		}
+		var value map[string]interface{}
+		if err := yaml.Unmarshal([]byte(sample), &value); err != nil {
+			t.Fatal(err)
+		}
+		if unknown := unknownKeys(t, root, root, value, ""); len(unknown) != 0 {
+			t.Errorf("%s: keys rejected by the schema: %v", name, unknown)
+		}
+	}
+
+	root := generic(t, mustGenerate(t, "services_biz.yaml"))
+	typo := map[string]interface{}{"services": []interface{}{map[string]interface{}{"name": "api", "imag": "api:1"}}}
+	if unknown := unknownKeys(t, root, root, typo, ""); len(unknown) != 1 || unknown[0] != ".services[].imag" {
+		t.Errorf("misspelled key: unknown = %v, want .services[].imag", unknown)
+	}
+}
+
+func TestGenerate_InfraServiceShapes(t *testing.T) {
+	root := generic(t, mustGenerate(t, "services_infra.yaml"))
+	defs := root["definitions"].(map[string]interface{})
+	variants := defs["InfraService"].(map[string]interface{})["oneOf"].([]interface{})
+	if len(variants) != 2 {
+		t.Fatalf("InfraService variants = %v", variants)
+	}
+	for def, want := range map[string]string{"GatewayInfraService": "gateway", "SSLInfraService": "ssl"} {
+		props := defs[def].(map[string]interface{})["properties"].(map[string]interface{})
+		enum := props["type"].(map[string]interface{})["enum"].([]interface{})
+		if len(enum) != 1 || enum[0] != want {
+			t.Errorf("%s type enum = %v, want [%s]", def, enum, want)
+		}
+	}
+	gwPorts := defs["GatewayPorts"].(map[string]interface{})["properties"].(map[string]interface{})
+	if _, ok := gwPorts["api"]; ok {
+		t.Error("gateway ports accept the ssl api port")
+	}
+}
+
+func TestGenerate_UnknownFile(t *testing.T) {
+	if _, err := Generate("vars.yaml"); err == nil {
+		t.Error("Generate(vars.yaml) error = nil")
+	}
+}
+
+func mustGenerate(t *testing.T, name string) Schema {
+	t.Helper()
+	s, err := Generate(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
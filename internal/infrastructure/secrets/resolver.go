@@ -63,6 +63,15 @@ func (r *SecretResolver) ResolveAll(cfg *entity.Config) error {
 		r.cacheResolved(passwordRef, password)
 	}
 
+	if cfg.Backend != nil {
+		ref := cfg.Backend.Password
+		val, err := r.Resolve(ref)
+		if err != nil {
+			return fmt.Errorf("backend.password: %w", err)
+		}
+		r.cacheResolved(ref, val)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,89 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lite-lake/infra-yamlops/internal/constants"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+)
+
+// Cached is the state observed by the last remote fetch of an environment,
+// kept so that plans can be made without access to its servers.
+type Cached struct {
+	FetchedAt time.Time
+	State     *repository.DeploymentState
+}
+
+type cacheMeta struct {
+	FetchedAt   time.Time         `json:"fetched_at"`
+	Unreachable map[string]string `json:"unreachable,omitempty"`
+}
+
+// CacheDir is the directory holding the cached remote state of configDir.
+// The cache stays on this machine whatever the state backend.
+func CacheDir(configDir string) string {
+	return filepath.Join(configDir, constants.StateDir, "cache")
+}
+
+func cachePaths(dir, env string) (string, string) {
+	return filepath.Join(dir, env+".yaml"), filepath.Join(dir, env+".json")
+}
+
+// SaveCache replaces the cached remote state of env with st.
+func SaveCache(dir, env string, st *repository.DeploymentState, fetchedAt time.Time) error {
+	statePath, metaPath := cachePaths(dir, env)
+	data, err := Marshal(st)
+	if err != nil {
+		return fmt.Errorf("marshaling cached state: %w", domain.WrapOp("marshal state", domain.ErrStateSerializeFail))
+	}
+	meta, err := json.MarshalIndent(cacheMeta{FetchedAt: fetchedAt.UTC(), Unreachable: st.Unreachable}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling cached state metadata: %w", domain.WrapOp("marshal state", domain.ErrStateSerializeFail))
+	}
+
+	if err := os.MkdirAll(dir, constants.DirPermissionOwner); err != nil {
+		return fmt.Errorf("creating state cache %s: %w", dir, domain.WrapOp("create state cache", domain.ErrStateWriteFailed))
+	}
+	if err := os.WriteFile(statePath, data, constants.FilePermissionOwnerRW); err != nil {
+		return fmt.Errorf("writing cached state %s: %w", statePath, domain.WrapOp("write cached state", domain.ErrStateWriteFailed))
+	}
+	if err := os.WriteFile(metaPath, meta, constants.FilePermissionOwnerRW); err != nil {
+		return fmt.Errorf("writing cached state metadata %s: %w", metaPath, domain.WrapOp("write cached state", domain.ErrStateWriteFailed))
+	}
+	return nil
+}
+
+// LoadCache reads the cached remote state of env. It returns nil without an
+// error when nothing was cached yet.
+func LoadCache(dir, env string) (*Cached, error) {
+	statePath, metaPath := cachePaths(dir, env)
+	metaData, err := os.ReadFile(metaPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading cached state metadata %s: %w", metaPath, domain.WrapOp("read cached state", domain.ErrStateReadFailed))
+	}
+	var meta cacheMeta
+	if err := json.Unmarshal(metaData, &meta); err != nil {
+		return nil, fmt.Errorf("parsing cached state metadata %s: %w", metaPath, domain.WrapOp("parse cached state", domain.ErrStateSerializeFail))
+	}
+
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading cached state %s: %w", statePath, domain.WrapOp("read cached state", domain.ErrStateReadFailed))
+	}
+	st, err := Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing cached state %s: %w", statePath, domain.WrapOp("parse cached state", domain.ErrStateSerializeFail))
+	}
+	for name, reason := range meta.Unreachable {
+		st.Unreachable[name] = reason
+	}
+	return &Cached{FetchedAt: meta.FetchedAt, State: st}, nil
+}
@@ -0,0 +1,40 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+
+	cached, err := LoadCache(dir, "prod")
+	if err != nil || cached != nil {
+		t.Fatalf("LoadCache() = %v, %v, want nothing cached", cached, err)
+	}
+
+	st := repository.NewDeploymentState()
+	st.Services["api"] = &entity.BizService{Name: "api", ServiceBase: entity.ServiceBase{Server: "srv1"}, Image: "api:1.0"}
+	st.Unreachable["srv2"] = "server unreachable"
+	fetchedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	if err := SaveCache(dir, "prod", st, fetchedAt); err != nil {
+		t.Fatalf("SaveCache() error = %v", err)
+	}
+
+	cached, err = LoadCache(dir, "prod")
+	if err != nil {
+		t.Fatalf("LoadCache() error = %v", err)
+	}
+	if !cached.FetchedAt.Equal(fetchedAt) {
+		t.Errorf("FetchedAt = %s, want %s", cached.FetchedAt, fetchedAt)
+	}
+	if svc := cached.State.Services["api"]; svc == nil || svc.Image != "api:1.0" {
+		t.Errorf("Services[api] = %+v", svc)
+	}
+	if cached.State.Unreachable["srv2"] == "" {
+		t.Errorf("Unreachable = %v, want srv2 kept", cached.State.Unreachable)
+	}
+}
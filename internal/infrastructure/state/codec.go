@@ -0,0 +1,75 @@
+package state
+
+import (
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"gopkg.in/yaml.v3"
+)
+
+// Unmarshal parses a state document as written by Marshal.
+func Unmarshal(data []byte) (*repository.DeploymentState, error) {
+	var cfg entity.Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+
+	state := repository.NewDeploymentState()
+
+	for i := range cfg.Services {
+		state.Services[cfg.Services[i].Name] = &cfg.Services[i]
+	}
+	for i := range cfg.InfraServices {
+		state.InfraServices[cfg.InfraServices[i].Name] = &cfg.InfraServices[i]
+	}
+	for i := range cfg.Servers {
+		state.Servers[cfg.Servers[i].Name] = &cfg.Servers[i]
+	}
+	for i := range cfg.Zones {
+		state.Zones[cfg.Zones[i].Name] = &cfg.Zones[i]
+	}
+	for i := range cfg.Domains {
+		state.Domains[cfg.Domains[i].Name] = &cfg.Domains[i]
+		for _, r := range cfg.Domains[i].FlattenRecords() {
+			record := r
+			state.Records[record.Key()] = &record
+		}
+	}
+	for i := range cfg.ISPs {
+		state.ISPs[cfg.ISPs[i].Name] = &cfg.ISPs[i]
+	}
+
+	return state, nil
+}
+
+// Marshal renders st in the YAML layout shared by every state backend.
+func Marshal(state *repository.DeploymentState) ([]byte, error) {
+	cfg := &entity.Config{
+		Services:      make([]entity.BizService, 0, len(state.Services)),
+		InfraServices: make([]entity.InfraService, 0, len(state.InfraServices)),
+		Servers:       make([]entity.Server, 0, len(state.Servers)),
+		Zones:         make([]entity.Zone, 0, len(state.Zones)),
+		Domains:       make([]entity.Domain, 0, len(state.Domains)),
+		ISPs:          make([]entity.ISP, 0, len(state.ISPs)),
+	}
+
+	for _, svc := range state.Services {
+		cfg.Services = append(cfg.Services, *svc)
+	}
+	for _, infra := range state.InfraServices {
+		cfg.InfraServices = append(cfg.InfraServices, *infra)
+	}
+	for _, srv := range state.Servers {
+		cfg.Servers = append(cfg.Servers, *srv)
+	}
+	for _, z := range state.Zones {
+		cfg.Zones = append(cfg.Zones, *z)
+	}
+	for _, d := range state.Domains {
+		cfg.Domains = append(cfg.Domains, *d)
+	}
+	for _, isp := range state.ISPs {
+		cfg.ISPs = append(cfg.ISPs, *isp)
+	}
+
+	return yaml.Marshal(cfg)
+}
@@ -0,0 +1,39 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lite-lake/infra-yamlops/internal/constants"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+)
+
+// NewStore returns the state store selected by backend. A nil backend or the
+// file type keeps state in <configDir>/.state/<env>.yaml.
+func NewStore(backend *entity.StateBackend, configDir, env string, secrets map[string]string) (repository.VersionedStateRepository, error) {
+	if backend == nil || backend.Type == "" || backend.Type == entity.StateBackendFile {
+		stateDir := filepath.Join(configDir, constants.StateDir)
+		if err := os.MkdirAll(stateDir, constants.DirPermissionOwner); err != nil {
+			return nil, fmt.Errorf("creating state directory %s: %w", stateDir, err)
+		}
+		var opts []FileStoreOption
+		if backend != nil && backend.Keep > 0 {
+			opts = append(opts, WithKeep(backend.Keep))
+		}
+		return NewFileStore(filepath.Join(stateDir, fmt.Sprintf(constants.StateFileFormat, env)), opts...), nil
+	}
+
+	switch backend.Type {
+	case entity.StateBackendHTTP:
+		password, err := backend.Password.Resolve(secrets)
+		if err != nil {
+			return nil, fmt.Errorf("resolving state backend password: %w", err)
+		}
+		return NewHTTPStore(backend.Address, WithBasicAuth(backend.Username, password)), nil
+	default:
+		return nil, fmt.Errorf("%w: state backend %s", domain.ErrInvalidType, backend.Type)
+	}
+}
@@ -2,28 +2,48 @@ package state
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/gofrs/flock"
 	"github.com/lite-lake/infra-yamlops/internal/constants"
 	"github.com/lite-lake/infra-yamlops/internal/domain"
-	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
 	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
-	"gopkg.in/yaml.v3"
 )
 
 type FileStore struct {
-	path  string
-	flock *flock.Flock
+	path   string
+	keep   int
+	flock  *flock.Flock
+	opLock *flock.Flock
 }
 
-func NewFileStore(path string) *FileStore {
-	return &FileStore{
-		path:  path,
-		flock: flock.New(path + ".lock"),
+type FileStoreOption func(*FileStore)
+
+// WithKeep limits the history to the keep latest versions; older snapshots
+// are deleted as new ones are saved. Zero keeps every version.
+func WithKeep(keep int) FileStoreOption {
+	return func(s *FileStore) { s.keep = keep }
+}
+
+// NewFileStore keeps the constants.DefaultStateHistoryKeep latest versions
+// unless told otherwise with WithKeep.
+func NewFileStore(path string, opts ...FileStoreOption) *FileStore {
+	s := &FileStore{
+		path:   path,
+		keep:   constants.DefaultStateHistoryKeep,
+		flock:  flock.New(path + ".lock"),
+		opLock: flock.New(path + ".oplock"),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *FileStore) Load(ctx context.Context, env string) (*repository.DeploymentState, error) {
@@ -40,88 +60,226 @@ func (s *FileStore) Load(ctx context.Context, env string) (*repository.Deploymen
 		return nil, fmt.Errorf("reading state file %s: %w", s.path, domain.WrapOp("read state file", domain.ErrStateReadFailed))
 	}
 
-	var cfg entity.Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	state, err := Unmarshal(data)
+	if err != nil {
 		return nil, fmt.Errorf("parsing state file %s: %w", s.path, domain.WrapOp("parse state file", domain.ErrStateSerializeFail))
 	}
+	return state, nil
+}
 
-	state := repository.NewDeploymentState()
+// Save writes state as the current state without recording a version in the
+// history, as a checkpoint of an operation still running.
+func (s *FileStore) Save(ctx context.Context, env string, state *repository.DeploymentState) error {
+	if err := s.flock.Lock(); err != nil {
+		return fmt.Errorf("acquiring lock: %w", err)
+	}
+	defer s.flock.Unlock()
 
-	for i := range cfg.Services {
-		state.Services[cfg.Services[i].Name] = &cfg.Services[i]
+	data, err := Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshaling state for %s: %w", s.path, domain.WrapOp("marshal state", domain.ErrStateSerializeFail))
 	}
-	for i := range cfg.InfraServices {
-		state.InfraServices[cfg.InfraServices[i].Name] = &cfg.InfraServices[i]
+	return s.writeState(data)
+}
+
+// SaveVersion writes state and then records it as the next numbered snapshot
+// in the history directory, together with meta, so that the history never
+// holds a version that did not become the current state.
+func (s *FileStore) SaveVersion(ctx context.Context, env string, state *repository.DeploymentState, meta *repository.StateVersion) error {
+	if err := s.flock.Lock(); err != nil {
+		return fmt.Errorf("acquiring lock: %w", err)
 	}
-	for i := range cfg.Servers {
-		state.Servers[cfg.Servers[i].Name] = &cfg.Servers[i]
+	defer s.flock.Unlock()
+
+	data, err := Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshaling state for %s: %w", s.path, domain.WrapOp("marshal state", domain.ErrStateSerializeFail))
 	}
-	for i := range cfg.Zones {
-		state.Zones[cfg.Zones[i].Name] = &cfg.Zones[i]
+
+	if err := s.writeState(data); err != nil {
+		return err
 	}
-	for i := range cfg.Domains {
-		state.Domains[cfg.Domains[i].Name] = &cfg.Domains[i]
-		for _, r := range cfg.Domains[i].FlattenRecords() {
-			record := r
-			key := fmt.Sprintf("%s:%s:%s", record.Domain, record.Type, record.Name)
-			state.Records[key] = &record
-		}
+	return s.writeSnapshot(data, meta)
+}
+
+// writeState replaces the state file with data through a temporary file.
+func (s *FileStore) writeState(data []byte) error {
+	tmpPath := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
+	if err := os.WriteFile(tmpPath, data, constants.FilePermissionOwnerRW); err != nil {
+		return fmt.Errorf("writing temp state file %s: %w", tmpPath, domain.WrapOp("write temp state file", domain.ErrStateWriteFailed))
 	}
-	for i := range cfg.ISPs {
-		state.ISPs[cfg.ISPs[i].Name] = &cfg.ISPs[i]
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("renaming state file from %s to %s: %w", tmpPath, s.path, domain.WrapOp("rename state file", domain.ErrStateWriteFailed))
 	}
 
-	return state, nil
+	return nil
 }
 
-func (s *FileStore) Save(ctx context.Context, env string, state *repository.DeploymentState) error {
+func (s *FileStore) History(ctx context.Context, env string) ([]*repository.StateVersion, error) {
 	if err := s.flock.Lock(); err != nil {
-		return fmt.Errorf("acquiring lock: %w", err)
+		return nil, fmt.Errorf("acquiring lock: %w", err)
 	}
 	defer s.flock.Unlock()
 
-	cfg := &entity.Config{
-		Services:      make([]entity.BizService, 0, len(state.Services)),
-		InfraServices: make([]entity.InfraService, 0, len(state.InfraServices)),
-		Servers:       make([]entity.Server, 0, len(state.Servers)),
-		Zones:         make([]entity.Zone, 0, len(state.Zones)),
-		Domains:       make([]entity.Domain, 0, len(state.Domains)),
-		ISPs:          make([]entity.ISP, 0, len(state.ISPs)),
+	return s.readHistory()
+}
+
+func (s *FileStore) LoadVersion(ctx context.Context, env string, version int) (*repository.DeploymentState, error) {
+	path := s.snapshotPath(version, ".yaml")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %d", domain.ErrStateVersionNotFound, version)
+		}
+		return nil, fmt.Errorf("reading state snapshot %s: %w", path, domain.WrapOp("read state snapshot", domain.ErrStateReadFailed))
 	}
 
-	for _, svc := range state.Services {
-		cfg.Services = append(cfg.Services, *svc)
+	state, err := Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing state snapshot %s: %w", path, domain.WrapOp("parse state snapshot", domain.ErrStateSerializeFail))
 	}
-	for _, infra := range state.InfraServices {
-		cfg.InfraServices = append(cfg.InfraServices, *infra)
+	return state, nil
+}
+
+// historyDir holds the snapshots of .state/<env>.yaml in .state/history/<env>.
+func (s *FileStore) historyDir() string {
+	base := strings.TrimSuffix(filepath.Base(s.path), filepath.Ext(s.path))
+	return filepath.Join(filepath.Dir(s.path), "history", base)
+}
+
+func (s *FileStore) snapshotPath(version int, ext string) string {
+	return filepath.Join(s.historyDir(), fmt.Sprintf("%06d%s", version, ext))
+}
+
+func (s *FileStore) readHistory() ([]*repository.StateVersion, error) {
+	entries, err := os.ReadDir(s.historyDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading state history %s: %w", s.historyDir(), domain.WrapOp("read state history", domain.ErrStateReadFailed))
 	}
-	for _, srv := range state.Servers {
-		cfg.Servers = append(cfg.Servers, *srv)
+
+	var versions []*repository.StateVersion
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(s.historyDir(), e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading state snapshot metadata %s: %w", path, domain.WrapOp("read state history", domain.ErrStateReadFailed))
+		}
+		var v repository.StateVersion
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("parsing state snapshot metadata %s: %w", path, domain.WrapOp("parse state history", domain.ErrStateSerializeFail))
+		}
+		versions = append(versions, &v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+func (s *FileStore) writeSnapshot(data []byte, meta *repository.StateVersion) error {
+	versions, err := s.readHistory()
+	if err != nil {
+		return err
 	}
-	for _, z := range state.Zones {
-		cfg.Zones = append(cfg.Zones, *z)
+
+	v := repository.StateVersion{}
+	if meta != nil {
+		v = *meta
 	}
-	for _, d := range state.Domains {
-		cfg.Domains = append(cfg.Domains, *d)
+	v.Version = 1
+	if len(versions) > 0 {
+		v.Version = versions[len(versions)-1].Version + 1
 	}
-	for _, isp := range state.ISPs {
-		cfg.ISPs = append(cfg.ISPs, *isp)
+	if v.Created.IsZero() {
+		v.Created = time.Now().UTC()
 	}
 
-	data, err := yaml.Marshal(cfg)
+	if err := os.MkdirAll(s.historyDir(), constants.DirPermissionOwner); err != nil {
+		return fmt.Errorf("creating state history %s: %w", s.historyDir(), domain.WrapOp("create state history", domain.ErrStateWriteFailed))
+	}
+	if err := os.WriteFile(s.snapshotPath(v.Version, ".yaml"), data, constants.FilePermissionOwnerRW); err != nil {
+		return fmt.Errorf("writing state snapshot %d: %w", v.Version, domain.WrapOp("write state snapshot", domain.ErrStateWriteFailed))
+	}
+	metaData, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
-		return fmt.Errorf("marshaling state for %s: %w", s.path, domain.WrapOp("marshal state", domain.ErrStateSerializeFail))
+		return fmt.Errorf("marshaling state snapshot metadata: %w", domain.WrapOp("marshal state history", domain.ErrStateSerializeFail))
 	}
+	if err := os.WriteFile(s.snapshotPath(v.Version, ".json"), metaData, constants.FilePermissionOwnerRW); err != nil {
+		return fmt.Errorf("writing state snapshot metadata %d: %w", v.Version, domain.WrapOp("write state snapshot", domain.ErrStateWriteFailed))
+	}
+	if meta != nil {
+		*meta = v
+	}
+	return s.prune(append(versions, &v))
+}
 
-	tmpPath := filepath.Join(filepath.Dir(s.path), "."+filepath.Base(s.path)+".tmp")
-	if err := os.WriteFile(tmpPath, data, constants.FilePermissionOwnerRW); err != nil {
-		return fmt.Errorf("writing temp state file %s: %w", tmpPath, domain.WrapOp("write temp state file", domain.ErrStateWriteFailed))
+// prune deletes the snapshots of versions beyond the keep latest ones.
+func (s *FileStore) prune(versions []*repository.StateVersion) error {
+	if s.keep <= 0 || len(versions) <= s.keep {
+		return nil
 	}
+	for _, old := range versions[:len(versions)-s.keep] {
+		for _, ext := range []string{".json", ".yaml"} {
+			if err := os.Remove(s.snapshotPath(old.Version, ext)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("removing state snapshot %d: %w", old.Version, domain.WrapOp("prune state history", domain.ErrStateWriteFailed))
+			}
+		}
+	}
+	return nil
+}
 
-	if err := os.Rename(tmpPath, s.path); err != nil {
-		os.Remove(tmpPath)
-		return fmt.Errorf("renaming state file from %s to %s: %w", tmpPath, s.path, domain.WrapOp("rename state file", domain.ErrStateWriteFailed))
+// Lock takes an exclusive lock next to the state file that other yamlops
+// processes on this machine respect. The holder is recorded in the lock file.
+func (s *FileStore) Lock(ctx context.Context, env string, info *repository.LockInfo) error {
+	locked, err := s.opLock.TryLock()
+	if err != nil {
+		return fmt.Errorf("acquiring state lock %s: %w", s.opLock.Path(), err)
+	}
+	if !locked {
+		if holder := s.readLockInfo(); holder != nil {
+			return fmt.Errorf("%w: %s", domain.ErrStateLocked, holder)
+		}
+		return fmt.Errorf("%w: %s", domain.ErrStateLocked, s.opLock.Path())
 	}
 
+	data, err := json.Marshal(info)
+	if err == nil {
+		err = os.WriteFile(s.opLock.Path(), data, constants.FilePermissionOwnerRW)
+	}
+	if err != nil {
+		s.opLock.Unlock()
+		return fmt.Errorf("writing state lock %s: %w", s.opLock.Path(), err)
+	}
+	return nil
+}
+
+func (s *FileStore) Unlock(ctx context.Context, env string, info *repository.LockInfo) error {
+	if !s.opLock.Locked() {
+		return nil
+	}
+	os.Truncate(s.opLock.Path(), 0)
+	if err := s.opLock.Unlock(); err != nil {
+		return fmt.Errorf("releasing state lock %s: %w", s.opLock.Path(), err)
+	}
 	return nil
 }
+
+func (s *FileStore) readLockInfo() *repository.LockInfo {
+	data, err := os.ReadFile(s.opLock.Path())
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var info repository.LockInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil
+	}
+	return &info
+}
+
+var _ repository.VersionedStateRepository = (*FileStore)(nil)
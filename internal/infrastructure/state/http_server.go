@@ -0,0 +1,287 @@
+package state
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lite-lake/infra-yamlops/internal/constants"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/logger"
+)
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// maxStateSize bounds the body of a PUT; larger states are rejected with
+// 413 Request Entity Too Large.
+const maxStateSize = 32 << 20
+
+// HTTPServer is the reference implementation of the protocol spoken by
+// HTTPStore. States are written to <dir>/<env>.yaml with snapshots under
+// <dir>/history/<env>; locks are kept in memory, so restarting the server
+// releases them.
+type HTTPServer struct {
+	dir      string
+	username string
+	password string
+	keep     int
+	maxBody  int64
+
+	mu    sync.Mutex
+	locks map[string]*repository.LockInfo
+}
+
+func NewHTTPServer(dir, username, password string) *HTTPServer {
+	return &HTTPServer{
+		dir:      dir,
+		username: username,
+		password: password,
+		keep:     constants.DefaultStateHistoryKeep,
+		maxBody:  maxStateSize,
+		locks:    make(map[string]*repository.LockInfo),
+	}
+}
+
+// SetKeep limits the history of each environment to the keep latest
+// versions. Zero keeps every version.
+func (s *HTTPServer) SetKeep(keep int) {
+	s.keep = keep
+}
+
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="yamlops state"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	env := parts[0]
+	if !envNamePattern.MatchString(env) {
+		http.Error(w, "invalid environment name", http.StatusNotFound)
+		return
+	}
+
+	if len(parts) > 1 {
+		s.serveHistory(w, r, env, parts[1:])
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.handleGet(w, env)
+	case http.MethodPut, http.MethodPost:
+		s.handlePut(w, r, env)
+	case MethodLock:
+		s.handleLock(w, r, env)
+	case MethodUnlock:
+		s.handleUnlock(w, r, env)
+	default:
+		w.Header().Set("Allow", strings.Join([]string{http.MethodGet, http.MethodPut, MethodLock, MethodUnlock}, ", "))
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *HTTPServer) serveHistory(w http.ResponseWriter, r *http.Request, env string, parts []string) {
+	if parts[0] != "history" || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store := NewFileStore(s.statePath(env), WithKeep(s.keep))
+	if len(parts) == 1 {
+		versions, err := store.History(r.Context(), env)
+		if err != nil {
+			logger.Error("failed to read state history", "env", env, "error", err)
+			http.Error(w, "failed to read state history", http.StatusInternalServerError)
+			return
+		}
+		if versions == nil {
+			versions = []*repository.StateVersion{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(versions)
+		return
+	}
+
+	version, err := strconv.Atoi(parts[1])
+	if err != nil || version < 1 {
+		http.Error(w, "invalid version", http.StatusBadRequest)
+		return
+	}
+	st, err := store.LoadVersion(r.Context(), env, version)
+	if errors.Is(err, domain.ErrStateVersionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err == nil {
+		var data []byte
+		if data, err = Marshal(st); err == nil {
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Write(data)
+			return
+		}
+	}
+	logger.Error("failed to read state snapshot", "env", env, "version", version, "error", err)
+	http.Error(w, "failed to read state snapshot", http.StatusInternalServerError)
+}
+
+func (s *HTTPServer) authorized(r *http.Request) bool {
+	if s.username == "" && s.password == "" {
+		return true
+	}
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(s.username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(s.password)) == 1
+	return userOK && passOK
+}
+
+func (s *HTTPServer) statePath(env string) string {
+	return filepath.Join(s.dir, fmt.Sprintf(constants.StateFileFormat, env))
+}
+
+func (s *HTTPServer) handleGet(w http.ResponseWriter, env string) {
+	s.mu.Lock()
+	data, err := os.ReadFile(s.statePath(env))
+	s.mu.Unlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "state not found", http.StatusNotFound)
+			return
+		}
+		logger.Error("failed to read state", "env", env, "error", err)
+		http.Error(w, "failed to read state", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(data)
+}
+
+// handlePut reads and parses the body before taking the mutex, so that a
+// slow client only holds up its own request.
+func (s *HTTPServer) handlePut(w http.ResponseWriter, r *http.Request, env string) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBody))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("state larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	st, err := Unmarshal(data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid state: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if held, ok := s.locks[env]; ok && r.URL.Query().Get("ID") != held.ID {
+		writeLockInfo(w, http.StatusLocked, held)
+		return
+	}
+
+	if err := os.MkdirAll(s.dir, constants.DirPermissionOwner); err != nil {
+		logger.Error("failed to create state directory", "dir", s.dir, "error", err)
+		http.Error(w, "failed to write state", http.StatusInternalServerError)
+		return
+	}
+	store := NewFileStore(s.statePath(env), WithKeep(s.keep))
+	if r.Header.Get(HeaderCheckpoint) != "" {
+		if err := store.Save(r.Context(), env, st); err != nil {
+			logger.Error("failed to write state", "env", env, "error", err)
+			http.Error(w, "failed to write state", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	meta := &repository.StateVersion{
+		Who:       r.Header.Get(HeaderWho),
+		Operation: r.Header.Get(HeaderOperation),
+		Plan:      r.Header.Get(HeaderPlan),
+	}
+	if err := store.SaveVersion(r.Context(), env, st, meta); err != nil {
+		logger.Error("failed to write state", "env", env, "error", err)
+		http.Error(w, "failed to write state", http.StatusInternalServerError)
+		return
+	}
+	logger.Info("state saved", "env", env, "version", meta.Version, "who", meta.Who, "remote", r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(meta)
+}
+
+func (s *HTTPServer) handleLock(w http.ResponseWriter, r *http.Request, env string) {
+	info, ok := readLockInfo(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if held, exists := s.locks[env]; exists && held.ID != info.ID {
+		writeLockInfo(w, http.StatusLocked, held)
+		return
+	}
+	s.locks[env] = info
+	logger.Info("state locked", "env", env, "id", info.ID, "who", info.Who, "operation", info.Operation)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *HTTPServer) handleUnlock(w http.ResponseWriter, r *http.Request, env string) {
+	info, ok := readLockInfo(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	held, exists := s.locks[env]
+	if !exists {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if held.ID != info.ID {
+		writeLockInfo(w, http.StatusConflict, held)
+		return
+	}
+	delete(s.locks, env)
+	logger.Info("state unlocked", "env", env, "id", info.ID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func readLockInfo(w http.ResponseWriter, r *http.Request) (*repository.LockInfo, bool) {
+	var info repository.LockInfo
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil || info.ID == "" {
+		http.Error(w, "lock info with an id is required", http.StatusBadRequest)
+		return nil, false
+	}
+	return &info, true
+}
+
+func writeLockInfo(w http.ResponseWriter, status int, info *repository.LockInfo) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,311 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+)
+
+const (
+	MethodLock   = "LOCK"
+	MethodUnlock = "UNLOCK"
+
+	HeaderWho       = "X-Yamlops-Who"
+	HeaderOperation = "X-Yamlops-Operation"
+	HeaderPlan      = "X-Yamlops-Plan"
+	// HeaderCheckpoint set on a PUT asks the server to replace the current
+	// state without recording a version.
+	HeaderCheckpoint = "X-Yamlops-Checkpoint"
+
+	defaultHTTPTimeout = 30 * time.Second
+)
+
+// HTTPStore keeps state on a REST endpoint. The state of an environment lives
+// at <address>/<env>: GET reads it, PUT replaces it, and LOCK / UNLOCK with a
+// JSON LockInfo body guard it. A PUT records a new version unless it carries
+// X-Yamlops-Checkpoint. A held lock is reported with 423 Locked.
+// <address>/<env>/history lists saved versions and <address>/<env>/history/<n>
+// returns one of them.
+type HTTPStore struct {
+	address  string
+	username string
+	password string
+	client   *http.Client
+
+	mu     sync.Mutex
+	lockID string
+}
+
+type HTTPStoreOption func(*HTTPStore)
+
+func WithBasicAuth(username, password string) HTTPStoreOption {
+	return func(s *HTTPStore) {
+		s.username = username
+		s.password = password
+	}
+}
+
+func WithHTTPClient(client *http.Client) HTTPStoreOption {
+	return func(s *HTTPStore) { s.client = client }
+}
+
+func NewHTTPStore(address string, opts ...HTTPStoreOption) *HTTPStore {
+	s := &HTTPStore{
+		address: strings.TrimRight(address, "/"),
+		client:  &http.Client{Timeout: defaultHTTPTimeout},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *HTTPStore) Load(ctx context.Context, env string) (*repository.DeploymentState, error) {
+	resp, err := s.do(ctx, http.MethodGet, env, nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading state from %s: %w", s.envURL(env), domain.WrapOp("read state", err))
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusNoContent:
+		return repository.NewDeploymentState(), nil
+	default:
+		return nil, fmt.Errorf("reading state from %s: %w", s.envURL(env), statusError(resp, domain.ErrStateReadFailed))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading state from %s: %w", s.envURL(env), domain.WrapOp("read response", domain.ErrStateReadFailed))
+	}
+	state, err := Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing state from %s: %w", s.envURL(env), domain.WrapOp("parse state", domain.ErrStateSerializeFail))
+	}
+	return state, nil
+}
+
+// Save replaces the current state without recording a version.
+func (s *HTTPStore) Save(ctx context.Context, env string, state *repository.DeploymentState) error {
+	return s.put(ctx, env, state, http.Header{HeaderCheckpoint: []string{"true"}}, nil)
+}
+
+// SaveVersion sends meta along with the state in X-Yamlops-* headers. The
+// server assigns the version number and returns it in the response body.
+func (s *HTTPStore) SaveVersion(ctx context.Context, env string, state *repository.DeploymentState, meta *repository.StateVersion) error {
+	return s.put(ctx, env, state, versionHeaders(meta), meta)
+}
+
+func (s *HTTPStore) put(ctx context.Context, env string, state *repository.DeploymentState, header http.Header, meta *repository.StateVersion) error {
+	data, err := Marshal(state)
+	if err != nil {
+		return fmt.Errorf("marshaling state for %s: %w", s.envURL(env), domain.WrapOp("marshal state", domain.ErrStateSerializeFail))
+	}
+
+	resp, err := s.doRequest(ctx, http.MethodPut, s.envURL(env), data, header)
+	if err != nil {
+		return fmt.Errorf("writing state to %s: %w", s.envURL(env), domain.WrapOp("write state", err))
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		if meta != nil {
+			var saved repository.StateVersion
+			if err := json.NewDecoder(resp.Body).Decode(&saved); err == nil && saved.Version > 0 {
+				*meta = saved
+			}
+		}
+		return nil
+	case http.StatusLocked, http.StatusConflict:
+		return fmt.Errorf("writing state to %s: %w", s.envURL(env), lockedError(resp))
+	default:
+		return fmt.Errorf("writing state to %s: %w", s.envURL(env), statusError(resp, domain.ErrStateWriteFailed))
+	}
+}
+
+func (s *HTTPStore) History(ctx context.Context, env string) ([]*repository.StateVersion, error) {
+	target := s.envURL(env) + "/history"
+	resp, err := s.doRequest(ctx, http.MethodGet, target, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading state history from %s: %w", target, domain.WrapOp("read state history", err))
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("reading state history from %s: %w", target, statusError(resp, domain.ErrStateReadFailed))
+	}
+
+	var versions []*repository.StateVersion
+	if err := json.NewDecoder(resp.Body).Decode(&versions); err != nil {
+		return nil, fmt.Errorf("parsing state history from %s: %w", target, domain.WrapOp("parse state history", domain.ErrStateSerializeFail))
+	}
+	return versions, nil
+}
+
+func (s *HTTPStore) LoadVersion(ctx context.Context, env string, version int) (*repository.DeploymentState, error) {
+	target := fmt.Sprintf("%s/history/%d", s.envURL(env), version)
+	resp, err := s.doRequest(ctx, http.MethodGet, target, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading state snapshot from %s: %w", target, domain.WrapOp("read state snapshot", err))
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %d", domain.ErrStateVersionNotFound, version)
+	default:
+		return nil, fmt.Errorf("reading state snapshot from %s: %w", target, statusError(resp, domain.ErrStateReadFailed))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading state snapshot from %s: %w", target, domain.WrapOp("read response", domain.ErrStateReadFailed))
+	}
+	state, err := Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing state snapshot from %s: %w", target, domain.WrapOp("parse state snapshot", domain.ErrStateSerializeFail))
+	}
+	return state, nil
+}
+
+func (s *HTTPStore) Lock(ctx context.Context, env string, info *repository.LockInfo) error {
+	body, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("encoding lock info: %w", err)
+	}
+
+	resp, err := s.do(ctx, MethodLock, env, body)
+	if err != nil {
+		return fmt.Errorf("locking state at %s: %w", s.envURL(env), err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		s.mu.Lock()
+		s.lockID = info.ID
+		s.mu.Unlock()
+		return nil
+	case http.StatusLocked, http.StatusConflict:
+		return fmt.Errorf("locking state at %s: %w", s.envURL(env), lockedError(resp))
+	default:
+		return fmt.Errorf("locking state at %s: %w", s.envURL(env), statusError(resp, domain.ErrStateWriteFailed))
+	}
+}
+
+func (s *HTTPStore) Unlock(ctx context.Context, env string, info *repository.LockInfo) error {
+	body, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("encoding lock info: %w", err)
+	}
+
+	resp, err := s.do(ctx, MethodUnlock, env, body)
+	if err != nil {
+		return fmt.Errorf("unlocking state at %s: %w", s.envURL(env), err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		s.mu.Lock()
+		s.lockID = ""
+		s.mu.Unlock()
+		return nil
+	case http.StatusLocked, http.StatusConflict:
+		return fmt.Errorf("unlocking state at %s: %w", s.envURL(env), lockedError(resp))
+	default:
+		return fmt.Errorf("unlocking state at %s: %w", s.envURL(env), statusError(resp, domain.ErrStateWriteFailed))
+	}
+}
+
+func (s *HTTPStore) envURL(env string) string {
+	return s.address + "/" + url.PathEscape(env)
+}
+
+func (s *HTTPStore) do(ctx context.Context, method, env string, body []byte) (*http.Response, error) {
+	return s.doRequest(ctx, method, s.envURL(env), body, nil)
+}
+
+func (s *HTTPStore) doRequest(ctx context.Context, method, target string, body []byte, header http.Header) (*http.Response, error) {
+	s.mu.Lock()
+	lockID := s.lockID
+	s.mu.Unlock()
+	if method == http.MethodPut && lockID != "" {
+		target += "?ID=" + url.QueryEscape(lockID)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if s.username != "" || s.password != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	if method == MethodLock || method == MethodUnlock {
+		req.Header.Set("Content-Type", "application/json")
+	} else if body != nil {
+		req.Header.Set("Content-Type", "application/yaml")
+	}
+
+	return s.client.Do(req)
+}
+
+func versionHeaders(meta *repository.StateVersion) http.Header {
+	header := http.Header{}
+	if meta == nil {
+		return header
+	}
+	if meta.Who != "" {
+		header.Set(HeaderWho, meta.Who)
+	}
+	if meta.Operation != "" {
+		header.Set(HeaderOperation, meta.Operation)
+	}
+	if meta.Plan != "" {
+		header.Set(HeaderPlan, meta.Plan)
+	}
+	return header
+}
+
+func lockedError(resp *http.Response) error {
+	var holder repository.LockInfo
+	data, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(data, &holder); err == nil && holder.ID != "" {
+		return fmt.Errorf("%w: %s", domain.ErrStateLocked, &holder)
+	}
+	return fmt.Errorf("%w: %s", domain.ErrStateLocked, resp.Status)
+}
+
+func statusError(resp *http.Response, sentinel error) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if msg := strings.TrimSpace(string(data)); msg != "" {
+		return fmt.Errorf("%w: %s: %s", sentinel, resp.Status, msg)
+	}
+	return fmt.Errorf("%w: %s", sentinel, resp.Status)
+}
+
+var _ repository.VersionedStateRepository = (*HTTPStore)(nil)
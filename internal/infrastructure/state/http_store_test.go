@@ -0,0 +1,285 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+)
+
+func newTestServer(t *testing.T, username, password string) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(NewHTTPServer(t.TempDir(), username, password))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func testState() *repository.DeploymentState {
+	st := repository.NewDeploymentState()
+	st.Services["api"] = &entity.BizService{ServiceBase: entity.ServiceBase{Server: "srv1"}, Name: "api", Image: "api:1.0"}
+	st.Zones["cn"] = &entity.Zone{Name: "cn", ISP: "aliyun"}
+	return st
+}
+
+func TestHTTPStore_LoadMissingReturnsEmptyState(t *testing.T) {
+	ts := newTestServer(t, "", "")
+	store := NewHTTPStore(ts.URL)
+
+	st, err := store.Load(context.Background(), "prod")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(st.Services) != 0 || len(st.Zones) != 0 {
+		t.Errorf("Load() = %+v, want empty state", st)
+	}
+}
+
+func TestHTTPStore_SaveLoadRoundTrip(t *testing.T) {
+	ts := newTestServer(t, "", "")
+	store := NewHTTPStore(ts.URL + "/")
+	ctx := context.Background()
+
+	if err := store.Save(ctx, "prod", testState()); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	st, err := store.Load(ctx, "prod")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if svc := st.Services["api"]; svc == nil || svc.Image != "api:1.0" || svc.Server != "srv1" {
+		t.Errorf("Services[api] = %+v", svc)
+	}
+	if z := st.Zones["cn"]; z == nil || z.ISP != "aliyun" {
+		t.Errorf("Zones[cn] = %+v", z)
+	}
+
+	other, err := store.Load(ctx, "staging")
+	if err != nil {
+		t.Fatalf("Load(staging) error = %v", err)
+	}
+	if len(other.Services) != 0 {
+		t.Errorf("staging state should be independent of prod, got %+v", other.Services)
+	}
+}
+
+func TestHTTPStore_LockExcludesOtherClients(t *testing.T) {
+	ts := newTestServer(t, "", "")
+	alice := NewHTTPStore(ts.URL)
+	bob := NewHTTPStore(ts.URL)
+	ctx := context.Background()
+
+	aliceLock := &repository.LockInfo{ID: "a1", Operation: "apply", Who: "alice@laptop"}
+	bobLock := &repository.LockInfo{ID: "b1", Operation: "apply", Who: "bob@desktop"}
+
+	if err := alice.Lock(ctx, "prod", aliceLock); err != nil {
+		t.Fatalf("alice Lock() error = %v", err)
+	}
+
+	err := bob.Lock(ctx, "prod", bobLock)
+	if !errors.Is(err, domain.ErrStateLocked) {
+		t.Fatalf("bob Lock() error = %v, want ErrStateLocked", err)
+	}
+	if err := bob.Save(ctx, "prod", testState()); !errors.Is(err, domain.ErrStateLocked) {
+		t.Errorf("bob Save() error = %v, want ErrStateLocked", err)
+	}
+	if err := bob.Unlock(ctx, "prod", bobLock); !errors.Is(err, domain.ErrStateLocked) {
+		t.Errorf("bob Unlock() error = %v, want ErrStateLocked", err)
+	}
+	if err := bob.Lock(ctx, "staging", bobLock); err != nil {
+		t.Errorf("locks should be per environment, got %v", err)
+	}
+
+	if err := alice.Save(ctx, "prod", testState()); err != nil {
+		t.Errorf("alice Save() while holding lock error = %v", err)
+	}
+	if err := alice.Unlock(ctx, "prod", aliceLock); err != nil {
+		t.Fatalf("alice Unlock() error = %v", err)
+	}
+	if err := bob.Lock(ctx, "prod", bobLock); err != nil {
+		t.Errorf("bob Lock() after release error = %v", err)
+	}
+}
+
+func TestHTTPStore_BasicAuth(t *testing.T) {
+	ts := newTestServer(t, "ops", "s3cret")
+	ctx := context.Background()
+
+	if _, err := NewHTTPStore(ts.URL).Load(ctx, "prod"); !errors.Is(err, domain.ErrStateReadFailed) {
+		t.Errorf("Load() without credentials error = %v, want ErrStateReadFailed", err)
+	}
+	if _, err := NewHTTPStore(ts.URL, WithBasicAuth("ops", "wrong")).Load(ctx, "prod"); err == nil {
+		t.Error("Load() with wrong password should fail")
+	}
+	if _, err := NewHTTPStore(ts.URL, WithBasicAuth("ops", "s3cret")).Load(ctx, "prod"); err != nil {
+		t.Errorf("Load() with credentials error = %v", err)
+	}
+}
+
+func TestFileStore_LockExcludesOtherStores(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prod.yaml")
+	first := NewFileStore(path)
+	second := NewFileStore(path)
+	ctx := context.Background()
+	info := &repository.LockInfo{ID: "a1", Operation: "apply", Who: "alice@laptop"}
+
+	if err := first.Lock(ctx, "prod", info); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	err := second.Lock(ctx, "prod", &repository.LockInfo{ID: "b1"})
+	if !errors.Is(err, domain.ErrStateLocked) {
+		t.Fatalf("second Lock() error = %v, want ErrStateLocked", err)
+	}
+	if err := first.Save(ctx, "prod", testState()); err != nil {
+		t.Errorf("Save() while locked error = %v", err)
+	}
+	if err := first.Unlock(ctx, "prod", info); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+	if err := second.Lock(ctx, "prod", &repository.LockInfo{ID: "b1"}); err != nil {
+		t.Errorf("second Lock() after release error = %v", err)
+	}
+}
+
+func assertHistory(t *testing.T, store repository.VersionedStateRepository) {
+	t.Helper()
+	ctx := context.Background()
+
+	first := &repository.StateVersion{Who: "alice@laptop", Operation: "apply", Plan: "prod.plan"}
+	if err := store.SaveVersion(ctx, "prod", testState(), first); err != nil {
+		t.Fatalf("SaveVersion() error = %v", err)
+	}
+	if first.Version != 1 {
+		t.Errorf("first version = %d, want 1", first.Version)
+	}
+
+	second := testState()
+	second.Services["api"].Image = "api:2.0"
+	if err := store.Save(ctx, "prod", second); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	versions, err := store.History(ctx, "prod")
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if len(versions) != 1 {
+		t.Fatalf("History() returned %d versions, want 1: Save must not record a version", len(versions))
+	}
+	if v := versions[0]; v.Version != 1 || v.Who != "alice@laptop" || v.Operation != "apply" || v.Plan != "prod.plan" || v.Created.IsZero() {
+		t.Errorf("versions[0] = %+v", v)
+	}
+
+	old, err := store.LoadVersion(ctx, "prod", 1)
+	if err != nil {
+		t.Fatalf("LoadVersion(1) error = %v", err)
+	}
+	if got := old.Services["api"].Image; got != "api:1.0" {
+		t.Errorf("version 1 image = %s, want api:1.0", got)
+	}
+	current, err := store.Load(ctx, "prod")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := current.Services["api"].Image; got != "api:2.0" {
+		t.Errorf("current image = %s, want api:2.0", got)
+	}
+
+	if _, err := store.LoadVersion(ctx, "prod", 9); !errors.Is(err, domain.ErrStateVersionNotFound) {
+		t.Errorf("LoadVersion(9) error = %v, want ErrStateVersionNotFound", err)
+	}
+}
+
+func TestFileStore_History(t *testing.T) {
+	assertHistory(t, NewFileStore(filepath.Join(t.TempDir(), "prod.yaml")))
+}
+
+func TestFileStore_Keep(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "prod.yaml"), WithKeep(2))
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		if err := store.SaveVersion(ctx, "prod", testState(), &repository.StateVersion{}); err != nil {
+			t.Fatalf("SaveVersion() error = %v", err)
+		}
+	}
+
+	versions, err := store.History(ctx, "prod")
+	if err != nil {
+		t.Fatalf("History() error = %v", err)
+	}
+	if len(versions) != 2 || versions[0].Version != 3 || versions[1].Version != 4 {
+		t.Fatalf("History() = %v, want versions 3 and 4", versions)
+	}
+	if _, err := store.LoadVersion(ctx, "prod", 2); !errors.Is(err, domain.ErrStateVersionNotFound) {
+		t.Errorf("LoadVersion(2) error = %v, want ErrStateVersionNotFound", err)
+	}
+}
+
+func TestHTTPServer_PutTooLarge(t *testing.T) {
+	srv := NewHTTPServer(t.TempDir(), "", "")
+	srv.maxBody = 64
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/prod", strings.NewReader(strings.Repeat("#", 65)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("PUT of 65 bytes status = %d, want 413", resp.StatusCode)
+	}
+
+	err = NewHTTPStore(ts.URL).Save(context.Background(), "prod", testState())
+	if err == nil || !errors.Is(err, domain.ErrStateWriteFailed) {
+		t.Errorf("Save() of a state over the limit error = %v, want ErrStateWriteFailed", err)
+	}
+}
+
+func TestHTTPServer_StalledPutDoesNotBlock(t *testing.T) {
+	ts := newTestServer(t, "", "")
+
+	body, stall := io.Pipe()
+	defer stall.Close()
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/staging", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	if _, err := stall.Write([]byte("services:\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := NewHTTPStore(ts.URL).Save(ctx, "prod", testState()); err != nil {
+		t.Errorf("Save() while another client stalls its upload error = %v", err)
+	}
+}
+
+func TestHTTPStore_History(t *testing.T) {
+	ts := newTestServer(t, "", "")
+	store := NewHTTPStore(ts.URL)
+
+	versions, err := store.History(context.Background(), "prod")
+	if err != nil || len(versions) != 0 {
+		t.Fatalf("History() on empty server = %v, %v", versions, err)
+	}
+	assertHistory(t, store)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/lite-lake/infra-yamlops/internal/application/handler"
 	"github.com/lite-lake/infra-yamlops/internal/application/usecase"
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
@@ -22,7 +23,9 @@ type AppFilters struct {
 
 func newAppCommand(ctx *Context) *cobra.Command {
 	var filters AppFilters
-	var autoApprove bool
+	var applyOpts ApplyOptions
+	var output string
+	var detailedExitCode bool
 
 	appCmd := &cobra.Command{
 		Use:   "app",
@@ -35,7 +38,7 @@ func newAppCommand(ctx *Context) *cobra.Command {
 		Short: "Generate deployment plan",
 		Long:  "Generate a deployment plan for application resources.",
 		Run: func(cmd *cobra.Command, args []string) {
-			runAppPlan(ctx, filters)
+			runAppPlan(ctx, filters, output, detailedExitCode)
 		},
 	}
 
@@ -44,7 +47,7 @@ func newAppCommand(ctx *Context) *cobra.Command {
 		Short: "Apply deployment",
 		Long:  "Apply the deployment for application resources.",
 		Run: func(cmd *cobra.Command, args []string) {
-			runAppApply(ctx, filters, autoApprove)
+			runAppApply(ctx, filters, applyOpts)
 		},
 	}
 
@@ -79,7 +82,12 @@ func newAppCommand(ctx *Context) *cobra.Command {
 	appCmd.PersistentFlags().StringVarP(&filters.Infra, "infra", "i", "", "Filter by infra service")
 	appCmd.PersistentFlags().StringVarP(&filters.Biz, "biz", "b", "", "Filter by business service")
 
-	appApplyCmd.Flags().BoolVar(&autoApprove, "auto-approve", false, "Auto approve changes")
+	appPlanCmd.Flags().StringVarP(&output, "output", "o", OutputText, "Output format (text/json)")
+	appPlanCmd.Flags().BoolVar(&detailedExitCode, "detailed-exitcode", false, "Return a detailed exit code (0 no changes, 1 error, 2 changes, 3 destructive changes)")
+	appApplyCmd.Flags().BoolVar(&applyOpts.AutoApprove, "auto-approve", false, "Auto approve changes")
+	appApplyCmd.Flags().StringVarP(&applyOpts.Output, "output", "o", OutputText, "Output format (text/json)")
+	appApplyCmd.Flags().IntVar(&applyOpts.Parallelism, "parallelism", 1, "Number of changes applied concurrently across servers")
+	appApplyCmd.Flags().BoolVar(&applyOpts.AllowDestroy, "allow-destroy", false, "Allow deletes denied by no_delete policies")
 
 	appCmd.AddCommand(appPlanCmd)
 	appCmd.AddCommand(appApplyCmd)
@@ -89,70 +97,95 @@ func newAppCommand(ctx *Context) *cobra.Command {
 	return appCmd
 }
 
-func runAppPlan(ctx *Context, filters AppFilters) {
-	wf := NewWorkflow(ctx.Env, ctx.ConfigDir)
+func runAppPlan(ctx *Context, filters AppFilters, output string, detailedExitCode bool) {
+	if err := validateOutputFormat(output); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(ExitCodeError)
+	}
+
+	wf := NewWorkflow(ctx)
 	planScope := valueobject.NewScope().
 		WithZone(filters.Zone).
 		WithServer(filters.Server).
 		WithService(filters.Biz)
 
-	executionPlan, _, err := wf.Plan(context.Background(), "", planScope)
+	executionPlan, cfg, err := wf.Plan(context.Background(), "", planScope)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+		os.Exit(ExitCodeError)
 	}
+	changes := filterAppChanges(executionPlan.Changes(), filters)
 
-	if !executionPlan.HasChanges() {
+	if output == OutputJSON {
+		printJSON(buildPlanOutput(ctx.Env, changes, cfg.GetSecretsMap()))
+	} else if len(changes) == 0 {
 		fmt.Println("No changes detected.")
-		return
+	} else {
+		fmt.Println("Execution Plan:")
+		fmt.Println("===============")
+		for _, ch := range changes {
+			printChange(ch)
+		}
 	}
 
-	fmt.Println("Execution Plan:")
-	fmt.Println("===============")
-	for _, ch := range executionPlan.Changes() {
+	if detailedExitCode {
+		os.Exit(planExitCode(changes))
+	}
+}
+
+func filterAppChanges(changes []*valueobject.Change, filters AppFilters) []*valueobject.Change {
+	var filtered []*valueobject.Change
+	for _, ch := range changes {
 		if filters.Infra != "" && ch.Entity() != "infra_service" {
 			continue
 		}
 		if filters.Biz != "" && ch.Entity() != "service" {
 			continue
 		}
-		var prefix string
-		switch ch.Type() {
-		case valueobject.ChangeTypeCreate:
-			prefix = "+"
-		case valueobject.ChangeTypeUpdate:
-			prefix = "~"
-		case valueobject.ChangeTypeDelete:
-			prefix = "-"
-		default:
-			prefix = " "
-		}
-		fmt.Printf("%s %s: %s\n", prefix, ch.Entity(), ch.Name())
-		for _, action := range ch.Actions() {
-			fmt.Printf("    - %s\n", action)
-		}
+		filtered = append(filtered, ch)
 	}
+	return filtered
 }
 
-func runAppApply(ctx *Context, filters AppFilters, autoApprove bool) {
-	wf := NewWorkflow(ctx.Env, ctx.ConfigDir)
+func runAppApply(ctx *Context, filters AppFilters, opts ApplyOptions) {
+	output := opts.Output
+	if err := validateOutputFormat(output); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(ExitCodeError)
+	}
+	if output == OutputJSON && !opts.AutoApprove {
+		fmt.Fprintln(os.Stderr, "--output json requires --auto-approve")
+		os.Exit(ExitCodeError)
+	}
+
+	wf := NewWorkflow(ctx)
 	planScope := valueobject.NewScope().
 		WithZone(filters.Zone).
 		WithServer(filters.Server).
 		WithService(filters.Biz)
 
-	executionPlan, cfg, err := wf.Plan(nil, "", planScope)
+	executionPlan, cfg, err := wf.Plan(context.Background(), "", planScope)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
 	}
 
 	if !executionPlan.HasChanges() {
+		if output == OutputJSON {
+			printJSON(ApplyOutput{Plan: buildPlanOutput(ctx.Env, nil, nil), Results: []ResultOutput{}, Success: true})
+			return
+		}
 		fmt.Println("No changes to apply.")
+		displayUnknown(executionPlan)
 		return
 	}
 
-	if !autoApprove {
+	violations := enforcePolicies(ctx, cfg, executionPlan, opts)
+	if output != OutputJSON {
+		displayViolations(violations)
+	}
+
+	if !opts.AutoApprove {
 		if !Confirm("Do you want to apply these changes?", false) {
 			fmt.Println("Cancelled.")
 			return
@@ -172,6 +205,8 @@ func runAppApply(ctx *Context, filters AppFilters, autoApprove bool) {
 	executor.SetDomains(cfg.GetDomainMap())
 	executor.SetISPs(cfg.GetISPMap())
 	executor.SetServerEntities(cfg.GetServerMap())
+	executor.SetConfig(cfg)
+	executor.SetParallelism(opts.Parallelism)
 	executor.SetWorkDir(ctx.ConfigDir)
 
 	for _, srv := range cfg.Servers {
@@ -191,6 +226,30 @@ func runAppApply(ctx *Context, filters AppFilters, autoApprove bool) {
 
 	results := executor.Apply()
 
+	if output == OutputJSON {
+		var filtered []*handler.Result
+		for _, result := range results {
+			if filters.Infra != "" && result.Change.Entity() != "infra_service" {
+				continue
+			}
+			if filters.Biz != "" && result.Change.Entity() != "service" {
+				continue
+			}
+			filtered = append(filtered, result)
+		}
+		out := ApplyOutput{
+			Plan:    buildPlanOutput(ctx.Env, filterAppChanges(executionPlan.Changes(), filters), cfg.GetSecretsMap()),
+			Results: buildResultsOutput(filtered),
+			Success: !hasErrors(filtered),
+		}
+		out.Plan.Violations = violations
+		printJSON(out)
+		if !out.Success {
+			os.Exit(ExitCodeError)
+		}
+		return
+	}
+
 	hasError := false
 	for _, result := range results {
 		if filters.Infra != "" && result.Change.Entity() != "infra_service" {
@@ -216,7 +275,7 @@ func runAppApply(ctx *Context, filters AppFilters, autoApprove bool) {
 }
 
 func runAppList(ctx *Context, filters AppFilters, resource string) {
-	wf := NewWorkflow(ctx.Env, ctx.ConfigDir)
+	wf := NewWorkflow(ctx)
 	cfg, err := wf.LoadConfig(context.Background())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
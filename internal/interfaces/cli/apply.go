@@ -2,6 +2,7 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 
@@ -9,23 +10,58 @@ import (
 
 	"github.com/lite-lake/infra-yamlops/internal/application/handler"
 	"github.com/lite-lake/infra-yamlops/internal/application/usecase"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/journal"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/planfile"
 )
 
+type ApplyOptions struct {
+	Output       string
+	AutoApprove  bool
+	Parallelism  int
+	PlanFile     string
+	Resume       bool
+	AllowDestroy bool
+}
+
 func newApplyCommand(ctx *Context) *cobra.Command {
 	var filters Filters
+	var opts ApplyOptions
 
 	cmd := &cobra.Command{
-		Use:   "apply [scope]",
+		Use:   "apply [planfile]",
 		Short: "Apply changes",
-		Long:  "Apply infrastructure changes for the specified scope.",
-		Args:  cobra.MaximumNArgs(1),
+		Long: `Apply infrastructure changes for the specified scope, or exactly the changes stored in a plan file created by 'plan --out'.
+
+Progress is journaled under .state/journal and the state is saved after every
+change that succeeds. When an apply stops halfway, 'apply --resume' continues
+the same plan from the first change that did not succeed.`,
+		Args: cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			scope := ""
+			if err := validateOutputFormat(opts.Output); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(ExitCodeError)
+			}
+			if opts.Parallelism < 1 {
+				fmt.Fprintln(os.Stderr, "--parallelism must be at least 1")
+				os.Exit(ExitCodeError)
+			}
+			if opts.Resume {
+				if len(args) > 0 {
+					fmt.Fprintln(os.Stderr, "--resume cannot be combined with a plan file")
+					os.Exit(ExitCodeError)
+				}
+				runApplyResume(ctx, opts)
+				return
+			}
 			if len(args) > 0 {
-				scope = args[0]
+				runApplyPlanFile(ctx, args[0], opts)
+				return
 			}
-			runApply(ctx, scope, filters)
+			runApply(ctx, filters, opts)
 		},
 	}
 
@@ -33,40 +69,279 @@ func newApplyCommand(ctx *Context) *cobra.Command {
 	cmd.Flags().StringVar(&filters.Zone, "zone", "", "Filter by zone")
 	cmd.Flags().StringVar(&filters.Server, "server", "", "Filter by server")
 	cmd.Flags().StringVar(&filters.Service, "service", "", "Filter by service")
+	addTargetFlags(cmd, &filters)
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", OutputText, "Output format (text/json)")
+	cmd.Flags().BoolVar(&opts.AutoApprove, "auto-approve", false, "Skip interactive approval")
+	cmd.Flags().IntVar(&opts.Parallelism, "parallelism", 1, "Number of changes applied concurrently across servers")
+	cmd.Flags().BoolVar(&opts.Resume, "resume", false, "Continue the unfinished apply of the previous run")
+	cmd.Flags().BoolVar(&opts.AllowDestroy, "allow-destroy", false, "Allow deletes denied by no_delete policies")
 
 	return cmd
 }
 
-func runApply(ctx *Context, scope string, filters Filters) {
-	wf := NewWorkflow(ctx.Env, ctx.ConfigDir)
-	planScope := valueobject.NewScope().
-		WithDomain(filters.Domain).
-		WithZone(filters.Zone).
-		WithServer(filters.Server).
-		WithService(filters.Service)
+func runApply(ctx *Context, filters Filters, opts ApplyOptions) {
+	if opts.Output == OutputJSON && !opts.AutoApprove {
+		fmt.Fprintln(os.Stderr, "--output json requires --auto-approve or a plan file")
+		os.Exit(ExitCodeError)
+	}
+
+	wf := NewWorkflow(ctx)
+	planScope := filters.Scope()
 
-	executionPlan, cfg, err := wf.Plan(context.Background(), "", planScope)
+	cfg, remoteState, err := wf.Prepare(context.Background(), "")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+		os.Exit(ExitCodeError)
+	}
+	executionPlan, err := wf.PlanFromState(cfg, remoteState, "", planScope)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(ExitCodeError)
+	}
+	pf, err := planfile.New(ctx.Env, cfg, remoteState, executionPlan)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(ExitCodeError)
+	}
+
+	if opts.Output == OutputJSON {
+		if !executionPlan.HasChanges() {
+			planOut := buildPlanOutput(ctx.Env, executionPlan.Changes(), cfg.GetSecretsMap())
+			planOut.Unknown = buildUnknownOutput(executionPlan.Unknown())
+			printJSON(ApplyOutput{Plan: planOut, Results: []ResultOutput{}, Success: true})
+			return
+		}
+		violations := enforcePolicies(ctx, cfg, executionPlan, opts)
+		executePlan(ctx, wf, cfg, pf, executionPlan, violations, opts)
+		return
 	}
 
 	if !executionPlan.HasChanges() {
 		fmt.Println("No changes to apply.")
+		displayUnknown(executionPlan)
 		return
 	}
 
+	violations := enforcePolicies(ctx, cfg, executionPlan, opts)
 	displayPlan(executionPlan)
-	if !Confirm("\nDo you want to apply these changes?", false) {
+	displayViolations(violations)
+	if !opts.AutoApprove && !Confirm("\nDo you want to apply these changes?", false) {
 		fmt.Println("Cancelled.")
 		return
 	}
 
+	executePlan(ctx, wf, cfg, pf, executionPlan, violations, opts)
+}
+
+func runApplyPlanFile(ctx *Context, path string, opts ApplyOptions) {
+	pf, err := planfile.Load(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading plan file: %v\n", err)
+		os.Exit(ExitCodeError)
+	}
+	if pf.Env != ctx.Env {
+		fmt.Fprintf(os.Stderr, "Plan file %s was created for env %s, not %s\n", path, pf.Env, ctx.Env)
+		os.Exit(ExitCodeError)
+	}
+
+	wf := NewWorkflow(ctx)
+	cfg, err := wf.PrepareConfig(context.Background(), "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(ExitCodeError)
+	}
+	if err := pf.VerifyConfig(ctx.Env, cfg); err != nil {
+		refuseStalePlan(path, err)
+	}
+
+	if opts.Output != OutputJSON && !pf.Plan.HasChanges() {
+		fmt.Println("No changes to apply.")
+		return
+	}
+	violations := enforcePolicies(ctx, cfg, pf.Plan, opts)
+
+	// The state is fetched and checked against the plan under the lock, so
+	// that no other apply can change it before this one runs.
+	unlock := lockStateForApply(wf, cfg)
+	remoteState := wf.FetchRemoteState(context.Background(), cfg)
+	if err := pf.Verify(ctx.Env, cfg, remoteState); err != nil {
+		unlock()
+		refuseStalePlan(path, err)
+	}
+
+	if opts.Output != OutputJSON {
+		displayPlan(pf.Plan)
+		displayViolations(violations)
+		fmt.Println()
+	}
+	opts.PlanFile = path
+	executeLocked(ctx, wf, cfg, pf, pf.Plan, violations, opts, unlock)
+}
+
+func refuseStalePlan(path string, err error) {
+	fmt.Fprintf(os.Stderr, "Refusing to apply %s: %v\nRun 'yamlops plan --out %s' again and review the new plan.\n", path, err, path)
+	os.Exit(ExitCodeError)
+}
+
+// runApplyResume applies the changes of the journaled plan that did not
+// succeed, provided the configuration is still the one it was planned from.
+func runApplyResume(ctx *Context, opts ApplyOptions) {
+	if opts.Output == OutputJSON && !opts.AutoApprove {
+		fmt.Fprintln(os.Stderr, "--output json requires --auto-approve")
+		os.Exit(ExitCodeError)
+	}
+
+	pf, entries, err := journal.Load(journal.Dir(ctx.ConfigDir), ctx.Env)
+	if err != nil {
+		if errors.Is(err, domain.ErrJournalNotFound) {
+			fmt.Fprintf(os.Stderr, "Nothing to resume: no unfinished apply for env %s.\n", ctx.Env)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error loading apply journal: %v\n", err)
+		}
+		os.Exit(ExitCodeError)
+	}
+
+	// The journaled plan is applied as it is, so the servers are not fetched
+	// again: only the config has to be the one it was planned from.
+	wf := NewWorkflow(ctx)
+	cfg, err := wf.PrepareConfig(context.Background(), "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(ExitCodeError)
+	}
+	if err := pf.VerifyConfig(ctx.Env, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Refusing to resume: %v\nRun 'yamlops apply' to plan the changes again.\n", err)
+		os.Exit(ExitCodeError)
+	}
+
+	remaining := journal.Remaining(pf.Plan, entries)
+	violations := enforcePolicies(ctx, cfg, remaining, opts)
+	if opts.Output != OutputJSON {
+		done := len(pf.Plan.Changes()) - len(remaining.Changes())
+		fmt.Printf("Resuming apply started %s: %d of %d change(s) already applied.\n\n",
+			pf.CreatedAt.Local().Format("2006-01-02 15:04:05"), done, len(pf.Plan.Changes()))
+		displayPlan(remaining)
+		displayViolations(violations)
+		if !opts.AutoApprove && !Confirm("\nDo you want to apply the remaining changes?", false) {
+			fmt.Println("Cancelled.")
+			return
+		}
+	}
+	executePlan(ctx, wf, cfg, pf, remaining, violations, opts)
+}
+
+// openJournal is called with the state locked, so that a concurrent apply
+// cannot replace the journal of the running one.
+func openJournal(ctx *Context, pf *planfile.File, resume bool) (*journal.Journal, error) {
+	dir := journal.Dir(ctx.ConfigDir)
+	if resume {
+		return journal.Open(dir, ctx.Env)
+	}
+	if journal.Exists(dir, ctx.Env) {
+		fmt.Fprintln(os.Stderr, "Warning: discarding the journal of an unfinished apply, it can no longer be resumed.")
+	}
+	return journal.Create(dir, ctx.Env, pf)
+}
+
+// executePlan applies executionPlan, which is pf's plan or, when resuming,
+// the part of it that is left. violations are the policy warnings it passed
+// enforcePolicies with.
+func executePlan(ctx *Context, wf *Workflow, cfg *entity.Config, pf *planfile.File, executionPlan *valueobject.Plan, violations []service.PolicyViolation, opts ApplyOptions) {
 	if err := wf.GenerateDeployments(cfg, ""); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+		os.Exit(ExitCodeError)
+	}
+
+	executeLocked(ctx, wf, cfg, pf, executionPlan, violations, opts, lockStateForApply(wf, cfg))
+}
+
+// lockStateForApply locks the state for an apply, exiting when it cannot.
+func lockStateForApply(wf *Workflow, cfg *entity.Config) func() error {
+	unlock, err := wf.LockState(context.Background(), cfg, "apply")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error locking state: %v\n", err)
+		os.Exit(ExitCodeError)
+	}
+	return unlock
+}
+
+// executeLocked is executePlan with the state already locked; it releases
+// the lock with unlock.
+func executeLocked(ctx *Context, wf *Workflow, cfg *entity.Config, pf *planfile.File, executionPlan *valueobject.Plan, violations []service.PolicyViolation, opts ApplyOptions, unlock func() error) {
+	executor := newPlanExecutor(ctx, cfg, executionPlan, opts.Parallelism)
+
+	releaseAndExit := func(msg string, err error) {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", msg, err)
+		unlock()
+		os.Exit(ExitCodeError)
+	}
+
+	j, err := openJournal(ctx, pf, opts.Resume)
+	if err != nil {
+		releaseAndExit("Error opening apply journal", err)
+	}
+	recorder, err := wf.NewApplyRecorder(context.Background(), cfg, j, opts.PlanFile)
+	if err != nil {
+		j.Close()
+		releaseAndExit("Error loading state", err)
+	}
+	executor.SetObserver(recorder)
+
+	results := executor.Apply()
+	success := !hasErrors(results)
+
+	// Successful changes are already checkpointed in the state one by one;
+	// the apply as a whole becomes one version, which records what it did
+	// and nothing else.
+	version := recorder.Finish()
+	for _, w := range recorder.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", w)
+	}
+	if success {
+		if err := j.Remove(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	} else {
+		j.Close()
+	}
+	if err := unlock(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to release state lock: %v\n", err)
+	}
+
+	if opts.Output == OutputJSON {
+		planOut := buildPlanOutput(ctx.Env, executionPlan.Changes(), cfg.GetSecretsMap())
+		planOut.Unknown = buildUnknownOutput(executionPlan.Unknown())
+		planOut.Violations = violations
+		out := ApplyOutput{
+			Plan:       planOut,
+			Results:    buildResultsOutput(results),
+			Success:    success,
+			StateSaved: version != nil,
+			Resumable:  !success,
+		}
+		if version != nil {
+			out.StateVersion = version.Version
+		}
+		printJSON(out)
+		if !out.Success {
+			os.Exit(ExitCodeError)
+		}
+		return
 	}
 
+	printResults(results)
+	if version != nil {
+		fmt.Printf("State saved successfully (version %d).\n", version.Version)
+	}
+	if !success {
+		fmt.Println("Run 'yamlops apply --resume' to retry the failed changes and continue the plan.")
+		os.Exit(ExitCodeError)
+	}
+}
+
+// newPlanExecutor prepares an executor for executionPlan with the servers of
+// cfg that are in the plan's scope registered.
+func newPlanExecutor(ctx *Context, cfg *entity.Config, executionPlan *valueobject.Plan, parallelism int) *usecase.Executor {
 	executor := usecase.NewExecutor(&usecase.ExecutorConfig{
 		Plan: executionPlan,
 		Env:  ctx.Env,
@@ -75,13 +350,16 @@ func runApply(ctx *Context, scope string, filters Filters) {
 	executor.SetDomains(cfg.GetDomainMap())
 	executor.SetISPs(cfg.GetISPMap())
 	executor.SetServerEntities(cfg.GetServerMap())
+	executor.SetConfig(cfg)
+	executor.SetParallelism(parallelism)
 	executor.SetWorkDir(ctx.ConfigDir)
 
+	scope := executionPlan.Scope()
 	for _, srv := range cfg.Servers {
-		if filters.Server != "" && srv.Name != filters.Server {
+		if scope.Server() != "" && srv.Name != scope.Server() {
 			continue
 		}
-		if filters.Zone != "" && srv.Zone != filters.Zone {
+		if scope.Zone() != "" && srv.Zone != scope.Zone() {
 			continue
 		}
 		password, err := srv.SSH.Password.Resolve(cfg.GetSecretsMap())
@@ -91,19 +369,7 @@ func runApply(ctx *Context, scope string, filters Filters) {
 		}
 		executor.RegisterServer(srv.Name, srv.SSH.Host, srv.SSH.Port, srv.SSH.User, password)
 	}
-
-	results := executor.Apply()
-	displayResults(results)
-
-	if hasErrors(results) {
-		os.Exit(1)
-	}
-
-	if err := wf.SaveState(context.Background(), cfg); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to save state: %v\n", err)
-	} else {
-		fmt.Println("State saved successfully.")
-	}
+	return executor
 }
 
 func hasErrors(results []*handler.Result) bool {
@@ -116,6 +382,13 @@ func hasErrors(results []*handler.Result) bool {
 }
 
 func displayResults(results []*handler.Result) {
+	if printResults(results) {
+		os.Exit(1)
+	}
+}
+
+// printResults reports whether any change failed or was skipped.
+func printResults(results []*handler.Result) bool {
 	hasError := false
 	for _, result := range results {
 		if result.Success {
@@ -123,12 +396,13 @@ func displayResults(results []*handler.Result) {
 			for _, w := range result.Warnings {
 				fmt.Printf("  ⚠ %s\n", w)
 			}
+		} else if errors.Is(result.Error, domain.ErrDependencyFailed) {
+			fmt.Printf("- %s: %s - skipped (%v)\n", result.Change.Entity(), result.Change.Name(), result.Error)
+			hasError = true
 		} else {
 			fmt.Printf("✗ %s: %s - %v\n", result.Change.Entity(), result.Change.Name(), result.Error)
 			hasError = true
 		}
 	}
-	if hasError {
-		os.Exit(1)
-	}
+	return hasError
 }
@@ -1,11 +1,13 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
 	"github.com/lite-lake/infra-yamlops/internal/infrastructure/persistence"
@@ -44,8 +46,23 @@ func newConfigCommand(ctx *Context) *cobra.Command {
 		},
 	}
 
+	var showSecrets bool
+	configRenderCmd := &cobra.Command{
+		Use:   "render",
+		Short: "Show the merged configuration",
+		Long: `Show the configuration of the environment as loaded: the userdata/_base
+layer merged with the environment's own files. Secret values are masked
+unless --show-secrets is given.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runConfigRender(ctx, showSecrets)
+		},
+	}
+	configRenderCmd.Flags().BoolVar(&showSecrets, "show-secrets", false, "Show secret and credential values")
+
 	configCmd.AddCommand(configListCmd)
 	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configRenderCmd)
 
 	return configCmd
 }
@@ -138,6 +155,51 @@ func runConfigShow(ctx *Context, cfgType, name string) {
 	showEntity(ctx, cfgType, name, finder, opts...)
 }
 
+// renderSections is the order config render prints the top-level keys in,
+// the order of entity.Config.
+var renderSections = []string{
+	"secrets", "isps", "registries", "zones", "servers",
+	"infra_services", "services", "domains", "backend", "policies",
+}
+
+func runConfigRender(ctx *Context, showSecrets bool) {
+	loader := persistence.NewConfigLoader(ctx.ConfigDir)
+	cfg, err := loader.Load(context.Background(), ctx.Env)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	var doc interface{}
+	if showSecrets {
+		fmt.Fprintln(os.Stderr, "WARNING: This will display sensitive values!")
+		data, err := yaml.Marshal(cfg)
+		if err == nil {
+			err = yaml.Unmarshal(data, &doc)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error rendering config: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		doc = redactState(cfg, cfg.GetSecretsMap())
+	}
+
+	sections, _ := doc.(map[string]interface{})
+	for _, key := range renderSections {
+		value, ok := sections[key]
+		if !ok {
+			continue
+		}
+		data, err := yaml.Marshal(map[string]interface{}{key: value})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error rendering %s: %v\n", key, err)
+			os.Exit(1)
+		}
+		fmt.Print(string(data))
+	}
+}
+
 func isVaultSecret(value string) bool {
 	return strings.HasPrefix(value, "vault:")
 }
@@ -35,3 +35,16 @@ func Confirm(message string, defaultYes bool) bool {
 func ConfirmWithDefault(message string) bool {
 	return Confirm(message, false)
 }
+
+// ConfirmTyped asks the user to type expected, for operations too
+// destructive for a yes/no answer.
+func ConfirmTyped(message, expected string) bool {
+	fmt.Printf("%s\nType %q to confirm: ", message, expected)
+
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(response) == expected
+}
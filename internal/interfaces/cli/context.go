@@ -1,8 +1,19 @@
 package cli
 
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
 type Context struct {
 	Env       string
 	ConfigDir string
+	// FetchTimeout bounds fetching the live state of one server; zero keeps
+	// the default.
+	FetchTimeout time.Duration
 }
 
 func NewContext() *Context {
@@ -17,4 +28,25 @@ type Filters struct {
 	Zone    string
 	Server  string
 	Service string
+
+	Targets            []string
+	TargetDependencies bool
+	TargetDependents   bool
+}
+
+// addTargetFlags registers --target and its closure flags on cmd.
+func addTargetFlags(cmd *cobra.Command, f *Filters) {
+	cmd.Flags().StringArrayVar(&f.Targets, "target", nil, "Limit the plan to the change of this entity, e.g. service:api or dns_record:example.com:A:www (repeatable)")
+	cmd.Flags().BoolVar(&f.TargetDependencies, "with-dependencies", false, "Also include the changes the targets depend on")
+	cmd.Flags().BoolVar(&f.TargetDependents, "with-dependents", false, "Also include the changes that depend on the targets")
+}
+
+// Scope turns the filters into a plan scope.
+func (f Filters) Scope() *valueobject.Scope {
+	return valueobject.NewScope().
+		WithDomain(f.Domain).
+		WithZone(f.Zone).
+		WithServer(f.Server).
+		WithService(f.Service).
+		WithTargets(f.Targets, f.TargetDependencies, f.TargetDependents)
 }
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+)
+
+type DestroyOptions struct {
+	Confirm      string
+	Parallelism  int
+	AllowDestroy bool
+}
+
+func newDestroyCommand(ctx *Context) *cobra.Command {
+	var opts DestroyOptions
+
+	cmd := &cobra.Command{
+		Use:   "destroy",
+		Short: "Destroy every resource of the environment",
+		Long: `Delete every service, infra service, DNS record and network of the environment,
+as observed on the servers and recorded in the state, then clear the state.
+
+Services are removed with 'docker compose down -v', which also removes their
+volumes. With each server go the networks yamlops created on it: the networks
+it declares, the networks its services declare and the default yamlops-<env>
+network. The command asks you to type the environment name; --confirm <env>
+does the same without a prompt.
+
+Resources with lifecycle.prevent_destroy make the command fail before anything
+is deleted, and so do the deny rules of policies.yaml; --allow-destroy turns
+no_delete denials into warnings, as for apply.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if opts.Parallelism < 1 {
+				fmt.Fprintln(os.Stderr, "--parallelism must be at least 1")
+				os.Exit(ExitCodeError)
+			}
+			runDestroy(ctx, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Confirm, "confirm", "", "Confirm with the environment name instead of a prompt")
+	cmd.Flags().IntVar(&opts.Parallelism, "parallelism", 1, "Number of deletes run concurrently across servers")
+	cmd.Flags().BoolVar(&opts.AllowDestroy, "allow-destroy", false, "Allow deletes denied by no_delete policies")
+
+	return cmd
+}
+
+func runDestroy(ctx *Context, opts DestroyOptions) {
+	if opts.Confirm != "" && opts.Confirm != ctx.Env {
+		fmt.Fprintf(os.Stderr, "--confirm %s does not match env %s\n", opts.Confirm, ctx.Env)
+		os.Exit(ExitCodeError)
+	}
+
+	bg := context.Background()
+	wf := NewWorkflow(ctx)
+	cfg, err := wf.LoadAndValidate(bg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(ExitCodeError)
+	}
+	if err := wf.ResolveSecrets(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "resolve secrets: %v\n", err)
+		os.Exit(ExitCodeError)
+	}
+
+	destroyPlan, err := wf.PlanDestroy(bg, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Refusing to destroy env %s: %v\n", ctx.Env, err)
+		os.Exit(ExitCodeError)
+	}
+	if !destroyPlan.HasChanges() {
+		fmt.Printf("Nothing to destroy in env %s.\n", ctx.Env)
+		return
+	}
+
+	violations := enforcePolicies(ctx, cfg, destroyPlan, ApplyOptions{AllowDestroy: opts.AllowDestroy})
+
+	displayPlan(destroyPlan)
+	displayViolations(violations)
+	if opts.Confirm == "" {
+		msg := fmt.Sprintf("\nThis deletes %d resource(s) of env %s, including the data volumes of its services.", len(destroyPlan.Changes()), ctx.Env)
+		if !ConfirmTyped(msg, ctx.Env) {
+			fmt.Println("Cancelled.")
+			return
+		}
+	}
+
+	executor := newPlanExecutor(ctx, cfg, destroyPlan, opts.Parallelism)
+	unlock, err := wf.LockState(bg, cfg, "destroy")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error locking state: %v\n", err)
+		os.Exit(ExitCodeError)
+	}
+	recorder, err := wf.NewDestroyRecorder(bg, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading state: %v\n", err)
+		unlock()
+		os.Exit(ExitCodeError)
+	}
+	executor.SetObserver(recorder)
+
+	results := executor.Apply()
+	success := !hasErrors(results)
+
+	var version *repository.StateVersion
+	if success {
+		cleared := wf.NewStateVersion("destroy", "")
+		if err := wf.ClearState(bg, cfg, cleared); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to clear state: %v\n", err)
+		} else {
+			version = cleared
+		}
+	} else {
+		version = recorder.Finish()
+	}
+	for _, w := range recorder.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", w)
+	}
+	if err := unlock(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to release state lock: %v\n", err)
+	}
+
+	printResults(results)
+	if !success {
+		if version != nil {
+			fmt.Printf("State saved with the deleted resources removed (version %d).\n", version.Version)
+		}
+		fmt.Println("Run 'yamlops destroy' again to retry the remaining deletes.")
+		os.Exit(ExitCodeError)
+	}
+	if version != nil {
+		fmt.Printf("Env %s destroyed, state cleared (version %d).\n", ctx.Env, version.Version)
+	}
+}
@@ -18,6 +18,7 @@ func newDNSCommand(ctx *Context) *cobra.Command {
 		dnsDomainFilter string
 		dnsRecordFilter string
 		dnsAutoApprove  bool
+		dnsAllowDestroy bool
 	)
 
 	dnsCmd := &cobra.Command{
@@ -40,7 +41,7 @@ func newDNSCommand(ctx *Context) *cobra.Command {
 		Short: "Apply DNS changes",
 		Long:  "Apply DNS changes to providers.",
 		Run: func(cmd *cobra.Command, args []string) {
-			runDNSApply(ctx, dnsDomainFilter, dnsRecordFilter, dnsAutoApprove)
+			runDNSApply(ctx, dnsDomainFilter, dnsRecordFilter, dnsAutoApprove, dnsAllowDestroy)
 		},
 	}
 
@@ -76,6 +77,7 @@ func newDNSCommand(ctx *Context) *cobra.Command {
 	dnsApplyCmd.Flags().StringVarP(&dnsDomainFilter, "domain", "d", "", "Filter by domain")
 	dnsApplyCmd.Flags().StringVarP(&dnsRecordFilter, "record", "r", "", "Filter by record (format: name.domain)")
 	dnsApplyCmd.Flags().BoolVar(&dnsAutoApprove, "auto-approve", false, "Skip confirmation prompt")
+	dnsApplyCmd.Flags().BoolVar(&dnsAllowDestroy, "allow-destroy", false, "Allow deletes denied by no_delete policies")
 
 	dnsCmd.AddCommand(dnsPlanCmd)
 	dnsCmd.AddCommand(dnsApplyCmd)
@@ -88,7 +90,7 @@ func newDNSCommand(ctx *Context) *cobra.Command {
 }
 
 func runDNSPlan(ctx *Context, domain, record string) {
-	wf := NewWorkflow(ctx.Env, ctx.ConfigDir)
+	wf := NewWorkflow(ctx)
 	planScope := valueobject.NewScope().WithDomain(domain)
 
 	executionPlan, _, err := wf.Plan(context.Background(), "", planScope)
@@ -108,11 +110,11 @@ func runDNSPlan(ctx *Context, domain, record string) {
 	displayChanges(dnsChanges)
 }
 
-func runDNSApply(ctx *Context, domain, record string, autoApprove bool) {
-	wf := NewWorkflow(ctx.Env, ctx.ConfigDir)
+func runDNSApply(ctx *Context, domain, record string, autoApprove, allowDestroy bool) {
+	wf := NewWorkflow(ctx)
 	planScope := valueobject.NewScope().WithDomain(domain)
 
-	executionPlan, cfg, err := wf.Plan(nil, "", planScope)
+	executionPlan, cfg, err := wf.Plan(context.Background(), "", planScope)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
 		os.Exit(1)
@@ -124,8 +126,15 @@ func runDNSApply(ctx *Context, domain, record string, autoApprove bool) {
 		return
 	}
 
+	filteredPlan := valueobject.NewPlan()
+	for _, ch := range dnsChanges {
+		filteredPlan.AddChange(ch)
+	}
+	violations := enforcePolicies(ctx, cfg, filteredPlan, ApplyOptions{AllowDestroy: allowDestroy})
+
 	fmt.Println("DNS Changes:")
 	displayChanges(dnsChanges)
+	displayViolations(violations)
 
 	if !autoApprove {
 		if !Confirm("\nProceed?", false) {
@@ -139,10 +148,6 @@ func runDNSApply(ctx *Context, domain, record string, autoApprove bool) {
 		os.Exit(1)
 	}
 
-	filteredPlan := valueobject.NewPlan()
-	for _, ch := range dnsChanges {
-		filteredPlan.AddChange(ch)
-	}
 	executor := usecase.NewExecutor(&usecase.ExecutorConfig{
 		Plan: filteredPlan,
 		Env:  ctx.Env,
@@ -177,7 +182,7 @@ func displayChanges(changes []*valueobject.Change) {
 }
 
 func runDNSList(ctx *Context, resource string) {
-	wf := NewWorkflow(ctx.Env, ctx.ConfigDir)
+	wf := NewWorkflow(ctx)
 	cfg, err := wf.LoadConfig(context.Background())
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -10,11 +10,11 @@ import (
 
 	"github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
 	infradns "github.com/lite-lake/infra-yamlops/internal/infrastructure/dns"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/formatter"
 	"github.com/lite-lake/infra-yamlops/internal/infrastructure/persistence"
 )
 
@@ -425,9 +425,14 @@ func saveRecordDiffs(ctx *Context, diffs []RecordDiff, cfg *entity.Config) error
 	return saveYAMLFile(dnsPath, "domains", newDomains)
 }
 
+// saveYAMLFile writes data under key to path in canonical form, keeping the
+// comments of the entities already in the file.
 func saveYAMLFile(path, key string, data interface{}) error {
-	yamlData := map[string]interface{}{key: data}
-	content, err := yaml.Marshal(yamlData)
+	previous, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	content, err := formatter.Marshal(key, data, previous)
 	if err != nil {
 		return fmt.Errorf("failed to marshal yaml: %w", err)
 	}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lite-lake/infra-yamlops/internal/application/orchestrator"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+// ExitCodeDrift is returned by drift when any resource has drifted. It
+// matches the "changes" code of plan --detailed-exitcode.
+const ExitCodeDrift = ExitCodeChanges
+
+type DriftOptions struct {
+	Server string
+	Domain string
+	Output string
+}
+
+func newDriftCommand(ctx *Context) *cobra.Command {
+	var opts DriftOptions
+
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "Detect drift between live resources and configuration",
+		Long: `Compare the containers running on servers and the records at DNS
+providers with the desired configuration and report every attribute that
+differs: missing or stopped containers, image and digest, env file, networks,
+restart policy, and missing, extra or changed DNS records.
+
+The command exits with 0 when nothing drifted, 1 when a resource could not be
+checked and 2 when drift was found, so it can be run from cron.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runDrift(ctx, opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Server, "server", "", "Only check services on this server")
+	cmd.Flags().StringVar(&opts.Domain, "domain", "", "Only check records of this domain")
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", OutputText, "Output format (text/json)")
+
+	return cmd
+}
+
+func runDrift(ctx *Context, opts DriftOptions) {
+	if err := validateOutputFormat(opts.Output); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(ExitCodeError)
+	}
+
+	wf := NewWorkflow(ctx)
+	report, err := wf.DetectDrift(context.Background(), orchestrator.DriftFilter{Server: opts.Server, Domain: opts.Domain})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(ExitCodeError)
+	}
+
+	if opts.Output == OutputJSON {
+		printJSON(report)
+	} else {
+		displayDrift(report)
+	}
+
+	switch {
+	case report.HasDrift():
+		os.Exit(ExitCodeDrift)
+	case len(report.Errors) > 0:
+		os.Exit(ExitCodeError)
+	}
+}
+
+func displayDrift(report *orchestrator.DriftReport) {
+	for _, e := range report.Errors {
+		fmt.Fprintf(os.Stderr, "Warning: could not check %s: %s\n", e.Resource, e.Error)
+	}
+	if !report.HasDrift() {
+		fmt.Println("No drift detected.")
+		return
+	}
+
+	fmt.Printf("Drift Detected (env: %s):\n", report.Env)
+	fmt.Println("==========================")
+	prefix, style := FormatChangeType(valueobject.ChangeTypeUpdate)
+	lastResource := ""
+	for _, item := range report.Drifts {
+		if item.Resource != lastResource {
+			header := item.Resource
+			if item.Server != "" {
+				header += fmt.Sprintf(" (server: %s)", item.Server)
+			}
+			fmt.Printf("%s %s\n", style.Render(prefix), style.Render(header))
+			lastResource = item.Resource
+		}
+		fmt.Printf("    %s: expected %s, live %s\n", item.Attribute, driftValue(item.Expected), driftValue(item.Actual))
+	}
+	fmt.Printf("\n%d drifted attribute(s).\n", len(report.Drifts))
+}
+
+func driftValue(v string) string {
+	if v == "" {
+		return "(absent)"
+	}
+	return fmt.Sprintf("%q", v)
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/formatter"
+)
+
+func newFmtCommand(ctx *Context) *cobra.Command {
+	var check bool
+
+	cmd := &cobra.Command{
+		Use:   "fmt [path...]",
+		Short: "Rewrite config files in canonical form",
+		Long: `Rewrite the YAML config files in canonical form: entities sorted by name,
+fields in the order yamlops writes them, short-form volumes expanded, secret
+refs and TTLs written one way. Comments are kept.
+
+Without paths every .yaml file under userdata, in all environments, is
+formatted. The files rewritten are listed. With --check nothing is written,
+the files that are not formatted are listed and the command exits with 1 if
+there are any.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			runFmt(ctx, args, check)
+		},
+	}
+
+	cmd.Flags().BoolVar(&check, "check", false, "List unformatted files and exit with 1 if there are any, without writing")
+
+	return cmd
+}
+
+func runFmt(ctx *Context, paths []string, check bool) {
+	if len(paths) == 0 {
+		paths = []string{filepath.Join(ctx.ConfigDir, "userdata")}
+	}
+	files, err := configFiles(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(ExitCodeError)
+	}
+
+	unformatted := 0
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", file, err)
+			os.Exit(ExitCodeError)
+		}
+		out, err := formatter.Format(src)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", file, err)
+			os.Exit(ExitCodeError)
+		}
+		if bytes.Equal(src, out) {
+			continue
+		}
+		unformatted++
+		fmt.Println(file)
+		if check {
+			continue
+		}
+		if err := os.WriteFile(file, out, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", file, err)
+			os.Exit(ExitCodeError)
+		}
+	}
+
+	if check && unformatted > 0 {
+		os.Exit(ExitCodeError)
+	}
+}
+
+// configFiles returns the given files and the .yaml files under the given
+// directories.
+func configFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && filepath.Ext(p) == ".yaml" {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/lite-lake/infra-yamlops/internal/application/orchestrator"
+	"github.com/lite-lake/infra-yamlops/internal/constants"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
+)
+
+type ImportOptions struct {
+	Server    string
+	Container string
+	ISP       string
+	ConfigOut string
+}
+
+func newImportCommand(ctx *Context) *cobra.Command {
+	var opts ImportOptions
+
+	cmd := &cobra.Command{
+		Use:   "import <entity> <name>",
+		Short: "Import existing resources into state",
+		Long: `Record a resource that already exists, but was not deployed by yamlops, in
+the state so that the next plan compares the configuration with it instead of
+proposing to create it.
+
+  yamlops import service <name>                    inspect a running container
+  yamlops import dns_record <domain>:<TYPE>:<name> read records from the DNS provider
+
+A service is looked up on the server it is configured on, or on --server, in
+the container yo-<env>-<name> unless --container names another one, which
+the first deploy of the service replaces. Environment variables injected from
+secrets are left out and values the config does not set are redacted. With
+--config-out the matching configuration is written as well, so that it can be
+pasted into userdata; use - to print it.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			switch args[0] {
+			case "service":
+				runImportService(ctx, args[1], opts)
+			case "dns_record":
+				runImportRecord(ctx, args[1], opts)
+			default:
+				fmt.Fprintf(os.Stderr, "%v: cannot import %s (supported: service, dns_record)\n", domain.ErrInvalidType, args[0])
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Server, "server", "", "Server running the container (default: the server configured for the service)")
+	cmd.Flags().StringVar(&opts.Container, "container", "", "Container to inspect (default: yo-<env>-<name>)")
+	cmd.Flags().StringVar(&opts.ISP, "isp", "", "DNS ISP of a domain that is not configured yet")
+	cmd.Flags().StringVar(&opts.ConfigOut, "config-out", "", "Write a configuration snippet for the imported resource to this file (- for stdout)")
+
+	return cmd
+}
+
+func runImportService(ctx *Context, name string, opts ImportOptions) {
+	wf, cfg, _ := openStateStore(ctx)
+	if err := wf.ResolveSecrets(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving secrets: %v\n", err)
+		os.Exit(1)
+	}
+
+	serverName := opts.Server
+	if serverName == "" {
+		if svc, ok := cfg.GetServiceMap()[name]; ok {
+			serverName = svc.Server
+		}
+	}
+	if serverName == "" {
+		fmt.Fprintf(os.Stderr, "service %s is not configured, use --server to name the server running it\n", name)
+		os.Exit(1)
+	}
+	container := opts.Container
+	if container == "" {
+		container = fmt.Sprintf(constants.ServicePrefixFormat, ctx.Env, name)
+	}
+
+	svc, err := wf.ImportService(cfg, name, serverName, container)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ref := service.EntityRef{Kind: "service", Name: name}
+	version := modifyState(ctx, "import "+ref.String(), func(_ repository.VersionedStateRepository, st *repository.DeploymentState) error {
+		return service.ImportService(st, svc)
+	})
+	fmt.Fprintf(os.Stderr, "Imported %s from container %s on %s (state version %d).\n", ref, container, serverName, version.Version)
+
+	if opts.ConfigOut != "" {
+		snippet := *svc
+		snippet.AdoptedContainer = ""
+		for _, ref := range snippet.Env {
+			if ref.Plain() == orchestrator.RedactedEnvValue {
+				fmt.Fprintf(os.Stderr, "Warning: env values that are not configured are written as %s, fill them in or reference secrets before applying.\n", orchestrator.RedactedEnvValue)
+				break
+			}
+		}
+		writeConfigSnippet(opts.ConfigOut, map[string]interface{}{"services": []entity.BizService{snippet}})
+	}
+}
+
+func runImportRecord(ctx *Context, address string, opts ImportOptions) {
+	parts := strings.SplitN(address, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		fmt.Fprintf(os.Stderr, "%v: dns record %q must be <domain>:<TYPE>:<name>\n", domain.ErrInvalidFormat, address)
+		os.Exit(1)
+	}
+	domainName, recordType, name := parts[0], entity.DNSRecordType(strings.ToUpper(parts[1])), parts[2]
+
+	wf, cfg, _ := openStateStore(ctx)
+	if err := wf.ResolveSecrets(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error resolving secrets: %v\n", err)
+		os.Exit(1)
+	}
+
+	dom := cfg.GetDomainMap()[domainName]
+	if dom == nil {
+		if opts.ISP == "" {
+			fmt.Fprintf(os.Stderr, "domain %s is not configured, use --isp to name its DNS ISP\n", domainName)
+			os.Exit(1)
+		}
+		dom = &entity.Domain{Name: domainName, DNSISP: opts.ISP}
+	}
+
+	records, err := wf.ImportRecords(context.Background(), cfg, dom, recordType, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	ref := service.EntityRef{Kind: "dns_record", Name: fmt.Sprintf("%s:%s:%s", domainName, recordType, name)}
+	version := modifyState(ctx, "import "+ref.String(), func(_ repository.VersionedStateRepository, st *repository.DeploymentState) error {
+		return service.ImportRecords(st, dom, records)
+	})
+	for _, r := range records {
+		fmt.Fprintf(os.Stderr, "Imported %s -> %s (ttl: %d)\n", ref, r.Value, r.TTL)
+	}
+	fmt.Fprintf(os.Stderr, "State saved (version %d).\n", version.Version)
+
+	if opts.ConfigOut != "" {
+		snippet := entity.Domain{Name: dom.Name, ISP: dom.ISP, DNSISP: dom.DNSISP, Parent: dom.Parent, Records: records}
+		writeConfigSnippet(opts.ConfigOut, map[string]interface{}{"domains": []entity.Domain{snippet}})
+	}
+}
+
+func writeConfigSnippet(path string, snippet interface{}) {
+	data, err := yaml.Marshal(snippet)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error rendering config snippet: %v\n", err)
+		os.Exit(1)
+	}
+	if path == "-" {
+		fmt.Print(string(data))
+		return
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing config snippet: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Config snippet written to %s.\n", path)
+}
@@ -24,7 +24,7 @@ func newListCommand(ctx *Context) *cobra.Command {
 }
 
 func runList(ctx *Context, entity string) {
-	wf := NewWorkflow(ctx.Env, ctx.ConfigDir)
+	wf := NewWorkflow(ctx)
 	cfg, err := wf.LoadConfig(nil)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
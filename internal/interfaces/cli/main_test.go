@@ -0,0 +1,264 @@
+package cli
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/state"
+)
+
+// cliArgsEnv carries the arguments of a yamlops run to the test binary
+// started by runCLI, separated by newlines.
+const cliArgsEnv = "YAMLOPS_TEST_CLI_ARGS"
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(cliArgsEnv); ok {
+		os.Args = append([]string{"yamlops"}, strings.Split(args, "\n")...)
+		Execute()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs yamlops with args in a child process, since the commands exit
+// the process, and returns its combined output and exit code.
+func runCLI(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Dir = t.TempDir()
+	cmd.Env = append(os.Environ(), cliArgsEnv+"="+strings.Join(args, "\n"))
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("running yamlops %v: %v", args, err)
+	}
+	return string(out), 0
+}
+
+// writeConfig writes the config files of env prod under a temporary config
+// directory and returns the directory.
+func writeConfig(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	envDir := filepath.Join(dir, "userdata", "prod")
+	if err := os.MkdirAll(envDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(envDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// unreachableServer is a config with one service on a server whose SSH port
+// refuses connections.
+var unreachableServer = map[string]string{
+	"zones.yaml": "zones:\n  - name: zone1\n    region: local\n",
+	"servers.yaml": `servers:
+  - name: srv1
+    zone: zone1
+    ip:
+      public: 127.0.0.1
+      private: 127.0.0.1
+    ssh:
+      host: 127.0.0.1
+      port: 1
+      user: root
+      password: secret
+`,
+	"services_biz.yaml": `services:
+  - name: api
+    server: srv1
+    image: api:1.0
+`,
+}
+
+func TestApplyCommands_Plan(t *testing.T) {
+	dir := writeConfig(t, unreachableServer)
+	for _, tc := range []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"app", "apply", "--auto-approve"}, []string{"No changes to apply.", "? service: api"}},
+		{[]string{"dns", "apply", "--auto-approve"}, []string{"No DNS changes to apply."}},
+	} {
+		t.Run(strings.Join(tc.args[:2], " "), func(t *testing.T) {
+			out, code := runCLI(t, append([]string{"-c", dir, "-e", "prod", "--fetch-timeout", "2s"}, tc.args...)...)
+			if strings.Contains(out, "panic:") {
+				t.Fatalf("%s panicked:\n%s", strings.Join(tc.args, " "), out)
+			}
+			if code != 0 {
+				t.Errorf("exit code = %d, want 0\n%s", code, out)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output does not contain %q:\n%s", want, out)
+				}
+			}
+			if strings.Contains(out, "+ service") {
+				t.Errorf("service on the unreachable server was planned for creation:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestAppPlan_NoChangesAfterFilter(t *testing.T) {
+	files := map[string]string{
+		"isps.yaml": "isps:\n  - name: local\n    services: [dns]\n    credentials:\n      token: plain\n",
+		"dns.yaml":  "domains:\n  - name: example.com\n    dns_isp: local\n    records:\n      - type: A\n        name: www\n        value: 1.2.3.4\n",
+	}
+	for name, content := range unreachableServer {
+		files[name] = content
+	}
+	dir := writeConfig(t, files)
+
+	out, code := runCLI(t, "-c", dir, "-e", "prod", "--fetch-timeout", "2s", "app", "plan", "--infra", "gateway")
+	if code != 0 || !strings.Contains(out, "No changes detected.") || strings.Contains(out, "Execution Plan") {
+		t.Errorf("app plan with only dns changes: exit code = %d, want 0 and no changes\n%s", code, out)
+	}
+}
+
+// keepServers is a policies.yaml denying the deletion of servers.
+const keepServers = `policies:
+  - name: keep-servers
+    rule: no_delete
+    severity: deny
+    entities: [server]
+`
+
+func TestDestroy_Policies(t *testing.T) {
+	files := map[string]string{"policies.yaml": keepServers}
+	for name, content := range unreachableServer {
+		files[name] = content
+	}
+	dir := writeConfig(t, files)
+	args := []string{"-c", dir, "-e", "prod", "--fetch-timeout", "2s", "destroy", "--confirm", "prod"}
+
+	out, code := runCLI(t, args...)
+	if code != ExitCodeError {
+		t.Errorf("exit code = %d, want %d\n%s", code, ExitCodeError, out)
+	}
+	for _, want := range []string{"DENY server:srv1 [keep-servers]", "denied by policy", "--allow-destroy"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "destroyed") {
+		t.Errorf("destroy ran despite the denial:\n%s", out)
+	}
+
+	out, code = runCLI(t, append(args, "--allow-destroy")...)
+	if code != 0 {
+		t.Errorf("exit code with --allow-destroy = %d, want 0\n%s", code, out)
+	}
+	for _, want := range []string{"WARN server:srv1 [keep-servers]", "remove network yamlops-prod", "Env prod destroyed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output with --allow-destroy does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestApplyCommands_Policies(t *testing.T) {
+	files := map[string]string{
+		"isps.yaml": "isps:\n  - name: local\n    services: [dns]\n    credentials:\n      token: plain\n",
+		"dns.yaml":  "domains:\n  - name: example.com\n    dns_isp: local\n",
+		"policies.yaml": `policies:
+  - name: keep
+    rule: no_delete
+    severity: deny
+    entities: [service, dns_record]
+`,
+	}
+	for name, content := range unreachableServer {
+		files[name] = content
+	}
+	dir := writeConfig(t, files)
+	writeState(t, dir, `services:
+  - name: legacy
+    server: srv1
+    image: legacy:1.0
+    adopted_container: legacy
+domains:
+  - name: example.com
+    dns_isp: local
+    records:
+      - type: A
+        name: old
+        value: 1.2.3.4
+`)
+
+	for _, tc := range []struct {
+		args []string
+		deny string
+	}{
+		{[]string{"app", "apply", "--auto-approve"}, "DENY service:legacy [keep]"},
+		{[]string{"dns", "apply", "--auto-approve"}, "DENY dns_record:example.com:A:old:1.2.3.4 [keep]"},
+		{[]string{"service", "deploy", "--yes"}, "DENY service:legacy [keep]"},
+	} {
+		t.Run(strings.Join(tc.args[:2], " "), func(t *testing.T) {
+			out, code := runCLI(t, append([]string{"-c", dir, "-e", "prod", "--fetch-timeout", "2s"}, tc.args...)...)
+			if code != ExitCodeError {
+				t.Errorf("exit code = %d, want %d\n%s", code, ExitCodeError, out)
+			}
+			for _, want := range []string{tc.deny, "denied by policy", "--allow-destroy"} {
+				if !strings.Contains(out, want) {
+					t.Errorf("output does not contain %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestStatePushPull(t *testing.T) {
+	dir := writeConfig(t, unreachableServer)
+	writeState(t, dir, "services: [")
+	file := filepath.Join(t.TempDir(), "prod.state.yaml")
+	if err := os.WriteFile(file, []byte("services:\n  - name: api\n    server: srv1\n    image: api:1.0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-c", dir, "-e", "prod", "state"}
+
+	out, code := runCLI(t, append(args, "push", file)...)
+	if code != ExitCodeError || !strings.Contains(out, "--force") {
+		t.Errorf("push over an unreadable state: exit code = %d, want %d with a --force hint\n%s", code, ExitCodeError, out)
+	}
+	if out, code := runCLI(t, append(args, "push", file, "--force")...); code != 0 {
+		t.Errorf("push --force: exit code = %d, want 0\n%s", code, out)
+	}
+
+	srv := httptest.NewServer(state.NewHTTPServer(t.TempDir(), "", ""))
+	defer srv.Close()
+	if out, code := runCLI(t, append(args, "push", file, "--to", srv.URL)...); code != 0 {
+		t.Fatalf("push --to: exit code = %d, want 0\n%s", code, out)
+	}
+	out, code = runCLI(t, append(args, "pull", "--from", srv.URL)...)
+	if code != 0 || !strings.Contains(out, "image: api:1.0") {
+		t.Errorf("pull --from: exit code = %d, want 0 with the pushed state\n%s", code, out)
+	}
+	out, code = runCLI(t, append(args, "pull", "--from", "file")...)
+	if code != 0 || !strings.Contains(out, "image: api:1.0") {
+		t.Errorf("pull --from file: exit code = %d, want 0 with the pushed state\n%s", code, out)
+	}
+}
+
+// writeState records state as the file state of env prod under dir.
+func writeState(t *testing.T, dir, state string) {
+	t.Helper()
+	stateDir := filepath.Join(dir, ".state")
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stateDir, "prod.yaml"), []byte(state), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,321 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/lite-lake/infra-yamlops/internal/application/handler"
+	"github.com/lite-lake/infra-yamlops/internal/application/orchestrator"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// Exit codes for --detailed-exitcode. Destructive plans get their own code so
+// CI can block deletes without parsing the plan.
+const (
+	ExitCodeNoChanges   = 0
+	ExitCodeError       = 1
+	ExitCodeChanges     = 2
+	ExitCodeDestructive = 3
+)
+
+const redactedValue = "***"
+
+var sensitiveKeyParts = []string{"password", "token", "api_key", "apikey", "secret_key", "access_key", "private_key"}
+
+func validateOutputFormat(format string) error {
+	switch format {
+	case OutputText, OutputJSON:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q (valid: %s, %s)", format, OutputText, OutputJSON)
+	}
+}
+
+type PlanSummary struct {
+	Create int `json:"create"`
+	Update int `json:"update"`
+	Delete int `json:"delete"`
+}
+
+type ChangeOutput struct {
+	Type         string       `json:"type"`
+	Entity       string       `json:"entity"`
+	Name         string       `json:"name"`
+	Actions      []string     `json:"actions"`
+	RemoteExists bool         `json:"remote_exists"`
+	Diffs        []DiffOutput `json:"diffs,omitempty"`
+	OldState     interface{}  `json:"old_state,omitempty"`
+	NewState     interface{}  `json:"new_state,omitempty"`
+}
+
+type DiffOutput struct {
+	Type  string `json:"type"`
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// UnknownOutput is an entity left out of the plan because its live state
+// could not be fetched.
+type UnknownOutput struct {
+	Entity string `json:"entity"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// OfflineOutput describes the state an offline plan was made against.
+type OfflineOutput struct {
+	Source       string     `json:"source"`
+	Time         *time.Time `json:"time,omitempty"`
+	StateVersion int        `json:"state_version,omitempty"`
+}
+
+type PlanOutput struct {
+	Env        string                    `json:"env"`
+	Offline    *OfflineOutput            `json:"offline,omitempty"`
+	HasChanges bool                      `json:"has_changes"`
+	Summary    PlanSummary               `json:"summary"`
+	Changes    []ChangeOutput            `json:"changes"`
+	Unknown    []UnknownOutput           `json:"unknown,omitempty"`
+	Violations []service.PolicyViolation `json:"policy_violations,omitempty"`
+}
+
+type ResultOutput struct {
+	Type     string   `json:"type"`
+	Entity   string   `json:"entity"`
+	Name     string   `json:"name"`
+	Success  bool     `json:"success"`
+	Skipped  bool     `json:"skipped,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Output   string   `json:"output,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type ApplyOutput struct {
+	Plan         PlanOutput     `json:"plan"`
+	Results      []ResultOutput `json:"results"`
+	Success      bool           `json:"success"`
+	StateSaved   bool           `json:"state_saved"`
+	StateVersion int            `json:"state_version,omitempty"`
+	Resumable    bool           `json:"resumable,omitempty"`
+}
+
+func summarizePlan(changes []*valueobject.Change) PlanSummary {
+	var s PlanSummary
+	for _, ch := range changes {
+		switch ch.Type() {
+		case valueobject.ChangeTypeCreate:
+			s.Create++
+		case valueobject.ChangeTypeUpdate:
+			s.Update++
+		case valueobject.ChangeTypeDelete:
+			s.Delete++
+		}
+	}
+	return s
+}
+
+func planExitCode(changes []*valueobject.Change) int {
+	s := summarizePlan(changes)
+	switch {
+	case s.Delete > 0:
+		return ExitCodeDestructive
+	case s.Create > 0 || s.Update > 0:
+		return ExitCodeChanges
+	default:
+		return ExitCodeNoChanges
+	}
+}
+
+func buildPlanOutput(env string, changes []*valueobject.Change, secrets map[string]string) PlanOutput {
+	out := PlanOutput{
+		Env:     env,
+		Summary: summarizePlan(changes),
+		Changes: make([]ChangeOutput, 0, len(changes)),
+	}
+	for _, ch := range changes {
+		if ch.Type() != valueobject.ChangeTypeNoop {
+			out.HasChanges = true
+		}
+		actions := ch.Actions()
+		if actions == nil {
+			actions = []string{}
+		}
+		out.Changes = append(out.Changes, ChangeOutput{
+			Type:         ch.Type().String(),
+			Entity:       ch.Entity(),
+			Name:         ch.Name(),
+			Actions:      actions,
+			RemoteExists: ch.RemoteExists(),
+			Diffs:        buildDiffsOutput(ch.Diffs(), secrets),
+			OldState:     redactState(ch.OldState(), secrets),
+			NewState:     redactState(ch.NewState(), secrets),
+		})
+	}
+	return out
+}
+
+func buildOfflineOutput(src *orchestrator.OfflineSource) *OfflineOutput {
+	if src == nil {
+		return nil
+	}
+	out := &OfflineOutput{Source: "state", StateVersion: src.Version}
+	if src.Cached {
+		out.Source = "cache"
+	}
+	if !src.Time.IsZero() {
+		t := src.Time
+		out.Time = &t
+	}
+	return out
+}
+
+func buildUnknownOutput(unknown []valueobject.Unknown) []UnknownOutput {
+	if len(unknown) == 0 {
+		return nil
+	}
+	out := make([]UnknownOutput, 0, len(unknown))
+	for _, u := range sortedUnknown(unknown) {
+		out = append(out, UnknownOutput{Entity: u.Entity, Name: u.Name, Reason: u.Reason})
+	}
+	return out
+}
+
+// sortedUnknown orders servers before the services placed on them.
+func sortedUnknown(unknown []valueobject.Unknown) []valueobject.Unknown {
+	sorted := append([]valueobject.Unknown(nil), unknown...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if (a.Entity == "server") != (b.Entity == "server") {
+			return a.Entity == "server"
+		}
+		if a.Entity != b.Entity {
+			return a.Entity < b.Entity
+		}
+		return a.Name < b.Name
+	})
+	return sorted
+}
+
+func buildDiffsOutput(diffs []valueobject.FieldDiff, secrets map[string]string) []DiffOutput {
+	if len(diffs) == 0 {
+		return nil
+	}
+	secretValues := secretValueSet(secrets)
+	out := make([]DiffOutput, 0, len(diffs))
+	for _, d := range diffs {
+		key := d.Field()
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			key = key[i+1:]
+		}
+		out = append(out, DiffOutput{
+			Type:  d.Type().String(),
+			Field: d.Field(),
+			Old:   redactValue(d.OldValue(), key, secretValues).(string),
+			New:   redactValue(d.NewValue(), key, secretValues).(string),
+		})
+	}
+	return out
+}
+
+func buildResultsOutput(results []*handler.Result) []ResultOutput {
+	out := make([]ResultOutput, 0, len(results))
+	for _, r := range results {
+		ro := ResultOutput{
+			Type:     r.Change.Type().String(),
+			Entity:   r.Change.Entity(),
+			Name:     r.Change.Name(),
+			Success:  r.Success,
+			Warnings: r.Warnings,
+			Output:   r.Output,
+		}
+		if r.Error != nil {
+			ro.Error = r.Error.Error()
+			ro.Skipped = errors.Is(r.Error, domain.ErrDependencyFailed)
+		}
+		out = append(out, ro)
+	}
+	return out
+}
+
+// redactState converts an entity into plain maps through its YAML form, so
+// SecretRef and custom marshalers are honored, then masks sensitive values.
+func redactState(state interface{}, secrets map[string]string) interface{} {
+	if state == nil {
+		return nil
+	}
+	data, err := yaml.Marshal(state)
+	if err != nil {
+		return redactedValue
+	}
+	var generic interface{}
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		return redactedValue
+	}
+	return redactValue(generic, "", secretValueSet(secrets))
+}
+
+func secretValueSet(secrets map[string]string) map[string]bool {
+	secretValues := make(map[string]bool, len(secrets))
+	for _, v := range secrets {
+		if v != "" {
+			secretValues[v] = true
+		}
+	}
+	return secretValues
+}
+
+func redactValue(v interface{}, key string, secretValues map[string]bool) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			val[k] = redactValue(child, k, secretValues)
+		}
+		return val
+	case []interface{}:
+		for i, child := range val {
+			val[i] = redactValue(child, key, secretValues)
+		}
+		return val
+	case string:
+		if val != "" && (secretValues[val] || isSensitiveKey(key)) {
+			return redactedValue
+		}
+		return val
+	default:
+		return val
+	}
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding JSON output: %v\n", err)
+		os.Exit(ExitCodeError)
+	}
+}
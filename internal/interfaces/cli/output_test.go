@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/application/handler"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+func TestPlanExitCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []*valueobject.Change
+		want    int
+	}{
+		{"no changes", nil, ExitCodeNoChanges},
+		{"noop only", []*valueobject.Change{valueobject.NewChange(valueobject.ChangeTypeNoop, "zone", "z1")}, ExitCodeNoChanges},
+		{"create", []*valueobject.Change{valueobject.NewChange(valueobject.ChangeTypeCreate, "service", "api")}, ExitCodeChanges},
+		{"delete", []*valueobject.Change{
+			valueobject.NewChange(valueobject.ChangeTypeUpdate, "service", "api"),
+			valueobject.NewChange(valueobject.ChangeTypeDelete, "dns_record", "example.com:A:www"),
+		}, ExitCodeDestructive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := planExitCode(tt.changes); got != tt.want {
+				t.Errorf("planExitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildPlanOutput_RedactsSecrets(t *testing.T) {
+	srv := &entity.Server{
+		Name: "srv1",
+		SSH: entity.ServerSSH{
+			Host:     "10.0.0.1",
+			User:     "root",
+			Password: *valueobject.NewSecretRefPlain("hunter2"),
+		},
+	}
+	svc := &entity.BizService{
+		Name: "api",
+		Env: map[string]valueobject.SecretRef{
+			"DB_URL":    *valueobject.NewSecretRefPlain("postgres://u:s3cret@db"),
+			"LOG_LEVEL": *valueobject.NewSecretRefPlain("info"),
+		},
+	}
+	changes := []*valueobject.Change{
+		valueobject.NewChangeFull(valueobject.ChangeTypeCreate, "server", "srv1", nil, srv, []string{"create server"}, false),
+		valueobject.NewChangeFull(valueobject.ChangeTypeUpdate, "service", "api", nil, svc, nil, true),
+	}
+
+	out := buildPlanOutput("prod", changes, map[string]string{"db_url": "postgres://u:s3cret@db"})
+	data, err := json.Marshal(out)
+	if err != nil {
+		t.Fatalf("json.Marshal() error: %v", err)
+	}
+	s := string(data)
+
+	for _, leaked := range []string{"hunter2", "s3cret"} {
+		if strings.Contains(s, leaked) {
+			t.Errorf("output leaks %q: %s", leaked, s)
+		}
+	}
+	if !strings.Contains(s, `"LOG_LEVEL":"info"`) {
+		t.Errorf("expected non-secret env to be kept: %s", s)
+	}
+	if out.Summary.Create != 1 || out.Summary.Update != 1 || !out.HasChanges {
+		t.Errorf("unexpected summary: %+v", out.Summary)
+	}
+	if out.Changes[1].Actions == nil {
+		t.Error("expected empty actions to encode as an array")
+	}
+}
+
+func TestBuildResultsOutput(t *testing.T) {
+	ch := valueobject.NewChange(valueobject.ChangeTypeCreate, "service", "api")
+	results := []*handler.Result{
+		{Change: ch, Success: true, Output: "deployed", Warnings: []string{"slow"}},
+		{Change: ch, Success: false, Error: errors.New("boom")},
+	}
+
+	out := buildResultsOutput(results)
+	if len(out) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(out))
+	}
+	if out[0].Output != "deployed" || out[0].Warnings[0] != "slow" || out[0].Error != "" {
+		t.Errorf("unexpected first result: %+v", out[0])
+	}
+	if out[1].Success || out[1].Error != "boom" {
+		t.Errorf("unexpected second result: %+v", out[1])
+	}
+}
@@ -4,26 +4,51 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/lite-lake/infra-yamlops/internal/application/orchestrator"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/planfile"
 )
 
+type PlanOptions struct {
+	OutFile          string
+	Output           string
+	DetailedExitCode bool
+	AllowDestroy     bool
+	Offline          bool
+}
+
 func newPlanCommand(ctx *Context) *cobra.Command {
 	var filters Filters
+	var opts PlanOptions
 
 	cmd := &cobra.Command{
 		Use:   "plan [scope]",
 		Short: "Generate execution plan",
-		Long:  "Generate an execution plan for the specified scope.",
-		Args:  cobra.MaximumNArgs(1),
+		Long: `Generate an execution plan for the specified scope.
+
+With --detailed-exitcode the command exits with 0 when there are no changes,
+1 on error, 2 when there are changes and 3 when the plan deletes resources.
+
+With --offline no server or DNS provider is contacted: the plan is made
+against the remote state cached by the last fetch or apply, without reading
+the state backend. Only when there is no cache is it made against the
+recorded state.`,
+		Args: cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			scope := ""
 			if len(args) > 0 {
 				scope = args[0]
 			}
-			runPlan(ctx, scope, filters)
+			runPlan(ctx, scope, filters, opts)
 		},
 	}
 
@@ -31,50 +56,158 @@ func newPlanCommand(ctx *Context) *cobra.Command {
 	cmd.Flags().StringVar(&filters.Zone, "zone", "", "Filter by zone")
 	cmd.Flags().StringVar(&filters.Server, "server", "", "Filter by server")
 	cmd.Flags().StringVar(&filters.Service, "service", "", "Filter by service")
+	addTargetFlags(cmd, &filters)
+	cmd.Flags().StringVar(&opts.OutFile, "out", "", "Save the plan to a file for a later apply")
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", OutputText, "Output format (text/json)")
+	cmd.Flags().BoolVar(&opts.AllowDestroy, "allow-destroy", false, "Report deletes denied by no_delete policies as warnings")
+	cmd.Flags().BoolVar(&opts.Offline, "offline", false, "Plan against the cached or recorded state without contacting servers")
+	cmd.Flags().BoolVar(&opts.DetailedExitCode, "detailed-exitcode", false, "Return a detailed exit code (0 no changes, 1 error, 2 changes, 3 destructive changes)")
 
 	return cmd
 }
 
-func runPlan(ctx *Context, scope string, filters Filters) {
-	wf := NewWorkflow(ctx.Env, ctx.ConfigDir)
-	planScope := valueobject.NewScope().
-		WithDomain(filters.Domain).
-		WithZone(filters.Zone).
-		WithServer(filters.Server).
-		WithService(filters.Service)
+func runPlan(ctx *Context, scope string, filters Filters, opts PlanOptions) {
+	if err := validateOutputFormat(opts.Output); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(ExitCodeError)
+	}
 
-	executionPlan, _, err := wf.Plan(context.Background(), "", planScope)
+	wf := NewWorkflow(ctx)
+	planScope := filters.Scope()
+
+	var (
+		cfg           *entity.Config
+		remoteState   *repository.DeploymentState
+		executionPlan *valueobject.Plan
+		offline       *orchestrator.OfflineSource
+		err           error
+	)
+	if opts.Offline {
+		cfg, err = wf.PrepareConfig(context.Background(), "")
+		if err == nil {
+			executionPlan, remoteState, offline, err = wf.PlanOffline(context.Background(), cfg, "", planScope)
+		}
+	} else {
+		cfg, remoteState, err = wf.Prepare(context.Background(), "")
+		if err == nil {
+			executionPlan, err = wf.PlanFromState(cfg, remoteState, "", planScope)
+		}
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+		os.Exit(ExitCodeError)
 	}
 
-	if !executionPlan.HasChanges() {
+	violations := service.EvaluatePolicies(cfg, executionPlan, service.PolicyOptions{AllowDestroy: opts.AllowDestroy})
+	if opts.Output != OutputJSON {
+		displayOffline(offline)
+	}
+	if opts.Output == OutputJSON {
+		out := buildPlanOutput(ctx.Env, executionPlan.Changes(), cfg.GetSecretsMap())
+		out.Offline = buildOfflineOutput(offline)
+		out.Unknown = buildUnknownOutput(executionPlan.Unknown())
+		out.Violations = violations
+		printJSON(out)
+	} else if !executionPlan.HasChanges() {
 		fmt.Println("No changes detected.")
-		return
+		displayUnknown(executionPlan)
+	} else {
+		displayPlan(executionPlan)
+		displayViolations(violations)
+		if service.HasDenials(violations) {
+			fmt.Printf("\nThis plan is %s and cannot be applied as is.\n", domain.ErrPolicyDenied)
+		}
+	}
+
+	if opts.OutFile != "" && executionPlan.HasChanges() {
+		savePlanFile(ctx, opts, cfg, remoteState, executionPlan)
 	}
 
-	displayPlan(executionPlan)
+	if opts.DetailedExitCode {
+		os.Exit(planExitCode(executionPlan.Changes()))
+	}
+}
+
+func savePlanFile(ctx *Context, opts PlanOptions, cfg *entity.Config, remoteState *repository.DeploymentState, executionPlan *valueobject.Plan) {
+	pf, err := planfile.New(ctx.Env, cfg, remoteState, executionPlan)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating plan file: %v\n", err)
+		os.Exit(ExitCodeError)
+	}
+	if err := planfile.Save(opts.OutFile, pf); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving plan file: %v\n", err)
+		os.Exit(ExitCodeError)
+	}
+	msg := fmt.Sprintf("Plan saved to %s. Run \"yamlops apply %s -e %s\" to apply exactly these changes.", opts.OutFile, opts.OutFile, ctx.Env)
+	if opts.Output == OutputJSON {
+		fmt.Fprintln(os.Stderr, msg)
+		return
+	}
+	fmt.Printf("\n%s\n", msg)
 }
 
 func displayPlan(p *valueobject.Plan) {
 	fmt.Println("Execution Plan:")
 	fmt.Println("===============")
 	for _, ch := range p.Changes() {
-		var prefix string
-		switch ch.Type() {
-		case valueobject.ChangeTypeCreate:
-			prefix = "+"
-		case valueobject.ChangeTypeUpdate:
-			prefix = "~"
-		case valueobject.ChangeTypeDelete:
-			prefix = "-"
-		default:
-			prefix = " "
-		}
-		fmt.Printf("%s %s: %s\n", prefix, ch.Entity(), ch.Name())
-		for _, action := range ch.Actions() {
-			fmt.Printf("    - %s\n", action)
-		}
+		printChange(ch)
+	}
+	displayUnknown(p)
+	if targets := p.Scope().Targets(); len(targets) > 0 {
+		fmt.Printf("\nNote: plan limited to --target %s; other pending changes are not shown.\n", strings.Join(targets, ", "))
+	}
+}
+
+// displayOffline marks an offline plan with the state it was made against
+// so it is not mistaken for a plan against the live infrastructure.
+func displayOffline(src *orchestrator.OfflineSource) {
+	if src == nil {
+		return
+	}
+	fmt.Printf("%s\n\n", offlineBanner(src))
+}
+
+func offlineBanner(src *orchestrator.OfflineSource) string {
+	const suffix = "; no servers were contacted and live changes since then are not shown."
+	switch {
+	case src.Cached:
+		return fmt.Sprintf("OFFLINE PLAN: diffed against the remote state cached at %s%s", src.Time.Format(time.RFC3339), suffix)
+	case src.Version > 0:
+		return fmt.Sprintf("OFFLINE PLAN: diffed against recorded state version %d saved at %s%s", src.Version, src.Time.Format(time.RFC3339), suffix)
+	default:
+		return "OFFLINE PLAN: no cached or recorded state found, diffed against an empty state" + suffix
+	}
+}
+
+// displayUnknown lists the entities whose live state could not be fetched
+// and that the plan therefore leaves alone.
+func displayUnknown(p *valueobject.Plan) {
+	if len(p.Unknown()) == 0 {
+		return
+	}
+	fmt.Println("\nUnknown (live state could not be fetched, not planned):")
+	for _, u := range sortedUnknown(p.Unknown()) {
+		fmt.Printf("? %s: %s (%s)\n", u.Entity, u.Name, u.Reason)
+	}
+}
+
+func printChange(ch *valueobject.Change) {
+	var prefix string
+	switch ch.Type() {
+	case valueobject.ChangeTypeCreate:
+		prefix = "+"
+	case valueobject.ChangeTypeUpdate:
+		prefix = "~"
+	case valueobject.ChangeTypeDelete:
+		prefix = "-"
+	default:
+		prefix = " "
+	}
+	fmt.Printf("%s %s: %s\n", prefix, ch.Entity(), ch.Name())
+	for _, action := range ch.Actions() {
+		fmt.Printf("    - %s\n", action)
+	}
+	for _, diff := range ch.Diffs() {
+		fmt.Printf("      %s\n", diff)
 	}
 }
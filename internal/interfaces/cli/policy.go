@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+)
+
+func displayViolations(violations []service.PolicyViolation) {
+	if len(violations) == 0 {
+		return
+	}
+	fmt.Println("\nPolicy Violations:")
+	for _, v := range violations {
+		fmt.Printf("  %s %s [%s]: %s\n", severityLabel(v.Severity), v.Resource, v.Policy, v.Message)
+	}
+}
+
+func severityLabel(severity string) string {
+	if severity == entity.PolicySeverityDeny {
+		return ChangeDeleteStyle.Render("DENY")
+	}
+	return WarningStyle.Render("WARN")
+}
+
+// enforcePolicies evaluates the policies of cfg against the plan about to be
+// applied and exits, before anything is changed, when one of them denies it.
+func enforcePolicies(ctx *Context, cfg *entity.Config, p *valueobject.Plan, opts ApplyOptions) []service.PolicyViolation {
+	violations := service.EvaluatePolicies(cfg, p, service.PolicyOptions{AllowDestroy: opts.AllowDestroy})
+	if !service.HasDenials(violations) {
+		return violations
+	}
+
+	if opts.Output == OutputJSON {
+		out := buildPlanOutput(ctx.Env, p.Changes(), cfg.GetSecretsMap())
+		out.Violations = violations
+		printJSON(ApplyOutput{Plan: out, Results: []ResultOutput{}, Success: false})
+		os.Exit(ExitCodeError)
+	}
+
+	displayPlan(p)
+	displayViolations(violations)
+	fmt.Fprintf(os.Stderr, "\nPlan %s; nothing was changed.\n", domain.ErrPolicyDenied)
+	for _, v := range violations {
+		if v.Rule == entity.PolicyRuleNoDelete && v.Severity == entity.PolicySeverityDeny {
+			fmt.Fprintln(os.Stderr, "Use --allow-destroy to apply deletes protected by no_delete policies.")
+			break
+		}
+	}
+	os.Exit(ExitCodeError)
+	return nil
+}
@@ -3,15 +3,18 @@ package cli
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/lite-lake/infra-yamlops/internal/constants"
 	"github.com/lite-lake/infra-yamlops/internal/version"
 	"github.com/spf13/cobra"
 )
 
 var (
-	flagEnv         string
-	flagConfigDir   string
-	flagShowVersion bool
+	flagEnv          string
+	flagConfigDir    string
+	flagShowVersion  bool
+	flagFetchTimeout time.Duration
 )
 
 var Version = version.Version
@@ -30,6 +33,7 @@ func Execute() {
 			}
 			ctx.Env = flagEnv
 			ctx.ConfigDir = flagConfigDir
+			ctx.FetchTimeout = flagFetchTimeout
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 			runTUI(ctx)
@@ -38,6 +42,7 @@ func Execute() {
 
 	rootCmd.PersistentFlags().StringVarP(&flagEnv, "env", "e", "dev", "Environment (prod/staging/dev/demo)")
 	rootCmd.PersistentFlags().StringVarP(&flagConfigDir, "config", "c", ".", "Configuration directory")
+	rootCmd.PersistentFlags().DurationVar(&flagFetchTimeout, "fetch-timeout", constants.DefaultStateFetchTimeout, "Time allowed to fetch the live state of each server")
 	rootCmd.PersistentFlags().BoolVarP(&flagShowVersion, "version", "v", false, "Show version information")
 
 	rootCmd.AddCommand(newPlanCommand(ctx))
@@ -52,6 +57,12 @@ func Execute() {
 	rootCmd.AddCommand(newConfigCommand(ctx))
 	rootCmd.AddCommand(newAppCommand(ctx))
 	rootCmd.AddCommand(newServiceCommand(ctx))
+	rootCmd.AddCommand(newStateCommand(ctx))
+	rootCmd.AddCommand(newDriftCommand(ctx))
+	rootCmd.AddCommand(newImportCommand(ctx))
+	rootCmd.AddCommand(newDestroyCommand(ctx))
+	rootCmd.AddCommand(newSchemaCommand(ctx))
+	rootCmd.AddCommand(newFmtCommand(ctx))
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
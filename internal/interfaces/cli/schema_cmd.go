@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/schema"
+)
+
+func newSchemaCommand(ctx *Context) *cobra.Command {
+	var outDir string
+
+	cmd := &cobra.Command{
+		Use:   "schema [file]",
+		Short: "Generate JSON Schemas for the config files",
+		Long: `Generate the JSON Schema of a userdata config file, such as
+services_biz.yaml, and print it. With --out the schemas of all config files
+are written to the directory as <file>.schema.json instead.
+
+Valid files: ` + strings.Join(schema.Names(), ", "),
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			file := ""
+			if len(args) > 0 {
+				file = args[0]
+			}
+			runSchema(file, outDir)
+		},
+	}
+
+	cmd.Flags().StringVar(&outDir, "out", "", "Write the schemas of all config files to this directory")
+
+	return cmd
+}
+
+func runSchema(file, outDir string) {
+	if outDir == "" {
+		if file == "" {
+			fmt.Fprintf(os.Stderr, "Specify a config file or --out. Valid files: %s\n", strings.Join(schema.Names(), ", "))
+			os.Exit(ExitCodeError)
+		}
+		s, err := schema.Generate(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(ExitCodeError)
+		}
+		printJSON(s)
+		return
+	}
+
+	files := schema.Names()
+	if file != "" {
+		files = []string{file}
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", outDir, err)
+		os.Exit(ExitCodeError)
+	}
+	for _, name := range files {
+		s, err := schema.Generate(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(ExitCodeError)
+		}
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding schema of %s: %v\n", name, err)
+			os.Exit(ExitCodeError)
+		}
+		path := filepath.Join(outDir, strings.TrimSuffix(name, filepath.Ext(name))+".schema.json")
+		if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", path, err)
+			os.Exit(ExitCodeError)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+}
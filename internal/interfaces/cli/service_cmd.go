@@ -25,6 +25,7 @@ type ServiceFilters struct {
 func newServiceCommand(ctx *Context) *cobra.Command {
 	var filters ServiceFilters
 	var autoApprove bool
+	var allowDestroy bool
 
 	serviceCmd := &cobra.Command{
 		Use:   "service",
@@ -37,7 +38,7 @@ func newServiceCommand(ctx *Context) *cobra.Command {
 		Short: "Deploy services",
 		Long:  "Deploy services. If services already exist, they will be restarted with updated files.",
 		Run: func(cmd *cobra.Command, args []string) {
-			runServiceDeploy(ctx, filters, autoApprove)
+			runServiceDeploy(ctx, filters, autoApprove, allowDestroy)
 		},
 	}
 
@@ -73,6 +74,7 @@ func newServiceCommand(ctx *Context) *cobra.Command {
 	serviceCmd.PersistentFlags().StringVarP(&filters.Biz, "biz", "b", "", "Filter by business service")
 
 	serviceDeployCmd.Flags().BoolVarP(&autoApprove, "yes", "y", false, "Auto approve without confirmation")
+	serviceDeployCmd.Flags().BoolVar(&allowDestroy, "allow-destroy", false, "Allow deletes denied by no_delete policies")
 	serviceStopCmd.Flags().BoolVarP(&autoApprove, "yes", "y", false, "Auto approve without confirmation")
 	serviceRestartCmd.Flags().BoolVarP(&autoApprove, "yes", "y", false, "Auto approve without confirmation")
 	serviceCleanupCmd.Flags().BoolVarP(&autoApprove, "yes", "y", false, "Auto approve without confirmation")
@@ -85,13 +87,15 @@ func newServiceCommand(ctx *Context) *cobra.Command {
 	return serviceCmd
 }
 
-func runServiceDeploy(ctx *Context, filters ServiceFilters, autoApprove bool) {
-	wf := NewWorkflow(ctx.Env, ctx.ConfigDir)
+func runServiceDeploy(ctx *Context, filters ServiceFilters, autoApprove, allowDestroy bool) {
+	wf := NewWorkflow(ctx)
 
 	planScope := valueobject.NewScope().
 		WithServer(filters.Server).
-		WithService(filters.Biz).
-		WithInfraServices(strings.Split(filters.Infra, ","))
+		WithService(filters.Biz)
+	if filters.Infra != "" {
+		planScope = planScope.WithInfraServices(strings.Split(filters.Infra, ","))
+	}
 
 	executionPlan, cfg, err := wf.Plan(context.Background(), "", planScope)
 	if err != nil {
@@ -124,11 +128,14 @@ func runServiceDeploy(ctx *Context, filters ServiceFilters, autoApprove bool) {
 		return
 	}
 
+	violations := enforcePolicies(ctx, cfg, executionPlan, ApplyOptions{AllowDestroy: allowDestroy})
+
 	fmt.Println("Deploy Plan:")
 	fmt.Println("============")
 	for _, ch := range targetChanges {
 		fmt.Printf("  %s %s: %s\n", changeTypeIcon(ch.Type()), ch.Entity(), ch.Name())
 	}
+	displayViolations(violations)
 
 	if !autoApprove {
 		if !Confirm("Do you want to deploy these services?", false) {
@@ -148,6 +155,7 @@ func runServiceDeploy(ctx *Context, filters ServiceFilters, autoApprove bool) {
 	})
 	executor.SetSecrets(cfg.GetSecretsMap())
 	executor.SetServerEntities(cfg.GetServerMap())
+	executor.SetConfig(cfg)
 	executor.SetWorkDir(ctx.ConfigDir)
 
 	for _, srv := range cfg.Servers {
@@ -293,7 +301,7 @@ func runServiceCleanup(ctx *Context, filters ServiceFilters, autoApprove bool) {
 }
 
 func loadConfig(ctx *Context) (*entity.Config, error) {
-	wf := NewWorkflow(ctx.Env, ctx.ConfigDir)
+	wf := NewWorkflow(ctx)
 	cfg, err := wf.LoadConfig(context.Background())
 	if err != nil {
 		return nil, err
@@ -62,7 +62,7 @@ func showEntity(ctx *Context, entityType, name string, finder EntityFinder, opts
 		}
 	}
 
-	wf := NewWorkflow(ctx.Env, ctx.ConfigDir)
+	wf := NewWorkflow(ctx)
 	loadedCfg, err := wf.LoadConfig(nil)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
@@ -0,0 +1,526 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/lite-lake/infra-yamlops/internal/constants"
+	"github.com/lite-lake/infra-yamlops/internal/domain"
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
+	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/state"
+)
+
+type StateServeOptions struct {
+	Listen   string
+	Dir      string
+	Username string
+	Password string
+	Keep     int
+}
+
+func newStateCommand(ctx *Context) *cobra.Command {
+	stateCmd := &cobra.Command{
+		Use:   "state",
+		Short: "State operations",
+		Long:  "Manage deployment state and state backends.",
+	}
+
+	stateCmd.AddCommand(&cobra.Command{
+		Use:   "list [entity]",
+		Short: "List entities in state",
+		Long:  "List the addresses (<entity>:<name>) of all entities recorded in the state, optionally only those of one entity type.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			kind := ""
+			if len(args) > 0 {
+				kind = args[0]
+			}
+			runStateList(ctx, kind)
+		},
+	})
+	stateCmd.AddCommand(newStateShowCommand(ctx))
+	stateCmd.AddCommand(&cobra.Command{
+		Use:   "rm <address>...",
+		Short: "Forget entities in state",
+		Long:  "Remove entities from the state without touching servers or DNS providers. The next plan will propose to create them again.",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runStateRm(ctx, args)
+		},
+	})
+	stateCmd.AddCommand(&cobra.Command{
+		Use:   "mv <source> <destination>",
+		Short: "Rename a service in state",
+		Long: `Rename a service in the state without redeploying it, after renaming it in
+the config. The destination may be a full address or just the new name.
+
+The service keeps running in the container of its old name, which the state
+records as adopted: the next plan proposes no change for it, and its first
+deploy under the new name replaces that container.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			runStateMv(ctx, args[0], args[1])
+		},
+	})
+	stateCmd.AddCommand(newStatePullCommand(ctx))
+	stateCmd.AddCommand(newStatePushCommand(ctx))
+	stateCmd.AddCommand(&cobra.Command{
+		Use:   "history",
+		Short: "List saved state versions",
+		Long:  "List every saved version of the state with when, by whom and by which operation it was saved.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runStateHistory(ctx)
+		},
+	})
+	stateCmd.AddCommand(&cobra.Command{
+		Use:   "rollback <version>",
+		Short: "Restore a saved state version",
+		Long: `Save an earlier version of the state as the current recorded state. Nothing
+is applied: servers and DNS providers are not touched.
+
+Plans still compare the config against the live state. From the recorded
+state they only take what cannot be observed live: lifecycle settings,
+services adopted by import or state mv, the DNS records of domains whose
+provider cannot be read and which DNS names yamlops manages. plan --offline
+keeps using the cached live state and only reads the recorded state when
+there is no cache.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runStateRollback(ctx, args[0])
+		},
+	})
+	stateCmd.AddCommand(newStateServeCommand())
+
+	return stateCmd
+}
+
+func newStateShowCommand(ctx *Context) *cobra.Command {
+	var version int
+
+	cmd := &cobra.Command{
+		Use:   "show <address>",
+		Short: "Show an entity in state",
+		Long:  "Show the recorded state of a single entity, e.g. service:api or dns_record:example.com:A:www.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runStateShow(ctx, args[0], version)
+		},
+	}
+
+	cmd.Flags().IntVar(&version, "version", 0, "Show the entity as of this state version")
+
+	return cmd
+}
+
+func newStatePullCommand(ctx *Context) *cobra.Command {
+	var outFile, from string
+	var version int
+
+	cmd := &cobra.Command{
+		Use:   "pull",
+		Short: "Download state",
+		Long: `Print the state stored in the configured backend, or write it to a file with --out.
+
+--from reads another backend instead: "file" for the local state under the
+config directory, or the http(s) address of an http backend. Basic auth
+credentials can be given in the address; a missing password is read from
+YAMLOPS_STATE_PASSWORD.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			runStatePull(ctx, from, outFile, version)
+		},
+	}
+
+	cmd.Flags().StringVar(&outFile, "out", "", "Write the state to a file instead of stdout")
+	cmd.Flags().IntVar(&version, "version", 0, "Download this state version instead of the current one")
+	cmd.Flags().StringVar(&from, "from", "", "Backend to read from instead of the configured one (file or an http(s) address)")
+
+	return cmd
+}
+
+func newStatePushCommand(ctx *Context) *cobra.Command {
+	var to string
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "push <file>",
+		Short: "Replace state with a local file",
+		Long: `Upload a state file, as written by 'state pull', to the configured backend,
+replacing the current state. Use - to read from stdin.
+
+--to writes to another backend instead, given as for 'state pull --from'.
+The current state of the backend is read first and the push stops when it
+cannot be; --force replaces it anyway.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runStatePush(ctx, args[0], to, force)
+		},
+	}
+
+	cmd.Flags().StringVar(&to, "to", "", "Backend to write to instead of the configured one (file or an http(s) address)")
+	cmd.Flags().BoolVar(&force, "force", false, "Replace the state even when the current one cannot be read")
+
+	return cmd
+}
+
+func newStateServeCommand() *cobra.Command {
+	var opts StateServeOptions
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run a reference HTTP state server",
+		Long: `Run a small HTTP server that stores state for the http backend.
+
+States are written to <dir>/<env>.yaml. Locks are held in memory, so
+restarting the server releases all locks. The password can also be set
+with the YAMLOPS_STATE_PASSWORD environment variable.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if opts.Password == "" {
+				opts.Password = os.Getenv("YAMLOPS_STATE_PASSWORD")
+			}
+			runStateServe(opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Listen, "listen", ":8080", "Address to listen on")
+	cmd.Flags().StringVar(&opts.Dir, "dir", "state-data", "Directory to store states in")
+	cmd.Flags().StringVar(&opts.Username, "username", "", "Require HTTP basic auth with this username")
+	cmd.Flags().StringVar(&opts.Password, "password", "", "Require HTTP basic auth with this password")
+	cmd.Flags().IntVar(&opts.Keep, "keep", constants.DefaultStateHistoryKeep, "State versions kept per environment, 0 for all")
+
+	return cmd
+}
+
+func openStateStore(ctx *Context) (*Workflow, *entity.Config, repository.VersionedStateRepository) {
+	return openStateStoreAt(ctx, "")
+}
+
+// openStateStoreAt opens the store of backend, as given to --from or --to,
+// or the configured one when backend is empty.
+func openStateStoreAt(ctx *Context, backend string) (*Workflow, *entity.Config, repository.VersionedStateRepository) {
+	wf := NewWorkflow(ctx)
+	cfg, err := wf.LoadConfig(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if backend != "" {
+		b, err := parseStateBackend(backend)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		store, err := state.NewStore(b, ctx.ConfigDir, ctx.Env, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		wf.UseStateStore(store)
+	} else if cfg.Backend != nil {
+		if err := cfg.Backend.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "backend: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	store, err := wf.StateStore(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	return wf, cfg, store
+}
+
+// parseStateBackend reads a backend given on the command line: "file" for
+// the local state, or the address of an http backend, which may carry basic
+// auth credentials. A password left out of the address is taken from
+// YAMLOPS_STATE_PASSWORD.
+func parseStateBackend(spec string) (*entity.StateBackend, error) {
+	if spec == entity.StateBackendFile {
+		return &entity.StateBackend{Type: entity.StateBackendFile}, nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: state backend %q, want file or an http(s) address", domain.ErrInvalidType, spec)
+	}
+	b := &entity.StateBackend{Type: entity.StateBackendHTTP}
+	if u.User != nil {
+		b.Username = u.User.Username()
+		password, ok := u.User.Password()
+		if !ok {
+			password = os.Getenv("YAMLOPS_STATE_PASSWORD")
+		}
+		b.Password = *valueobject.NewSecretRefPlain(password)
+		u.User = nil
+	}
+	b.Address = u.String()
+	return b, b.Validate()
+}
+
+// loadStateOrExit loads the current state, or the given version when it is
+// not zero.
+func loadStateOrExit(ctx *Context, store repository.VersionedStateRepository, version int) *repository.DeploymentState {
+	var st *repository.DeploymentState
+	var err error
+	if version != 0 {
+		st, err = store.LoadVersion(context.Background(), ctx.Env, version)
+	} else {
+		st, err = store.Load(context.Background(), ctx.Env)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading state: %v\n", err)
+		os.Exit(1)
+	}
+	return st
+}
+
+// modifyState runs fn on the current state under the state lock and saves the
+// result as a new version when fn succeeds.
+func modifyState(ctx *Context, operation string, fn func(store repository.VersionedStateRepository, st *repository.DeploymentState) error) *repository.StateVersion {
+	wf, cfg, store := openStateStore(ctx)
+	unlock, err := wf.LockState(context.Background(), cfg, operation)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error locking state: %v\n", err)
+		os.Exit(1)
+	}
+
+	version := wf.NewStateVersion(operation, "")
+	st, err := store.Load(context.Background(), ctx.Env)
+	if err == nil {
+		err = fn(store, st)
+		if err == nil {
+			err = store.SaveVersion(context.Background(), ctx.Env, st, version)
+		}
+	}
+	if unlockErr := unlock(); unlockErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to release state lock: %v\n", unlockErr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return version
+}
+
+func runStateList(ctx *Context, kind string) {
+	_, _, store := openStateStore(ctx)
+	st := loadStateOrExit(ctx, store, 0)
+	for _, ref := range service.StateRefs(st) {
+		if kind != "" && ref.Kind != kind {
+			continue
+		}
+		fmt.Println(ref)
+	}
+}
+
+func runStateShow(ctx *Context, address string, version int) {
+	ref, err := service.ParseEntityRef(address)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	_, _, store := openStateStore(ctx)
+	st := loadStateOrExit(ctx, store, version)
+
+	found, ok := service.StateEntity(st, ref)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "%v: %s\n", domain.ErrStateEntryNotFound, ref)
+		os.Exit(1)
+	}
+	data, err := yaml.Marshal(found)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	fmt.Print(string(data))
+}
+
+func runStateRm(ctx *Context, addresses []string) {
+	refs := make([]service.EntityRef, 0, len(addresses))
+	for _, address := range addresses {
+		ref, err := service.ParseEntityRef(address)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		refs = append(refs, ref)
+	}
+
+	modifyState(ctx, "state rm", func(_ repository.VersionedStateRepository, st *repository.DeploymentState) error {
+		for _, ref := range refs {
+			if err := service.RemoveFromState(st, ref); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	for _, ref := range refs {
+		fmt.Printf("Removed %s\n", ref)
+	}
+}
+
+func runStateMv(ctx *Context, source, destination string) {
+	from, err := service.ParseEntityRef(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	to := service.EntityRef{Kind: from.Kind, Name: destination}
+	if strings.Contains(destination, ":") {
+		if to, err = service.ParseEntityRef(destination); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	modifyState(ctx, "state mv", func(_ repository.VersionedStateRepository, st *repository.DeploymentState) error {
+		return service.MoveInState(st, ctx.Env, from, to)
+	})
+	fmt.Printf("Moved %s to %s\n", from, to)
+}
+
+func runStatePull(ctx *Context, from, outFile string, version int) {
+	_, _, store := openStateStoreAt(ctx, from)
+	st := loadStateOrExit(ctx, store, version)
+	data, err := state.Marshal(st)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if outFile == "" {
+		fmt.Print(string(data))
+		return
+	}
+	if err := os.WriteFile(outFile, data, constants.FilePermissionOwnerRW); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", outFile, err)
+		os.Exit(1)
+	}
+	fmt.Printf("State written to %s\n", outFile)
+}
+
+func runStatePush(ctx *Context, file, to string, force bool) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", file, err)
+		os.Exit(1)
+	}
+	pushed, err := state.Unmarshal(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing %s: %v\n", file, err)
+		os.Exit(1)
+	}
+
+	wf, cfg, store := openStateStoreAt(ctx, to)
+	unlock, err := wf.LockState(context.Background(), cfg, "state push")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error locking state: %v\n", err)
+		os.Exit(1)
+	}
+	version := wf.NewStateVersion("state push", "")
+	_, loadErr := store.Load(context.Background(), ctx.Env)
+	if loadErr == nil || force {
+		if loadErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: replacing a state that cannot be read: %v\n", loadErr)
+		}
+		err = store.SaveVersion(context.Background(), ctx.Env, pushed, version)
+	}
+	if unlockErr := unlock(); unlockErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to release state lock: %v\n", unlockErr)
+	}
+	if loadErr != nil && !force {
+		fmt.Fprintf(os.Stderr, "Error loading the current state: %v\nUse --force to replace it anyway.\n", loadErr)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("State for %s replaced with %s (version %d)\n", ctx.Env, file, version.Version)
+}
+
+func runStateHistory(ctx *Context) {
+	_, _, store := openStateStore(ctx)
+	versions, err := store.History(context.Background(), ctx.Env)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading state history: %v\n", err)
+		os.Exit(1)
+	}
+	if len(versions) == 0 {
+		fmt.Println("No saved state versions.")
+		return
+	}
+
+	fmt.Printf("%-8s %-20s %-24s %-20s %s\n", "VERSION", "CREATED", "WHO", "OPERATION", "PLAN")
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		fmt.Printf("%-8d %-20s %-24s %-20s %s\n", v.Version, v.Created.Local().Format("2006-01-02 15:04:05"), v.Who, v.Operation, v.Plan)
+	}
+}
+
+func runStateRollback(ctx *Context, arg string) {
+	target, err := strconv.Atoi(arg)
+	if err != nil || target < 1 {
+		fmt.Fprintf(os.Stderr, "invalid state version %q\n", arg)
+		os.Exit(1)
+	}
+
+	saved := modifyState(ctx, fmt.Sprintf("rollback to %d", target), func(store repository.VersionedStateRepository, st *repository.DeploymentState) error {
+		restored, err := store.LoadVersion(context.Background(), ctx.Env, target)
+		if err != nil {
+			return err
+		}
+		*st = *restored
+		return nil
+	})
+	fmt.Printf("Recorded state for %s restored from version %d (saved as version %d).\n", ctx.Env, target, saved.Version)
+	fmt.Println("Nothing was applied: servers and DNS providers are unchanged, and plans still compare the config against the live state.")
+}
+
+func runStateServe(opts StateServeOptions) {
+	handler := state.NewHTTPServer(opts.Dir, opts.Username, opts.Password)
+	handler.SetKeep(opts.Keep)
+	srv := &http.Server{
+		Addr:              opts.Listen,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-sigCtx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("Serving state from %s on %s\n", opts.Dir, opts.Listen)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
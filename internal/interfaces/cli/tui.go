@@ -97,6 +97,7 @@ func (m Model) handlePlanGeneratedMsg(msg planGeneratedMsg) (tea.Model, tea.Cmd)
 		return m, nil
 	}
 	m.Action.PlanResult = msg.plan
+	m.Action.PolicyViolations = msg.violations
 	m.Action.ApplyTotal = len(msg.plan.Changes())
 	if m.Action.ApplyTotal == 0 {
 		m.Action.ApplyTotal = 1
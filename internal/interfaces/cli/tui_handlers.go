@@ -2,6 +2,8 @@ package cli
 
 import (
 	"github.com/charmbracelet/bubbletea"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
 )
 
 func (m Model) handleUp() Model {
@@ -222,6 +224,9 @@ func (m Model) handleEnter() (tea.Model, tea.Cmd) {
 		m.ViewState = ViewStatePlan
 		return m, nil
 	case ViewStatePlan:
+		if service.HasDenials(m.Action.PolicyViolations) {
+			return m, nil
+		}
 		m.ViewState = ViewStateApplyConfirm
 		m.Action.ConfirmSelected = 0
 		return m, nil
@@ -6,6 +6,7 @@ import (
 	"github.com/charmbracelet/bubbletea"
 	"github.com/lite-lake/infra-yamlops/internal/application/handler"
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
 	serverpkg "github.com/lite-lake/infra-yamlops/internal/environment"
 	"github.com/lite-lake/infra-yamlops/internal/infrastructure/dns"
@@ -28,8 +29,9 @@ type configLoadedMsg struct {
 }
 
 type planGeneratedMsg struct {
-	plan *valueobject.Plan
-	err  error
+	plan       *valueobject.Plan
+	violations []service.PolicyViolation
+	err        error
 }
 
 type applyCompleteMsg struct {
@@ -414,14 +416,15 @@ type RestartState struct {
 }
 
 type ActionState struct {
-	PlanResult      *valueobject.Plan
-	ApplyProgress   int
-	ApplyTotal      int
-	ApplyComplete   bool
-	ApplyResults    []*handler.Result
-	ApplyInProgress bool
-	ConfirmSelected int
-	PlanScope       *valueobject.Scope
+	PlanResult       *valueobject.Plan
+	PolicyViolations []service.PolicyViolation
+	ApplyProgress    int
+	ApplyTotal       int
+	ApplyComplete    bool
+	ApplyResults     []*handler.Result
+	ApplyInProgress  bool
+	ConfirmSelected  int
+	PlanScope        *valueobject.Scope
 }
 
 type Model struct {
@@ -10,6 +10,7 @@ import (
 	"github.com/lite-lake/infra-yamlops/internal/application/plan"
 	"github.com/lite-lake/infra-yamlops/internal/application/usecase"
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
 	"github.com/lite-lake/infra-yamlops/internal/infrastructure/persistence"
 )
@@ -215,6 +216,7 @@ func (m *Model) generatePlan() {
 		return
 	}
 	m.Action.PlanResult = executionPlan
+	m.Action.PolicyViolations = service.EvaluatePolicies(m.Config, executionPlan, service.PolicyOptions{})
 	m.Action.ApplyTotal = len(executionPlan.Changes())
 	if m.Action.ApplyTotal == 0 {
 		m.Action.ApplyTotal = 1
@@ -291,7 +293,10 @@ func (m *Model) generatePlanAsync() tea.Cmd {
 		if err != nil {
 			return planGeneratedMsg{err: err}
 		}
-		return planGeneratedMsg{plan: executionPlan}
+		return planGeneratedMsg{
+			plan:       executionPlan,
+			violations: service.EvaluatePolicies(m.Config, executionPlan, service.PolicyOptions{}),
+		}
 	}
 }
 
@@ -335,14 +340,14 @@ func (m *Model) fetchDNSRemoteState() *plan.DeploymentState {
 			} else if strings.HasSuffix(rr.Name, "."+domainName) {
 				recordName = strings.TrimSuffix(rr.Name, "."+domainName)
 			}
-			key := fmt.Sprintf("%s:%s:%s", domainName, rr.Type, recordName)
-			state.Records[key] = &entity.DNSRecord{
+			record := &entity.DNSRecord{
 				Domain: domainName,
 				Type:   entity.DNSRecordType(rr.Type),
 				Name:   recordName,
 				Value:  rr.Value,
 				TTL:    rr.TTL,
 			}
+			state.Records[record.Key()] = record
 		}
 	}
 
@@ -447,6 +452,7 @@ func (m *Model) executeApplyAsync() tea.Cmd {
 		executor.SetDomains(m.Config.GetDomainMap())
 		executor.SetISPs(m.Config.GetISPMap())
 		executor.SetServerEntities(m.Config.GetServerMap())
+		executor.SetConfig(m.Config)
 		executor.SetWorkDir(m.ConfigDir)
 		secrets := m.Config.GetSecretsMap()
 		for _, srv := range m.Config.Servers {
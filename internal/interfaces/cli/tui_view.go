@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
 )
 
@@ -210,10 +214,28 @@ func (m Model) renderPlan() string {
 				}
 			}
 			lines = append(lines, style.Render(line))
+			for _, diff := range ch.Diffs() {
+				lines = append(lines, diffStyle(diff.Type()).Render("    "+diff.String()))
+			}
+		}
+	}
+	if len(m.Action.PolicyViolations) > 0 {
+		lines = append(lines, "")
+		lines = append(lines, WarningStyle.Render("Policy Violations:"))
+		for _, v := range m.Action.PolicyViolations {
+			style := WarningStyle
+			if v.Severity == entity.PolicySeverityDeny {
+				style = ChangeDeleteStyle
+			}
+			lines = append(lines, style.Render(fmt.Sprintf("  %s %s [%s]: %s", strings.ToUpper(v.Severity), v.Resource, v.Policy, v.Message)))
 		}
 	}
 	lines = append(lines, "")
-	lines = append(lines, ChangeCreateStyle.Render("Press Enter to apply"))
+	if service.HasDenials(m.Action.PolicyViolations) {
+		lines = append(lines, ChangeDeleteStyle.Render("Apply blocked by policy"))
+	} else {
+		lines = append(lines, ChangeCreateStyle.Render("Press Enter to apply"))
+	}
 
 	availableHeight := m.UI.Height - 6
 	if availableHeight < 5 {
@@ -238,6 +260,17 @@ func (m Model) renderPlan() string {
 	return content.String()
 }
 
+func diffStyle(t valueobject.ChangeType) lipgloss.Style {
+	switch t {
+	case valueobject.ChangeTypeCreate:
+		return ChangeCreateStyle
+	case valueobject.ChangeTypeDelete:
+		return ChangeDeleteStyle
+	default:
+		return ChangeUpdateStyle
+	}
+}
+
 func (m Model) renderApplyConfirm() string {
 	var content strings.Builder
 	content.WriteString(TitleStyle.Render("Confirm Apply"))
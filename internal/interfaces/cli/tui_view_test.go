@@ -3,6 +3,9 @@ package cli
 import (
 	"strings"
 	"testing"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
+	"github.com/lite-lake/infra-yamlops/internal/domain/service"
 )
 
 func TestModel_RenderLoading(t *testing.T) {
@@ -159,3 +162,24 @@ func TestModel_HandleEnter_MainMenu(t *testing.T) {
 		t.Errorf("Expected ViewStateServiceManagement, got %d", model.ViewState)
 	}
 }
+
+func TestModel_PlanBlockedByPolicy(t *testing.T) {
+	m := NewModel("demo", "../../..")
+	m.UI.Width = 80
+	m.UI.Height = 24
+	m.ViewState = ViewStatePlan
+	m.Loading.Active = false
+	m.Action.PolicyViolations = []service.PolicyViolation{
+		{Policy: "keep-services", Rule: entity.PolicyRuleNoDelete, Severity: entity.PolicySeverityDeny, Resource: "service:api", Message: "deletes service api"},
+	}
+
+	view := m.View()
+	if !strings.Contains(view, "keep-services") || !strings.Contains(view, "Apply blocked by policy") {
+		t.Errorf("Plan view should list the violation and block apply, got:\n%s", view)
+	}
+
+	newModel, _ := m.handleEnter()
+	if model := newModel.(Model); model.ViewState != ViewStatePlan {
+		t.Errorf("Enter on a denied plan should stay on the plan, got %d", model.ViewState)
+	}
+}
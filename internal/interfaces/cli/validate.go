@@ -1,31 +1,101 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"github.com/lite-lake/infra-yamlops/internal/domain"
 )
 
 func newValidateCommand(ctx *Context) *cobra.Command {
+	var output string
+
 	cmd := &cobra.Command{
 		Use:   "validate",
 		Short: "Validate configurations",
-		Long:  "Validate all YAML configurations.",
-		Args:  cobra.NoArgs,
+		Long: `Validate all YAML configurations.
+
+Every failure is reported, one per line, as file:line:col: message, pointing
+at the entity or field at fault. With -o json the result is printed as an
+object with valid and errors.`,
+		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			runValidate(ctx)
+			runValidate(ctx, output)
 		},
 	}
 
+	cmd.Flags().StringVarP(&output, "output", "o", OutputText, "Output format (text/json)")
+
 	return cmd
 }
 
-func runValidate(ctx *Context) {
-	wf := NewWorkflow(ctx.Env, ctx.ConfigDir)
-	if _, err := wf.LoadAndValidate(nil); err != nil {
+// ValidateOutput is the JSON output of validate.
+type ValidateOutput struct {
+	Valid  bool                    `json:"valid"`
+	Errors []ValidationErrorOutput `json:"errors"`
+}
+
+// ValidationErrorOutput is a validation failure. File, line and column are
+// omitted when its position is not known.
+type ValidationErrorOutput struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func runValidate(ctx *Context, output string) {
+	if err := validateOutputFormat(output); err != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", err)
-		os.Exit(1)
+		os.Exit(ExitCodeError)
+	}
+
+	wf := NewWorkflow(ctx)
+	_, err := wf.LoadAndValidate(nil)
+
+	if output == OutputJSON {
+		printJSON(buildValidateOutput(err))
+		if err != nil {
+			os.Exit(ExitCodeError)
+		}
+		return
+	}
+
+	if err != nil {
+		var verrs domain.ValidationErrors
+		if !errors.As(err, &verrs) {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(ExitCodeError)
+		}
+		for _, verr := range verrs {
+			fmt.Fprintln(os.Stderr, verr)
+		}
+		fmt.Fprintf(os.Stderr, "\n%d validation error(s).\n", len(verrs))
+		os.Exit(ExitCodeError)
 	}
 	fmt.Println("Configuration is valid.")
 }
+
+func buildValidateOutput(err error) ValidateOutput {
+	out := ValidateOutput{Valid: err == nil, Errors: []ValidationErrorOutput{}}
+	if err == nil {
+		return out
+	}
+	var verrs domain.ValidationErrors
+	if !errors.As(err, &verrs) {
+		out.Errors = append(out.Errors, ValidationErrorOutput{Message: err.Error()})
+		return out
+	}
+	for _, verr := range verrs {
+		out.Errors = append(out.Errors, ValidationErrorOutput{
+			File:    verr.File,
+			Line:    verr.Line,
+			Column:  verr.Column,
+			Message: verr.Err.Error(),
+		})
+	}
+	return out
+}
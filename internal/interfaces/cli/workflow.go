@@ -8,16 +8,19 @@ import (
 	"github.com/lite-lake/infra-yamlops/internal/domain/entity"
 	"github.com/lite-lake/infra-yamlops/internal/domain/repository"
 	"github.com/lite-lake/infra-yamlops/internal/domain/valueobject"
+	"github.com/lite-lake/infra-yamlops/internal/infrastructure/journal"
 )
 
 type Workflow struct {
 	*orchestrator.Workflow
 }
 
-func NewWorkflow(env, configDir string) *Workflow {
-	return &Workflow{
-		Workflow: orchestrator.NewWorkflow(env, configDir),
+func NewWorkflow(ctx *Context) *Workflow {
+	wf := &Workflow{
+		Workflow: orchestrator.NewWorkflow(ctx.Env, ctx.ConfigDir),
 	}
+	wf.SetFetchTimeout(ctx.FetchTimeout)
+	return wf
 }
 
 func (w *Workflow) CreatePlanner(cfg *entity.Config, outputDir string) *plan.Planner {
@@ -28,6 +31,22 @@ func (w *Workflow) Plan(ctx context.Context, outputDir string, scope *valueobjec
 	return w.Workflow.Plan(ctx, outputDir, scope)
 }
 
+func (w *Workflow) Prepare(ctx context.Context, outputDir string) (*entity.Config, *repository.DeploymentState, error) {
+	return w.Workflow.Prepare(ctx, outputDir)
+}
+
+func (w *Workflow) PrepareConfig(ctx context.Context, outputDir string) (*entity.Config, error) {
+	return w.Workflow.PrepareConfig(ctx, outputDir)
+}
+
+func (w *Workflow) PlanOffline(ctx context.Context, cfg *entity.Config, outputDir string, scope *valueobject.Scope) (*valueobject.Plan, *repository.DeploymentState, *orchestrator.OfflineSource, error) {
+	return w.Workflow.PlanOffline(ctx, cfg, outputDir, scope)
+}
+
+func (w *Workflow) PlanFromState(cfg *entity.Config, remoteState *repository.DeploymentState, outputDir string, scope *valueobject.Scope) (*valueobject.Plan, error) {
+	return w.Workflow.PlanFromState(cfg, remoteState, outputDir, scope)
+}
+
 func (w *Workflow) GenerateDeployments(cfg *entity.Config, outputDir string) error {
 	return w.Workflow.GenerateDeployments(cfg, outputDir)
 }
@@ -44,6 +63,42 @@ func (w *Workflow) ResolveSecrets(cfg *entity.Config) error {
 	return w.Workflow.ResolveSecrets(cfg)
 }
 
-func (w *Workflow) SaveState(ctx context.Context, cfg *entity.Config) error {
-	return w.Workflow.SaveState(ctx, cfg)
+func (w *Workflow) NewStateVersion(operation, plan string) *repository.StateVersion {
+	return w.Workflow.NewStateVersion(operation, plan)
+}
+
+func (w *Workflow) StateStore(cfg *entity.Config) (repository.VersionedStateRepository, error) {
+	return w.Workflow.StateStore(cfg)
+}
+
+func (w *Workflow) LockState(ctx context.Context, cfg *entity.Config, operation string) (func() error, error) {
+	return w.Workflow.LockState(ctx, cfg, operation)
+}
+
+func (w *Workflow) DetectDrift(ctx context.Context, filter orchestrator.DriftFilter) (*orchestrator.DriftReport, error) {
+	return w.Workflow.DetectDrift(ctx, filter)
+}
+
+func (w *Workflow) NewApplyRecorder(ctx context.Context, cfg *entity.Config, j *journal.Journal, planFile string) (*orchestrator.ApplyRecorder, error) {
+	return w.Workflow.NewApplyRecorder(ctx, cfg, j, planFile)
+}
+
+func (w *Workflow) NewDestroyRecorder(ctx context.Context, cfg *entity.Config) (*orchestrator.ApplyRecorder, error) {
+	return w.Workflow.NewDestroyRecorder(ctx, cfg)
+}
+
+func (w *Workflow) PlanDestroy(ctx context.Context, cfg *entity.Config) (*valueobject.Plan, error) {
+	return w.Workflow.PlanDestroy(ctx, cfg)
+}
+
+func (w *Workflow) ClearState(ctx context.Context, cfg *entity.Config, meta *repository.StateVersion) error {
+	return w.Workflow.ClearState(ctx, cfg, meta)
+}
+
+func (w *Workflow) ImportService(cfg *entity.Config, name, serverName, containerName string) (*entity.BizService, error) {
+	return w.Workflow.ImportService(cfg, name, serverName, containerName)
+}
+
+func (w *Workflow) ImportRecords(ctx context.Context, cfg *entity.Config, dom *entity.Domain, recordType entity.DNSRecordType, name string) ([]entity.DNSRecord, error) {
+	return w.Workflow.ImportRecords(ctx, cfg, dom, recordType, name)
 }